@@ -0,0 +1,68 @@
+// khalehla Project
+// disassembler command-line driver
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"khalehla/dasm"
+	"khalehla/tasm"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: dasm [options] file.abs\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  Disassembles an absolute executable produced by tasm -abs, or a memory snapshot produced by krun -snapshot.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	symbolFile := flag.String("sym", "", "symbol file (JSON) produced by tasm -sym for the executable")
+	outputFile := flag.String("o", "", "write the disassembly to the given file (default is stdout)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	os.Exit(run(flag.Arg(0), *symbolFile, *outputFile))
+}
+
+// run disassembles the given executable, returning the process exit code
+func run(fileName string, symbolFile string, outputFile string) int {
+	executable, err := tasm.LoadExecutable(fileName)
+	if err != nil {
+		fmt.Printf("Cannot load executable %s\n", err.Error())
+		return 1
+	}
+
+	da := dasm.NewDisassembler().AddExecutable(executable)
+	if len(symbolFile) > 0 {
+		symbolTable, err := tasm.LoadSymbolTable(symbolFile)
+		if err != nil {
+			fmt.Printf("Cannot load symbol file %s\n", err.Error())
+			return 1
+		}
+		da.SetSymbolTable(symbolTable)
+	}
+
+	writer := os.Stdout
+	if len(outputFile) > 0 {
+		writer, err = os.Create(outputFile)
+		if err != nil {
+			fmt.Printf("Cannot create %s:%s\n", outputFile, err.Error())
+			return 1
+		}
+		defer writer.Close()
+	}
+
+	_, _ = fmt.Fprintf(writer, ". Disassembly of %s\n", fileName)
+	da.Disassemble(writer)
+	return 0
+}
@@ -0,0 +1,99 @@
+// khalehla Project
+// absolute executable runner
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"khalehla/hardware"
+	"khalehla/hardware/processors"
+	"khalehla/hardware/processors/ipEngine"
+	"khalehla/tasm"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: krun [options] file.abs\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  Loads an absolute executable produced by tasm -abs, and runs it until it stops or is interrupted.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	cycles := flag.Uint64("cycles", 0, "maximum number of cycles to execute (0 is unlimited)")
+	trace := flag.Bool("trace", false, "log each instruction and interrupt")
+	dump := flag.Bool("dump", false, "dump the engine and general register set when execution ends")
+	snapshot := flag.String("snapshot", "", "write the content of the banks to the given file when execution ends, for dasm")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	os.Exit(run(flag.Arg(0), *cycles, *trace, *dump, *snapshot))
+}
+
+// run loads and runs the given executable, returning the process exit code
+func run(fileName string, cycles uint64, trace bool, dump bool, snapshot string) int {
+	executable, err := tasm.LoadExecutable(fileName)
+	if err != nil {
+		fmt.Printf("Cannot load executable %s\n", err.Error())
+		return 1
+	}
+
+	storage := hardware.NewMainStorage(100)
+	ip := processors.NewInstructionProcessor(1, "IP0", nil)
+	err = ip.LoadExecutable(storage, executable)
+	if err != nil {
+		fmt.Printf("Cannot load executable:%s\n", err.Error())
+		return 1
+	}
+
+	engine := ip.GetEngine()
+	engine.SetLogInstructions(trace)
+	engine.SetLogInterrupts(trace)
+	ip.SetCycleLimit(cycles)
+
+	err = ip.Start()
+	if err != nil {
+		fmt.Printf("Cannot start processor:%s\n", err.Error())
+		return 1
+	}
+	ip.Wait()
+	count := ip.GetCycleCount()
+
+	result := 0
+	if engine.IsStopped() {
+		reason, detail := engine.GetStopReason()
+		fmt.Printf("Processor stopped after %d cycles: reason %d detail %012o\n", count, reason, detail)
+	} else if engine.HasPendingInterrupt() {
+		fmt.Printf("Execution interrupted after %d cycles\n", count)
+		result = 1
+	} else {
+		fmt.Printf("Cycle limit of %d reached\n", cycles)
+		result = 1
+	}
+
+	if dump {
+		engine.Dump()
+		engine.GetGeneralRegisterSet().Dump()
+	}
+
+	if len(snapshot) > 0 {
+		err = ipEngine.SnapshotExecutable(storage, executable)
+		if err == nil {
+			err = executable.Save(snapshot)
+		}
+		if err != nil {
+			fmt.Printf("Cannot write snapshot:%s\n", err.Error())
+			return 1
+		}
+	}
+
+	return result
+}
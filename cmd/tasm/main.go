@@ -0,0 +1,188 @@
+// khalehla Project
+// tiny assembler command-line driver
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"khalehla/tasm"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: tasm [options] file.asm|file.obj [file.asm|file.obj ...]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  All source files are assembled into a single set of segments.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  Object modules (.obj) are appended to those segments, in the order given.\n")
+	flag.PrintDefaults()
+}
+
+type options struct {
+	basicMode    bool
+	link         bool
+	specFile     string
+	objectFile   string
+	absoluteFile string
+	listingFile  string
+	mapFile      string
+	symbolFile   string
+}
+
+func main() {
+	opts := options{}
+	flag.BoolVar(&opts.basicMode, "basic", false, "assemble and link for basic mode (default is extended mode)")
+	flag.BoolVar(&opts.link, "link", false, "link the segments into a single bank")
+	flag.StringVar(&opts.specFile, "spec", "", "link the segments according to the given link spec (JSON)")
+	flag.StringVar(&opts.objectFile, "o", "", "write the assembled segments to the given object module file")
+	flag.StringVar(&opts.absoluteFile, "abs", "", "write the linked executable to the given absolute executable file")
+	flag.StringVar(&opts.listingFile, "list", "-", "write the assembly listing to the given file ('-' for stdout, empty for none)")
+	flag.StringVar(&opts.mapFile, "map", "-", "write the link map to the given file ('-' for stdout, empty for none)")
+	flag.StringVar(&opts.symbolFile, "sym", "", "write the symbol file (JSON) for the linked executable to the given file")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	os.Exit(run(flag.Args(), &opts))
+}
+
+// writeOutput creates the named file (or uses stdout if the name is '-') and invokes the given function to fill it.
+// Nothing is written if the name is empty.
+func writeOutput(fileName string, write func(writer io.Writer) error) error {
+	if len(fileName) == 0 {
+		return nil
+	} else if fileName == "-" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// run assembles (and optionally links) the given files, returning the process exit code
+func run(fileNames []string, opts *options) int {
+	sourceSets := make([]*tasm.SourceSet, 0)
+	objectModules := make([]*tasm.ObjectModule, 0)
+	diagnostics := tasm.NewDiagnosticSet()
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(strings.ToLower(fileName), ".obj") {
+			om, err := tasm.LoadObjectModule(fileName)
+			if err != nil {
+				fmt.Printf("Cannot load object module %s\n", err.Error())
+				return 1
+			}
+			objectModules = append(objectModules, om)
+			continue
+		}
+
+		sourceSet, parseDiagnostics, err := tasm.ParseSourceFile(fileName)
+		if err != nil {
+			fmt.Printf("Cannot read %s:%s\n", fileName, err.Error())
+			return 1
+		}
+		diagnostics.Append(parseDiagnostics)
+		sourceSets = append(sourceSets, sourceSet)
+	}
+
+	a := tasm.NewTinyAssembler().SetBasicMode(opts.basicMode)
+	for _, sourceSet := range sourceSets {
+		a.Assemble(sourceSet)
+	}
+
+	//	References to symbols in other modules cannot be checked until link time
+	segments := a.GetSegments()
+	if len(objectModules) == 0 && len(opts.objectFile) == 0 {
+		a.CheckReferences()
+	}
+	diagnostics.Append(a.GetDiagnostics())
+
+	err := writeOutput(opts.listingFile, func(writer io.Writer) error {
+		a.WriteListing(writer)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Cannot write listing:%s\n", err.Error())
+		return 1
+	}
+
+	if len(opts.objectFile) > 0 && diagnostics.GetErrorCount() == 0 {
+		err := a.GetObjectModule(opts.objectFile).Save(opts.objectFile)
+		if err != nil {
+			fmt.Printf("Cannot write object module:%s\n", err.Error())
+			return 1
+		}
+	}
+
+	if len(objectModules) > 0 {
+		modules := append([]*tasm.ObjectModule{a.GetObjectModule("source")}, objectModules...)
+		var mergeDiagnostics *tasm.DiagnosticSet
+		segments, mergeDiagnostics = tasm.MergeSegments(modules...)
+		diagnostics.Append(mergeDiagnostics)
+	}
+
+	var executable *tasm.Executable
+	if len(opts.specFile) > 0 && diagnostics.GetErrorCount() == 0 {
+		spec, err := tasm.LoadLinkSpec(opts.specFile)
+		if err != nil {
+			fmt.Printf("Cannot load link spec:%s\n", err.Error())
+			return 1
+		}
+
+		executable, _ = tasm.Link(segments, spec)
+	} else if opts.link && diagnostics.GetErrorCount() == 0 {
+		executable = &tasm.Executable{}
+		executable.LinkSimple(segments, !opts.basicMode)
+	}
+
+	if executable != nil {
+		diagnostics.Append(executable.GetDiagnostics())
+		if executable.GetDiagnostics().GetErrorCount() > 0 {
+			executable = nil
+		}
+	}
+
+	if executable != nil {
+		err = writeOutput(opts.mapFile, func(writer io.Writer) error {
+			executable.WriteMap(writer)
+			return nil
+		})
+		if err == nil {
+			err = writeOutput(opts.symbolFile, executable.WriteSymbols)
+		}
+		if err == nil && len(opts.absoluteFile) > 0 {
+			err = executable.Save(opts.absoluteFile)
+		}
+		if err != nil {
+			fmt.Printf("Cannot write link output:%s\n", err.Error())
+			return 1
+		}
+	}
+
+	fmt.Printf("\n")
+	for _, diag := range diagnostics.GetDiagnostics() {
+		fmt.Printf("%s\n", diag.GetString())
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", diagnostics.GetErrorCount(), diagnostics.GetWarningCount())
+
+	if diagnostics.GetErrorCount() > 0 {
+		return 1
+	}
+	return 0
+}
@@ -48,12 +48,12 @@ func (lock *AccessLock) GetString() string {
 }
 
 func (lock *AccessLock) SetDomain(value uint64) *AccessLock {
-	lock.domain = value & 03
+	lock.domain = value & 0xFFFF
 	return lock
 }
 
 func (lock *AccessLock) SetRing(value uint64) *AccessLock {
-	lock.ring = value & 0xFFFF
+	lock.ring = value & 03
 	return lock
 }
 
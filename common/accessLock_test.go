@@ -0,0 +1,16 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package common
+
+import (
+	"testing"
+)
+
+func Test_AccessLock_RingAndDomain(t *testing.T) {
+	lock := NewAccessLock(2, 0177)
+	checkEquals(t, 2, lock.GetRing(), "ring")
+	checkEquals(t, 0177, lock.GetDomain(), "domain")
+	checkEquals(t, 0_000000_400177, lock.GetComposite(), "composite")
+}
@@ -171,9 +171,9 @@ func NewBankDescriptorFromStorage(buffer []Word36) *BankDescriptor {
 		buffer[0]&0_200000_000000 != 0,
 		buffer[0]&0_100000_000000 != 0)
 	sap := NewAccessPermissions(
-		buffer[0]&0_0400000_000000 != 0,
-		buffer[0]&0_0200000_000000 != 0,
-		buffer[0]&0_0100000_000000 != 0)
+		buffer[0]&0_040000_000000 != 0,
+		buffer[0]&0_020000_000000 != 0,
+		buffer[0]&0_010000_000000 != 0)
 	typ := BankType((buffer[0] >> 24) & 0x0F)
 	gBit := buffer[0]&0_000020_000000 != 0
 	sBit := buffer[0]&0_000004_000000 != 0
@@ -227,7 +227,7 @@ func (bd *BankDescriptor) Serialize(buffer []Word36) {
 
 	value0 |= uint64(bd.generalAccessPermissions.GetComposite()) << 33
 	value0 |= uint64(bd.specialAccessPermissions.GetComposite()) << 30
-	value0 |= uint64(bd.bankType) << 26
+	value0 |= uint64(bd.bankType) << 24
 	if bd.generalFault {
 		value0 |= 0_000020_000000
 	}
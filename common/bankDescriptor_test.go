@@ -0,0 +1,36 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package common
+
+import (
+	"testing"
+)
+
+func Test_BankDescriptor_SerializeRoundTrip(t *testing.T) {
+	bd := NewBankDescriptor(
+		true,
+		NewAccessLock(2, 0177),
+		NewAccessPermissions(false, true, false),
+		NewAccessPermissions(true, false, true),
+		NewAbsoluteAddress(5, 0),
+		false,
+		02000,
+		02777,
+		0)
+
+	buffer := make([]Word36, 8)
+	bd.Serialize(buffer)
+	result := NewBankDescriptorFromStorage(buffer)
+
+	if result.GetBankType() != BasicModeBankDescriptor {
+		t.Errorf("bank type expected %v, got %v", BasicModeBankDescriptor, result.GetBankType())
+	}
+	checkEquals(t, 02, uint64(result.GetGeneralAccessPermissions().GetComposite()), "general access permissions")
+	checkEquals(t, 05, uint64(result.GetSpecialAccessPermissions().GetComposite()), "special access permissions")
+	checkEquals(t, bd.GetAccessLock().GetComposite(), result.GetAccessLock().GetComposite(), "access lock")
+	checkEquals(t, 02000, result.GetLowerLimitNormalized(), "lower limit")
+	checkEquals(t, 02777, result.GetUpperLimitNormalized(), "upper limit")
+	checkEquals(t, 5, uint64(result.GetBaseAddress().GetSegment()), "base address segment")
+}
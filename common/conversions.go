@@ -636,3 +636,63 @@ func UnpackWord36Strict(source []byte, destination []uint64) error {
 	_, _ = ByteArrayPackedToWord36(source, 0, uint(len(source)), destination, 0)
 	return nil
 }
+
+// FieldataToString converts Fieldata text, packed six characters per word, to an ASCII string.
+func FieldataToString(source []uint64) string {
+	result := make([]byte, len(source)*6)
+	for sx, word := range source {
+		for cx := 0; cx < 6; cx++ {
+			result[sx*6+cx] = AsciiFromFieldata[(word>>(30-6*cx))&077]
+		}
+	}
+	return string(result)
+}
+
+// StringToFieldata converts an ASCII string to Fieldata text, packed six characters per word.
+// The final word is space-filled. Characters which have no Fieldata equivalent become spaces.
+func StringToFieldata(str string) []uint64 {
+	result := make([]uint64, (len(str)+5)/6)
+	for wx := range result {
+		var word uint64
+		for cx := 0; cx < 6; cx++ {
+			code := uint64(005)
+			sx := wx*6 + cx
+			if sx < len(str) && str[sx] < 0200 {
+				code = uint64(FieldataFromAscii[str[sx]])
+			}
+			word = (word << 6) | code
+		}
+		result[wx] = word
+	}
+	return result
+}
+
+// AsciiToString converts ASCII text, packed four 9-bit characters per word, to a string.
+func AsciiToString(source []uint64) string {
+	result := make([]byte, len(source)*4)
+	for sx, word := range source {
+		for cx := 0; cx < 4; cx++ {
+			result[sx*4+cx] = byte((word >> (27 - 9*cx)) & 0377)
+		}
+	}
+	return string(result)
+}
+
+// StringToAscii converts a string to ASCII text, packed four 9-bit characters per word.
+// The final word is space-filled.
+func StringToAscii(str string) []uint64 {
+	result := make([]uint64, (len(str)+3)/4)
+	for wx := range result {
+		var word uint64
+		for cx := 0; cx < 4; cx++ {
+			code := uint64(' ')
+			sx := wx*4 + cx
+			if sx < len(str) {
+				code = uint64(str[sx])
+			}
+			word = (word << 9) | code
+		}
+		result[wx] = word
+	}
+	return result
+}
@@ -183,3 +183,29 @@ func Test_ByteArray6BitToWord36(t *testing.T) {
 		t.Errorf("Error:non-integral was false")
 	}
 }
+
+func Test_StringToFieldata(t *testing.T) {
+	expected := []uint64{0_151221_212405, 0_600305_050505}
+	result := StringToFieldata("hello 0#")
+	if !wordsEqual(expected, result) {
+		t.Errorf("Error:expected %012o got %012o", expected, result)
+	}
+
+	str := FieldataToString(result)
+	if str != "HELLO 0#    " {
+		t.Errorf("Error:expected 'HELLO 0#    ' got '%s'", str)
+	}
+}
+
+func Test_StringToAscii(t *testing.T) {
+	expected := []uint64{0_110105_114114, 0_117040_040040}
+	result := StringToAscii("HELLO")
+	if !wordsEqual(expected, result) {
+		t.Errorf("Error:expected %012o got %012o", expected, result)
+	}
+
+	str := AsciiToString(result)
+	if str != "HELLO   " {
+		t.Errorf("Error:expected 'HELLO   ' got '%s'", str)
+	}
+}
@@ -0,0 +1,660 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package common
+
+import (
+	"sort"
+	"sync"
+)
+
+// The instruction tables describe every instruction we know about, for basic mode and for extended mode.
+// They are consumed by the disassembler (which walks them from instruction word to mnemonic) and by the
+// tiny assembler (which walks them from mnemonic to instruction word), so the two can never disagree.
+
+type AFieldUsage int
+type JFieldUsage int
+type IndexField int
+
+const (
+	ARegister AFieldUsage = iota
+	BRegister
+	RRegister
+	XRegister
+	AGRSComponent
+	AFunctionDiscriminator
+	AUnused
+)
+
+const (
+	JPartialWordDesignator JFieldUsage = iota
+	JGRSComponent
+	JFunctionDiscriminator
+	JUnused
+)
+
+const (
+	IndexByF IndexField = iota
+	IndexByJ
+	IndexByA
+)
+
+// FunctionTableEntry is either a FunctionTable (for function codes which are further discriminated
+// by the j-field or a-field) or an InstructionDefinition.
+type FunctionTableEntry interface {
+	IsInstruction() bool
+}
+
+type FunctionTable struct {
+	table   map[int]FunctionTableEntry
+	indexBy IndexField
+}
+
+// Lookup finds the definition of the instruction represented by the given instruction word.
+// Returns nil if the instruction word does not represent a known instruction.
+func (ft *FunctionTable) Lookup(iw *InstructionWord) *InstructionDefinition {
+	var entry FunctionTableEntry
+	var ok bool
+
+	if ft.indexBy == IndexByF {
+		entry, ok = ft.table[int(iw.GetF())]
+	} else if ft.indexBy == IndexByJ {
+		entry, ok = ft.table[int(iw.GetJ())]
+	} else if ft.indexBy == IndexByA {
+		entry, ok = ft.table[int(iw.GetA())]
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if entry.IsInstruction() {
+		return entry.(*InstructionDefinition)
+	} else {
+		return entry.(*FunctionTable).Lookup(iw)
+	}
+}
+
+func (ft *FunctionTable) IsInstruction() bool {
+	return false
+}
+
+// Walk visits every instruction definition in the table, along with the encoding which selects it.
+func (ft *FunctionTable) Walk(visit func(*InstructionEncoding)) {
+	ft.walk(0, 0, 0, visit)
+}
+
+// walk visits every instruction definition in the table (in ascending order of index),
+// along with the f, j, and a field values which lead to it.
+func (ft *FunctionTable) walk(f uint64, j uint64, a uint64, visit func(*InstructionEncoding)) {
+	keys := make([]int, 0, len(ft.table))
+	for key := range ft.table {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	for _, key := range keys {
+		value := uint64(key)
+		switch ft.indexBy {
+		case IndexByF:
+			f = value
+		case IndexByJ:
+			j = value
+		case IndexByA:
+			a = value
+		}
+
+		entry := ft.table[key]
+		if entry.IsInstruction() {
+			visit(&InstructionEncoding{
+				definition: entry.(*InstructionDefinition),
+				f:          f,
+				j:          j,
+				a:          a,
+			})
+		} else {
+			entry.(*FunctionTable).walk(f, j, a, visit)
+		}
+	}
+}
+
+type InstructionDefinition struct {
+	mnemonic     string
+	aField       AFieldUsage
+	jField       JFieldUsage
+	uIs18Bits    bool
+	noGRSAddress bool
+}
+
+func (i *InstructionDefinition) GetAFieldUsage() AFieldUsage {
+	return i.aField
+}
+
+func (i *InstructionDefinition) GetJFieldUsage() JFieldUsage {
+	return i.jField
+}
+
+func (i *InstructionDefinition) GetMnemonic() string {
+	return i.mnemonic
+}
+
+// IsUField18Bits indicates that the operand is an 18-bit u-field (jumps and the like) rather than
+// an address which is subject to basic-mode or extended-mode base register selection.
+func (i *InstructionDefinition) IsUField18Bits() bool {
+	return i.uIs18Bits
+}
+
+// IsGRSAddressAllowed indicates whether an operand address less than 0200 refers to the GRS.
+func (i *InstructionDefinition) IsGRSAddressAllowed() bool {
+	return !i.noGRSAddress
+}
+
+func (i *InstructionDefinition) IsInstruction() bool {
+	return true
+}
+
+// InstructionEncoding describes the f, j, and a field values which select a particular instruction.
+// The j-field value is meaningful only if the j-field is a function discriminator, and likewise for the a-field.
+type InstructionEncoding struct {
+	definition *InstructionDefinition
+	f          uint64
+	j          uint64
+	a          uint64
+}
+
+func (ie *InstructionEncoding) GetDefinition() *InstructionDefinition {
+	return ie.definition
+}
+
+func (ie *InstructionEncoding) GetF() uint64 {
+	return ie.f
+}
+
+func (ie *InstructionEncoding) GetJ() uint64 {
+	return ie.j
+}
+
+func (ie *InstructionEncoding) GetA() uint64 {
+	return ie.a
+}
+
+var mnemonicTableOnce sync.Once
+var basicMnemonicTable map[string]*InstructionEncoding
+var extendedMnemonicTable map[string]*InstructionEncoding
+
+func buildMnemonicTable(ft *FunctionTable) map[string]*InstructionEncoding {
+	result := make(map[string]*InstructionEncoding)
+	ft.walk(0, 0, 0, func(ie *InstructionEncoding) {
+		if _, ok := result[ie.definition.mnemonic]; !ok {
+			result[ie.definition.mnemonic] = ie
+		}
+	})
+	return result
+}
+
+// LookupMnemonic finds the encoding for the given instruction mnemonic in the basic mode or extended mode
+// instruction table. Returns nil if the mnemonic is not defined for the requested mode.
+func LookupMnemonic(mnemonic string, basicMode bool) *InstructionEncoding {
+	mnemonicTableOnce.Do(func() {
+		basicMnemonicTable = buildMnemonicTable(&BasicFunctionTable)
+		extendedMnemonicTable = buildMnemonicTable(&ExtendedFunctionTable)
+	})
+
+	if basicMode {
+		return basicMnemonicTable[mnemonic]
+	} else {
+		return extendedMnemonicTable[mnemonic]
+	}
+}
+
+//	Basic --------------------------------------------------------------------------------------------------------------
+
+var BasicFunctionTable = FunctionTable{
+	indexBy: IndexByF,
+	table: map[int]FunctionTableEntry{
+		001: &InstructionDefinition{mnemonic: "SA", aField: ARegister, jField: JPartialWordDesignator},
+		002: &InstructionDefinition{mnemonic: "SNA", aField: ARegister, jField: JPartialWordDesignator},
+		003: &InstructionDefinition{mnemonic: "SMA", aField: ARegister, jField: JPartialWordDesignator},
+		004: &InstructionDefinition{mnemonic: "SR", aField: RRegister, jField: JPartialWordDesignator},
+		005: &function005InterpreterBasic,
+		006: &InstructionDefinition{mnemonic: "SX", aField: XRegister, jField: JPartialWordDesignator},
+		007: &function007InterpreterBasic,
+		010: &InstructionDefinition{mnemonic: "LA", aField: ARegister, jField: JPartialWordDesignator},
+		011: &InstructionDefinition{mnemonic: "LNA", aField: ARegister, jField: JPartialWordDesignator},
+		012: &InstructionDefinition{mnemonic: "LMA", aField: ARegister, jField: JPartialWordDesignator},
+		013: &InstructionDefinition{mnemonic: "LNMA", aField: ARegister, jField: JPartialWordDesignator},
+		014: &InstructionDefinition{mnemonic: "AA", aField: ARegister, jField: JPartialWordDesignator},
+		015: &InstructionDefinition{mnemonic: "ANA", aField: ARegister, jField: JPartialWordDesignator},
+		016: &InstructionDefinition{mnemonic: "AMA", aField: ARegister, jField: JPartialWordDesignator},
+		017: &InstructionDefinition{mnemonic: "ANMA", aField: ARegister, jField: JPartialWordDesignator},
+		020: &InstructionDefinition{mnemonic: "AU", aField: ARegister, jField: JPartialWordDesignator},
+		021: &InstructionDefinition{mnemonic: "ANU", aField: ARegister, jField: JPartialWordDesignator},
+		023: &InstructionDefinition{mnemonic: "LR", aField: RRegister, jField: JPartialWordDesignator},
+		024: &InstructionDefinition{mnemonic: "AX", aField: XRegister, jField: JPartialWordDesignator},
+		025: &InstructionDefinition{mnemonic: "ANX", aField: XRegister, jField: JPartialWordDesignator},
+		026: &InstructionDefinition{mnemonic: "LXM", aField: XRegister, jField: JPartialWordDesignator},
+		027: &InstructionDefinition{mnemonic: "LX", aField: XRegister, jField: JPartialWordDesignator},
+		030: &InstructionDefinition{mnemonic: "MI", aField: ARegister, jField: JPartialWordDesignator},
+		031: &InstructionDefinition{mnemonic: "MSI", aField: ARegister, jField: JPartialWordDesignator},
+		032: &InstructionDefinition{mnemonic: "MF", aField: ARegister, jField: JPartialWordDesignator},
+		034: &InstructionDefinition{mnemonic: "DI", aField: ARegister, jField: JPartialWordDesignator},
+		035: &InstructionDefinition{mnemonic: "DSF", aField: ARegister, jField: JPartialWordDesignator},
+		036: &InstructionDefinition{mnemonic: "DF", aField: ARegister, jField: JPartialWordDesignator},
+		040: &InstructionDefinition{mnemonic: "OR", aField: ARegister},
+		041: &InstructionDefinition{mnemonic: "XOR", aField: ARegister},
+		042: &InstructionDefinition{mnemonic: "AND", aField: ARegister},
+		043: &InstructionDefinition{mnemonic: "MLU", aField: ARegister},
+		044: &InstructionDefinition{mnemonic: "TEP", aField: ARegister, jField: JPartialWordDesignator},
+		045: &InstructionDefinition{mnemonic: "TOP", aField: ARegister, jField: JPartialWordDesignator},
+		046: &InstructionDefinition{mnemonic: "LXI", aField: XRegister},
+		050: &InstructionDefinition{mnemonic: "TZ", aField: AUnused, jField: JFunctionDiscriminator},
+		070: &InstructionDefinition{mnemonic: "JGD", aField: AGRSComponent, jField: JGRSComponent, uIs18Bits: true},
+		071: &function071InterpreterBasic,
+		072: &function072InterpreterBasic,
+		073: &function073InterpreterBasic,
+		074: &function074InterpreterBasic,
+		075: &function075InterpreterBasic,
+	},
+}
+
+var function005InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "SZ", aField: AFunctionDiscriminator},
+		001: &InstructionDefinition{mnemonic: "SNZ", aField: AFunctionDiscriminator},
+		002: &InstructionDefinition{mnemonic: "SP1", aField: AFunctionDiscriminator},
+		003: &InstructionDefinition{mnemonic: "SN1", aField: AFunctionDiscriminator},
+		004: &InstructionDefinition{mnemonic: "SFS", aField: AFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "SFZ", aField: AFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "SAS", aField: AFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "SAZ", aField: AFunctionDiscriminator},
+	},
+}
+
+var function007InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		004: &InstructionDefinition{mnemonic: "LAQW", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "SAQW", aField: ARegister, jField: JFunctionDiscriminator},
+	},
+}
+
+var function071InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		010: &InstructionDefinition{mnemonic: "DA", aField: ARegister, jField: JFunctionDiscriminator},
+		011: &InstructionDefinition{mnemonic: "DAN", aField: ARegister, jField: JFunctionDiscriminator},
+		012: &InstructionDefinition{mnemonic: "DS", aField: ARegister, jField: JFunctionDiscriminator},
+		013: &InstructionDefinition{mnemonic: "DL", aField: ARegister, jField: JFunctionDiscriminator},
+		014: &InstructionDefinition{mnemonic: "DLN", aField: ARegister, jField: JFunctionDiscriminator},
+		015: &InstructionDefinition{mnemonic: "DLM", aField: ARegister, jField: JFunctionDiscriminator},
+		016: &InstructionDefinition{mnemonic: "DJZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function072InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		001: &InstructionDefinition{mnemonic: "SLJ", aField: AUnused, jField: JFunctionDiscriminator},
+		002: &InstructionDefinition{mnemonic: "JPS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JNS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		004: &InstructionDefinition{mnemonic: "AH", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "ANH", aField: ARegister, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "AT", aField: ARegister, jField: JFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "ANT", aField: ARegister, jField: JFunctionDiscriminator},
+		010: &InstructionDefinition{mnemonic: "EX", aField: AUnused, jField: JFunctionDiscriminator},
+		011: &InstructionDefinition{mnemonic: "ER", aField: AUnused, jField: JFunctionDiscriminator},
+		016: &InstructionDefinition{mnemonic: "SRS", aField: ARegister, jField: JFunctionDiscriminator},
+		017: &InstructionDefinition{mnemonic: "LRS", aField: ARegister, jField: JFunctionDiscriminator},
+	},
+}
+
+var function073InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "SSC", aField: ARegister, jField: JFunctionDiscriminator},
+		001: &InstructionDefinition{mnemonic: "DSC", aField: ARegister, jField: JFunctionDiscriminator},
+		002: &InstructionDefinition{mnemonic: "SSL", aField: ARegister, jField: JFunctionDiscriminator},
+		003: &InstructionDefinition{mnemonic: "DSL", aField: ARegister, jField: JFunctionDiscriminator},
+		004: &InstructionDefinition{mnemonic: "SSA", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "DSA", aField: ARegister, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "LSC", aField: ARegister, jField: JFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "DLSC", aField: ARegister, jField: JFunctionDiscriminator},
+		010: &InstructionDefinition{mnemonic: "LSSC", aField: ARegister, jField: JFunctionDiscriminator},
+		011: &InstructionDefinition{mnemonic: "LDSC", aField: ARegister, jField: JFunctionDiscriminator},
+		012: &InstructionDefinition{mnemonic: "LSSL", aField: ARegister, jField: JFunctionDiscriminator},
+		013: &InstructionDefinition{mnemonic: "LDSL", aField: ARegister, jField: JFunctionDiscriminator},
+		015: &function07315InterpreterBasic,
+		017: &function07317InterpreterBasic,
+	},
+}
+
+var function07315InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		014: &InstructionDefinition{mnemonic: "LD", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		015: &InstructionDefinition{mnemonic: "SD", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		017: &InstructionDefinition{mnemonic: "SGNL", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+	},
+}
+
+var function07317InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		006: &InstructionDefinition{mnemonic: "IAR", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true, noGRSAddress: true},
+	},
+}
+
+var function074InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JNZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JP", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JN", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		004: &function07404InterpreterBasic,
+		005: &InstructionDefinition{mnemonic: "HKJ", aField: AUnused, jField: JFunctionDiscriminator, uIs18Bits: true},
+		006: &InstructionDefinition{mnemonic: "NOP", aField: AUnused, jField: JFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "AAIJ", aField: AUnused, jField: JFunctionDiscriminator, uIs18Bits: true},
+		010: &InstructionDefinition{mnemonic: "JNLB", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		011: &InstructionDefinition{mnemonic: "JLB", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		012: &InstructionDefinition{mnemonic: "JMGI", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		013: &InstructionDefinition{mnemonic: "LMJ", aField: XRegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		014: &function07414InterpreterBasic,
+		015: &function07415InterpreterBasic,
+		016: &InstructionDefinition{mnemonic: "JC", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		017: &InstructionDefinition{mnemonic: "JNC", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+	},
+}
+
+var function07404InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "J", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JK01", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JK02", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JK03", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		004: &InstructionDefinition{mnemonic: "JK04", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		005: &InstructionDefinition{mnemonic: "JK05", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		006: &InstructionDefinition{mnemonic: "JK06", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		007: &InstructionDefinition{mnemonic: "JK07", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		010: &InstructionDefinition{mnemonic: "JK10", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		011: &InstructionDefinition{mnemonic: "JK11", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		012: &InstructionDefinition{mnemonic: "JK12", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		013: &InstructionDefinition{mnemonic: "JK13", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		014: &InstructionDefinition{mnemonic: "JK14", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		015: &InstructionDefinition{mnemonic: "JK15", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		016: &InstructionDefinition{mnemonic: "JK16", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+		017: &InstructionDefinition{mnemonic: "JK17", aField: AFunctionDiscriminator, jField: JUnused, uIs18Bits: true},
+	},
+}
+
+var function07414InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JFU", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JFO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JDF", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		007: &InstructionDefinition{mnemonic: "PAIJ", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function07415InterpreterBasic = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JNO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JNFU", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JNFO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JNDF", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		005: &InstructionDefinition{mnemonic: "HLTJ", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function075InterpreterBasic = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		013: &InstructionDefinition{mnemonic: "LXLM", aField: XRegister, jField: JFunctionDiscriminator},
+	},
+}
+
+//	Extended -----------------------------------------------------------------------------------------------------------
+
+var ExtendedFunctionTable = FunctionTable{
+	indexBy: IndexByF,
+	table: map[int]FunctionTableEntry{
+		001: &InstructionDefinition{mnemonic: "SA", aField: ARegister, jField: JPartialWordDesignator},
+		002: &InstructionDefinition{mnemonic: "SNA", aField: ARegister, jField: JPartialWordDesignator},
+		003: &InstructionDefinition{mnemonic: "SMA", aField: ARegister, jField: JPartialWordDesignator},
+		004: &InstructionDefinition{mnemonic: "SR", aField: RRegister, jField: JPartialWordDesignator},
+		005: &function005InterpreterExtended,
+		006: &InstructionDefinition{mnemonic: "SX", aField: XRegister, jField: JPartialWordDesignator},
+		007: &function007InterpreterExtended,
+		010: &InstructionDefinition{mnemonic: "LA", aField: ARegister, jField: JPartialWordDesignator},
+		011: &InstructionDefinition{mnemonic: "LNA", aField: ARegister, jField: JPartialWordDesignator},
+		012: &InstructionDefinition{mnemonic: "LMA", aField: ARegister, jField: JPartialWordDesignator},
+		013: &InstructionDefinition{mnemonic: "LNMA", aField: ARegister, jField: JPartialWordDesignator},
+		014: &InstructionDefinition{mnemonic: "AA", aField: ARegister, jField: JPartialWordDesignator},
+		015: &InstructionDefinition{mnemonic: "ANA", aField: ARegister, jField: JPartialWordDesignator},
+		016: &InstructionDefinition{mnemonic: "AMA", aField: ARegister, jField: JPartialWordDesignator},
+		017: &InstructionDefinition{mnemonic: "ANMA", aField: ARegister, jField: JPartialWordDesignator},
+		020: &InstructionDefinition{mnemonic: "AU", aField: ARegister, jField: JPartialWordDesignator},
+		021: &InstructionDefinition{mnemonic: "ANU", aField: ARegister, jField: JPartialWordDesignator},
+		023: &InstructionDefinition{mnemonic: "LR", aField: RRegister, jField: JPartialWordDesignator},
+		024: &InstructionDefinition{mnemonic: "AX", aField: XRegister, jField: JPartialWordDesignator},
+		025: &InstructionDefinition{mnemonic: "ANX", aField: XRegister, jField: JPartialWordDesignator},
+		026: &InstructionDefinition{mnemonic: "LXM", aField: XRegister, jField: JPartialWordDesignator},
+		027: &InstructionDefinition{mnemonic: "LX", aField: XRegister, jField: JPartialWordDesignator},
+		030: &InstructionDefinition{mnemonic: "MI", aField: ARegister, jField: JPartialWordDesignator},
+		031: &InstructionDefinition{mnemonic: "MSI", aField: ARegister, jField: JPartialWordDesignator},
+		032: &InstructionDefinition{mnemonic: "MF", aField: ARegister, jField: JPartialWordDesignator},
+		033: &function033InterpreterExtended,
+		034: &InstructionDefinition{mnemonic: "DI", aField: ARegister, jField: JPartialWordDesignator},
+		035: &InstructionDefinition{mnemonic: "DSF", aField: ARegister, jField: JPartialWordDesignator},
+		036: &InstructionDefinition{mnemonic: "DF", aField: ARegister, jField: JPartialWordDesignator},
+		037: &function037InterpreterExtended,
+		040: &InstructionDefinition{mnemonic: "OR", aField: ARegister},
+		041: &InstructionDefinition{mnemonic: "XOR", aField: ARegister},
+		042: &InstructionDefinition{mnemonic: "AND", aField: ARegister},
+		043: &InstructionDefinition{mnemonic: "MLU", aField: ARegister},
+		044: &InstructionDefinition{mnemonic: "TEP", aField: ARegister, jField: JPartialWordDesignator},
+		045: &InstructionDefinition{mnemonic: "TOP", aField: ARegister, jField: JPartialWordDesignator},
+		046: &InstructionDefinition{mnemonic: "LXI", aField: XRegister, jField: JPartialWordDesignator},
+		047: &InstructionDefinition{mnemonic: "TLEM", aField: XRegister, jField: JPartialWordDesignator},
+		050: &function050InterpreterExtended,
+		051: &InstructionDefinition{mnemonic: "LXSI", aField: XRegister, jField: JPartialWordDesignator},
+		060: &InstructionDefinition{mnemonic: "LSBO", aField: XRegister, jField: JPartialWordDesignator},
+		061: &InstructionDefinition{mnemonic: "LSBL", aField: XRegister, jField: JPartialWordDesignator},
+		070: &InstructionDefinition{mnemonic: "JGD", aField: AGRSComponent, jField: JGRSComponent, uIs18Bits: true},
+		071: &function071InterpreterExtended,
+		072: &function072InterpreterExtended,
+		073: &function073InterpreterExtended,
+		074: &function074InterpreterExtended,
+		075: &function075InterpreterExtended,
+	},
+}
+
+var function005InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "SZ", aField: AFunctionDiscriminator},
+		001: &InstructionDefinition{mnemonic: "SNZ", aField: AFunctionDiscriminator},
+		002: &InstructionDefinition{mnemonic: "SP1", aField: AFunctionDiscriminator},
+		003: &InstructionDefinition{mnemonic: "SN1", aField: AFunctionDiscriminator},
+		004: &InstructionDefinition{mnemonic: "SFS", aField: AFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "SFZ", aField: AFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "SAS", aField: AFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "SAZ", aField: AFunctionDiscriminator},
+	},
+}
+
+var function007InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		004: &InstructionDefinition{mnemonic: "LAQW", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "SAQW", aField: ARegister, jField: JFunctionDiscriminator},
+	},
+}
+
+var function033InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		015: &InstructionDefinition{mnemonic: "DCB", aField: ARegister, jField: JFunctionDiscriminator},
+	},
+}
+
+var function037InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		004: &function037004InterpreterExtended,
+	},
+}
+
+var function037004InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		005: &InstructionDefinition{mnemonic: "RNGI", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "RNGB", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+	},
+}
+
+var function050InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "TNOP", aField: AUnused, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "TZ", aField: AFunctionDiscriminator, jField: JPartialWordDesignator},
+		017: &InstructionDefinition{mnemonic: "TSKP", aField: AUnused, jField: JFunctionDiscriminator},
+	},
+}
+
+var function071InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		010: &InstructionDefinition{mnemonic: "DA", aField: ARegister, jField: JFunctionDiscriminator},
+		011: &InstructionDefinition{mnemonic: "DAN", aField: ARegister, jField: JFunctionDiscriminator},
+		012: &InstructionDefinition{mnemonic: "DS", aField: ARegister, jField: JFunctionDiscriminator},
+		013: &InstructionDefinition{mnemonic: "DL", aField: ARegister, jField: JFunctionDiscriminator},
+		014: &InstructionDefinition{mnemonic: "DLN", aField: ARegister, jField: JFunctionDiscriminator},
+		015: &InstructionDefinition{mnemonic: "DLM", aField: ARegister, jField: JFunctionDiscriminator},
+		016: &InstructionDefinition{mnemonic: "DJZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function072InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		002: &InstructionDefinition{mnemonic: "JPS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JNS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		004: &InstructionDefinition{mnemonic: "AH", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "ANH", aField: ARegister, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "AT", aField: ARegister, jField: JFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "ANT", aField: ARegister, jField: JFunctionDiscriminator},
+		016: &InstructionDefinition{mnemonic: "SRS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		017: &InstructionDefinition{mnemonic: "LRS", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function073InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "SSC", aField: ARegister, jField: JFunctionDiscriminator},
+		001: &InstructionDefinition{mnemonic: "DSC", aField: ARegister, jField: JFunctionDiscriminator},
+		002: &InstructionDefinition{mnemonic: "SSL", aField: ARegister, jField: JFunctionDiscriminator},
+		003: &InstructionDefinition{mnemonic: "DSL", aField: ARegister, jField: JFunctionDiscriminator},
+		004: &InstructionDefinition{mnemonic: "SSA", aField: ARegister, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "DSA", aField: ARegister, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "LSC", aField: ARegister, jField: JFunctionDiscriminator},
+		007: &InstructionDefinition{mnemonic: "DLSC", aField: ARegister, jField: JFunctionDiscriminator},
+		010: &InstructionDefinition{mnemonic: "LSSC", aField: ARegister, jField: JFunctionDiscriminator},
+		011: &InstructionDefinition{mnemonic: "LDSC", aField: ARegister, jField: JFunctionDiscriminator},
+		012: &InstructionDefinition{mnemonic: "LSSL", aField: ARegister, jField: JFunctionDiscriminator},
+		013: &InstructionDefinition{mnemonic: "LDSL", aField: ARegister, jField: JFunctionDiscriminator},
+		014: &function07314InterpreterExtended,
+		015: &function07315InterpreterExtended,
+		017: &function07317InterpreterExtended,
+	},
+}
+
+var function07314InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "NOP", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		005: &InstructionDefinition{mnemonic: "EX", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		006: &InstructionDefinition{mnemonic: "EXR", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+	},
+}
+
+var function07315InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		014: &InstructionDefinition{mnemonic: "LD", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+		015: &InstructionDefinition{mnemonic: "SD", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator},
+	},
+}
+
+var function07317InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		006: &InstructionDefinition{mnemonic: "IAR", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true, noGRSAddress: true},
+	},
+}
+
+var function074InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JNZ", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JP", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JN", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		010: &InstructionDefinition{mnemonic: "JNLB", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		011: &InstructionDefinition{mnemonic: "JLB", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		012: &InstructionDefinition{mnemonic: "JMGI", aField: ARegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		013: &InstructionDefinition{mnemonic: "LMJ", aField: XRegister, jField: JFunctionDiscriminator, uIs18Bits: true},
+		014: &function07414InterpreterExtended,
+		015: &function07415InterpreterExtended,
+	},
+}
+
+var function07414InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JFU", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JFO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JDF", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		004: &InstructionDefinition{mnemonic: "JC", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		005: &InstructionDefinition{mnemonic: "JNC", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		006: &InstructionDefinition{mnemonic: "AAIJ", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		007: &InstructionDefinition{mnemonic: "PAIJ", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function07415InterpreterExtended = FunctionTable{
+	indexBy: IndexByA,
+	table: map[int]FunctionTableEntry{
+		000: &InstructionDefinition{mnemonic: "JNO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		001: &InstructionDefinition{mnemonic: "JNFU", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		002: &InstructionDefinition{mnemonic: "JNFO", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		003: &InstructionDefinition{mnemonic: "JNDF", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		004: &InstructionDefinition{mnemonic: "J", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+		005: &InstructionDefinition{mnemonic: "HLTJ", aField: AFunctionDiscriminator, jField: JFunctionDiscriminator, uIs18Bits: true},
+	},
+}
+
+var function075InterpreterExtended = FunctionTable{
+	indexBy: IndexByJ,
+	table: map[int]FunctionTableEntry{
+		013: &InstructionDefinition{mnemonic: "LXLM", aField: XRegister, jField: JFunctionDiscriminator},
+	},
+}
+
+//	Other stuff --------------------------------------------------------------------------------------------------------
+
+var JFieldThirdWordNames = []string{
+	"W", "H2", "H1", "XH2", "XH1", "T3", "T2", "T1", "S6", "S5", "S4", "S3", "S2", "S1", "U", "XU",
+}
+
+var JFieldQuarterWordNames = []string{
+	"W", "H2", "H1", "XH2", "Q2", "Q4", "Q3", "Q1", "S6", "S5", "S4", "S3", "S2", "S1", "U", "XU",
+}
@@ -0,0 +1,52 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package common
+
+import "testing"
+
+func checkMnemonicRoundTrip(t *testing.T, ft *FunctionTable, basicMode bool) {
+	count := 0
+	ft.walk(0, 0, 0, func(ie *InstructionEncoding) {
+		count++
+		mnemonic := ie.GetDefinition().GetMnemonic()
+		found := LookupMnemonic(mnemonic, basicMode)
+		if found == nil {
+			t.Errorf("Error mnemonic %s not found (basic=%v)", mnemonic, basicMode)
+			return
+		}
+
+		iw := InstructionWord(found.GetF()<<30 | found.GetJ()<<26 | found.GetA()<<22)
+		definition := ft.Lookup(&iw)
+		if definition != found.GetDefinition() {
+			t.Errorf("Error mnemonic %s encoded as %012o does not decode to itself (basic=%v)", mnemonic, iw, basicMode)
+		}
+	})
+
+	if count == 0 {
+		t.Errorf("Error no instructions found (basic=%v)", basicMode)
+	}
+}
+
+func Test_InstructionTable_BasicRoundTrip(t *testing.T) {
+	checkMnemonicRoundTrip(t, &BasicFunctionTable, true)
+}
+
+func Test_InstructionTable_ExtendedRoundTrip(t *testing.T) {
+	checkMnemonicRoundTrip(t, &ExtendedFunctionTable, false)
+}
+
+func Test_InstructionTable_LookupMnemonic(t *testing.T) {
+	ie := LookupMnemonic("LD", true)
+	if ie == nil || ie.GetF() != 073 || ie.GetJ() != 015 || ie.GetA() != 014 {
+		t.Fatalf("Error LD encoding wrong in basic mode: %v", ie)
+	}
+
+	if LookupMnemonic("LXSI", true) != nil {
+		t.Errorf("Error LXSI should not exist in basic mode")
+	}
+	if LookupMnemonic("LXSI", false) == nil {
+		t.Errorf("Error LXSI should exist in extended mode")
+	}
+}
@@ -43,7 +43,7 @@ func GetH1(value uint64) uint64 {
 
 // GetH2 retrieves H2 of the given value as an unsigned integer
 func (w *Word36) GetH2() uint64 {
-	return GetH1(uint64(*w))
+	return GetH2(uint64(*w))
 }
 
 func GetH2(value uint64) uint64 {
@@ -497,7 +497,7 @@ func Compare(operand1 uint64, operand2 uint64) int {
 			return 1
 		}
 	} else if !pos1 && !pos2 {
-		if operand1 > operand2 {
+		if operand1 < operand2 {
 			return -1
 		} else {
 			return 1
@@ -812,14 +812,14 @@ func CompareDouble(operand1 []uint64, operand2 []uint64) int {
 			}
 		}
 	} else {
-		if operand1[0] > operand2[0] {
+		if operand1[0] < operand2[0] {
 			return -1
-		} else if operand1[0] < operand2[0] {
+		} else if operand1[0] > operand2[0] {
 			return 1
 		} else {
-			if operand1[1] > operand2[1] {
+			if operand1[1] < operand2[1] {
 				return -1
-			} else if operand1[1] < operand2[1] {
+			} else if operand1[1] > operand2[1] {
 				return 1
 			} else {
 				return 0
@@ -916,45 +916,35 @@ func NegateDouble(op []uint64) []uint64 {
 // RightDoubleShiftAlgebraic shifts the 72-bit word stored in two consecutive uint64's (MSW first)
 // to the right. Bits shifted out of bit 71 are lost while bit 0 is propagated to the right.
 func RightDoubleShiftAlgebraic(operand []uint64, count uint64) []uint64 {
-	var result []uint64
+	neg := IsNegative(operand[0])
 	if count > 71 {
-		if IsNegative(operand[0]) {
-			result = DoubleNegativeZero
+		if neg {
+			return []uint64{NegativeZero, NegativeZero}
 		} else {
-			result = DoublePositiveZero
+			return []uint64{PositiveZero, PositiveZero}
 		}
-	} else {
-		if count > 0 {
-			neg := IsNegative(operand[0])
-			if count > 36 {
-				if neg {
-					result[0] = NegativeZero
-				} else {
-					result[0] = PositiveZero
-				}
-				result[1] = operand[0]
-				count -= 36
-			} else {
-				result = []uint64{operand[0], operand[1]}
-			}
+	}
 
-			for count > 0 {
-				shift := uint64Min(27, count)
-				mask := uint64(1<<shift) - 1
-				partial := result[0] & mask
-				result[0] >>= shift
-				if neg {
-					bits := mask << (36 - count)
-					result[0] |= bits
-				}
-				result[1] |= partial << 36
-				result[1] >>= shift
-				count -= shift
-			}
+	result := []uint64{operand[0], operand[1]}
+	if count >= 36 {
+		result[1] = result[0]
+		if neg {
+			result[0] = NegativeZero
 		} else {
-			result = operand
+			result[0] = PositiveZero
 		}
+		count -= 36
 	}
+
+	if count > 0 {
+		mask := uint64(1<<count) - 1
+		result[1] = ((result[1] >> count) | ((result[0] & mask) << (36 - count))) & NegativeZero
+		result[0] >>= count
+		if neg {
+			result[0] |= mask << (36 - count)
+		}
+	}
+
 	return result
 }
 
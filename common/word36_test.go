@@ -53,6 +53,12 @@ func TestSetPartialWord(t *testing.T) {
 	// TODO more
 }
 
+func TestWord36PartialWord(t *testing.T) {
+	w := Word36(0_321364_101023)
+	checkEquals(t, w.GetH1(), 0_321364, "Word36.GetH1() failed")
+	checkEquals(t, w.GetH2(), 0_101023, "Word36.GetH2() failed")
+}
+
 func TestCountBits(t *testing.T) {
 	type parameterSet struct {
 		input          uint64
@@ -749,6 +755,23 @@ func Test_AddSimple_1(t *testing.T) {
 	}
 }
 
+func Test_RightDoubleShiftAlgebraic(t *testing.T) {
+	checkDouble := func(operand []uint64, count uint64, expected []uint64) {
+		result := RightDoubleShiftAlgebraic(operand, count)
+		if result[0] != expected[0] || result[1] != expected[1] {
+			t.Errorf("shift %012o %012o by %v expected %012o %012o, got %012o %012o",
+				operand[0], operand[1], count, expected[0], expected[1], result[0], result[1])
+		}
+	}
+
+	checkDouble([]uint64{0_000000_000001, 0_000000_000000}, 0, []uint64{0_000000_000001, 0_000000_000000})
+	checkDouble([]uint64{0_000000_000007, 0_000000_000000}, 3, []uint64{0_000000_000000, 0_700000_000000})
+	checkDouble([]uint64{0_400000_000000, 0_000000_000000}, 3, []uint64{0_740000_000000, 0_000000_000000})
+	checkDouble([]uint64{0_123456_701234, 0_567012_345670}, 36, []uint64{0_000000_000000, 0_123456_701234})
+	checkDouble([]uint64{0_700000_000000, 0_000000_000000}, 37, []uint64{0_777777_777777, 0_740000_000000})
+	checkDouble([]uint64{0_400000_000000, 0_000000_000000}, 72, []uint64{0_777777_777777, 0_777777_777777})
+}
+
 func Test_GetOnesComplement_1(t *testing.T) {
 	value := uint64(100234)
 	expected := uint64(100234)
@@ -857,3 +880,31 @@ func TestNegate(t *testing.T) {
 		t.Errorf("Error expected %12o, got %12o", expected, result)
 	}
 }
+
+func Test_Compare_Negative(t *testing.T) {
+	minusOne := uint64(0_777777_777776)
+	minusFive := uint64(0_777777_777772)
+	if Compare(minusOne, minusFive) <= 0 {
+		t.Errorf("Error expected -1 to compare greater than -5")
+	}
+	if Compare(minusFive, minusOne) >= 0 {
+		t.Errorf("Error expected -5 to compare less than -1")
+	}
+	if Compare(NegativeZero, PositiveZero) >= 0 {
+		t.Errorf("Error expected -0 to compare less than +0")
+	}
+	if Compare(minusOne, 1) >= 0 {
+		t.Errorf("Error expected -1 to compare less than +1")
+	}
+}
+
+func Test_CompareDouble_Negative(t *testing.T) {
+	minusOne := []uint64{0_777777_777777, 0_777777_777776}
+	minusFive := []uint64{0_777777_777777, 0_777777_777772}
+	if CompareDouble(minusOne, minusFive) <= 0 {
+		t.Errorf("Error expected -1 to compare greater than -5")
+	}
+	if CompareDouble(minusFive, minusOne) >= 0 {
+		t.Errorf("Error expected -5 to compare less than -1")
+	}
+}
@@ -9,35 +9,20 @@ import (
 	"fmt"
 
 	"khalehla/common"
-	"khalehla/hardware"
-	"khalehla/tasm"
 )
 
-// Disassembler is a simple disassembler which assists in khalehla development
-
-type Disassembler struct {
-}
-
-func NewDisassembler() *Disassembler {
-	return &Disassembler{}
-}
-
-func (da *Disassembler) DisassembleStorage(storage *hardware.MainStorage, executable *tasm.Executable) {
-	//	TODO I think we need BDTables as a parameter as well...?
-}
-
 func DisassembleInstruction(asp *common.ActivityStatePacket) string {
 	var s string
 	var ok bool
 	iw := asp.GetCurrentInstruction()
 	dr := asp.GetDesignatorRegister()
 	if asp.GetDesignatorRegister().IsBasicModeEnabled() {
-		s, ok = BasicFunctionTable.Interpret(iw, dr.IsBasicModeEnabled(), dr.IsQuarterWordModeEnabled())
+		s, ok = Interpret(&common.BasicFunctionTable, iw, dr.IsBasicModeEnabled(), dr.IsQuarterWordModeEnabled())
 		if !ok {
 			s = fmt.Sprintf("%012o", *iw)
 		}
 	} else {
-		s, ok = ExtendedFunctionTable.Interpret(iw, dr.IsBasicModeEnabled(), dr.IsQuarterWordModeEnabled())
+		s, ok = Interpret(&common.ExtendedFunctionTable, iw, dr.IsBasicModeEnabled(), dr.IsQuarterWordModeEnabled())
 		if !ok {
 			s = fmt.Sprintf("%012o", *iw)
 		}
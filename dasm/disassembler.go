@@ -0,0 +1,472 @@
+// khalehla Project
+// disassembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package dasm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"khalehla/common"
+	"khalehla/hardware"
+	"khalehla/tasm"
+)
+
+// Disassembler is a simple disassembler which assists in khalehla development.
+// It disassembles whole banks at a time, producing source which is acceptable to the tiny assembler.
+//
+// Code is separated from data by following the flow of control from the entry points of the executable
+// (the starting address, and any added with AddEntryPoint). Any word which cannot be reached in that fashion
+// is considered to be data. Symbols do not make entry points, since they label data as often as code -
+// a symbol is only a name for an address, which is used if the address is labeled.
+// Jump targets and operand addresses which fall within a known bank are given labels - the name
+// from the symbol table if there is one, otherwise a name recovered from the address. Banks commonly share
+// the same limits, so when there is more than one bank the recovered names are qualified by the segment number
+// which the disassembly gives the bank (e.g., S1L001000 rather than L001000) so that they remain unique.
+// The L,BDI would be more natural, but would make the names too long for the assembler.
+
+type bankImage struct {
+	levelBDI      uint64
+	segmentNumber int // segment in which the bank is disassembled
+	lowerLimit    uint64
+	basicMode     bool
+	enterable     bool
+	code          []uint64
+	isCode        []bool
+	isData        []bool            // words which code refers to as operands, and which therefore are not traced as code
+	labels        map[uint64]string // key is relative address
+}
+
+// contains indicates whether the given relative address falls within the bank
+func (bi *bankImage) contains(address uint64) bool {
+	return address >= bi.lowerLimit && address-bi.lowerLimit < uint64(len(bi.code))
+}
+
+// entryPoint is a relative address in a particular bank at which code is known (or believed) to begin
+type entryPoint struct {
+	levelBDI uint64
+	address  uint64
+}
+
+type Disassembler struct {
+	banks           map[uint64]*bankImage // key is L,BDI
+	baseRegisters   map[uint64]uint64     // key is base register index, value is L,BDI
+	symbols         map[uint64]map[uint64]string
+	entryPoints     []*entryPoint
+	quarterWordMode bool
+}
+
+func NewDisassembler() *Disassembler {
+	return &Disassembler{
+		banks:         make(map[uint64]*bankImage),
+		baseRegisters: make(map[uint64]uint64),
+		symbols:       make(map[uint64]map[uint64]string),
+		entryPoints:   make([]*entryPoint, 0),
+	}
+}
+
+// AddBank adds a bank to be disassembled. The code is the content of the bank, the first word of which
+// is at the given lower limit. enterable indicates that the bank may contain code - nothing in a bank
+// which is not enterable is traced as code.
+func (da *Disassembler) AddBank(
+	levelBDI uint64,
+	lowerLimit uint64,
+	basicMode bool,
+	enterable bool,
+	code []uint64,
+) *Disassembler {
+	da.banks[levelBDI] = &bankImage{
+		levelBDI:   levelBDI,
+		lowerLimit: lowerLimit,
+		basicMode:  basicMode,
+		enterable:  enterable,
+		code:       code,
+	}
+	return da
+}
+
+// AddEntryPoint indicates that the given relative address in the given bank is the beginning of code
+func (da *Disassembler) AddEntryPoint(levelBDI uint64, address uint64) *Disassembler {
+	da.entryPoints = append(da.entryPoints, &entryPoint{levelBDI, address})
+	return da
+}
+
+// SetBaseRegister indicates that the given bank is based on the given base register,
+// which allows operand addresses to be related to the banks which contain them.
+func (da *Disassembler) SetBaseRegister(baseRegisterIndex uint64, levelBDI uint64) *Disassembler {
+	da.baseRegisters[baseRegisterIndex] = levelBDI
+	return da
+}
+
+func (da *Disassembler) SetQuarterWordMode(value bool) *Disassembler {
+	da.quarterWordMode = value
+	return da
+}
+
+// SetSymbolTable provides the symbols (and the initial basing) produced by the linker for the executable
+// which is being disassembled.
+func (da *Disassembler) SetSymbolTable(symbolTable *tasm.SymbolTable) *Disassembler {
+	for _, stb := range symbolTable.GetBanks() {
+		if brx, ok := stb.GetBaseRegister(); ok {
+			da.baseRegisters[brx] = stb.GetLevelBDI()
+		}
+		for address, name := range symbolTable.GetSymbolsForBank(stb.GetLevelBDI()) {
+			if da.symbols[stb.GetLevelBDI()] == nil {
+				da.symbols[stb.GetLevelBDI()] = make(map[uint64]string)
+			}
+			da.symbols[stb.GetLevelBDI()][address] = name
+		}
+	}
+	return da
+}
+
+// AddExecutable adds all the banks of the given executable, along with its initial basing, its starting address,
+// and any symbols the linker recorded for it.
+func (da *Disassembler) AddExecutable(executable *tasm.Executable) *Disassembler {
+	for lbdi, bank := range executable.GetBanks() {
+		bd := bank.GetBankDescriptor()
+		da.AddBank(
+			lbdi,
+			bd.GetLowerLimitNormalized(),
+			executable.IsBasicMode() || bd.GetBankType() == common.BasicModeBankDescriptor,
+			bd.GetGeneralAccessPermissions().CanEnter() || bd.GetSpecialAccessPermissions().CanEnter(),
+			bank.GetCode())
+	}
+
+	for brx, lbdi := range executable.GetInitiallyBasedBanks() {
+		da.SetBaseRegister(brx, lbdi)
+	}
+
+	da.SetQuarterWordMode(executable.IsQuarterWordMode())
+	da.SetSymbolTable(executable.GetSymbolTable())
+
+	start := executable.GetStartingAddress()
+	if bank := da.findCodeBank(executable.IsBasicMode(), nil, start); bank != nil {
+		da.AddEntryPoint(bank.levelBDI, start)
+	}
+	return da
+}
+
+// DisassembleExecutable disassembles all the banks of the given executable to the given writer
+func (da *Disassembler) DisassembleExecutable(executable *tasm.Executable, writer io.Writer) {
+	da.AddExecutable(executable)
+	da.Disassemble(writer)
+}
+
+// DisassembleStorage disassembles the banks of the given executable as they currently exist in main storage,
+// which is to say after the executable has been loaded (and possibly run). The base addresses in the
+// bank descriptors of the executable must have been established by the loader.
+func (da *Disassembler) DisassembleStorage(
+	storage *hardware.MainStorage,
+	executable *tasm.Executable,
+	writer io.Writer,
+) error {
+	da.AddExecutable(executable)
+	for lbdi, bank := range executable.GetBanks() {
+		address := bank.GetBankDescriptor().GetBaseAddress()
+		if address == nil {
+			return fmt.Errorf("bank %06o has not been loaded", lbdi)
+		}
+
+		slice, interrupt := storage.GetSlice(address.GetSegment(), address.GetOffset(), bank.GetCodeLength())
+		if interrupt != nil {
+			return fmt.Errorf("bank %06o:%s", lbdi, common.GetInterruptString(interrupt))
+		}
+
+		code := make([]uint64, len(slice))
+		for wx, word := range slice {
+			code[wx] = word.GetW()
+		}
+		da.banks[lbdi].code = code
+	}
+
+	da.Disassemble(writer)
+	return nil
+}
+
+// findCodeBank finds the bank which contains a jump target. In extended mode this is always the current bank.
+// In basic mode it is the current bank if the address falls within it, otherwise the first of the banks based on
+// B12 through B15 which contains the address.
+func (da *Disassembler) findCodeBank(basicMode bool, current *bankImage, address uint64) *bankImage {
+	if !basicMode {
+		if current == nil {
+			current = da.banks[da.baseRegisters[0]]
+		}
+		if current != nil && current.contains(address) {
+			return current
+		}
+		return nil
+	}
+
+	if current != nil && current.contains(address) {
+		return current
+	}
+	return da.findBasicModeBank(address)
+}
+
+// findBasicModeBank finds the first of the banks based on B12 through B15 which contains the given address
+func (da *Disassembler) findBasicModeBank(address uint64) *bankImage {
+	for brx := uint64(12); brx <= 15; brx++ {
+		if lbdi, ok := da.baseRegisters[brx]; ok {
+			if bank := da.banks[lbdi]; bank != nil && bank.contains(address) {
+				return bank
+			}
+		}
+	}
+	return nil
+}
+
+// nonJumpInstructions are those which have an 18-bit u-field, but for which it is not a jump target
+var nonJumpInstructions = map[string]bool{
+	"IAR": true,
+	"LRS": true,
+	"SRS": true,
+}
+
+// terminalInstructions are those after which control never falls through to the next instruction
+var terminalInstructions = map[string]bool{
+	"AAIJ": true,
+	"HLTJ": true,
+	"IAR":  true,
+	"J":    true,
+	"PAIJ": true,
+}
+
+// isSkipInstruction indicates whether the instruction is a test which may skip the next instruction
+func isSkipInstruction(i *common.InstructionDefinition) bool {
+	mnemonic := i.GetMnemonic()
+	return strings.HasPrefix(mnemonic, "T") || strings.HasPrefix(mnemonic, "DT")
+}
+
+// getTarget finds the bank and relative address referred to by the operand of the given instruction, if the operand
+// refers to storage at all (rather than to the GRS, or being an immediate value or a shift count).
+// isJump indicates that the operand is the target of a jump.
+func (da *Disassembler) getTarget(
+	bank *bankImage,
+	i *common.InstructionDefinition,
+	iw *common.InstructionWord,
+) (target *bankImage, address uint64, isJump bool) {
+	if i.IsUField18Bits() {
+		if nonJumpInstructions[i.GetMnemonic()] || iw.GetX() != 0 || (bank.basicMode && iw.GetI() != 0) {
+			return nil, 0, false
+		}
+		address = iw.GetU()
+		return da.findCodeBank(bank.basicMode, bank, address), address, true
+	}
+
+	if i.GetJFieldUsage() == common.JPartialWordDesignator &&
+		iw.GetX() == 0 &&
+		(iw.GetJ() == common.JFieldU || iw.GetJ() == common.JFieldXU) {
+		return nil, 0, false
+	}
+
+	if bank.basicMode {
+		address = iw.GetU()
+		if (i.IsGRSAddressAllowed() && address < 0200) || iw.GetI() != 0 {
+			return nil, 0, false
+		}
+		return da.findBasicModeBank(address), address, false
+	}
+
+	address = iw.GetD()
+	if iw.GetB() == 0 && i.IsGRSAddressAllowed() && address < 0200 {
+		return nil, 0, false
+	}
+	if lbdi, ok := da.baseRegisters[iw.GetB()]; ok {
+		if target = da.banks[lbdi]; target != nil && target.contains(address) {
+			return target, address, false
+		}
+	}
+	return nil, 0, false
+}
+
+func (da *Disassembler) getFunctionTable(bank *bankImage) *common.FunctionTable {
+	if bank.basicMode {
+		return &common.BasicFunctionTable
+	}
+	return &common.ExtendedFunctionTable
+}
+
+// addLabel labels the given relative address in the given bank, unless it is already labeled
+func (da *Disassembler) addLabel(bank *bankImage, address uint64) {
+	if _, ok := bank.labels[address]; !ok {
+		if len(da.banks) > 1 {
+			bank.labels[address] = fmt.Sprintf("S%dL%06o", bank.segmentNumber, address)
+		} else {
+			bank.labels[address] = fmt.Sprintf("L%06o", address)
+		}
+	}
+}
+
+// trace follows the flow of control from the given entry points, marking the words it reaches as code,
+// and labeling the jump targets and operand addresses it finds along the way.
+func (da *Disassembler) trace(workList []*entryPoint) {
+	for len(workList) > 0 {
+		ep := workList[len(workList)-1]
+		workList = workList[:len(workList)-1]
+
+		bank := da.banks[ep.levelBDI]
+		if bank == nil || !bank.enterable || !bank.contains(ep.address) {
+			continue
+		}
+		wx := ep.address - bank.lowerLimit
+		if bank.isCode[wx] || bank.isData[wx] {
+			continue
+		}
+
+		iw := common.InstructionWord(bank.code[wx])
+		i := da.getFunctionTable(bank).Lookup(&iw)
+		if i == nil {
+			continue
+		}
+		bank.isCode[wx] = true
+
+		target, address, isJump := da.getTarget(bank, i, &iw)
+		if target != nil {
+			da.addLabel(target, address)
+			if isJump {
+				workList = append(workList, &entryPoint{target.levelBDI, address})
+			} else if tx := address - target.lowerLimit; !target.isCode[tx] {
+				target.isData[tx] = true
+			}
+		}
+
+		if !terminalInstructions[i.GetMnemonic()] {
+			workList = append(workList, &entryPoint{bank.levelBDI, ep.address + 1})
+			if isSkipInstruction(i) {
+				workList = append(workList, &entryPoint{bank.levelBDI, ep.address + 2})
+			}
+		}
+	}
+}
+
+// analyze separates code from data and establishes labels for the symbols, jump targets, and operand addresses.
+// Flow is traced from the entry points only; symbols merely name the addresses they label.
+func (da *Disassembler) analyze() {
+	for lbdi, bank := range da.banks {
+		bank.isCode = make([]bool, len(bank.code))
+		bank.isData = make([]bool, len(bank.code))
+		bank.labels = make(map[uint64]string)
+		for address, name := range da.symbols[lbdi] {
+			if bank.contains(address) {
+				bank.labels[address] = name
+			}
+		}
+	}
+
+	workList := make([]*entryPoint, 0)
+	for _, ep := range da.entryPoints {
+		if bank := da.banks[ep.levelBDI]; bank != nil && bank.contains(ep.address) {
+			da.addLabel(bank, ep.address)
+			workList = append(workList, ep)
+		}
+	}
+	da.trace(workList)
+}
+
+// printableAscii replaces the characters in the given string which cannot be displayed with periods
+func printableAscii(str string) string {
+	result := []byte(str)
+	for cx, ch := range result {
+		if ch < 040 || ch >= 0177 {
+			result[cx] = '.'
+		}
+	}
+	return string(result)
+}
+
+// emitLine writes a line of assembler source, with the address and content of the word as a comment
+func emitLine(writer io.Writer, label string, text string, comment string) {
+	line := fmt.Sprintf("%-8s %s", label, text)
+	_, _ = fmt.Fprintf(writer, "%-56s . %s\n", line, comment)
+}
+
+// disassembleBank writes the source for a single bank
+func (da *Disassembler) disassembleBank(writer io.Writer, bank *bankImage) {
+	mode := "extended"
+	directive := ".EXTEND"
+	if bank.basicMode {
+		mode = "basic"
+		directive = ".BASIC"
+	}
+
+	based := ""
+	for brx := uint64(0); brx < 32; brx++ {
+		if lbdi, ok := da.baseRegisters[brx]; ok && lbdi == bank.levelBDI {
+			based += fmt.Sprintf(", based on B%d", brx)
+		}
+	}
+
+	_, _ = fmt.Fprintf(writer, "\n. Bank %06o, %s mode, limits %06o to %06o%s\n",
+		bank.levelBDI, mode, bank.lowerLimit, bank.lowerLimit+uint64(len(bank.code))-1, based)
+	_, _ = fmt.Fprintf(writer, "         %s\n", directive)
+	_, _ = fmt.Fprintf(writer, "         .SEG     %d\n", bank.segmentNumber)
+
+	ft := da.getFunctionTable(bank)
+
+	for wx := 0; wx < len(bank.code); wx++ {
+		address := bank.lowerLimit + uint64(wx)
+		word := bank.code[wx]
+		label := bank.labels[address]
+
+		if bank.isCode[wx] {
+			iw := common.InstructionWord(word)
+			str, _ := interpret(ft, &iw, bank.basicMode, da.quarterWordMode,
+				func(i *common.InstructionDefinition, operand uint64) string {
+					target, targetAddress, _ := da.getTarget(bank, i, &iw)
+					if target != nil && targetAddress == operand {
+						return target.labels[targetAddress]
+					}
+					return ""
+				})
+			emitLine(writer, label, str, fmt.Sprintf("%06o  %012o", address, word))
+			continue
+		}
+
+		//	Runs of zero data words are reserved rather than generated, up to the next label or code
+		if word == 0 {
+			end := wx + 1
+			for end < len(bank.code) && bank.code[end] == 0 && !bank.isCode[end] {
+				if _, ok := bank.labels[bank.lowerLimit+uint64(end)]; ok {
+					break
+				}
+				end++
+			}
+			if end-wx > 1 {
+				emitLine(writer, label, fmt.Sprintf("%-10s%d", ".RES", end-wx),
+					fmt.Sprintf("%06o  to %06o", address, address+uint64(end-wx)-1))
+				wx = end - 1
+				continue
+			}
+		}
+
+		emitLine(writer, label, fmt.Sprintf("%-10s0%o", "W", word),
+			fmt.Sprintf("%06o  %012o  '%s'  '%s'",
+				address,
+				word,
+				common.FieldataToString([]uint64{word}),
+				printableAscii(common.AsciiToString([]uint64{word}))))
+	}
+}
+
+// Disassemble analyzes all the banks which have been added to the disassembler, and writes the resulting
+// source to the given writer, one segment per bank, in L,BDI order.
+func (da *Disassembler) Disassemble(writer io.Writer) {
+	bankIndices := make([]uint64, 0, len(da.banks))
+	for lbdi := range da.banks {
+		bankIndices = append(bankIndices, lbdi)
+	}
+	sort.Slice(bankIndices, func(i, j int) bool { return bankIndices[i] < bankIndices[j] })
+	for bx, lbdi := range bankIndices {
+		da.banks[lbdi].segmentNumber = bx
+	}
+
+	da.analyze()
+	for _, lbdi := range bankIndices {
+		da.disassembleBank(writer, da.banks[lbdi])
+	}
+}
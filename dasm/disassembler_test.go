@@ -0,0 +1,247 @@
+// khalehla Project
+// disassembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package dasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"khalehla/common"
+	"khalehla/hardware"
+	"khalehla/tasm"
+)
+
+const disassemblerTestSource = "         .SEG     0\n" +
+	"start    LA       A0,table\n" +
+	"         LA,U     A1,-1\n" +
+	"loop     TZ       A1\n" +
+	"         J        done\n" +
+	"         LMJ      X11,sub\n" +
+	"         SA       A0,table+2\n" +
+	"         J        loop\n" +
+	"done     IAR      0\n" +
+	"sub      AA,U     A1,1\n" +
+	"         J        0,X11\n" +
+	"table    LA       A0,0\n" +
+	"         .FD      'ABCDEF'\n" +
+	"         .RES     3\n"
+
+func linkTestExecutable(t *testing.T) *tasm.Executable {
+	sourceSet, _, _ := tasm.ParseSource("test", strings.NewReader(disassemblerTestSource))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+	a.CheckReferences()
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error assembling test source")
+	}
+
+	e := &tasm.Executable{}
+	e.LinkSimple(a.GetSegments(), true)
+	return e
+}
+
+func checkDisassembly(t *testing.T, text string, expected []string) {
+	lines := strings.Split(text, "\n")
+	for _, str := range expected {
+		found := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, str) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Error expected a line beginning with '%s'", str)
+		}
+	}
+	if t.Failed() {
+		t.Logf("%s", text)
+	}
+}
+
+func Test_Disassembler_RecoveredLabels(t *testing.T) {
+	original := linkTestExecutable(t)
+
+	//	An executable which has been saved and reloaded has no symbols
+	buffer := &bytes.Buffer{}
+	_ = original.Write(buffer)
+	e, err := tasm.ReadExecutable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	out := &bytes.Buffer{}
+	NewDisassembler().DisassembleExecutable(e, out)
+	checkDisassembly(t, out.String(), []string{
+		"L001000  LA,W      A0,L001012,,B0 ",
+		"L001002  TZ,W      A1 ",
+		"         J         L001007 ",
+		"         LMJ       X11,L001010 ",
+		"         SA,W      A0,L001014,,B0 ",
+		"L001007  IAR       00 ",
+		"L001010  AA,U      A1,01 ",
+		"L001012  W         0100000000000 ",
+		"         W         060710111213                          . 001013  060710111213  'ABCDEF'",
+		"L001014  .RES      3 ",
+	})
+}
+
+func Test_Disassembler_Symbols(t *testing.T) {
+	e := linkTestExecutable(t)
+
+	out := &bytes.Buffer{}
+	NewDisassembler().DisassembleExecutable(e, out)
+	checkDisassembly(t, out.String(), []string{
+		"START    LA,W      A0,TABLE,,B0 ",
+		"LOOP     TZ,W      A1 ",
+		"         J         DONE ",
+		"         LMJ       X11,SUB ",
+		"         SA,W      A0,L001014,,B0 ",
+		"TABLE    W         0100000000000 ",
+	})
+}
+
+func Test_Disassembler_Storage(t *testing.T) {
+	e := linkTestExecutable(t)
+
+	out := &bytes.Buffer{}
+	storage := hardware.NewMainStorage(4)
+	err := NewDisassembler().DisassembleStorage(storage, e, out)
+	if err == nil {
+		t.Fatalf("Error expected failure disassembling banks which have not been loaded")
+	}
+
+	//	Place the bank in storage as the loader would, then modify it
+	bank := e.GetBanks()[0600004]
+	segment, _ := storage.Allocate(bank.GetCodeLength())
+	words, _ := storage.GetSegment(segment)
+	for wx, word := range bank.GetCode() {
+		words[wx].SetW(word)
+	}
+	words[013].SetW(0_777777_777777)
+	bank.GetBankDescriptor().SetBaseAddress(common.NewAbsoluteAddress(segment, 0))
+
+	out = &bytes.Buffer{}
+	err = NewDisassembler().DisassembleStorage(storage, e, out)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	checkDisassembly(t, out.String(), []string{
+		"START    LA,W      A0,TABLE,,B0 ",
+		"         W         0777777777777 ",
+	})
+}
+
+// Both banks have the default lower limit, so labels recovered from addresses alone would collide.
+const multiBankTestSource = "         .SEG     1\n" +
+	"data     W        0_111111_222222\n" +
+	"         W        0\n" +
+	"         .SEG     0\n" +
+	"start    LA       A1,data,,B2\n" +
+	"         SA       A1,data+1,,B2\n" +
+	"         J        next\n" +
+	"next     IAR      0\n"
+
+func linkMultiBankExecutable(t *testing.T, source string) *tasm.Executable {
+	sourceSet, _, _ := tasm.ParseSource("test", strings.NewReader(source))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+	a.CheckReferences()
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error assembling:%s\n%s", a.GetDiagnostics().GetDiagnostics()[0].GetString(), source)
+	}
+
+	spec := tasm.NewLinkSpec().
+		AddBank(tasm.NewBankSpec(0600004, 0).SetGeneralPermissions(true, true, false)).
+		AddBank(tasm.NewBankSpec(0600005, 1).SetGeneralPermissions(false, true, true)).
+		BaseOn(0, 0600004).
+		BaseOn(2, 0600005).
+		SetStartingSymbol("start")
+	e, diagnostics := tasm.Link(a.GetSegments(), spec)
+	if diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("Error linking:%s", diagnostics.GetDiagnostics()[0].GetString())
+	}
+	return e
+}
+
+func Test_Disassembler_MultiBankReassembly(t *testing.T) {
+	original := linkMultiBankExecutable(t, multiBankTestSource)
+
+	//	Lose the symbols, so that every label has to be recovered
+	buffer := &bytes.Buffer{}
+	_ = original.Write(buffer)
+	e, err := tasm.ReadExecutable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	out := &bytes.Buffer{}
+	NewDisassembler().DisassembleExecutable(e, out)
+	checkDisassembly(t, out.String(), []string{
+		"S0L001000 LA,W      A1,S1L001000,,B2 ",
+		"S1L001000 W         0111111222222 ",
+	})
+
+	//	The recovered labels must be unique, so that the disassembly reassembles to the same banks
+	source := strings.Replace(out.String(), "S0L001000", "start", -1)
+	reassembled := linkMultiBankExecutable(t, source)
+	for lbdi, bank := range original.GetBanks() {
+		code := reassembled.GetBanks()[lbdi].GetCode()
+		for wx, word := range bank.GetCode() {
+			if code[wx] != word {
+				t.Errorf("Error bank %06o word %d is %012o, expected %012o", lbdi, wx, code[wx], word)
+			}
+		}
+	}
+}
+
+// message is a data word which happens to look like an instruction, and which nothing refers to.
+// It is not code just because it has a name.
+const dataLabelTestSource = "         .SEG     0\n" +
+	"start    LA       A0,value\n" +
+	"         J        next\n" +
+	"message  .ASC     'a,b'\n" +
+	"next     IAR      0\n" +
+	"value    W        0123\n"
+
+func Test_Disassembler_SymbolFileDataLabel(t *testing.T) {
+	sourceSet, _, _ := tasm.ParseSource("test", strings.NewReader(dataLabelTestSource))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+	a.CheckReferences()
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error assembling test source")
+	}
+
+	original := &tasm.Executable{}
+	original.LinkSimple(a.GetSegments(), true)
+
+	//	Take the symbols from a symbol file, as dasm -sym does, rather than from the executable
+	buffer := &bytes.Buffer{}
+	_ = original.Write(buffer)
+	e, err := tasm.ReadExecutable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	buffer = &bytes.Buffer{}
+	_ = original.WriteSymbols(buffer)
+	symbolTable, err := tasm.ReadSymbolTable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	out := &bytes.Buffer{}
+	NewDisassembler().SetSymbolTable(symbolTable).DisassembleExecutable(e, out)
+	checkDisassembly(t, out.String(), []string{
+		"START    LA,W      A0,VALUE,,B0 ",
+		"         J         NEXT ",
+		"MESSAGE  W         0141054142040 ",
+		"NEXT     IAR       00 ",
+		"VALUE    W         0123 ",
+	})
+}
@@ -0,0 +1,189 @@
+// khalehla Project
+// disassembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package dasm
+
+import (
+	"fmt"
+	"strings"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+// The round-trip harness verifies that the disassembler and the tiny assembler agree with one another.
+// For every slot in the instruction tables, it generates instruction words with representative values in the
+// fields which are not used to select the instruction, disassembles each word, assembles the resulting text,
+// and compares the assembled word with the original.
+
+// RoundTripFailure describes an instruction word which did not survive the round trip
+type RoundTripFailure struct {
+	basicMode bool
+	word      uint64
+	text      string
+	reason    string
+}
+
+func (rtf *RoundTripFailure) GetReason() string {
+	return rtf.reason
+}
+
+func (rtf *RoundTripFailure) GetString() string {
+	mode := "extended"
+	if rtf.basicMode {
+		mode = "basic"
+	}
+	return fmt.Sprintf("%s %012o '%s': %s", mode, rtf.word, rtf.text, rtf.reason)
+}
+
+func (rtf *RoundTripFailure) GetText() string {
+	return rtf.text
+}
+
+func (rtf *RoundTripFailure) GetWord() uint64 {
+	return rtf.word
+}
+
+func (rtf *RoundTripFailure) IsBasicMode() bool {
+	return rtf.basicMode
+}
+
+// Representative field values. The first value of each is used when some other field is being varied.
+var (
+	roundTripRegisters        = []uint64{1, 0, 5, 15}
+	roundTripPartialWords     = []uint64{common.JFieldW, common.JFieldH2, common.JFieldXH1, common.JFieldT1, common.JFieldS6}
+	roundTripImmediates       = []uint64{0_001234, 0, 0_777777}
+	roundTripBasicAddresses   = []uint64{0_001234, 0, 0_000005, 0_000015, 0_000104, 0_000200, 0_177777}
+	roundTripDisplacements    = []uint64{0_1234, 0, 0_0015, 0_0104, 0_7777}
+	roundTripJumpTargets      = []uint64{0_001234, 0, 0_177777}
+	roundTripBaseRegisters    = []uint64{0, 5, 15}
+	roundTripIndexSelections  = [][2]uint64{{0, 0}, {3, 0}, {3, 1}} // x and h
+	roundTripIndirectBasicBit = []uint64{0, 1}
+)
+
+// GenerateInstructionWords produces the instruction words which exercise every slot of the instruction table
+// for the given mode. Each word has the f-field (and where they discriminate the function, the j-field and a-field)
+// of an instruction, with the remaining fields set to representative values, one field being varied at a time.
+func GenerateInstructionWords(basicMode bool) []uint64 {
+	ft := &common.ExtendedFunctionTable
+	if basicMode {
+		ft = &common.BasicFunctionTable
+	}
+
+	words := make([]uint64, 0)
+	ft.Walk(func(ie *common.InstructionEncoding) {
+		i := ie.GetDefinition()
+
+		//	fields which select the instruction (whatever their nominal usage) are never varied
+		aValues := []uint64{ie.GetA()}
+		switch i.GetAFieldUsage() {
+		case common.ARegister, common.BRegister, common.RRegister, common.XRegister, common.AGRSComponent:
+			aValues = roundTripRegisters
+		}
+
+		jValues := []uint64{ie.GetJ()}
+		switch i.GetJFieldUsage() {
+		case common.JPartialWordDesignator:
+			jValues = roundTripPartialWords
+		case common.JGRSComponent:
+			jValues = []uint64{0, 1, 2, 4}
+		}
+
+		//	the operand portion of the word (h, i, u or h, i, b, d) for a non-indexed, non-immediate instruction
+		operands := make([]uint64, 0)
+		if i.IsUField18Bits() {
+			operands = append(operands, roundTripJumpTargets...)
+		} else if basicMode {
+			for _, i := range roundTripIndirectBasicBit {
+				for _, u := range roundTripBasicAddresses {
+					operands = append(operands, i<<16|u)
+				}
+			}
+		} else {
+			for _, b := range roundTripBaseRegisters {
+				for _, d := range roundTripDisplacements {
+					operands = append(operands, b<<12|d)
+				}
+			}
+		}
+
+		compose := func(j uint64, a uint64, x uint64, h uint64, operand uint64) uint64 {
+			return ie.GetF()<<30 | j<<26 | a<<22 | x<<18 | h<<17 | operand
+		}
+
+		a := aValues[0]
+		j := jValues[0]
+		for _, value := range aValues {
+			words = append(words, compose(j, value, 0, 0, operands[0]))
+		}
+		for _, value := range jValues[1:] {
+			words = append(words, compose(value, a, 0, 0, operands[0]))
+		}
+		for _, xh := range roundTripIndexSelections[1:] {
+			words = append(words, compose(j, a, xh[0], xh[1], operands[0]))
+		}
+		for _, operand := range operands[1:] {
+			words = append(words, compose(j, a, 0, 0, operand))
+		}
+
+		if i.GetJFieldUsage() == common.JPartialWordDesignator {
+			for _, value := range roundTripImmediates {
+				words = append(words, compose(common.JFieldU, a, 0, 0, value))
+				words = append(words, compose(common.JFieldXU, a, 0, 0, value))
+			}
+		}
+	})
+
+	return words
+}
+
+// roundTripWord disassembles the given word, assembles the resulting text, and compares the result with the word.
+// Returns nil if the round trip succeeds.
+func roundTripWord(basicMode bool, word uint64) *RoundTripFailure {
+	ft := &common.ExtendedFunctionTable
+	if basicMode {
+		ft = &common.BasicFunctionTable
+	}
+
+	iw := common.InstructionWord(word)
+	text, ok := Interpret(ft, &iw, basicMode, false)
+	text = strings.TrimSpace(text)
+	if !ok {
+		return &RoundTripFailure{basicMode, word, "", "not interpreted by dasm"}
+	}
+
+	sourceSet, diagnostics, _ := tasm.ParseSource("roundTrip", strings.NewReader("         "+text+"\n"))
+	a := tasm.NewTinyAssembler().SetBasicMode(basicMode)
+	a.Assemble(sourceSet)
+	diagnostics.Append(a.GetDiagnostics())
+	if diagnostics.GetErrorCount() > 0 {
+		reason := "rejected by tasm: " + diagnostics.GetDiagnostics()[0].GetString()
+		return &RoundTripFailure{basicMode, word, text, reason}
+	}
+
+	code := a.GetSegments()[0].GetCode()
+	if len(code) != 1 {
+		reason := fmt.Sprintf("tasm generated %d words", len(code))
+		return &RoundTripFailure{basicMode, word, text, reason}
+	} else if code[0] != word {
+		reason := fmt.Sprintf("tasm generated %012o", code[0])
+		return &RoundTripFailure{basicMode, word, text, reason}
+	}
+
+	return nil
+}
+
+// RoundTrip generates instruction words for every slot in the instruction table for the given mode,
+// and passes each of them through the disassembler and the tiny assembler.
+// Returns the words which did not survive the trip.
+func RoundTrip(basicMode bool) []*RoundTripFailure {
+	failures := make([]*RoundTripFailure, 0)
+	for _, word := range GenerateInstructionWords(basicMode) {
+		if failure := roundTripWord(basicMode, word); failure != nil {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,41 @@
+// khalehla Project
+// disassembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package dasm
+
+import (
+	"testing"
+
+	"khalehla/common"
+)
+
+func checkRoundTrip(t *testing.T, basicMode bool, ft *common.FunctionTable) {
+	//	every slot of the table must be represented among the generated words
+	slots := make(map[*common.InstructionDefinition]bool)
+	ft.Walk(func(ie *common.InstructionEncoding) {
+		slots[ie.GetDefinition()] = false
+	})
+	for _, word := range GenerateInstructionWords(basicMode) {
+		iw := common.InstructionWord(word)
+		slots[ft.Lookup(&iw)] = true
+	}
+	for definition, found := range slots {
+		if !found {
+			t.Errorf("Error no instruction word generated for %s", definition.GetMnemonic())
+		}
+	}
+
+	for _, failure := range RoundTrip(basicMode) {
+		t.Errorf("Error %s", failure.GetString())
+	}
+}
+
+func Test_RoundTrip_Basic(t *testing.T) {
+	checkRoundTrip(t, true, &common.BasicFunctionTable)
+}
+
+func Test_RoundTrip_Extended(t *testing.T) {
+	checkRoundTrip(t, false, &common.ExtendedFunctionTable)
+}
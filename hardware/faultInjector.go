@@ -0,0 +1,390 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package hardware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"khalehla/logger"
+)
+
+type FaultKind int
+
+const (
+	StorageReadFault               FaultKind = iota // a storage read fails with a hardware check
+	StorageWriteFault                               // a storage write fails with a hardware check
+	StuckBitFault                                   // some bits of a storage location always read as a fixed value
+	InstructionProcessorCheckFault                  // an instruction processor takes a hardware check between instructions
+	UPILossFault                                    // a UPI interrupt is lost in transit
+	ChannelErrorFault                               // a channel fails a channel program before starting it on the device
+	DeviceErrorFault                                // a device fails an IO which it has otherwise completed
+	faultKindCount
+)
+
+var faultKindNames = map[FaultKind]string{
+	StorageReadFault:               "storage-read",
+	StorageWriteFault:              "storage-write",
+	StuckBitFault:                  "stuck-bit",
+	InstructionProcessorCheckFault: "ip-check",
+	UPILossFault:                   "upi-loss",
+	ChannelErrorFault:              "channel-error",
+	DeviceErrorFault:               "device-error",
+}
+
+func (fk FaultKind) String() string {
+	if name, ok := faultKindNames[fk]; ok {
+		return name
+	}
+	return fmt.Sprintf("fault-%d", fk)
+}
+
+// FaultRule describes when, where, and how often a particular kind of fault is to be injected.
+//
+// Each call to one of the FaultInjector check functions which matches the rule is an opportunity.
+// The first Skip opportunities are passed over. Thereafter, if Every is non-zero the fault is injected at every
+// Every'th opportunity, otherwise it is injected with the given Probability (0.0 to 1.0) at each opportunity.
+// At most Limit faults are injected, if Limit is non-zero.
+//
+// Storage faults and stuck bits are restricted to the given Segment (unless it is negative) and to the offsets
+// from Offset to Offset+Length-1 within the segment (unless Length is zero). Stuck bits are not subject to
+// Skip, Every, Probability, or Limit - the bits in Mask always read as the corresponding bits in Value.
+//
+// Channel errors are restricted to the channel whose log name (e.g., CHDISK[3]) is Target, and device errors
+// to the device whose node identifier is Target. All other faults are restricted to the processor named by Target.
+// In every case an empty Target matches everything.
+type FaultRule struct {
+	Kind        FaultKind
+	Target      string
+	Segment     int
+	Offset      uint64
+	Length      uint64
+	Probability float64
+	Skip        uint64
+	Every       uint64
+	Limit       uint64
+	Mask        uint64
+	Value       uint64
+}
+
+// InjectedFault is the record of a single fault, as kept in the fault log
+type InjectedFault struct {
+	Sequence uint64
+	Kind     FaultKind
+	Target   string
+	Segment  uint
+	Offset   uint64
+	Detail   string
+}
+
+func (f *InjectedFault) GetString() string {
+	if f.Kind == StorageReadFault || f.Kind == StorageWriteFault || f.Kind == StuckBitFault {
+		str := fmt.Sprintf("#%d %s at %d:%012o", f.Sequence, f.Kind, f.Segment, f.Offset)
+		if len(f.Detail) > 0 {
+			str += " " + f.Detail
+		}
+		return str
+	}
+	return fmt.Sprintf("#%d %s target=%s", f.Sequence, f.Kind, f.Target)
+}
+
+type faultRuleState struct {
+	rule          FaultRule
+	opportunities uint64
+	injections    uint64
+}
+
+// FaultInjector decides when simulated hardware failures should occur, so that we can test how software running
+// on the emulator reacts to them. The various parts of the emulator ask the injector at appropriate points
+// whether they should fail - storage on reads and writes, instruction engines between instructions, channels as
+// they start and complete IOs, and so on.
+// Every fault which is injected is recorded in the fault log, and reported via the logger.
+//
+// A FaultInjector with no rules costs almost nothing, so that it can be left attached at all times.
+type FaultInjector struct {
+	mutex      sync.Mutex
+	rules      []*faultRuleState
+	ruleCounts [faultKindCount]atomic.Int32
+	random     *rand.Rand
+	log        []InjectedFault
+	sequence   uint64
+}
+
+// NewFaultInjector creates a FaultInjector with no rules, whose probabilistic decisions are based on the given seed.
+// The same rules and seed produce the same faults for the same sequence of opportunities.
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{
+		rules:  make([]*faultRuleState, 0),
+		random: rand.New(rand.NewSource(seed)),
+		log:    make([]InjectedFault, 0),
+	}
+}
+
+// AddRule adds a rule to the injector. Rules may be added at any time.
+func (fi *FaultInjector) AddRule(rule FaultRule) error {
+	if rule.Kind < 0 || rule.Kind >= faultKindCount {
+		return fmt.Errorf("invalid fault kind %d", rule.Kind)
+	} else if rule.Probability < 0.0 || rule.Probability > 1.0 {
+		return fmt.Errorf("probability %f is out of range", rule.Probability)
+	} else if rule.Kind == StuckBitFault && rule.Mask == 0 {
+		return fmt.Errorf("stuck-bit rule requires a mask")
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.rules = append(fi.rules, &faultRuleState{rule: rule})
+	fi.ruleCounts[rule.Kind].Add(1)
+	return nil
+}
+
+// ClearRules removes all the rules, leaving the fault log intact
+func (fi *FaultInjector) ClearRules() {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.rules = make([]*faultRuleState, 0)
+	for kx := range fi.ruleCounts {
+		fi.ruleCounts[kx].Store(0)
+	}
+}
+
+// ClearLog discards the fault log
+func (fi *FaultInjector) ClearLog() {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.log = make([]InjectedFault, 0)
+}
+
+// GetLog retrieves a copy of the fault log, in the order in which the faults were injected
+func (fi *FaultInjector) GetLog() []InjectedFault {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	result := make([]InjectedFault, len(fi.log))
+	copy(result, fi.log)
+	return result
+}
+
+// HasRules returns true if there are any rules for the given kind of fault
+func (fi *FaultInjector) HasRules(kind FaultKind) bool {
+	return fi.ruleCounts[kind].Load() > 0
+}
+
+// Check is invoked at each opportunity for a processor, channel, or device fault of the given kind.
+// Returns true if the fault is to be injected, in which case it has already been logged.
+func (fi *FaultInjector) Check(kind FaultKind, target string) bool {
+	if !fi.HasRules(kind) {
+		return false
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	for _, state := range fi.rules {
+		if state.rule.Kind == kind && (state.rule.Target == "" || state.rule.Target == target) && fi.trigger(state) {
+			fi.record(InjectedFault{Kind: kind, Target: target})
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStorage is invoked at each opportunity for a storage read or write fault at the given location.
+// Returns true if the fault is to be injected, in which case it has already been logged.
+func (fi *FaultInjector) CheckStorage(kind FaultKind, segment uint, offset uint64) bool {
+	if !fi.HasRules(kind) {
+		return false
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	for _, state := range fi.rules {
+		if state.rule.Kind == kind && state.rule.matchesAddress(segment, offset) && fi.trigger(state) {
+			fi.record(InjectedFault{Kind: kind, Segment: segment, Offset: offset})
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyStuckBits returns the given value as read from the given location, with any stuck bits applied.
+// A fault is logged only if the value is actually changed.
+func (fi *FaultInjector) ApplyStuckBits(segment uint, offset uint64, value uint64) uint64 {
+	if !fi.HasRules(StuckBitFault) {
+		return value
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	result := value
+	for _, state := range fi.rules {
+		if state.rule.Kind == StuckBitFault && state.rule.matchesAddress(segment, offset) {
+			result = (result &^ state.rule.Mask) | (state.rule.Value & state.rule.Mask)
+		}
+	}
+
+	if result != value {
+		fi.record(InjectedFault{
+			Kind:    StuckBitFault,
+			Segment: segment,
+			Offset:  offset,
+			Detail:  fmt.Sprintf("%012o->%012o", value, result),
+		})
+	}
+	return result
+}
+
+func (rule *FaultRule) matchesAddress(segment uint, offset uint64) bool {
+	if rule.Segment >= 0 && uint(rule.Segment) != segment {
+		return false
+	}
+	return rule.Length == 0 || (offset >= rule.Offset && offset < rule.Offset+rule.Length)
+}
+
+// trigger counts an opportunity for the given rule, and decides whether it results in a fault.
+// Must be invoked with the mutex held.
+func (fi *FaultInjector) trigger(state *faultRuleState) bool {
+	state.opportunities++
+	if state.opportunities <= state.rule.Skip {
+		return false
+	}
+	if state.rule.Limit > 0 && state.injections >= state.rule.Limit {
+		return false
+	}
+
+	var fire bool
+	if state.rule.Every > 0 {
+		fire = (state.opportunities-state.rule.Skip)%state.rule.Every == 0
+	} else {
+		fire = fi.random.Float64() < state.rule.Probability
+	}
+
+	if fire {
+		state.injections++
+	}
+	return fire
+}
+
+// record adds a fault to the log. Must be invoked with the mutex held.
+func (fi *FaultInjector) record(fault InjectedFault) {
+	fi.sequence++
+	fault.Sequence = fi.sequence
+	fi.log = append(fi.log, fault)
+	logger.LogWarningF("FaultInjector", "Injected %s", fault.GetString())
+}
+
+// Configuration -------------------------------------------------------------------------------------------------------
+
+// LoadFile reads rules from the given configuration file - see Load
+func (fi *FaultInjector) LoadFile(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return fi.Load(file)
+}
+
+// Load reads rules from a configuration source. Each non-blank line which does not begin with '#'
+// contains a fault kind (as produced by FaultKind.String()) followed by any number of key=value settings
+// corresponding to the fields of FaultRule:
+//
+//	target=IP0  segment=3  offset=01000  length=010  probability=0.001
+//	skip=100  every=1000  limit=1  mask=01  value=01
+//
+// Integers are decimal unless they begin with 0 (octal) or 0x (hexadecimal).
+// A line consisting of 'seed' and an integer reseeds the random number generator.
+func (fi *FaultInjector) Load(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "seed" {
+			if len(fields) != 2 {
+				return fmt.Errorf("line %d: seed requires a single value", lineNumber)
+			}
+			seed, err := strconv.ParseInt(fields[1], 0, 64)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid seed %s", lineNumber, fields[1])
+			}
+			fi.mutex.Lock()
+			fi.random = rand.New(rand.NewSource(seed))
+			fi.mutex.Unlock()
+			continue
+		}
+
+		rule, err := parseFaultRule(fields)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineNumber, err.Error())
+		}
+
+		err = fi.AddRule(*rule)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", lineNumber, err.Error())
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseFaultRule(fields []string) (*FaultRule, error) {
+	rule := &FaultRule{Kind: -1, Segment: -1}
+	for kind, name := range faultKindNames {
+		if name == fields[0] {
+			rule.Kind = kind
+		}
+	}
+	if rule.Kind < 0 {
+		return nil, fmt.Errorf("unknown fault kind %s", fields[0])
+	}
+
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("expected key=value, found %s", field)
+		}
+
+		var err error
+		switch key {
+		case "target":
+			rule.Target = value
+		case "segment":
+			rule.Segment, err = strconv.Atoi(value)
+		case "offset":
+			rule.Offset, err = strconv.ParseUint(value, 0, 64)
+		case "length":
+			rule.Length, err = strconv.ParseUint(value, 0, 64)
+		case "probability":
+			rule.Probability, err = strconv.ParseFloat(value, 64)
+		case "skip":
+			rule.Skip, err = strconv.ParseUint(value, 0, 64)
+		case "every":
+			rule.Every, err = strconv.ParseUint(value, 0, 64)
+		case "limit":
+			rule.Limit, err = strconv.ParseUint(value, 0, 64)
+		case "mask":
+			rule.Mask, err = strconv.ParseUint(value, 0, 64)
+		case "value":
+			rule.Value, err = strconv.ParseUint(value, 0, 64)
+		default:
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,172 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package hardware
+
+import (
+	"strings"
+	"testing"
+
+	"khalehla/common"
+)
+
+func Test_FaultInjector_Schedule(t *testing.T) {
+	fi := NewFaultInjector(0)
+	err := fi.AddRule(FaultRule{Kind: InstructionProcessorCheckFault, Target: "IP0", Skip: 3, Every: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	fired := make([]int, 0)
+	for x := 1; x <= 20; x++ {
+		if fi.Check(InstructionProcessorCheckFault, "IP1") {
+			t.Fatalf("Error fault injected for the wrong target")
+		}
+		if fi.Check(InstructionProcessorCheckFault, "IP0") {
+			fired = append(fired, x)
+		}
+	}
+
+	if len(fired) != 2 || fired[0] != 5 || fired[1] != 7 {
+		t.Fatalf("Error expected faults at opportunities 5 and 7, got %v", fired)
+	}
+
+	log := fi.GetLog()
+	if len(log) != 2 || log[0].Kind != InstructionProcessorCheckFault || log[1].Target != "IP0" || log[1].Sequence != 2 {
+		t.Fatalf("Error unexpected fault log %v", log)
+	}
+}
+
+func Test_FaultInjector_ProbabilityIsRepeatable(t *testing.T) {
+	run := func() []bool {
+		fi := NewFaultInjector(12345)
+		_ = fi.AddRule(FaultRule{Kind: InstructionProcessorCheckFault, Probability: 0.25})
+		result := make([]bool, 1000)
+		for x := range result {
+			result[x] = fi.Check(InstructionProcessorCheckFault, "IP0")
+		}
+		return result
+	}
+
+	first := run()
+	second := run()
+	count := 0
+	for x := range first {
+		if first[x] != second[x] {
+			t.Fatalf("Error runs differ at opportunity %d", x)
+		}
+		if first[x] {
+			count++
+		}
+	}
+
+	if count < 150 || count > 350 {
+		t.Fatalf("Error expected about 250 faults, got %d", count)
+	}
+}
+
+func Test_FaultInjector_Storage(t *testing.T) {
+	ms := NewMainStorage(4)
+	seg, _ := ms.Allocate(01000)
+	fi := NewFaultInjector(0)
+	_ = fi.AddRule(FaultRule{Kind: StorageWriteFault, Segment: int(seg), Offset: 0100, Length: 010, Every: 1})
+	_ = fi.AddRule(FaultRule{Kind: StuckBitFault, Segment: -1, Offset: 0200, Length: 1, Mask: 0_000000_000017, Value: 05})
+	ms.SetFaultInjector(fi)
+
+	if ms.CheckWriteFault(common.NewAbsoluteAddress(seg, 077)) != nil {
+		t.Fatalf("Error write fault injected outside the range")
+	}
+	if ms.CheckReadFault(common.NewAbsoluteAddress(seg, 0100)) != nil {
+		t.Fatalf("Error read fault injected by a write rule")
+	}
+
+	i := ms.CheckWriteFault(common.NewAbsoluteAddress(seg, 0107))
+	if i == nil || i.GetClass() != common.HardwareCheckInterruptClass {
+		t.Fatalf("Error expected a hardware check, got %s", common.GetInterruptString(i))
+	}
+
+	value := ms.ApplyStuckBits(common.NewAbsoluteAddress(seg, 0200), 0_777777_777770)
+	if value != 0_777777_777765 {
+		t.Fatalf("Error expected stuck bits to produce 0777777777765, got %012o", value)
+	}
+	value = ms.ApplyStuckBits(common.NewAbsoluteAddress(seg, 0200), 0_123456_701225)
+	if value != 0_123456_701225 {
+		t.Fatalf("Error expected unchanged value, got %012o", value)
+	}
+
+	// one write fault, one stuck bit change - the unchanged read is not logged
+	if len(fi.GetLog()) != 2 {
+		t.Fatalf("Error expected 2 faults logged, got %d", len(fi.GetLog()))
+	}
+
+	ms.SetFaultInjector(nil)
+	if ms.CheckWriteFault(common.NewAbsoluteAddress(seg, 0107)) != nil {
+		t.Fatalf("Error fault injected with no injector")
+	}
+}
+
+func Test_FaultInjector_ChannelAndDevice(t *testing.T) {
+	fi := NewFaultInjector(0)
+	_ = fi.AddRule(FaultRule{Kind: ChannelErrorFault, Target: "CHTAPE[2]", Every: 2})
+	_ = fi.AddRule(FaultRule{Kind: DeviceErrorFault, Target: "7", Probability: 1.0, Limit: 1})
+
+	expected := []bool{false, true, false, true}
+	for x, exp := range expected {
+		if fi.Check(ChannelErrorFault, "CHDISK[2]") {
+			t.Fatalf("Error channel fault injected for the wrong channel")
+		}
+		if fi.Check(ChannelErrorFault, "CHTAPE[2]") != exp {
+			t.Fatalf("Error channel opportunity %d expected %v", x, exp)
+		}
+	}
+
+	if fi.Check(DeviceErrorFault, "6") || !fi.Check(DeviceErrorFault, "7") || fi.Check(DeviceErrorFault, "7") {
+		t.Fatalf("Error device fault not injected once, for device 7 only")
+	}
+
+	log := fi.GetLog()
+	if len(log) != 3 {
+		t.Fatalf("Error expected 3 faults logged, got %d", len(log))
+	}
+	if log[2].GetString() != "#3 device-error target=7" {
+		t.Fatalf("Error unexpected log entry %s", log[2].GetString())
+	}
+}
+
+func Test_FaultInjector_Load(t *testing.T) {
+	config := `
+# a sample configuration
+seed 42
+storage-read  segment=2 offset=01000 length=010 probability=0.5
+stuck-bit     segment=2 offset=01004 length=1 mask=0400000000000 value=0400000000000
+upi-loss      target=IP0 every=10 limit=1
+channel-error target=CHDISK[3] every=2
+device-error  target=5 limit=1 probability=1.0
+`
+	fi := NewFaultInjector(0)
+	err := fi.Load(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	if !fi.HasRules(StorageReadFault) || !fi.HasRules(StuckBitFault) || !fi.HasRules(UPILossFault) {
+		t.Fatalf("Error expected rules to be loaded")
+	}
+	if !fi.HasRules(ChannelErrorFault) || !fi.HasRules(DeviceErrorFault) {
+		t.Fatalf("Error expected channel and device rules to be loaded")
+	}
+	if fi.HasRules(InstructionProcessorCheckFault) {
+		t.Fatalf("Error unexpected ip-check rule")
+	}
+
+	if fi.ApplyStuckBits(2, 01004, 0) != 0_400000_000000 {
+		t.Fatalf("Error stuck bit rule not loaded correctly")
+	}
+
+	for _, bad := range []string{"bogus-fault", "ip-check every=x", "ip-check color=red", "stuck-bit segment=1", "seed", "device-error mask"} {
+		if NewFaultInjector(0).Load(strings.NewReader(bad)) == nil {
+			t.Errorf("Error expected '%s' to be rejected", bad)
+		}
+	}
+}
@@ -7,21 +7,31 @@ package hardware
 import (
 	"fmt"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"khalehla/common"
 )
 
 type MainStorageClient interface{}
 
-const waitTime = time.Millisecond
+// number of independently-locked shards in the storage lock table - must be a power of two
+const storageLockShardCount = 64
 
 type MainStorage struct {
-	segmentMap         map[uint][]common.Word36
+	// segment table - readers load the slice pointers atomically, and never take a lock.
+	// writers (Allocate, Release, Resize, Clear) serialize on allocMutex.
+	segments           []atomic.Pointer[[]common.Word36]
 	freeSegmentIndices []uint
+	highWater          uint // index one past the highest segment index ever allocated (since the last Clear)
 	maxIndices         uint
-	locks              map[storageLockKey]StorageLockClient
-	mutex              sync.Mutex
+	allocMutex         sync.Mutex
+
+	// storage lock table - split into shards keyed by virtual address, each with its own mutex and condition
+	lockShards [storageLockShardCount]storageLockShard
+	lockCount  atomic.Int64 // total number of locks held across all shards
+
+	// if not nil, decides when simulated storage failures occur - see faultInjector.go
+	faultInjector atomic.Pointer[FaultInjector]
 }
 
 type StorageLockClient interface {
@@ -34,6 +44,21 @@ func newStorageLockKey(address common.VirtualAddress) storageLockKey {
 	return storageLockKey(address.GetComposite())
 }
 
+// storageLockShard is one portion of the storage lock table.
+// Waiters in LockWait block on the condition, and are woken whenever a lock in the shard is released.
+type storageLockShard struct {
+	mutex     sync.Mutex
+	condition *sync.Cond
+	locks     map[storageLockKey]StorageLockClient
+	count     atomic.Int64
+}
+
+func (ms *MainStorage) getLockShard(key storageLockKey) *storageLockShard {
+	// mix the bits a bit, so that consecutive addresses in the same bank land in different shards
+	hash := uint64(key) * 0x9E3779B97F4A7C15
+	return &ms.lockShards[hash>>58&(storageLockShardCount-1)]
+}
+
 // NewMainStorage creates one of these entities.
 // There should be exactly one, shared among all the InstructionEngine instances.
 // This struct serves two purposes.
@@ -43,54 +68,67 @@ func newStorageLockKey(address common.VirtualAddress) storageLockKey {
 // via operating system calls to a service instruction intended for the purpose.
 // 2) The storage lock table protects the integrity of the following instructions:
 // ADD1, CR, DEC, DEC2, ENZ, INC, INC2, SUB1, TCS, TS, TSS
+//
+// Storage references (GetSegment, GetSlice, GetWordFromAddress) do not take any lock, so that any number
+// of InstructionEngine instances may reference storage concurrently. The storage lock table is sharded so that
+// engines locking unrelated addresses do not contend with one another.
 func NewMainStorage(maxIndices uint) *MainStorage {
-	ms := MainStorage{
-		segmentMap:         make(map[uint][]common.Word36),
+	ms := &MainStorage{
+		segments:           make([]atomic.Pointer[[]common.Word36], maxIndices),
 		freeSegmentIndices: make([]uint, 0),
 		maxIndices:         maxIndices,
-		locks:              make(map[storageLockKey]StorageLockClient),
-		mutex:              sync.Mutex{},
 	}
-	return &ms
+
+	for sx := range ms.lockShards {
+		shard := &ms.lockShards[sx]
+		shard.condition = sync.NewCond(&shard.mutex)
+		shard.locks = make(map[storageLockKey]StorageLockClient)
+	}
+
+	return ms
 }
 
 // Allocate obtains a storage segment of the indicated type, returning the index of the segment.
 // May be invoked by a service processor for pre-loading memory prior to booting the system,
 // or by an instruction processor as part of executing a service instruction designed for that purpose.
+// Segment indices which have been released are re-used before any new index is handed out.
 func (ms *MainStorage) Allocate(length uint64) (uint, error) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
-	if uint(len(ms.segmentMap)) == ms.maxIndices {
-		return 0, fmt.Errorf("main storage segment table is full")
-	}
+	ms.allocMutex.Lock()
+	defer ms.allocMutex.Unlock()
 
 	var seg uint
-	if len(ms.freeSegmentIndices) == 0 {
-		seg = uint(len(ms.segmentMap))
-	} else {
+	if len(ms.freeSegmentIndices) > 0 {
 		ix := len(ms.freeSegmentIndices) - 1
 		seg = ms.freeSegmentIndices[ix]
-		ms.freeSegmentIndices = ms.freeSegmentIndices[:]
+		ms.freeSegmentIndices = ms.freeSegmentIndices[:ix]
+	} else if ms.highWater < ms.maxIndices {
+		seg = ms.highWater
+		ms.highWater++
+	} else {
+		return 0, fmt.Errorf("main storage segment table is full")
 	}
 
-	ms.segmentMap[seg] = make([]common.Word36, length)
+	slice := make([]common.Word36, length)
+	ms.segments[seg].Store(&slice)
 	return seg, nil
 }
 
 // Clear will ensure the entire storage is removed
 func (ms *MainStorage) Clear() {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	ms.allocMutex.Lock()
+	defer ms.allocMutex.Unlock()
 
+	for sx := uint(0); sx < ms.highWater; sx++ {
+		ms.segments[sx].Store(nil)
+	}
 	ms.freeSegmentIndices = make([]uint, 0)
-	ms.segmentMap = make(map[uint][]common.Word36)
+	ms.highWater = 0
 }
 
 // Dump will display the content of memory to stdout - used only for debugging
 func (ms *MainStorage) Dump() {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	ms.allocMutex.Lock()
+	defer ms.allocMutex.Unlock()
 
 	fmt.Printf("Main Storage Dump ----------------------\n")
 
@@ -104,7 +142,13 @@ func (ms *MainStorage) Dump() {
 		fmt.Printf("    none\n")
 	}
 
-	for index, slice := range ms.segmentMap {
+	for index := uint(0); index < ms.highWater; index++ {
+		ptr := ms.segments[index].Load()
+		if ptr == nil {
+			continue
+		}
+
+		slice := *ptr
 		fmt.Printf("  Segment %d:\n", index)
 		for ix := 0; ix < len(slice); ix += 8 {
 			fmt.Printf("    %08o:  ", ix)
@@ -119,31 +163,41 @@ func (ms *MainStorage) Dump() {
 		}
 	}
 
-	for value, client := range ms.locks {
-		fmt.Printf("    %012o:%s\n", value, client.GetStorageLockClientName())
+	for sx := range ms.lockShards {
+		shard := &ms.lockShards[sx]
+		shard.mutex.Lock()
+		for value, client := range shard.locks {
+			fmt.Printf("    %012o:%s\n", value, client.GetStorageLockClientName())
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+// getSegmentWorker retrieves the segment with the given index without taking any lock.
+func (ms *MainStorage) getSegmentWorker(segmentIndex uint) (segment []common.Word36, ok bool) {
+	if segmentIndex >= ms.maxIndices {
+		return nil, false
+	}
+
+	ptr := ms.segments[segmentIndex].Load()
+	if ptr == nil {
+		return nil, false
 	}
+
+	return *ptr, true
 }
 
-func (ms *MainStorage) getSegmentWorker(segmentIndex uint) (segment []common.Word36, interrupt common.Interrupt) {
+func (ms *MainStorage) GetSegment(segmentIndex uint) (segment []common.Word36, interrupt common.Interrupt) {
 	var ok bool
-	segment, ok = ms.segmentMap[segmentIndex]
+	segment, ok = ms.getSegmentWorker(segmentIndex)
 	if !ok {
 		interrupt = common.NewHardwareCheckInterrupt(common.NewAbsoluteAddress(segmentIndex, 0))
 	}
 	return
 }
 
-func (ms *MainStorage) GetSegment(segmentIndex uint) (segment []common.Word36, interrupt common.Interrupt) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-	return ms.getSegmentWorker(segmentIndex)
-}
-
 func (ms *MainStorage) GetSlice(segmentIndex uint, offset uint64, length uint64) (slice []common.Word36, interrupt common.Interrupt) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
-	segment, ok := ms.segmentMap[segmentIndex]
+	segment, ok := ms.getSegmentWorker(segmentIndex)
 	if !ok {
 		interrupt = common.NewHardwareCheckInterrupt(common.NewAbsoluteAddress(segmentIndex, offset))
 		return
@@ -165,15 +219,12 @@ func (ms *MainStorage) GetSliceFromAddress(absAddr *common.AbsoluteAddress, leng
 var zero = common.Word36(0)
 
 func (ms *MainStorage) GetWordFromAddress(absAddr *common.AbsoluteAddress) (word *common.Word36, interrupt common.Interrupt) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
 	word = &zero
 	interrupt = nil
 
-	var segment []common.Word36
-	segment, interrupt = ms.getSegmentWorker(absAddr.GetSegment())
-	if interrupt != nil {
+	segment, ok := ms.getSegmentWorker(absAddr.GetSegment())
+	if !ok {
+		interrupt = common.NewHardwareCheckInterrupt(common.NewAbsoluteAddress(absAddr.GetSegment(), 0))
 		return
 	}
 
@@ -187,13 +238,52 @@ func (ms *MainStorage) GetWordFromAddress(absAddr *common.AbsoluteAddress) (word
 	return
 }
 
+// GetFaultInjector retrieves the fault injector for the storage complex, or nil if there is none
+func (ms *MainStorage) GetFaultInjector() *FaultInjector {
+	return ms.faultInjector.Load()
+}
+
+// SetFaultInjector establishes (or, if nil, removes) the fault injector for the storage complex.
+// The same injector is used by the processors attached to this storage.
+func (ms *MainStorage) SetFaultInjector(injector *FaultInjector) {
+	ms.faultInjector.Store(injector)
+}
+
+// CheckReadFault is invoked by a processor before reading from the given location.
+// Returns a hardware check interrupt if a storage read fault is to be injected, else nil.
+func (ms *MainStorage) CheckReadFault(absAddr *common.AbsoluteAddress) common.Interrupt {
+	return ms.checkFault(StorageReadFault, absAddr)
+}
+
+// CheckWriteFault is invoked by a processor before writing to the given location.
+// Returns a hardware check interrupt if a storage write fault is to be injected, else nil.
+func (ms *MainStorage) CheckWriteFault(absAddr *common.AbsoluteAddress) common.Interrupt {
+	return ms.checkFault(StorageWriteFault, absAddr)
+}
+
+func (ms *MainStorage) checkFault(kind FaultKind, absAddr *common.AbsoluteAddress) common.Interrupt {
+	injector := ms.faultInjector.Load()
+	if injector != nil && injector.CheckStorage(kind, absAddr.GetSegment(), absAddr.GetOffset()) {
+		return common.NewHardwareCheckInterrupt(absAddr)
+	}
+	return nil
+}
+
+// ApplyStuckBits returns the given value, which was read from the given location, as modified by any stuck bits
+func (ms *MainStorage) ApplyStuckBits(absAddr *common.AbsoluteAddress, value uint64) uint64 {
+	injector := ms.faultInjector.Load()
+	if injector == nil {
+		return value
+	}
+	return injector.ApplyStuckBits(absAddr.GetSegment(), absAddr.GetOffset(), value)
+}
+
 func (ms *MainStorage) Release(segmentIndex uint) (interrupt common.Interrupt) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	ms.allocMutex.Lock()
+	defer ms.allocMutex.Unlock()
 
-	_, ok := ms.segmentMap[segmentIndex]
-	if ok {
-		delete(ms.segmentMap, segmentIndex)
+	if _, ok := ms.getSegmentWorker(segmentIndex); ok {
+		ms.segments[segmentIndex].Store(nil)
 		ms.freeSegmentIndices = append(ms.freeSegmentIndices, segmentIndex)
 	} else {
 		interrupt = common.NewHardwareCheckInterrupt(common.NewAbsoluteAddress(segmentIndex, 0))
@@ -202,81 +292,114 @@ func (ms *MainStorage) Release(segmentIndex uint) (interrupt common.Interrupt) {
 	return
 }
 
+// Resize changes the size of a segment. The content is copied to the new segment, so any slices previously
+// obtained for the segment continue to refer to the old content.
 func (ms *MainStorage) Resize(segmentIndex uint, length uint64) (interrupt common.Interrupt) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	ms.allocMutex.Lock()
+	defer ms.allocMutex.Unlock()
 
-	slice, ok := ms.segmentMap[segmentIndex]
+	slice, ok := ms.getSegmentWorker(segmentIndex)
 	if !ok {
 		interrupt = common.NewHardwareCheckInterrupt(common.NewAbsoluteAddress(segmentIndex, 0))
 		return
 	}
 
-	if length > uint64(len(slice)) {
-		extension := make([]common.Word36, length-uint64(len(slice)))
-		ms.segmentMap[segmentIndex] = append(slice, extension...)
-	} else if length < uint64(len(slice)) {
+	if length != uint64(len(slice)) {
 		dst := make([]common.Word36, length)
 		copy(dst, slice)
-		ms.segmentMap[segmentIndex] = dst
+		ms.segments[segmentIndex].Store(&dst)
 	}
 
 	return
 }
 
+// Lock attempts to obtain the storage lock for the given address on behalf of the given client.
+// Returns false if some client (including the requesting client) already holds the lock.
 func (ms *MainStorage) Lock(address common.VirtualAddress, client StorageLockClient) bool {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
 	key := newStorageLockKey(address)
-	_, ok := ms.locks[key]
-	if ok {
+	shard := ms.getLockShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if _, ok := shard.locks[key]; ok {
 		return false
 	}
 
-	ms.locks[key] = client
+	ms.putLock(shard, key, client)
 	return true
 }
 
+// LockWait obtains the storage lock for the given address on behalf of the given client,
+// waiting for the lock to be released by its current holder if necessary.
 func (ms *MainStorage) LockWait(address common.VirtualAddress, client StorageLockClient) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
-	for true {
-		key := newStorageLockKey(address)
-		_, ok := ms.locks[key]
-		if ok {
-			ms.mutex.Unlock()
-			time.Sleep(waitTime)
-			ms.mutex.Lock()
-		} else {
-			ms.locks[key] = client
+	key := newStorageLockKey(address)
+	shard := ms.getLockShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	for {
+		if _, ok := shard.locks[key]; !ok {
+			ms.putLock(shard, key, client)
 			return
 		}
+		shard.condition.Wait()
 	}
 }
 
 func (ms *MainStorage) ReleaseLocks(address common.VirtualAddress, client StorageLockClient) bool {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
-
 	key := newStorageLockKey(address)
-	lockClient, ok := ms.locks[key]
+	shard := ms.getLockShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	lockClient, ok := shard.locks[key]
 	if ok && lockClient == client {
-		delete(ms.locks, key)
+		ms.removeLock(shard, key)
+		shard.condition.Broadcast()
 		return true
 	} else {
 		return false
 	}
 }
 
+// ReleaseAllLocks releases all the storage locks held by the given client.
+// This is invoked at the end of every instruction, so we go to some trouble to make it cheap
+// when (as is nearly always the case) no locks are held.
 func (ms *MainStorage) ReleaseAllLocks(client StorageLockClient) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	if ms.lockCount.Load() == 0 {
+		return
+	}
 
-	for key, lockClient := range ms.locks {
-		if lockClient == client {
-			delete(ms.locks, key)
+	for sx := range ms.lockShards {
+		shard := &ms.lockShards[sx]
+		if shard.count.Load() == 0 {
+			continue
 		}
+
+		shard.mutex.Lock()
+		released := false
+		for key, lockClient := range shard.locks {
+			if lockClient == client {
+				ms.removeLock(shard, key)
+				released = true
+			}
+		}
+		if released {
+			shard.condition.Broadcast()
+		}
+		shard.mutex.Unlock()
 	}
 }
+
+// putLock and removeLock must be invoked with the shard mutex held
+func (ms *MainStorage) putLock(shard *storageLockShard, key storageLockKey, client StorageLockClient) {
+	shard.locks[key] = client
+	shard.count.Add(1)
+	ms.lockCount.Add(1)
+}
+
+func (ms *MainStorage) removeLock(shard *storageLockShard, key storageLockKey) {
+	delete(shard.locks, key)
+	shard.count.Add(-1)
+	ms.lockCount.Add(-1)
+}
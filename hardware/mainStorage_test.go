@@ -0,0 +1,266 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package hardware
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"khalehla/common"
+)
+
+type testLockClient struct {
+	name string
+}
+
+func (c *testLockClient) GetStorageLockClientName() string {
+	return c.name
+}
+
+func Test_Allocate_ReusesReleasedIndices(t *testing.T) {
+	ms := NewMainStorage(4)
+	for sx := uint(0); sx < 4; sx++ {
+		seg, err := ms.Allocate(16)
+		if err != nil {
+			t.Fatalf("Error:%s", err.Error())
+		}
+		if seg != sx {
+			t.Fatalf("Error expected segment %d, got %d", sx, seg)
+		}
+	}
+
+	_, err := ms.Allocate(16)
+	if err == nil {
+		t.Fatalf("Error expected segment table to be full")
+	}
+
+	if ms.Release(1) != nil || ms.Release(2) != nil {
+		t.Fatalf("Error releasing segments")
+	}
+
+	seen := make(map[uint]bool)
+	for x := 0; x < 2; x++ {
+		seg, err := ms.Allocate(8)
+		if err != nil {
+			t.Fatalf("Error:%s", err.Error())
+		}
+		if seg != 1 && seg != 2 {
+			t.Fatalf("Error expected a released segment index, got %d", seg)
+		}
+		seen[seg] = true
+	}
+
+	if len(seen) != 2 {
+		t.Fatalf("Error expected each released index to be handed out once, got %v", seen)
+	}
+
+	_, err = ms.Allocate(16)
+	if err == nil {
+		t.Fatalf("Error expected segment table to be full")
+	}
+}
+
+func Test_GetWordFromAddress_Limits(t *testing.T) {
+	ms := NewMainStorage(4)
+	seg, _ := ms.Allocate(8)
+	slice, _ := ms.GetSegment(seg)
+	slice[7].SetW(0_112233_445566)
+
+	word, interrupt := ms.GetWordFromAddress(common.NewAbsoluteAddress(seg, 7))
+	if interrupt != nil {
+		t.Fatalf("Error:%s", common.GetInterruptString(interrupt))
+	}
+	if word.GetW() != 0_112233_445566 {
+		t.Fatalf("Error expected %012o, got %012o", 0_112233_445566, word.GetW())
+	}
+
+	_, interrupt = ms.GetWordFromAddress(common.NewAbsoluteAddress(seg, 8))
+	if interrupt == nil {
+		t.Fatalf("Error expected interrupt for offset beyond segment")
+	}
+
+	_, interrupt = ms.GetWordFromAddress(common.NewAbsoluteAddress(3, 0))
+	if interrupt == nil {
+		t.Fatalf("Error expected interrupt for unallocated segment")
+	}
+
+	_, interrupt = ms.GetWordFromAddress(common.NewAbsoluteAddress(100, 0))
+	if interrupt == nil {
+		t.Fatalf("Error expected interrupt for segment index beyond table")
+	}
+}
+
+func Test_Resize_PreservesContent(t *testing.T) {
+	ms := NewMainStorage(4)
+	seg, _ := ms.Allocate(4)
+	slice, _ := ms.GetSegment(seg)
+	for x := range slice {
+		slice[x].SetW(uint64(x + 1))
+	}
+
+	ms.Resize(seg, 8)
+	slice, _ = ms.GetSegment(seg)
+	if len(slice) != 8 || slice[3].GetW() != 4 || slice[4].GetW() != 0 {
+		t.Fatalf("Error resize up did not preserve content: %v", slice)
+	}
+
+	ms.Resize(seg, 2)
+	slice, _ = ms.GetSegment(seg)
+	if len(slice) != 2 || slice[1].GetW() != 2 {
+		t.Fatalf("Error resize down did not preserve content: %v", slice)
+	}
+}
+
+func Test_Lock_Exclusive(t *testing.T) {
+	ms := NewMainStorage(4)
+	c1 := &testLockClient{"C1"}
+	c2 := &testLockClient{"C2"}
+	addr := common.NewExtendedModeVirtualAddress(6, 4, 01000)
+
+	if !ms.Lock(addr, c1) {
+		t.Fatalf("Error expected C1 to obtain lock")
+	}
+	if ms.Lock(addr, c2) {
+		t.Fatalf("Error expected C2 to be refused lock")
+	}
+	if ms.ReleaseLocks(addr, c2) {
+		t.Fatalf("Error expected C2 to be unable to release C1's lock")
+	}
+	if !ms.ReleaseLocks(addr, c1) {
+		t.Fatalf("Error expected C1 to release its lock")
+	}
+	if !ms.Lock(addr, c2) {
+		t.Fatalf("Error expected C2 to obtain lock")
+	}
+
+	ms.ReleaseAllLocks(c2)
+	if !ms.Lock(addr, c1) {
+		t.Fatalf("Error expected C1 to obtain lock after ReleaseAllLocks")
+	}
+}
+
+func Test_LockWait_WakesOnRelease(t *testing.T) {
+	ms := NewMainStorage(4)
+	c1 := &testLockClient{"C1"}
+	c2 := &testLockClient{"C2"}
+	addr := common.NewExtendedModeVirtualAddress(6, 4, 01000)
+
+	ms.Lock(addr, c1)
+
+	var acquired atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		ms.LockWait(addr, c2)
+		acquired.Store(true)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if acquired.Load() {
+		t.Fatalf("Error C2 obtained a lock held by C1")
+	}
+
+	ms.ReleaseAllLocks(c1)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Error C2 was not woken when C1 released the lock")
+	}
+
+	if ms.Lock(addr, c1) {
+		t.Fatalf("Error expected C2 to hold the lock")
+	}
+}
+
+// Test_LockWait_Contention has several clients repeatedly increment a shared word under a storage lock.
+func Test_LockWait_Contention(t *testing.T) {
+	ms := NewMainStorage(4)
+	seg, _ := ms.Allocate(1)
+	absAddr := common.NewAbsoluteAddress(seg, 0)
+	addr := common.NewExtendedModeVirtualAddress(6, 4, 0)
+
+	clientCount := 8
+	iterations := 1000
+	wg := sync.WaitGroup{}
+	for cx := 0; cx < clientCount; cx++ {
+		wg.Add(1)
+		go func(client StorageLockClient) {
+			defer wg.Done()
+			for ix := 0; ix < iterations; ix++ {
+				ms.LockWait(addr, client)
+				word, _ := ms.GetWordFromAddress(absAddr)
+				word.SetW(word.GetW() + 1)
+				ms.ReleaseAllLocks(client)
+			}
+		}(&testLockClient{fmt.Sprintf("C%d", cx)})
+	}
+	wg.Wait()
+
+	word, _ := ms.GetWordFromAddress(absAddr)
+	if word.GetW() != uint64(clientCount*iterations) {
+		t.Fatalf("Error expected %d, got %d", clientCount*iterations, word.GetW())
+	}
+}
+
+//	Benchmarks ---------------------------------------------------------------------------------------------------------
+
+// benchmarkEngines simulates the storage traffic of the given number of instruction engines.
+// Each engine fetches words from a shared code segment and reads/writes words in its own data segment,
+// and occasionally takes and releases a storage lock (as would be done by TS, INC, etc.).
+func benchmarkEngines(b *testing.B, engineCount int) {
+	ms := NewMainStorage(uint(engineCount + 1))
+	codeSeg, _ := ms.Allocate(4096)
+	dataSegs := make([]uint, engineCount)
+	for ex := range dataSegs {
+		dataSegs[ex], _ = ms.Allocate(4096)
+	}
+
+	b.ResetTimer()
+	wg := sync.WaitGroup{}
+	perEngine := b.N/engineCount + 1
+	for ex := 0; ex < engineCount; ex++ {
+		wg.Add(1)
+		go func(ex int) {
+			defer wg.Done()
+			client := &testLockClient{fmt.Sprintf("IP%d", ex)}
+			codeAddr := common.NewAbsoluteAddress(codeSeg, 0)
+			dataAddr := common.NewAbsoluteAddress(dataSegs[ex], 0)
+			for ix := 0; ix < perEngine; ix++ {
+				offset := uint64(ix & 07777)
+				codeAddr.SetOffset(offset)
+				dataAddr.SetOffset(offset)
+				_, _ = ms.GetWordFromAddress(codeAddr)
+				word, _ := ms.GetWordFromAddress(dataAddr)
+				word.SetW(word.GetW() + 1)
+				if ix&017 == 0 {
+					vAddr := common.NewExtendedModeVirtualAddress(6, uint64(ex), offset)
+					ms.LockWait(vAddr, client)
+				}
+				ms.ReleaseAllLocks(client)
+			}
+		}(ex)
+	}
+	wg.Wait()
+}
+
+func Benchmark_MainStorage_1Engine(b *testing.B)  { benchmarkEngines(b, 1) }
+func Benchmark_MainStorage_2Engines(b *testing.B) { benchmarkEngines(b, 2) }
+func Benchmark_MainStorage_4Engines(b *testing.B) { benchmarkEngines(b, 4) }
+func Benchmark_MainStorage_8Engines(b *testing.B) { benchmarkEngines(b, 8) }
+
+func Benchmark_MainStorage_GetSliceParallel(b *testing.B) {
+	ms := NewMainStorage(1)
+	seg, _ := ms.Allocate(4096)
+	b.RunParallel(func(pb *testing.PB) {
+		offset := uint64(0)
+		for pb.Next() {
+			_, _ = ms.GetSlice(seg, offset, 8)
+			offset = (offset + 8) & 07777
+		}
+	})
+}
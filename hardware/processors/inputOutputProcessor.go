@@ -7,8 +7,8 @@ package processors
 import (
 	"fmt"
 
+	"khalehla/hardware/channels"
 	"khalehla/logger"
-	"khalehla/old/hardware/channels"
 )
 
 // An InputOutputProcessor responds to UPI messages from an InstructionProcessor.
@@ -6,9 +6,13 @@ package processors
 
 import (
 	"fmt"
+	"sync"
 
+	"khalehla/common"
+	"khalehla/hardware"
 	"khalehla/hardware/processors/ipEngine"
 	"khalehla/logger"
+	"khalehla/tasm"
 )
 
 // An InstructionProcessor executes 36-bit architecturally-defined code.
@@ -17,6 +21,12 @@ type InstructionProcessor struct {
 	upiIndex UpiIndex
 	name     string
 	engine   *ipEngine.InstructionEngine
+	mutex    sync.Mutex
+	running  bool
+	done     chan bool // closed when the engine stops running
+
+	cycleLimit uint64 // maximum number of cycles to execute for each Start, zero for no limit
+	cycleCount uint64 // number of cycles executed since the most recent Start
 }
 
 func NewInstructionProcessor(index UpiIndex, name string, systemProcessor *SystemProcessor) *InstructionProcessor {
@@ -58,18 +68,125 @@ func (ip *InstructionProcessor) HandleInterrupt(source UpiIndex, details interfa
 	return nil
 }
 
+// GetEngine returns the engine for this processor, or nil if nothing has been loaded
+func (ip *InstructionProcessor) GetEngine() *ipEngine.InstructionEngine {
+	return ip.engine
+}
+
+// LoadExecutable places the given absolute executable into main storage, and establishes a new engine
+// ready to begin executing it. The processor must not be running.
+func (ip *InstructionProcessor) LoadExecutable(storage *hardware.MainStorage, executable *tasm.Executable) error {
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+
+	if ip.running {
+		return fmt.Errorf("%s is running", ip.name)
+	}
+
+	engine := ipEngine.NewEngine(ip.name, storage)
+	_, err := ipEngine.LoadExecutable(engine, storage, executable)
+	if err != nil {
+		return err
+	}
+
+	ip.engine = engine
+	return nil
+}
+
 func (ip *InstructionProcessor) Reset() (err error) {
-	// TODO
+	ip.Stop()
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+	ip.engine = nil
 	return
 }
 
+// Start begins executing whatever has been loaded, on a separate goroutine.
+// Execution continues until the engine stops, an interrupt is posted, the cycle limit is reached, or Stop is invoked;
+// at that point the system processor is notified, with the engine as the details of the interrupt.
 func (ip *InstructionProcessor) Start() (err error) {
-	// TODO
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+
+	if ip.engine == nil {
+		return fmt.Errorf("%s has nothing loaded", ip.name)
+	} else if ip.running {
+		return fmt.Errorf("%s is already running", ip.name)
+	}
+
+	ip.engine.GetGeneralRegisterSet().Clear()
+	ip.engine.ClearStop()
+	ip.engine.ClearAllInterrupts()
+	ip.engine.ClearJumpHistory()
+
+	ip.running = true
+	ip.done = make(chan bool)
+	ip.cycleCount = 0
+	go ip.run(ip.engine, ip.cycleLimit, ip.done)
 	return
 }
 
+func (ip *InstructionProcessor) run(engine *ipEngine.InstructionEngine, cycleLimit uint64, done chan bool) {
+	var count uint64
+	for !engine.HasPendingInterrupt() && !engine.IsStopped() && (cycleLimit == 0 || count < cycleLimit) {
+		engine.DoCycle()
+		count++
+	}
+
+	ip.mutex.Lock()
+	ip.running = false
+	ip.cycleCount = count
+	ip.mutex.Unlock()
+	close(done)
+
+	if ip.sp != nil {
+		err := ip.sp.SendInterrupt(ip.upiIndex, ip.sp.GetIndex(), engine)
+		if err != nil {
+			logger.LogWarningF(ip.name, "Cannot notify system processor: %v", err)
+		}
+	}
+}
+
+// GetCycleCount returns the number of cycles executed between the most recent Start and the processor
+// ceasing to run. It is not meaningful while the processor is running.
+func (ip *InstructionProcessor) GetCycleCount() uint64 {
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+	return ip.cycleCount
+}
+
+// SetCycleLimit limits the number of cycles executed after each subsequent Start; if the limit is reached,
+// the processor ceases to run even though the engine is neither stopped nor interrupted. Zero means no limit.
+func (ip *InstructionProcessor) SetCycleLimit(limit uint64) {
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+	ip.cycleLimit = limit
+}
+
+// Stop requests that a running processor stop, and waits for it to do so
 func (ip *InstructionProcessor) Stop() {
-	// TODO
+	ip.mutex.Lock()
+	running := ip.running
+	done := ip.done
+	if running {
+		ip.engine.Stop(ipEngine.PanelHaltStop, common.Word36(0))
+	}
+	ip.mutex.Unlock()
+
+	if running {
+		<-done
+	}
+}
+
+// Wait blocks until a started processor stops running
+func (ip *InstructionProcessor) Wait() {
+	ip.mutex.Lock()
+	done := ip.done
+	ip.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
 }
 
 // TODO function to adopt channels, manage channels, send IO to channels, and to manage UPI messages
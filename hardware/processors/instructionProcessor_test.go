@@ -0,0 +1,120 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package processors
+
+import (
+	"strings"
+	"testing"
+
+	"khalehla/common"
+	"khalehla/hardware"
+	"khalehla/hardware/processors/ipEngine"
+	"khalehla/tasm"
+)
+
+const storeSource = "         .SEG     0\n" +
+	"start    LA,U     A1,012\n" +
+	"         SA       A1,data\n" +
+	"         IAR      0\n" +
+	"data     W        0\n"
+
+// repeatSource runs (practically) forever, without jumping - jumps would eventually fill the jump history
+// and post an interrupt
+const repeatSource = "         .SEG     0\n" +
+	"start    LR       R1,count\n" +
+	"         EXR      target\n" +
+	"         IAR      0\n" +
+	"target   AA,U     A2,1\n" +
+	"count    W        0_377777_777777\n"
+
+func loadProcessorTest(t *testing.T, source string) (*InstructionProcessor, *hardware.MainStorage, *tasm.Executable) {
+	sourceSet, _, _ := tasm.ParseSource("Test", strings.NewReader(source))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	e := &tasm.Executable{}
+	e.LinkSimple(a.GetSegments(), true)
+
+	storage := hardware.NewMainStorage(100)
+	ip := NewInstructionProcessor(1, "IP0", nil)
+	err := ip.LoadExecutable(storage, e)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	ip.GetEngine().SetLogInstructions(false)
+	return ip, storage, e
+}
+
+func checkProcessorStopped(t *testing.T, ip *InstructionProcessor, reason ipEngine.StopReason) {
+	engine := ip.GetEngine()
+	if engine.HasPendingInterrupt() {
+		t.Fatalf("Error unexpected interrupt")
+	}
+	if !engine.IsStopped() {
+		t.Fatalf("Error expected %s to be stopped", ip.GetName())
+	}
+	actual, _ := engine.GetStopReason()
+	if actual != reason {
+		t.Fatalf("Error expected stop reason %d, got %d", reason, actual)
+	}
+}
+
+func Test_InstructionProcessor_LoadAndRun(t *testing.T) {
+	ip, storage, e := loadProcessorTest(t, storeSource)
+	err := ip.Start()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	ip.Wait()
+
+	checkProcessorStopped(t, ip, ipEngine.InitiateAutoRecoveryStop)
+	a1 := ip.GetEngine().GetGeneralRegisterSet().GetRegister(common.A1).GetW()
+	if a1 != 012 {
+		t.Errorf("Error expected A1 to be 012, got %012o", a1)
+	}
+
+	err = ipEngine.SnapshotExecutable(storage, e)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	code := e.GetBanks()[0600004].GetCode()
+	if code[3] != 012 {
+		t.Errorf("Error expected snapshot of data to be 012, got %012o", code[3])
+	}
+}
+
+func Test_InstructionProcessor_Stop(t *testing.T) {
+	ip, _, _ := loadProcessorTest(t, repeatSource)
+	err := ip.Start()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	err = ip.Start()
+	if err == nil {
+		t.Errorf("Error expected second Start to be rejected")
+	}
+
+	ip.Stop()
+	checkProcessorStopped(t, ip, ipEngine.PanelHaltStop)
+}
+
+func Test_InstructionProcessor_CycleLimit(t *testing.T) {
+	ip, _, _ := loadProcessorTest(t, repeatSource)
+	ip.SetCycleLimit(100)
+	err := ip.Start()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	ip.Wait()
+
+	if ip.GetEngine().IsStopped() || ip.GetEngine().HasPendingInterrupt() {
+		t.Fatalf("Error expected %s to reach the cycle limit", ip.GetName())
+	}
+	if ip.GetCycleCount() != 100 {
+		t.Errorf("Error expected 100 cycles, got %d", ip.GetCycleCount())
+	}
+}
@@ -893,6 +893,7 @@ func step19(bm *BankManipulator) bool {
 		seg, _ := bm.engine.mainStorage.GetSegment(bm.targetBankDescriptor.GetBaseAddress().GetSegment())
 		bm.engine.baseRegisters[bm.baseRegisterIndex].FromBankDescriptor(bm.targetBankDescriptor, seg)
 	}
+	bm.engine.InvalidateInstructionCache()
 
 	bm.nextStep++
 	return true
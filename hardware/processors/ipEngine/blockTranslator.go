@@ -0,0 +1,224 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"khalehla/common"
+)
+
+// Block translation is an optional execution mode in which runs of straight-line instructions are translated
+// into a list of pre-decoded steps, each holding the instruction word and the function handler which implements it.
+// The block as a whole is executed by a single call to DoCycle, which calls the handlers one after another.
+// This avoids the per-instruction fetch (address and access checking, bank selection, and decoding)
+// as well as the separate DoCycle which would otherwise be spent on fetching each instruction.
+//
+// A block is only ever a shortcut for what DoCycle would do anyway. After each instruction we check whether
+// DoCycle would have done anything differently for the next one, and if so we return to the caller and let
+// DoCycle carry on normally. In particular, we leave the block when
+//   - an interrupt is pending or the engine has stopped
+//   - the instruction did not complete (EXR, or an instruction interrupted mid-execution)
+//   - PAR.PC is not the address of the next instruction in the block (i.e., a jump was taken)
+//   - the execution mode, fetch base register, or access key has changed
+//   - any base register has been loaded (which invalidates all blocks)
+//   - the next instruction word in storage no longer matches the word which was translated
+//
+// Blocks are not used at all while a breakpoint is set, nor while a fault injector is attached to storage.
+
+// maximum number of instructions in a translated block
+const maxTranslatedBlockLength = 64
+
+// translatedStep is one pre-decoded instruction of a block
+type translatedStep struct {
+	pcOffset uint64 // offset of the instruction from the start of the bank's storage
+	iw       common.InstructionWord
+	handler  func(*InstructionEngine) (completed bool)
+}
+
+type translatedBlock struct {
+	generation        uint64 // value of engine.blockGeneration when the block was translated
+	basicMode         bool
+	baseRegisterIndex uint
+	accessKey         uint64
+	startAddress      uint64
+	storage           []common.Word36
+	steps             []translatedStep
+}
+
+// newBlockKey creates the key under which a block is stored in the block table
+func newBlockKey(basicMode bool, baseRegisterIndex uint, programCounter uint64) uint64 {
+	key := uint64(baseRegisterIndex)<<36 | programCounter
+	if basicMode {
+		key |= 1 << 42
+	}
+	return key
+}
+
+// executeBlock executes the block of translated instructions starting at the current PAR.PC,
+// translating the block first if necessary.
+// Returns false if no instructions were executed, in which case the caller should do a normal fetch.
+func (e *InstructionEngine) executeBlock() bool {
+	if e.breakpointAddress != nil {
+		return false
+	}
+
+	block := e.findBlock()
+	if block == nil {
+		return false
+	}
+
+	asp := e.activityStatePacket
+	ikr := asp.GetIndicatorKeyRegister()
+	dr := asp.GetDesignatorRegister()
+	par := asp.GetProgramAddressRegister()
+
+	count := 0
+	for sx := range block.steps {
+		if e.isStopped.Load() || !e.pendingInterrupts.IsClear() {
+			break
+		}
+
+		step := &block.steps[sx]
+		if block.storage[step.pcOffset].GetW() != step.iw.GetW() {
+			// someone has stored into the block - drop it, so that it is re-translated next time around
+			delete(e.translatedBlocks, newBlockKey(block.basicMode, block.baseRegisterIndex, block.startAddress))
+			break
+		}
+
+		// This is what fetchInstructionWord() and executeCycle() would do, less everything we checked
+		// when the block was translated.
+		asp.SetCurrentInstruction(&step.iw)
+		ikr.SetInstructionInF0(true)
+		ikr.SetExecuteRepeatedInstruction(false)
+		e.cachedInstructionHandler = step.handler
+		e.preventPCUpdate = false
+		count++
+
+		if e.logInstructions {
+			e.logCurrentInstruction()
+		}
+		if !step.handler(e) {
+			// leave the instruction in F0 for DoCycle to continue with
+			break
+		}
+
+		e.SetInstructionPoint(BetweenInstructions)
+		e.clearStorageLocks()
+		e.cachedInstructionHandler = nil
+		ikr.SetInstructionInF0(false)
+		ikr.SetExecuteRepeatedInstruction(false)
+		if !e.preventPCUpdate {
+			par.IncrementProgramCounter()
+		}
+
+		if e.blockGeneration != block.generation ||
+			par.GetProgramCounter() != block.startAddress+uint64(sx)+1 ||
+			dr.IsBasicModeEnabled() != block.basicMode ||
+			(block.basicMode && e.baseRegisterIndexForFetch != block.baseRegisterIndex) ||
+			ikr.GetAccessKey().GetComposite() != block.accessKey {
+			break
+		}
+	}
+
+	if count > 0 {
+		e.blocksExecuted++
+	}
+	return count > 0
+}
+
+// findBlock retrieves the block for the current PAR.PC, translating it if it is not already in the block table.
+// Returns nil if there is no usable block.
+func (e *InstructionEngine) findBlock() *translatedBlock {
+	basicMode := e.activityStatePacket.GetDesignatorRegister().IsBasicModeEnabled()
+	programCounter := e.activityStatePacket.GetProgramAddressRegister().GetProgramCounter()
+
+	brx := uint(0)
+	if basicMode {
+		// Let a normal fetch establish the basic mode bank first
+		brx = e.baseRegisterIndexForFetch
+		if brx == 0 {
+			return nil
+		}
+	}
+
+	key := newBlockKey(basicMode, brx, programCounter)
+	block, ok := e.translatedBlocks[key]
+	if !ok {
+		// translation failures are not remembered - they are rare, and generally end in an interrupt
+		block = e.translateBlock(basicMode, brx, programCounter)
+		if block == nil {
+			return nil
+		}
+		e.translatedBlocks[key] = block
+	}
+
+	if block.accessKey != e.activityStatePacket.GetIndicatorKeyRegister().GetAccessKey().GetComposite() {
+		return nil
+	}
+
+	return block
+}
+
+// translateBlock builds a block of straight-line instructions starting at the given program counter.
+// We check here everything which fetchInstructionWord() would check, so that executeBlock() does not have to.
+// Returns nil if not even the first instruction can be translated.
+func (e *InstructionEngine) translateBlock(basicMode bool, brx uint, programCounter uint64) *translatedBlock {
+	bReg := e.baseRegisters[brx]
+	if bReg.IsVoid() || bReg.GetBankDescriptor().IsLargeBank() {
+		return nil
+	}
+
+	accessKey := e.activityStatePacket.GetIndicatorKeyRegister().GetAccessKey()
+	if basicMode {
+		if !e.isReadAllowed(bReg) {
+			return nil
+		}
+	} else if e.checkAccessibility(bReg, true, false, false, accessKey) != nil {
+		return nil
+	}
+
+	block := &translatedBlock{
+		generation:        e.blockGeneration,
+		basicMode:         basicMode,
+		baseRegisterIndex: brx,
+		accessKey:         accessKey.GetComposite(),
+		startAddress:      programCounter,
+		storage:           bReg.GetStorage(),
+		steps:             make([]translatedStep, 0),
+	}
+
+	bDesc := bReg.GetBankDescriptor()
+	for pc := programCounter; len(block.steps) < maxTranslatedBlockLength; pc++ {
+		if !basicMode && e.checkAccessLimitsForAddress(basicMode, brx, pc, true) != nil {
+			break
+		}
+		if pc < bDesc.GetLowerLimitNormalized() || pc > bDesc.GetUpperLimitNormalized() {
+			break
+		}
+
+		pcOffset := pc - bDesc.GetLowerLimitNormalized()
+		if pcOffset >= uint64(len(block.storage)) {
+			break
+		}
+
+		iw := common.InstructionWord(block.storage[pcOffset])
+		handler := lookupFunctionHandler(basicMode, &iw)
+		if handler == nil {
+			break
+		}
+
+		block.steps = append(block.steps, translatedStep{
+			pcOffset: pcOffset,
+			iw:       iw,
+			handler:  handler,
+		})
+	}
+
+	if len(block.steps) == 0 {
+		return nil
+	}
+
+	e.blocksTranslated++
+	return block
+}
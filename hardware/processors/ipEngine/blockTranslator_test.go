@@ -0,0 +1,574 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+// The differential harness runs each program once in normal mode and once with block translation enabled,
+// and then requires the entire state of the two engines (and of their storage) to be identical.
+// Programs which produce random numbers (RNGB, RNGI) are necessarily excluded.
+
+type differentialCase struct {
+	name           string
+	source         []*tasm.SourceItem
+	bankPerSegment bool
+	extendedMode   bool
+	setup          func(dr *common.DesignatorRegister)
+}
+
+var differentialCases = []differentialCase{
+	{"TranslatedBlock_Loop", loopExtendedMode, false, true, func(dr *common.DesignatorRegister) {}},
+	{"SelfModifyingCode_Invalidation", selfModifyingExtendedMode, false, true, func(dr *common.DesignatorRegister) {}},
+	{"JZ_Extended_PosZero", jumpZeroExtendedPosZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JZ_Extended_NegZero", jumpZeroExtendedNegZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JZ_Extended_NotZero", jumpZeroExtendedNotZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"DJZ_Extended_PosZero", doubleJumpZeroExtendedMode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JNZ_Extended_PosZero", jumpNonZeroExtendedPosZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JNZ_Extended_NegZero", jumpNonZeroExtendedNegZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JNZ_Extended_NotZero", jumpNonZeroExtendedNotZero, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JP_JN_Extended", jumpPosNegExtended, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"JC_Basic_Pos", jumpCarryBasic, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCarry(true)
+	}},
+	{"JC_Basic_Neg", jumpCarryBasic, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCarry(false)
+	}},
+	{"JC_Extended_Pos", jumpCarryExtended, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCarry(true)
+	}},
+	{"JDF_Basic_Pos", jumpDivideFault, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetDivideCheck(true)
+	}},
+	{"JDF_Basic_Neg", jumpDivideFault, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetDivideCheck(false)
+	}},
+	{"JDF_Extended_Pos", jumpDivideFault, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetDivideCheck(true)
+	}},
+	{"JDF_Extended_Neg", jumpDivideFault, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetDivideCheck(false)
+	}},
+	{"JFO_Basic_Pos", jumpFloatingOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicOverflow(true)
+	}},
+	{"JFO_Basic_Neg", jumpFloatingOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicOverflow(false)
+	}},
+	{"JFO_Extended_Pos", jumpFloatingOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicOverflow(true)
+	}},
+	{"JFO_Extended_Neg", jumpFloatingOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicOverflow(false)
+	}},
+	{"JFU_Basic_Pos", jumpFloatingUnderflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicUnderflow(true)
+	}},
+	{"JFU_Basic_Neg", jumpFloatingUnderflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicUnderflow(false)
+	}},
+	{"JFU_Extended_Pos", jumpFloatingUnderflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicUnderflow(true)
+	}},
+	{"JFU_Extended_Neg", jumpFloatingUnderflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicUnderflow(false)
+	}},
+	{"JNC_Basic_Pos", jumpNoCarryBasic, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCarry(false)
+	}},
+	{"JNC_Basic_Neg", jumpNoCarryBasic, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCarry(true)
+	}},
+	{"JNC_Extended_Pos", jumpNoCarryExtended, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCarry(false)
+	}},
+	{"JNDF_Basic_Pos", jumpNoDivideFault, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetDivideCheck(false)
+	}},
+	{"JNDF_Basic_Neg", jumpNoDivideFault, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetDivideCheck(true)
+	}},
+	{"JNDF_Extended_Pos", jumpNoDivideFault, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetDivideCheck(false)
+	}},
+	{"JNDF_Extended_Neg", jumpNoDivideFault, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetDivideCheck(true)
+	}},
+	{"JNFO_Basic_Pos", jumpNoFloatingOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicOverflow(false)
+	}},
+	{"JNFO_Basic_Neg", jumpNoFloatingOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicOverflow(true)
+	}},
+	{"JNFO_Extended_Pos", jumpNoFloatingOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicOverflow(false)
+	}},
+	{"JNFO_Extended_Neg", jumpNoFloatingOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicOverflow(true)
+	}},
+	{"JNFU_Basic_Pos", jumpNoFloatingUnderflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicUnderflow(false)
+	}},
+	{"JNFU_Basic_Neg", jumpNoFloatingUnderflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetCharacteristicUnderflow(true)
+	}},
+	{"JNFU_Extended_Pos", jumpNoFloatingUnderflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicUnderflow(false)
+	}},
+	{"JNFU_Extended_Neg", jumpNoFloatingUnderflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetCharacteristicUnderflow(true)
+	}},
+	{"JNO_Basic_Pos", jumpNoOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetOverflow(false)
+	}},
+	{"JNO_Extended_Neg", jumpNoOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetOverflow(true)
+	}},
+	{"JO_Basic_Pos", jumpOverflow, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetOverflow(true)
+	}},
+	{"JO_Extended_Neg", jumpOverflow, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetOverflow(false)
+	}},
+	{"AA_Basic", aaCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"ANA_Basic", anaCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"AMA_Basic", amaCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"ANMA_Basic", anmaCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"ANU_Basic", anuCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"AX_Basic", axCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"ANX_Basic", anxCode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"MI_Extended", miCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"MSI_Overflow", msiCodeOverflow, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+		dr.SetOperationTrapEnabled(true)
+	}},
+	{"MSI_Extended", msiCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"MF_Extended", mfCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DI_Extended", diCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DI_DivideCheck", diCodeDivideCheck, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DSF_Extended", dsfCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DF_Extended", dfCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DA_Extended", daCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DAN_Extended", danCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"AH_Extended", ahCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"PartialWordLoads_BasicThirdWord", partialWordLoadsBasicThirdWord, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"PartialWordLoads_BasicQuarterWord", PartialWordLoadsBasicQuarterWord, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"PartialWordStores_BasicThirdWord", partialWordStoresBasicThirdWord, true, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"PartialWordStores_BasicQuarterWord", partialWordStoresBasicQuarterWord, true, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"PartialWordLoads_ExtendedThirdWord", partialWordLoadsExtendedThirdWord, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"PartialWordLoads_ExtendedQuarterWord", PartialWordLoadsExtendedQuarterWord, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"PartialWordStores_ExtendedThirdWord", partialWordStoresExtendedThirdWord, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"PartialWordStores_ExtendedQuarterWord", partialWordStoresExtendedQuarterWord, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"GRSAddressing_Extended", grsAddressingExtended, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LA_Basic", laBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LA_Extended", laExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LMA_Extended", lmaExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"LNA_Extended", lnaExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"LNMA_Extended", lnmaExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"LR_Basic", lrBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LR_Extended", lrExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(false)
+	}},
+	{"LX_Basic", lxBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LX_Extended", lxExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DL_Basic", dlBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetProcessorPrivilege(2)
+	}},
+	{"SSC", sscCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"SSL", sslCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"LSSC", lsscCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"EX_Basic", exBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"EX_BasicModeIndirect", exBasicModeIndirect, true, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+		dr.SetProcessorPrivilege(2)
+	}},
+	{"EX_Extended", exExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"EX_ExtendedCascade", exExtendedModeCascade, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"EX_ExtendedJump", exExtendedModeJump, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"EX_ExtendedTest", exExtendedModeTest, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"EXR_Extended", exrExtendedMode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"EXR_ExtendedInvalidInstruction", exrExtendedModeInvalidInstruction, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"EXR_ExtendedTZ", exrExtendedModeTZ, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"DCB_ExtendedTest", dcbExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"TEP", tepCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"TOP", topCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"TLEM", tlemCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"TNOP", tnopCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"TSKP", tskpCode, true, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+		dr.SetQuarterWordModeEnabled(true)
+	}},
+	{"LMJ_Basic", lmjBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+	}},
+	{"SLJ_Basic", sljBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+	}},
+	{"LMJ_Extended", lmjExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"J_Basic", jumpBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+	}},
+	{"JK_Basic", jumpKeyBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+	}},
+	{"J_Extended", jumpExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+	{"HKJ_Basic", haltKeysAndJumpBasicMode, false, false, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(true)
+	}},
+	{"HLTJ_Extended", haltJumpExtendedMode, false, true, func(dr *common.DesignatorRegister) {
+		dr.SetBasicModeEnabled(false)
+	}},
+}
+
+func runDifferentialCase(t *testing.T, dc differentialCase, blockTranslation bool) *UnitTestEngine {
+	sourceSet := tasm.NewSourceSet(dc.name, dc.source)
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	e := tasm.Executable{}
+	if dc.bankPerSegment {
+		e.LinkBankPerSegment(a.GetSegments(), dc.extendedMode)
+	} else {
+		e.LinkSimple(a.GetSegments(), dc.extendedMode)
+	}
+
+	ute := NewUnitTestExecutor()
+	err := ute.Load(&e)
+	if err == nil {
+		engine := ute.GetEngine()
+		engine.SetBlockTranslationEnabled(blockTranslation)
+		dc.setup(engine.GetDesignatorRegister())
+		err = ute.Run()
+	}
+
+	if err != nil {
+		t.Fatalf("%s: %s\n", dc.name, err.Error())
+	}
+
+	return ute
+}
+
+// getSegmentNames maps storage segment indices to the names of the banks they contain.
+// We compare by name so that the comparison does not depend upon which segments the loader used,
+// and for the same reason we do not compare the bank descriptor tables, which contain segment indices.
+func getSegmentNames(ute *UnitTestEngine) map[uint]string {
+	names := make(map[uint]string)
+	for bdi, absAddr := range ute.bankAddresses {
+		names[absAddr.GetSegment()] = fmt.Sprintf("Bank%06o", bdi)
+	}
+	for level, absAddr := range ute.bankDescriptorTableAddresses {
+		names[absAddr.GetSegment()] = fmt.Sprintf("BDT%d", level)
+	}
+	return names
+}
+
+// getEngineState produces a list of descriptions of everything we know about an engine and its storage.
+func getEngineState(ute *UnitTestEngine) []string {
+	e := ute.GetEngine()
+	names := getSegmentNames(ute)
+	asp := e.activityStatePacket
+	state := []string{
+		fmt.Sprintf("PAR:%012o", asp.GetProgramAddressRegister().GetComposite()),
+		fmt.Sprintf("DR:%012o", asp.GetDesignatorRegister().GetComposite()),
+		fmt.Sprintf("IKR:%012o", asp.GetIndicatorKeyRegister().GetComposite()),
+		fmt.Sprintf("F0:%012o", asp.GetCurrentInstruction().GetW()),
+		fmt.Sprintf("Stopped:%v Reason:%v Detail:%012o", e.isStopped.Load(), e.stopReason, e.stopDetail),
+		fmt.Sprintf("InstructionPoint:%v PreventPCUpdate:%v FetchBR:%d",
+			e.instructionPoint, e.preventPCUpdate, e.baseRegisterIndexForFetch),
+	}
+
+	for rx := uint64(0); rx < 128; rx++ {
+		state = append(state, fmt.Sprintf("GRS[%03o]:%012o", rx, e.generalRegisterSet.GetRegisterValue(rx)))
+	}
+
+	for bx, br := range e.baseRegisters {
+		if br.IsVoid() {
+			state = append(state, fmt.Sprintf("B%d:void", bx))
+		} else {
+			bd := br.GetBankDescriptor()
+			baseAddr := bd.GetBaseAddress()
+			state = append(state, fmt.Sprintf("B%d:%s+%012o %012o %012o %012o",
+				bx,
+				names[baseAddr.GetSegment()],
+				baseAddr.GetOffset(),
+				bd.GetLowerLimitNormalized(),
+				bd.GetUpperLimitNormalized(),
+				br.GetSubsetting()))
+		}
+	}
+
+	for ax := 1; ax < 16; ax++ {
+		state = append(state, fmt.Sprintf("ABTE%d:%s", ax, e.activeBaseTable[ax].GetString()))
+	}
+
+	for _, i := range e.pendingInterrupts.stack {
+		state = append(state, "Interrupt:"+common.GetInterruptString(i))
+	}
+
+	for _, va := range e.jumpHistory.GetEntries() {
+		state = append(state, fmt.Sprintf("JumpHistory:%012o", va.GetComposite()))
+	}
+
+	storageState := make([]string, 0)
+	for sx, name := range names {
+		if strings.HasPrefix(name, "BDT") {
+			continue
+		}
+		seg, _ := ute.storage.GetSegment(sx)
+		for wx, word := range seg {
+			storageState = append(storageState, fmt.Sprintf("%s[%06o]:%012o", name, wx, word.GetW()))
+		}
+	}
+	sort.Strings(storageState)
+
+	return append(state, storageState...)
+}
+
+func Test_BlockTranslation_Differential(t *testing.T) {
+	blocksExecuted := uint64(0)
+	for _, dc := range differentialCases {
+		normal := runDifferentialCase(t, dc, false)
+		translated := runDifferentialCase(t, dc, true)
+		blocksExecuted += translated.GetEngine().blocksExecuted
+
+		normalState := getEngineState(normal)
+		translatedState := getEngineState(translated)
+		if len(normalState) != len(translatedState) {
+			t.Fatalf("%s: state lengths differ normal=%d translated=%d", dc.name, len(normalState), len(translatedState))
+		}
+
+		for sx := range normalState {
+			if normalState[sx] != translatedState[sx] {
+				t.Errorf("%s: normal=%s translated=%s", dc.name, normalState[sx], translatedState[sx])
+			}
+		}
+	}
+
+	if blocksExecuted == 0 {
+		t.Fatalf("Expected some translated blocks to be executed")
+	}
+}
+
+func Test_BlockTranslation_Loop(t *testing.T) {
+	ute := loadTestProgram(t, loopExtendedMode)
+	engine := ute.GetEngine()
+	engine.SetBlockTranslationEnabled(true)
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.A0, 0100)
+	checkRegister(t, engine, common.A1, 0)
+
+	// one block for the prologue, and one for the body of the loop (which is re-used)
+	if engine.blocksTranslated != 2 {
+		t.Fatalf("Expected 2 blocks to be translated, got %d", engine.blocksTranslated)
+	}
+}
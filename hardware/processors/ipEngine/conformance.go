@@ -0,0 +1,527 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+// Conformance test vectors are data-driven descriptions of architectural behavior.
+// Each vector declares an initial state (GRS, designator register, and storage), a short sequence of instructions,
+// and the expected final state. The runner assembles the instructions, executes them in basic mode,
+// extended mode, or both, and compares the result against the expectation.
+// Vector files are JSON arrays of vectors, for example:
+//
+//	[
+//	  {
+//	    "name": "LA,U",
+//	    "registers": { "A1": "0777" },
+//	    "data": [ [ "value", "0_000000_000005" ] ],
+//	    "code": [ [ "", "fjaxhiu", "010", "0", "02", "0", "0", "0", "value" ] ],
+//	    "expect": { "registers": { "A2": "05" } }
+//	  }
+//	]
+//
+// Code and data items are [ label, operator, operands... ] and [ label, value ] respectively.
+// Every code and data item must generate exactly one word. The runner appends an IAR to the code, so a vector
+// which does not expect an interrupt is expected to stop with InitiateAutoRecoveryStop.
+// Memory references should use the FJAXHIU form with a u-field less than 010000 so that the same
+// instruction word is valid in both modes (in extended mode, such a u-field resolves to B0 with a displacement).
+// Register and storage values are strings parsed with strconv base 0, so "0_777777_777777" is an octal word.
+// Storage locations are expressed as "label" or "label+n".
+
+const conformanceMaxCycles = 10000
+
+type ConformanceVector struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Modes       []string               `json:"modes,omitempty"` // "basic" and/or "extended" - default is both
+	Designator  map[string]bool        `json:"designator,omitempty"`
+	Registers   map[string]string      `json:"registers,omitempty"`
+	Data        [][]string             `json:"data,omitempty"`
+	Code        [][]string             `json:"code"`
+	Expect      ConformanceExpectation `json:"expect"`
+}
+
+type ConformanceExpectation struct {
+	Registers  map[string]string `json:"registers,omitempty"`
+	Storage    map[string]string `json:"storage,omitempty"`
+	Designator map[string]bool   `json:"designator,omitempty"`
+	Interrupt  *uint             `json:"interrupt,omitempty"` // interrupt class
+}
+
+type ConformanceResult struct {
+	Vector    *ConformanceVector
+	BasicMode bool
+	Failures  []string
+}
+
+func (cr *ConformanceResult) GetString() string {
+	mode := "extended"
+	if cr.BasicMode {
+		mode = "basic"
+	}
+
+	if cr.IsSuccessful() {
+		return fmt.Sprintf("%s (%s mode): passed", cr.Vector.Name, mode)
+	}
+	return fmt.Sprintf("%s (%s mode): %s", cr.Vector.Name, mode, strings.Join(cr.Failures, "; "))
+}
+
+func (cr *ConformanceResult) IsSuccessful() bool {
+	return len(cr.Failures) == 0
+}
+
+func (cr *ConformanceResult) fail(format string, args ...any) {
+	cr.Failures = append(cr.Failures, fmt.Sprintf(format, args...))
+}
+
+// ConformanceRunner executes conformance vectors, and accumulates the set of instruction handlers
+// which were executed by those vectors, for each mode.
+type ConformanceRunner struct {
+	// key is the basic mode flag, value is a map of handler names to execution counts
+	covered map[bool]map[string]uint
+}
+
+func NewConformanceRunner() *ConformanceRunner {
+	return &ConformanceRunner{
+		covered: map[bool]map[string]uint{
+			true:  make(map[string]uint),
+			false: make(map[string]uint),
+		},
+	}
+}
+
+// LoadConformanceVectors reads a JSON file containing an array of conformance vectors
+func LoadConformanceVectors(fileName string) ([]*ConformanceVector, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vectors := make([]*ConformanceVector, 0)
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&vectors)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err.Error())
+	}
+
+	return vectors, nil
+}
+
+// Run executes the given vector in each of its modes.
+// An error is returned only if the vector itself is malformed - conformance failures are reported in the results.
+func (cr *ConformanceRunner) Run(vector *ConformanceVector) ([]*ConformanceResult, error) {
+	modes := vector.Modes
+	if len(modes) == 0 {
+		modes = []string{"basic", "extended"}
+	}
+
+	results := make([]*ConformanceResult, 0)
+	for _, mode := range modes {
+		var basicMode bool
+		switch strings.ToLower(mode) {
+		case "basic":
+			basicMode = true
+		case "extended":
+			basicMode = false
+		default:
+			return nil, fmt.Errorf("%s:invalid mode '%s'", vector.Name, mode)
+		}
+
+		result, err := cr.runMode(vector, basicMode)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s", vector.Name, err.Error())
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (cr *ConformanceRunner) runMode(vector *ConformanceVector, basicMode bool) (*ConformanceResult, error) {
+	source, labels, err := buildConformanceSource(vector)
+	if err != nil {
+		return nil, err
+	}
+
+	assembler := tasm.NewTinyAssembler()
+	assembler.Assemble(tasm.NewSourceSet(vector.Name, source))
+	executable := &tasm.Executable{}
+	executable.LinkSimple(assembler.GetSegments(), !basicMode)
+
+	ute := NewUnitTestExecutor()
+	err = ute.Load(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	var bankStorage []common.Word36
+	for _, absAddr := range ute.bankAddresses {
+		bankStorage, _ = ute.storage.GetSegment(absAddr.GetSegment())
+	}
+	if len(bankStorage) != len(source)-2 {
+		return nil, fmt.Errorf("expected %d words of code and data, assembler generated %d",
+			len(source)-2, len(bankStorage))
+	}
+
+	engine := ute.GetEngine()
+	engine.SetLogInstructions(false)
+	engine.SetLogInterrupts(false)
+	engine.SetBlockTranslationEnabled(false)
+
+	dr := engine.GetDesignatorRegister()
+	dr.SetBasicModeEnabled(basicMode)
+	for name, value := range vector.Designator {
+		flag, ok := conformanceDesignatorFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown designator flag '%s'", name)
+		}
+		flag.set(dr, value)
+	}
+
+	grs := engine.GetGeneralRegisterSet()
+	grs.Clear()
+	for name, str := range vector.Registers {
+		regIndex, value, err := parseConformanceRegister(name, str)
+		if err != nil {
+			return nil, err
+		}
+		grs.SetRegisterValue(regIndex, value)
+	}
+
+	engine.ClearStop()
+	engine.ClearAllInterrupts()
+	engine.ClearJumpHistory()
+
+	ikr := engine.activityStatePacket.GetIndicatorKeyRegister()
+	cycles := 0
+	for !engine.HasPendingInterrupt() && !engine.IsStopped() && cycles < conformanceMaxCycles {
+		wasInF0 := ikr.IsInstructionInF0()
+		engine.DoCycle()
+		if !wasInF0 && ikr.IsInstructionInF0() {
+			cr.recordCoverage(engine)
+		}
+		cycles++
+	}
+
+	result := &ConformanceResult{
+		Vector:    vector,
+		BasicMode: basicMode,
+		Failures:  make([]string, 0),
+	}
+
+	if cycles == conformanceMaxCycles {
+		result.fail("did not complete within %d cycles", conformanceMaxCycles)
+	}
+
+	expect := vector.Expect
+	if expect.Interrupt == nil {
+		if engine.HasPendingInterrupt() {
+			result.fail("unexpected interrupt(s) %s", getPendingInterruptClasses(engine))
+		} else if reason, _ := engine.GetStopReason(); reason != InitiateAutoRecoveryStop {
+			result.fail("expected stop reason %d, got %d", InitiateAutoRecoveryStop, reason)
+		}
+	} else {
+		found := false
+		for _, i := range engine.pendingInterrupts.stack {
+			if uint(i.GetClass()) == *expect.Interrupt {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.fail("expected interrupt class %d, got %s", *expect.Interrupt, getPendingInterruptClasses(engine))
+		}
+	}
+
+	for name, str := range expect.Registers {
+		regIndex, expected, err := parseConformanceRegister(name, str)
+		if err != nil {
+			return nil, err
+		}
+		actual := grs.GetRegisterValue(regIndex)
+		if actual != expected {
+			result.fail("%s expected %012o, got %012o", name, expected, actual)
+		}
+	}
+
+	for location, str := range expect.Storage {
+		offset, err := resolveConformanceLocation(location, labels)
+		if err != nil {
+			return nil, err
+		}
+		if offset >= uint64(len(bankStorage)) {
+			return nil, fmt.Errorf("storage location '%s' is outside the bank", location)
+		}
+		expected, err := strconv.ParseUint(str, 0, 36)
+		if err != nil {
+			return nil, fmt.Errorf("storage location '%s':%s", location, err.Error())
+		}
+		actual := bankStorage[offset].GetW()
+		if actual != expected {
+			result.fail("%s expected %012o, got %012o", location, expected, actual)
+		}
+	}
+
+	for name, expected := range expect.Designator {
+		flag, ok := conformanceDesignatorFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown designator flag '%s'", name)
+		}
+		if flag.get(dr) != expected {
+			result.fail("designator %s expected %v", name, expected)
+		}
+	}
+
+	sort.Strings(result.Failures)
+	return result, nil
+}
+
+// recordCoverage notes the handler for the instruction which has just been fetched into F0
+func (cr *ConformanceRunner) recordCoverage(engine *InstructionEngine) {
+	basicMode := engine.GetDesignatorRegister().IsBasicModeEnabled()
+	handler := lookupFunctionHandler(basicMode, engine.GetCurrentInstruction())
+	if handler != nil {
+		cr.covered[basicMode][getHandlerName(handler)]++
+	}
+}
+
+// GetCoverage reports, for the given mode, the number of distinct instruction handlers executed by the vectors
+// run so far, the total number of distinct handlers in the function tables, and the names of those not executed.
+func (cr *ConformanceRunner) GetCoverage(basicMode bool) (covered int, total int, uncovered []string) {
+	table := extendedModeDirectFunctionTable
+	if basicMode {
+		table = basicModeDirectFunctionTable
+	}
+
+	names := make(map[string]bool)
+	for _, handler := range table {
+		if handler != nil {
+			names[getHandlerName(handler)] = true
+		}
+	}
+
+	uncovered = make([]string, 0)
+	for name := range names {
+		if cr.covered[basicMode][name] > 0 {
+			covered++
+		} else {
+			uncovered = append(uncovered, name)
+		}
+	}
+
+	sort.Strings(uncovered)
+	return covered, len(names), uncovered
+}
+
+// GetCoverageReport produces a human-readable report of instruction coverage for both modes
+func (cr *ConformanceRunner) GetCoverageReport() string {
+	sb := strings.Builder{}
+	for _, basicMode := range []bool{true, false} {
+		mode := "Extended"
+		if basicMode {
+			mode = "Basic"
+		}
+
+		covered, total, uncovered := cr.GetCoverage(basicMode)
+		sb.WriteString(fmt.Sprintf("%s Mode: %d of %d instructions covered (%d%%)\n",
+			mode, covered, total, covered*100/total))
+
+		executed := make([]string, 0)
+		for name := range cr.covered[basicMode] {
+			executed = append(executed, name)
+		}
+		sort.Strings(executed)
+
+		sb.WriteString("  Covered:\n")
+		for _, name := range executed {
+			sb.WriteString(fmt.Sprintf("    %-40s %6d\n", name, cr.covered[basicMode][name]))
+		}
+
+		sb.WriteString("  Not covered:\n")
+		for _, name := range uncovered {
+			sb.WriteString(fmt.Sprintf("    %s\n", name))
+		}
+	}
+
+	return sb.String()
+}
+
+// buildConformanceSource produces the tasm source for a vector - data in segment 077 and code in segment 0.
+// LinkSimple places segment 0 ahead of segment 077, so the returned map of labels to bank offsets
+// can be calculated directly from the item counts.
+func buildConformanceSource(vector *ConformanceVector) ([]*tasm.SourceItem, map[string]uint64, error) {
+	labels := make(map[string]uint64)
+	codeLength := uint64(len(vector.Code) + 1)
+
+	source := []*tasm.SourceItem{tasm.NewSourceItem("", ".SEG", []string{"077"})}
+	for dx, item := range vector.Data {
+		if len(item) != 2 {
+			return nil, nil, fmt.Errorf("data item %d must be [ label, value ]", dx)
+		}
+		value, err := strconv.ParseUint(item[1], 0, 36)
+		if err != nil {
+			return nil, nil, fmt.Errorf("data item %d:%s", dx, err.Error())
+		}
+		if item[0] != "" {
+			labels[strings.ToUpper(item[0])] = codeLength + uint64(dx)
+		}
+		source = append(source, tasm.NewSourceItem(item[0], "W", []string{fmt.Sprintf("0%o", value)}))
+	}
+
+	source = append(source, tasm.NewSourceItem("", ".SEG", []string{"0"}))
+	for cx, item := range vector.Code {
+		if len(item) < 2 {
+			return nil, nil, fmt.Errorf("code item %d must be [ label, operator, operands... ]", cx)
+		}
+		if item[0] != "" {
+			labels[strings.ToUpper(item[0])] = uint64(cx)
+		}
+		source = append(source, tasm.NewSourceItem(item[0], item[1], item[2:]))
+	}
+	source = append(source, tasm.NewSourceItem("", "FJAXU", []string{"073", "017", "06", "0", "0"}))
+
+	return source, labels, nil
+}
+
+// parseConformanceRegister converts a register name (X0-X15, A0-A15, R0-R15, EX0-EX15, EA0-EA15, ER0-ER15,
+// or a GRS index) and a value string into a GRS index and value.
+func parseConformanceRegister(name string, value string) (uint64, uint64, error) {
+	var regIndex uint64
+	upName := strings.ToUpper(name)
+	prefixes := []struct {
+		prefix string
+		base   uint64
+	}{
+		{"EX", common.EX0},
+		{"EA", common.EA0},
+		{"ER", common.ER0},
+		{"X", common.X0},
+		{"A", common.A0},
+		{"R", common.R0},
+	}
+
+	found := false
+	for _, p := range prefixes {
+		if strings.HasPrefix(upName, p.prefix) {
+			n, err := strconv.ParseUint(upName[len(p.prefix):], 10, 64)
+			if err != nil || n > 15 {
+				return 0, 0, fmt.Errorf("invalid register name '%s'", name)
+			}
+			regIndex = p.base + n
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		n, err := strconv.ParseUint(name, 0, 64)
+		if err != nil || n >= 128 {
+			return 0, 0, fmt.Errorf("invalid register name '%s'", name)
+		}
+		regIndex = n
+	}
+
+	result, err := strconv.ParseUint(value, 0, 36)
+	if err != nil {
+		return 0, 0, fmt.Errorf("register %s:%s", name, err.Error())
+	}
+
+	return regIndex, result, nil
+}
+
+// resolveConformanceLocation converts "label" or "label+n" to a bank offset
+func resolveConformanceLocation(location string, labels map[string]uint64) (uint64, error) {
+	label := location
+	var addend uint64
+	if px := strings.Index(location, "+"); px >= 0 {
+		label = location[:px]
+		n, err := strconv.ParseUint(location[px+1:], 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid storage location '%s'", location)
+		}
+		addend = n
+	}
+
+	offset, ok := labels[strings.ToUpper(label)]
+	if !ok {
+		return 0, fmt.Errorf("undefined label in storage location '%s'", location)
+	}
+	return offset + addend, nil
+}
+
+func getHandlerName(handler func(*InstructionEngine) (completed bool)) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func getPendingInterruptClasses(engine *InstructionEngine) string {
+	if engine.pendingInterrupts.IsClear() {
+		return "none"
+	}
+
+	classes := make([]string, 0)
+	for _, i := range engine.pendingInterrupts.stack {
+		classes = append(classes, fmt.Sprintf("%d", i.GetClass()))
+	}
+	return strings.Join(classes, ",")
+}
+
+type conformanceDesignatorFlag struct {
+	get func(dr *common.DesignatorRegister) bool
+	set func(dr *common.DesignatorRegister, value bool)
+}
+
+var conformanceDesignatorFlags = map[string]conformanceDesignatorFlag{
+	"carry": {
+		(*common.DesignatorRegister).IsCarrySet,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetCarry(value) },
+	},
+	"overflow": {
+		(*common.DesignatorRegister).IsOverflowSet,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetOverflow(value) },
+	},
+	"characteristicUnderflow": {
+		(*common.DesignatorRegister).IsCharacteristicUnderflowSet,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetCharacteristicUnderflow(value) },
+	},
+	"characteristicOverflow": {
+		(*common.DesignatorRegister).IsCharacteristicOverflowSet,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetCharacteristicOverflow(value) },
+	},
+	"divideCheck": {
+		(*common.DesignatorRegister).IsDivideCheckSet,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetDivideCheck(value) },
+	},
+	"arithmeticExceptionEnabled": {
+		(*common.DesignatorRegister).IsArithmeticExceptionEnabled,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetArithmeticExceptionEnabled(value) },
+	},
+	"operationTrapEnabled": {
+		(*common.DesignatorRegister).IsOperationTrapEnabled,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetOperationTrapEnabled(value) },
+	},
+	"quarterWordModeEnabled": {
+		(*common.DesignatorRegister).IsQuarterWordModeEnabled,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetQuarterWordModeEnabled(value) },
+	},
+	"execRegisterSetSelected": {
+		(*common.DesignatorRegister).IsExecRegisterSetSelected,
+		func(dr *common.DesignatorRegister, value bool) { dr.SetExecRegisterSetSelected(value) },
+	},
+}
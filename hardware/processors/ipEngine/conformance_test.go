@@ -0,0 +1,64 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Conformance_Vectors(t *testing.T) {
+	fileNames, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.json"))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if len(fileNames) == 0 {
+		t.Fatalf("No conformance vectors found")
+	}
+
+	runner := NewConformanceRunner()
+	for _, fileName := range fileNames {
+		vectors, err := LoadConformanceVectors(fileName)
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+
+		for _, vector := range vectors {
+			results, err := runner.Run(vector)
+			if err != nil {
+				t.Errorf("%s:%s", fileName, err.Error())
+				continue
+			}
+			for _, result := range results {
+				if !result.IsSuccessful() {
+					t.Errorf("%s:%s", fileName, result.GetString())
+				}
+			}
+		}
+	}
+
+	t.Logf("\n%s", runner.GetCoverageReport())
+}
+
+func Test_Conformance_MalformedVector(t *testing.T) {
+	runner := NewConformanceRunner()
+	vector := &ConformanceVector{
+		Name:      "bad register",
+		Registers: map[string]string{"Q1": "0"},
+		Code:      [][]string{},
+	}
+	if _, err := runner.Run(vector); err == nil {
+		t.Errorf("Expected an error for an invalid register name")
+	}
+
+	vector = &ConformanceVector{
+		Name:   "bad location",
+		Code:   [][]string{},
+		Expect: ConformanceExpectation{Storage: map[string]string{"nowhere": "0"}},
+	}
+	if _, err := runner.Run(vector); err == nil {
+		t.Errorf("Expected an error for an undefined storage location")
+	}
+}
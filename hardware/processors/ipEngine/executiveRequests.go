@@ -0,0 +1,83 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+// ExecutiveRequestHandler services an ER or SGNL instruction in Go code.
+// When a handler is registered for a particular ER index (or SGNL code), the instruction invokes the handler
+// instead of posting the usual class 12 signal interrupt. The handler has full access to the engine,
+// and may examine or update registers and storage, post interrupts, or stop the engine.
+// The return value has the same meaning as for any instruction handler - if true, the instruction completes
+// and execution resumes with the next instruction. If false, the handler must have posted an interrupt
+// or stopped the engine.
+type ExecutiveRequestHandler interface {
+	Invoke(e *InstructionEngine, code uint64) (completed bool)
+}
+
+// ExecutiveRequestHandlerFunc allows an ordinary function to be used as an ExecutiveRequestHandler
+type ExecutiveRequestHandlerFunc func(e *InstructionEngine, code uint64) (completed bool)
+
+func (f ExecutiveRequestHandlerFunc) Invoke(e *InstructionEngine, code uint64) (completed bool) {
+	return f(e, code)
+}
+
+// ExecutiveRequestTable maps ER indices and SGNL codes to the handlers which service them.
+// A table may be shared among several engines, provided it is not updated while they are running.
+type ExecutiveRequestTable struct {
+	erHandlers     map[uint64]ExecutiveRequestHandler
+	signalHandlers map[uint64]ExecutiveRequestHandler
+}
+
+func NewExecutiveRequestTable() *ExecutiveRequestTable {
+	return &ExecutiveRequestTable{
+		erHandlers:     make(map[uint64]ExecutiveRequestHandler),
+		signalHandlers: make(map[uint64]ExecutiveRequestHandler),
+	}
+}
+
+func (ert *ExecutiveRequestTable) GetERHandler(erIndex uint64) (ExecutiveRequestHandler, bool) {
+	handler, ok := ert.erHandlers[erIndex]
+	return handler, ok
+}
+
+func (ert *ExecutiveRequestTable) GetSignalHandler(signalCode uint64) (ExecutiveRequestHandler, bool) {
+	handler, ok := ert.signalHandlers[signalCode]
+	return handler, ok
+}
+
+// RegisterER establishes a handler for the given ER index, replacing any previous handler
+func (ert *ExecutiveRequestTable) RegisterER(erIndex uint64, handler ExecutiveRequestHandler) {
+	ert.erHandlers[erIndex] = handler
+}
+
+// RegisterSignal establishes a handler for the given SGNL code, replacing any previous handler
+func (ert *ExecutiveRequestTable) RegisterSignal(signalCode uint64, handler ExecutiveRequestHandler) {
+	ert.signalHandlers[signalCode] = handler
+}
+
+// UnregisterER removes the handler (if any) for the given ER index, so that it once again posts an interrupt
+func (ert *ExecutiveRequestTable) UnregisterER(erIndex uint64) {
+	delete(ert.erHandlers, erIndex)
+}
+
+// UnregisterSignal removes the handler (if any) for the given SGNL code, so that it once again posts an interrupt
+func (ert *ExecutiveRequestTable) UnregisterSignal(signalCode uint64) {
+	delete(ert.signalHandlers, signalCode)
+}
+
+// findERHandler retrieves the handler for the given ER index, if there is a table and it contains such a handler
+func (e *InstructionEngine) findERHandler(erIndex uint64) (ExecutiveRequestHandler, bool) {
+	if e.executiveRequestTable == nil {
+		return nil, false
+	}
+	return e.executiveRequestTable.GetERHandler(erIndex)
+}
+
+// findSignalHandler retrieves the handler for the given SGNL code, if there is a table and it contains such a handler
+func (e *InstructionEngine) findSignalHandler(signalCode uint64) (ExecutiveRequestHandler, bool) {
+	if e.executiveRequestTable == nil {
+		return nil, false
+	}
+	return e.executiveRequestTable.GetSignalHandler(signalCode)
+}
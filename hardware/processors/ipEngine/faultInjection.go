@@ -0,0 +1,57 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"khalehla/common"
+	"khalehla/hardware"
+)
+
+// The engine consults the fault injector attached to main storage (if any) at the following points:
+//   - between instructions, for instruction processor hardware checks
+//   - on instruction fetch, for storage read faults and stuck bits
+//   - on operand reads, for storage read faults and stuck bits
+//     (stuck bits are not applied to multi-word operands which are to be updated in place)
+//   - on operand writes, for storage write faults
+// Every injected fault results in a hardware check interrupt (class 1).
+
+// checkStorageFaults checks each word of a multi-word storage reference for an injected fault of the given kind.
+// Returns a hardware check interrupt for the first failing word, else nil.
+func (e *InstructionEngine) checkStorageFaults(kind hardware.FaultKind, absAddr *common.AbsoluteAddress, count uint64) common.Interrupt {
+	if e.mainStorage.GetFaultInjector() == nil {
+		return nil
+	}
+
+	for ax := uint64(0); ax < count; ax++ {
+		wordAddr := common.NewAbsoluteAddress(absAddr.GetSegment(), absAddr.GetOffset()+ax)
+		var interrupt common.Interrupt
+		if kind == hardware.StorageWriteFault {
+			interrupt = e.mainStorage.CheckWriteFault(wordAddr)
+		} else {
+			interrupt = e.mainStorage.CheckReadFault(wordAddr)
+		}
+		if interrupt != nil {
+			return interrupt
+		}
+	}
+
+	return nil
+}
+
+// applyStuckBits returns the given words, which were read from the given location, as modified by any stuck bits.
+// If no bits are stuck, the original slice is returned. Otherwise, a modified copy is returned.
+func (e *InstructionEngine) applyStuckBits(absAddr *common.AbsoluteAddress, words []common.Word36) []common.Word36 {
+	injector := e.mainStorage.GetFaultInjector()
+	if injector == nil || !injector.HasRules(hardware.StuckBitFault) {
+		return words
+	}
+
+	result := make([]common.Word36, len(words))
+	for wx := range words {
+		wordAddr := common.NewAbsoluteAddress(absAddr.GetSegment(), absAddr.GetOffset()+uint64(wx))
+		result[wx] = common.Word36(e.mainStorage.ApplyStuckBits(wordAddr, words[wx].GetW()))
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"testing"
+
+	"khalehla/common"
+	"khalehla/hardware"
+	"khalehla/tasm"
+)
+
+// faultExtendedMode loads the same word twice. With LinkSimple the code occupies offsets 0 to 2 of the bank,
+// and the data word is at offset 3.
+var faultExtendedMode = []*tasm.SourceItem{
+	segSourceItem(077),
+	labelDataSourceItem("data", []uint64{0}),
+
+	segSourceItem(0),
+	laSourceItemHIBRef(jW, regA0, 0, 0, 0, 0, "data"),
+	laSourceItemHIBRef(jW, regA1, 0, 0, 0, 0, "data"),
+	iarSourceItem(0),
+}
+
+const faultDataOffset = 3
+
+func runFaultTest(t *testing.T, rule hardware.FaultRule) (*InstructionEngine, *hardware.FaultInjector) {
+	ute := loadTestProgram(t, faultExtendedMode)
+	injector := hardware.NewFaultInjector(0)
+	err := injector.AddRule(rule)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	ute.storage.SetFaultInjector(injector)
+
+	err = ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	return ute.GetEngine(), injector
+}
+
+func Test_FaultInjection_StuckBits(t *testing.T) {
+	engine, injector := runFaultTest(t, hardware.FaultRule{
+		Kind:    hardware.StuckBitFault,
+		Segment: -1,
+		Offset:  faultDataOffset,
+		Length:  1,
+		Mask:    0_400000_000001,
+		Value:   0_000000_000001,
+	})
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.A0, 1)
+	checkRegister(t, engine, common.A1, 1)
+	if len(injector.GetLog()) != 2 {
+		t.Errorf("Expected 2 faults logged, got %d", len(injector.GetLog()))
+	}
+}
+
+func Test_FaultInjection_StorageRead(t *testing.T) {
+	engine, injector := runFaultTest(t, hardware.FaultRule{
+		Kind:    hardware.StorageReadFault,
+		Segment: -1,
+		Offset:  faultDataOffset,
+		Length:  1,
+		Every:   2,
+	})
+
+	checkInterrupt(t, engine, common.HardwareCheckInterruptClass)
+	if engine.GetProgramAddressRegister().GetProgramCounter() != 01001 {
+		t.Errorf("Expected the second LA to be interrupted, PAR.PC=%06o", engine.GetProgramAddressRegister().GetProgramCounter())
+	}
+	if len(injector.GetLog()) != 1 {
+		t.Errorf("Expected 1 fault logged, got %d", len(injector.GetLog()))
+	}
+}
+
+func Test_FaultInjection_ProcessorCheck(t *testing.T) {
+	engine, injector := runFaultTest(t, hardware.FaultRule{
+		Kind:   hardware.InstructionProcessorCheckFault,
+		Target: "IPTEST",
+		Skip:   1,
+		Every:  1,
+		Limit:  1,
+	})
+
+	checkInterrupt(t, engine, common.HardwareCheckInterruptClass)
+	if engine.activityStatePacket.GetIndicatorKeyRegister().IsInstructionInF0() {
+		t.Errorf("Expected the check to occur between instructions")
+	}
+	if len(injector.GetLog()) != 1 || injector.GetLog()[0].Target != "IPTEST" {
+		t.Errorf("Unexpected fault log %v", injector.GetLog())
+	}
+}
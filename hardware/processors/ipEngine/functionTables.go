@@ -739,3 +739,119 @@ func extendedModeFunction75Handler(e *InstructionEngine) (completed bool) {
 		return false
 	}
 }
+
+//	Direct dispatch ----------------------------------------------------------------------------------------------------
+
+// subFunctionTable describes one of the second-level tables above, which is selected by the f field
+// and indexed either by the j field or by the a field.
+type subFunctionTable struct {
+	indexByA bool
+	table    map[uint]func(engine *InstructionEngine) (completed bool)
+}
+
+// Basic Mode second-level tables, keyed by the f field
+var basicModeSubFunctionTables = map[uint]subFunctionTable{
+	005: {true, basicModeFunction05Table},
+	007: {false, basicModeFunction07Table},
+	071: {false, basicModeFunction71Table},
+	072: {false, basicModeFunction72Table},
+	073: {false, basicModeFunction73Table},
+	074: {false, basicModeFunction74Table},
+	075: {false, basicModeFunction75Table},
+}
+
+// Basic Mode third-level tables, keyed by f<<4|j - these are always indexed by the a field
+var basicModeSubSubFunctionTables = map[uint]map[uint]func(engine *InstructionEngine) (completed bool){
+	073<<4 | 015: basicModeFunction7315Table,
+	073<<4 | 017: basicModeFunction7317Table,
+	074<<4 | 004: basicModeFunction7404Table,
+	074<<4 | 014: basicModeFunction7414Table,
+	074<<4 | 015: basicModeFunction7415Table,
+}
+
+// Extended Mode second-level tables, keyed by the f field
+var extendedModeSubFunctionTables = map[uint]subFunctionTable{
+	005: {true, extendedModeFunction05Table},
+	007: {false, extendedModeFunction07Table},
+	033: {false, extendedModeFunction33Table},
+	037: {false, extendedModeFunction37Table},
+	050: {true, extendedModeFunction50Table},
+	071: {false, extendedModeFunction71Table},
+	072: {false, extendedModeFunction72Table},
+	073: {false, extendedModeFunction73Table},
+	074: {false, extendedModeFunction74Table},
+	075: {false, extendedModeFunction75Table},
+}
+
+// Extended Mode third-level tables, keyed by f<<4|j - these are always indexed by the a field
+var extendedModeSubSubFunctionTables = map[uint]map[uint]func(engine *InstructionEngine) (completed bool){
+	037<<4 | 004: extendedModeFunction3704Table,
+	073<<4 | 014: extendedModeFunction7314Table,
+	073<<4 | 015: extendedModeFunction7315Table,
+	073<<4 | 017: extendedModeFunction7317Table,
+	074<<4 | 014: extendedModeFunction7414Table,
+	074<<4 | 015: extendedModeFunction7415Table,
+}
+
+// directFunctionTable holds a pointer to the final instruction handler for every combination of
+// f, j, and a fields, indexed by f<<8|j<<4|a. Entries for invalid instructions are nil.
+type directFunctionTable [0100 << 8]func(engine *InstructionEngine) (completed bool)
+
+var basicModeDirectFunctionTable = buildDirectFunctionTable(
+	BasicModeFunctionTable, basicModeSubFunctionTables, basicModeSubSubFunctionTables)
+
+var extendedModeDirectFunctionTable = buildDirectFunctionTable(
+	ExtendedModeFunctionTable, extendedModeSubFunctionTables, extendedModeSubSubFunctionTables)
+
+// buildDirectFunctionTable flattens the nested tables for one mode into a directFunctionTable,
+// so that an instruction can be dispatched with a single array index rather than a series of map lookups.
+func buildDirectFunctionTable(
+	topTable map[uint]func(*InstructionEngine) (completed bool),
+	subTables map[uint]subFunctionTable,
+	subSubTables map[uint]map[uint]func(engine *InstructionEngine) (completed bool),
+) *directFunctionTable {
+	table := &directFunctionTable{}
+	for f := uint(0); f < 0100; f++ {
+		for j := uint(0); j < 020; j++ {
+			for a := uint(0); a < 020; a++ {
+				table[f<<8|j<<4|a] = findFunctionHandler(topTable, subTables, subSubTables, f, j, a)
+			}
+		}
+	}
+	return table
+}
+
+func findFunctionHandler(
+	topTable map[uint]func(*InstructionEngine) (completed bool),
+	subTables map[uint]subFunctionTable,
+	subSubTables map[uint]map[uint]func(engine *InstructionEngine) (completed bool),
+	f uint,
+	j uint,
+	a uint,
+) func(*InstructionEngine) (completed bool) {
+	sub, ok := subTables[f]
+	if !ok {
+		return topTable[f]
+	}
+
+	if sub.indexByA {
+		return sub.table[a]
+	}
+
+	if subSub, ok := subSubTables[f<<4|j]; ok {
+		return subSub[a]
+	}
+
+	return sub.table[j]
+}
+
+// lookupFunctionHandler retrieves the final instruction handler for the given instruction word,
+// or nil if the word does not describe a valid instruction for the given mode.
+func lookupFunctionHandler(basicMode bool, iw *common.InstructionWord) func(*InstructionEngine) (completed bool) {
+	index := iw.GetF()<<8 | iw.GetJ()<<4 | iw.GetA()
+	if basicMode {
+		return basicModeDirectFunctionTable[index]
+	} else {
+		return extendedModeDirectFunctionTable[index]
+	}
+}
@@ -0,0 +1,190 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+// loopExtendedMode counts A0 up and A1 down, 0100 times round a tight loop.
+var loopExtendedMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	laSourceItemU(jU, regA0, 0, 0),
+	laSourceItemU(jU, regA1, 0, 0100),
+	labelSourceItem("loop"),
+	aaSourceItemU(jU, regA0, 0, 1),
+	anaSourceItemU(jU, regA1, 0, 1),
+	jnzSourceItemRef(regA1, "loop"),
+	iarSourceItem(0),
+}
+
+// selfModifyingExtendedMode executes the instruction at 'patch' twice, replacing it in between
+// with an instruction having a different function code. A stale decoded instruction would leave A0 == 1.
+var selfModifyingExtendedMode = []*tasm.SourceItem{
+	segSourceItem(077),
+	labelDataSourceItem("newInst", []uint64{fLNA<<30 | jU<<26 | regA0<<22 | 05}),
+
+	segSourceItem(0),
+	laSourceItemU(jU, regA3, 0, 0),
+	labelSourceItem("patch"),
+	laSourceItemU(jU, regA0, 0, 1),
+	jnzSourceItemRef(regA3, "done"),
+	laSourceItemHIBRef(jW, regA1, 0, 0, 0, 0, "newInst"),
+	saSourceItemHIBRef(jW, regA1, 0, 0, 0, 0, "patch"),
+	laSourceItemU(jU, regA3, 0, 1),
+	jSourceItemRefExtended("patch"),
+	labelSourceItem("done"),
+	iarSourceItem(0),
+}
+
+// loadTestProgram assembles and links the given source, and loads it into a new UnitTestEngine
+func loadTestProgram(t testing.TB, source []*tasm.SourceItem) *UnitTestEngine {
+	sourceSet := tasm.NewSourceSet("Test", source)
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	e := tasm.Executable{}
+	e.LinkSimple(a.GetSegments(), true)
+
+	ute := NewUnitTestExecutor()
+	err := ute.Load(&e)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	return ute
+}
+
+// loadSourceFileTest is loadTestProgram for a program kept as assembler source text in testdata
+func loadSourceFileTest(t testing.TB, fileName string) *UnitTestEngine {
+	sourceSet, diagnostics, err := tasm.ParseSourceFile(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	if diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("%s\n", diagnostics.GetDiagnostics()[0].GetString())
+	}
+	return loadTestProgram(t, sourceSet.GetSourceItems())
+}
+
+// dispatchConfiguration selects how the engine finds the handler for each instruction
+type dispatchConfiguration int
+
+const (
+	mapDispatch dispatchConfiguration = iota
+	directDispatch
+	cachedDispatch
+	translatedDispatch
+)
+
+func (dc dispatchConfiguration) apply(engine *InstructionEngine) {
+	engine.SetDirectDispatchEnabled(dc != mapDispatch)
+	engine.SetInstructionCacheEnabled(dc == cachedDispatch || dc == translatedDispatch)
+	engine.SetBlockTranslationEnabled(dc == translatedDispatch)
+}
+
+func Test_FunctionTables_Loop(t *testing.T) {
+	for _, dc := range []dispatchConfiguration{mapDispatch, directDispatch, cachedDispatch, translatedDispatch} {
+		ute := loadTestProgram(t, loopExtendedMode)
+		engine := ute.GetEngine()
+		dc.apply(engine)
+		err := ute.Run()
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+
+		checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+		checkRegister(t, engine, common.A0, 0100)
+		checkRegister(t, engine, common.A1, 0)
+	}
+}
+
+func Test_FunctionTables_SourceFile(t *testing.T) {
+	ute := loadSourceFileTest(t, "loop.asm")
+	engine := ute.GetEngine()
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.A0, 0100)
+	checkRegister(t, engine, common.A1, 0)
+}
+
+func Test_FunctionTables_SelfModifyingCode(t *testing.T) {
+	ute := loadTestProgram(t, selfModifyingExtendedMode)
+	engine := ute.GetEngine()
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.A0, 0_777777_777772)
+	checkRegister(t, engine, common.A3, 1)
+}
+
+//	Benchmarks ---------------------------------------------------------------------------------------------------------
+
+// benchmarkLoopExtendedMode is loopExtendedMode without the IAR - it jumps back to the start instead,
+// so that the engine never stops (stopping writes to stdout, which would swamp the measurement).
+var benchmarkLoopExtendedMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	labelSourceItem("start"),
+	laSourceItemU(jU, regA0, 0, 0),
+	laSourceItemU(jU, regA1, 0, 0100),
+	labelSourceItem("loop"),
+	aaSourceItemU(jU, regA0, 0, 1),
+	anaSourceItemU(jU, regA1, 0, 1),
+	jnzSourceItemRef(regA1, "loop"),
+	jSourceItemRefExtended("start"),
+}
+
+// benchmarkLoopInstructions is the number of instructions executed by one pass of benchmarkLoopExtendedMode
+const benchmarkLoopInstructions = 2 + 0100*3 + 1
+
+// benchmarkLoop runs one pass of the benchmark loop program per op, that is, until PAR.PC arrives back at the start.
+// All loading and setup is done before the timer starts, and nothing in the timed loop writes to stdout.
+// With block translation, one cycle may execute many instructions, so compare instructions/s rather than cycles.
+func benchmarkLoop(b *testing.B, dc dispatchConfiguration) {
+	ute := loadTestProgram(b, benchmarkLoopExtendedMode)
+	engine := ute.GetEngine()
+	engine.SetLogInstructions(false)
+	engine.SetLogInterrupts(false)
+	dc.apply(engine)
+	engine.GetGeneralRegisterSet().Clear()
+	engine.ClearStop()
+	engine.ClearAllInterrupts()
+	engine.ClearJumpHistory()
+
+	par := engine.GetProgramAddressRegister()
+	ikr := engine.activityStatePacket.GetIndicatorKeyRegister()
+	startAddress := par.GetProgramCounter()
+
+	b.ResetTimer()
+	for bx := 0; bx < b.N; bx++ {
+		// each pass records 0101 jumps - rewind the jump history so that it never fills
+		engine.jumpHistory.stackIndex = 0
+		engine.DoCycle()
+		for par.GetProgramCounter() != startAddress || ikr.IsInstructionInF0() {
+			engine.DoCycle()
+		}
+	}
+	b.StopTimer()
+
+	if engine.HasPendingInterrupt() || engine.IsStopped() {
+		b.Fatalf("benchmark program did not run to completion")
+	}
+	b.ReportMetric(float64(b.N*benchmarkLoopInstructions)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func Benchmark_Engine_MapDispatch(b *testing.B)     { benchmarkLoop(b, mapDispatch) }
+func Benchmark_Engine_DirectDispatch(b *testing.B)  { benchmarkLoop(b, directDispatch) }
+func Benchmark_Engine_Cached(b *testing.B)          { benchmarkLoop(b, cachedDispatch) }
+func Benchmark_Engine_BlockTranslated(b *testing.B) { benchmarkLoop(b, translatedDispatch) }
@@ -0,0 +1,104 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"fmt"
+
+	"khalehla/common"
+)
+
+// decodedInstruction is one entry in the InstructionCache.
+// It records the instruction word which was decoded, the mode in which it was decoded,
+// and the final instruction handler for that word in that mode.
+type decodedInstruction struct {
+	valid     bool
+	basicMode bool
+	word      uint64
+	handler   func(*InstructionEngine) (completed bool)
+}
+
+// InstructionCache holds pre-decoded instructions, keyed by absolute address (segment index and offset).
+// Entries are invalidated when the engine stores into a cached location, and the whole cache is invalidated
+// whenever a base register is changed. As an additional safeguard (other engines may store into code which
+// we have cached) an entry is only used if the word in storage still matches the word which was decoded.
+type InstructionCache struct {
+	segments      [][]decodedInstruction // indexed by segment index - each is nil, or as long as the cached part of the segment
+	hits          uint64
+	misses        uint64
+	invalidations uint64
+}
+
+func NewInstructionCache() *InstructionCache {
+	return &InstructionCache{
+		segments: make([][]decodedInstruction, 0),
+	}
+}
+
+// Clear invalidates all entries in the cache
+func (ic *InstructionCache) Clear() {
+	ic.segments = make([][]decodedInstruction, 0)
+	ic.invalidations++
+}
+
+func (ic *InstructionCache) Dump() {
+	fmt.Printf("  Instruction Cache: hits=%d misses=%d invalidations=%d\n", ic.hits, ic.misses, ic.invalidations)
+}
+
+func (ic *InstructionCache) GetStatistics() (hits uint64, misses uint64, invalidations uint64) {
+	return ic.hits, ic.misses, ic.invalidations
+}
+
+// Invalidate removes the entries (if any) for count consecutive locations starting at the given absolute address
+func (ic *InstructionCache) Invalidate(segment uint, offset uint64, count uint64) {
+	if segment >= uint(len(ic.segments)) {
+		return
+	}
+
+	entries := ic.segments[segment]
+	for ox := offset; ox < offset+count && ox < uint64(len(entries)); ox++ {
+		if entries[ox].valid {
+			entries[ox].valid = false
+			ic.invalidations++
+		}
+	}
+}
+
+// lookup returns the handler for the given word at the given absolute address, decoding it and caching
+// the result if necessary. Returns nil if the word is not a valid instruction in the given mode.
+func (ic *InstructionCache) lookup(segment uint, offset uint64, word uint64, basicMode bool) func(*InstructionEngine) (completed bool) {
+	entry := ic.getEntry(segment, offset)
+	if entry.valid && entry.word == word && entry.basicMode == basicMode {
+		ic.hits++
+		return entry.handler
+	}
+
+	ic.misses++
+	iw := common.InstructionWord(word)
+	entry.handler = lookupFunctionHandler(basicMode, &iw)
+	entry.word = word
+	entry.basicMode = basicMode
+	entry.valid = true
+	return entry.handler
+}
+
+func (ic *InstructionCache) getEntry(segment uint, offset uint64) *decodedInstruction {
+	if segment >= uint(len(ic.segments)) {
+		grown := make([][]decodedInstruction, segment+1)
+		copy(grown, ic.segments)
+		ic.segments = grown
+	}
+
+	entries := ic.segments[segment]
+	if offset >= uint64(len(entries)) {
+		// grow to the next multiple of 01000 words beyond the offset
+		grown := make([]decodedInstruction, (offset|0777)+1)
+		copy(grown, entries)
+		ic.segments[segment] = grown
+		entries = grown
+	}
+
+	return &entries[offset]
+}
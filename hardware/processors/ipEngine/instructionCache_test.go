@@ -0,0 +1,106 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"testing"
+
+	"khalehla/common"
+)
+
+func Test_InstructionCache_MatchesUncached(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ute := loadTestProgram(t, loopExtendedMode)
+		engine := ute.GetEngine()
+		engine.SetInstructionCacheEnabled(enabled)
+		err := ute.Run()
+		if err != nil {
+			t.Fatalf("%s\n", err.Error())
+		}
+
+		checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+		checkRegister(t, engine, common.A0, 0100)
+		checkRegister(t, engine, common.A1, 0)
+
+		hits, misses, _ := engine.GetInstructionCache().GetStatistics()
+		if enabled && (hits == 0 || misses == 0) {
+			t.Fatalf("Expected cache hits and misses, got hits=%d misses=%d", hits, misses)
+		} else if !enabled && (hits != 0 || misses != 0) {
+			t.Fatalf("Expected no cache activity, got hits=%d misses=%d", hits, misses)
+		}
+	}
+}
+
+func Test_InstructionCache_StoreInvalidates(t *testing.T) {
+	ute := loadTestProgram(t, selfModifyingExtendedMode)
+	engine := ute.GetEngine()
+	engine.SetInstructionCacheEnabled(true)
+	_, _, before := engine.GetInstructionCache().GetStatistics()
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.A0, 0_777777_777772)
+
+	// the only invalidation is that of the entry for 'patch', by the SA which stores into it
+	_, _, after := engine.GetInstructionCache().GetStatistics()
+	if after-before != 1 {
+		t.Fatalf("Expected one invalidation, got %d", after-before)
+	}
+}
+
+func Test_InstructionCache_BaseRegisterChange(t *testing.T) {
+	ute := loadTestProgram(t, loopExtendedMode)
+	engine := ute.GetEngine()
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	ic := engine.GetInstructionCache()
+	_, misses, invalidations := ic.GetStatistics()
+	engine.SetBaseRegister(1, engine.GetBaseRegister(0))
+	if len(ic.segments) != 0 {
+		t.Fatalf("Expected the cache to be emptied by a base register change")
+	}
+
+	_, _, after := ic.GetStatistics()
+	if after != invalidations+1 {
+		t.Fatalf("Expected one more invalidation, got %d", after-invalidations)
+	}
+
+	word := uint64(fLA<<30 | jU<<26 | regA0<<22 | 01)
+	ic.lookup(2, 01234, word, false)
+	_, afterMisses, _ := ic.GetStatistics()
+	if afterMisses != misses+1 {
+		t.Fatalf("Expected a miss after the base register change, got %d", afterMisses-misses)
+	}
+}
+
+func Test_InstructionCache_Invalidate(t *testing.T) {
+	ic := NewInstructionCache()
+	word := uint64(fLA<<30 | jU<<26 | regA0<<22 | 01)
+	if ic.lookup(2, 01234, word, false) == nil {
+		t.Fatalf("Expected a handler for LA,U")
+	}
+	ic.lookup(2, 01234, word, false)
+	ic.Invalidate(2, 01230, 010)
+	ic.lookup(2, 01234, word, false)
+
+	hits, misses, invalidations := ic.GetStatistics()
+	if hits != 1 || misses != 2 || invalidations != 1 {
+		t.Fatalf("Expected hits=1 misses=2 invalidations=1, got hits=%d misses=%d invalidations=%d",
+			hits, misses, invalidations)
+	}
+
+	// the same word in the other mode must be decoded afresh
+	ic.lookup(2, 01234, word, true)
+	_, misses, _ = ic.GetStatistics()
+	if misses != 3 {
+		t.Fatalf("Expected a miss on mode change, got misses=%d", misses)
+	}
+}
@@ -6,6 +6,8 @@ package ipEngine
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"khalehla/common"
 	"khalehla/dasm"
@@ -54,6 +56,11 @@ const (
 	InterruptHandlerOffsetOutOfRangeStop
 	InterruptHandlerInvalidBankTypeStop
 	InterruptHandlerInvalidLevelBDIStop
+
+	//  User-mode emulation stops (see userModeEmulator.go)...
+
+	UserModeExitStop
+	UserModeAbortStop
 )
 
 const L0BDTBaseRegister = common.B16
@@ -125,6 +132,24 @@ type InstructionEngine struct {
 	baseRegisterIndexForFetch uint // only applies to basic mode - if 0, it is not valid; otherwise it is 12:15
 	generalRegisterSet        *common.GeneralRegisterSet
 
+	//	Pre-decoded instructions, keyed by absolute address
+	instructionCache        *InstructionCache
+	instructionCacheEnabled bool
+	directDispatchEnabled   bool // if false, instructions are dispatched through FunctionTable as they once were
+
+	//	Translated blocks of straight-line code, keyed by newBlockKey() - see blockTranslator.go
+	translatedBlocks        map[uint64]*translatedBlock
+	blockGeneration         uint64 // incremented whenever all the translated blocks are invalidated
+	blockTranslationEnabled bool
+	blocksTranslated        uint64
+	blocksExecuted          uint64
+
+	//	If not nil, ER and SGNL instructions are serviced by Go code where the table has a handler
+	executiveRequestTable *ExecutiveRequestTable
+
+	//	If not nil, unimplemented instructions are serviced by Go code where the table has a handler
+	operationTrapTable *OperationTrapTable
+
 	//	If not nil, describes an interrupt which needs to be handled as soon as possible
 	pendingInterrupts *InterruptStack
 	jumpHistory       *JumpHistory
@@ -142,7 +167,10 @@ type InstructionEngine struct {
 	breakpointRead    bool
 	breakpointWrite   bool
 
-	isStopped        bool
+	// isStopped may be set from another goroutine (see Stop), so it is atomic and the reason and detail are
+	// protected by stopMutex
+	isStopped        atomic.Bool
+	stopMutex        sync.Mutex
 	stopReason       StopReason
 	stopDetail       common.Word36
 	instructionPoint InstructionPoint
@@ -182,6 +210,8 @@ func NewEngine(name string, mainStorage *hardware.MainStorage) *InstructionEngin
 	e := &InstructionEngine{}
 	e.name = name
 	e.mainStorage = mainStorage
+	e.instructionCacheEnabled = true
+	e.directDispatchEnabled = true
 	e.Clear()
 	return e
 }
@@ -201,15 +231,20 @@ func (e *InstructionEngine) Clear() {
 
 	e.generalRegisterSet = common.NewGeneralRegisterSet()
 	e.activityStatePacket = common.NewActivityStatePacket()
+	e.instructionCache = NewInstructionCache()
+	e.translatedBlocks = make(map[uint64]*translatedBlock)
+	e.blockGeneration++
 	e.breakpointAddress = nil
 	e.breakpointHalt = false
 	e.breakpointFetch = false
 	e.breakpointRead = false
 	e.breakpointWrite = false
 
-	e.isStopped = true
+	e.stopMutex.Lock()
 	e.stopReason = InitialStop
 	e.stopDetail = 0
+	e.isStopped.Store(true)
+	e.stopMutex.Unlock()
 
 	e.preventPCUpdate = false
 	e.instructionPoint = BetweenInstructions
@@ -224,7 +259,7 @@ func (e *InstructionEngine) ClearJumpHistory() {
 }
 
 func (e *InstructionEngine) ClearStop() {
-	e.isStopped = false
+	e.isStopped.Store(false)
 }
 
 // DoCycle executes one cycle
@@ -283,10 +318,25 @@ func (e *InstructionEngine) ClearStop() {
 func (e *InstructionEngine) DoCycle() {
 	ikr := e.activityStatePacket.GetIndicatorKeyRegister()
 	if !ikr.IsInstructionInF0() {
+		injector := e.mainStorage.GetFaultInjector()
+		if injector != nil && injector.Check(hardware.InstructionProcessorCheckFault, e.name) {
+			e.PostInterrupt(common.NewHardwareCheckInterrupt(&common.AbsoluteAddress{}))
+			return
+		}
+
+		if e.blockTranslationEnabled && injector == nil && e.executeBlock() {
+			return
+		}
 		e.fetchInstructionWord()
 		return
 	}
 
+	e.executeCycle()
+}
+
+// executeCycle is the part of DoCycle which executes (or continues executing) the instruction in F0.
+func (e *InstructionEngine) executeCycle() {
+	ikr := e.activityStatePacket.GetIndicatorKeyRegister()
 	complete := false
 	isEXRF := ikr.IsExecuteRepeatedInstruction()
 	if ikr.IsExecuteRepeatedInstruction() {
@@ -393,6 +443,15 @@ func (e *InstructionEngine) Dump() {
 		abte := e.activeBaseTable[bx]
 		fmt.Printf("    %2d:%s\n", bx, abte.GetString())
 	}
+
+	if e.instructionCacheEnabled {
+		e.instructionCache.Dump()
+	}
+
+	if e.blockTranslationEnabled {
+		fmt.Printf("  Translated Blocks: current=%d translated=%d executed=%d\n",
+			len(e.translatedBlocks), e.blocksTranslated, e.blocksExecuted)
+	}
 }
 
 // FindBasicModeBank takes a relative address and determines which (if any) of the basic mode banks
@@ -496,7 +555,15 @@ func (e *InstructionEngine) GetConsecutiveOperands(grsCheck bool, count uint64,
 		return
 	}
 
+	result.interrupt = e.checkStorageFaults(hardware.StorageReadFault, result.sourceAbsoluteAddress, count)
+	if result.interrupt != nil {
+		return
+	}
+
 	result.source, result.interrupt = e.mainStorage.GetSliceFromAddress(result.sourceAbsoluteAddress, count)
+	if !forUpdate && result.interrupt == nil {
+		result.source = e.applyStuckBits(result.sourceAbsoluteAddress, result.source)
+	}
 
 	_, result.interrupt = e.checkBreakpointRange(BreakpointRead, result.sourceAbsoluteAddress, count)
 	return
@@ -564,6 +631,19 @@ func (e *InstructionEngine) GetGeneralRegisterSet() *common.GeneralRegisterSet {
 	return e.generalRegisterSet
 }
 
+func (e *InstructionEngine) GetExecutiveRequestTable() *ExecutiveRequestTable {
+	return e.executiveRequestTable
+}
+
+func (e *InstructionEngine) GetOperationTrapTable() *OperationTrapTable {
+	return e.operationTrapTable
+}
+
+// GetInstructionCache retrieves a pointer to the pre-decoded instruction cache
+func (e *InstructionEngine) GetInstructionCache() *InstructionCache {
+	return e.instructionCache
+}
+
 // GetImmediateOperand retrieves an operand in the case where the u (and possibly h and i) fields
 // comprise the requested data.  This is NOT for jump instructions, which have slightly different rules.
 // Load the value indicated in F0 as follows:
@@ -764,17 +844,23 @@ func (e *InstructionEngine) GetOperand(
 			return
 		}
 
+		result.interrupt = e.mainStorage.CheckReadFault(result.sourceAbsoluteAddress)
+		if result.interrupt != nil {
+			return
+		}
+
 		if lockStorage {
 			e.mainStorage.Lock(result.sourceVirtualAddress, e)
 		}
 
 		readOffset := result.sourceRelativeAddress - bReg.GetBankDescriptor().GetLowerLimitNormalized()
 		result.source = &bReg.GetStorage()[readOffset]
+		value := e.mainStorage.ApplyStuckBits(result.sourceAbsoluteAddress, result.source.GetW())
 		if allowPartial {
 			qWordMode := dReg.IsQuarterWordModeEnabled()
-			result.operand = common.ExtractPartialWord(result.source.GetW(), jField, qWordMode)
+			result.operand = common.ExtractPartialWord(value, jField, qWordMode)
 		} else {
-			result.operand = result.source.GetW()
+			result.operand = value
 		}
 
 		_, result.interrupt = e.checkBreakpoint(BreakpointRead, result.sourceAbsoluteAddress)
@@ -788,6 +874,8 @@ func (e *InstructionEngine) GetProgramAddressRegister() *common.ProgramAddressRe
 }
 
 func (e *InstructionEngine) GetStopReason() (StopReason, uint64) {
+	e.stopMutex.Lock()
+	defer e.stopMutex.Unlock()
 	return e.stopReason, e.stopDetail.GetW()
 }
 
@@ -833,6 +921,28 @@ func (e *InstructionEngine) IgnoreOperand() (complete bool, interrupt common.Int
 	return
 }
 
+// InvalidateInstructionCache discards all pre-decoded instructions and translated blocks.
+// This must be invoked whenever a base register is changed other than by SetBaseRegister.
+func (e *InstructionEngine) InvalidateInstructionCache() {
+	e.instructionCache.Clear()
+	if len(e.translatedBlocks) > 0 {
+		e.translatedBlocks = make(map[uint64]*translatedBlock)
+	}
+	e.blockGeneration++
+}
+
+func (e *InstructionEngine) IsBlockTranslationEnabled() bool {
+	return e.blockTranslationEnabled
+}
+
+func (e *InstructionEngine) IsDirectDispatchEnabled() bool {
+	return e.directDispatchEnabled
+}
+
+func (e *InstructionEngine) IsInstructionCacheEnabled() bool {
+	return e.instructionCacheEnabled
+}
+
 func (e *InstructionEngine) IsLoggingInstructions() bool {
 	return e.logInstructions
 }
@@ -842,7 +952,7 @@ func (e *InstructionEngine) IsLoggingInterrupts() bool {
 }
 
 func (e *InstructionEngine) IsStopped() bool {
-	return e.isStopped
+	return e.isStopped.Load()
 }
 
 // PostInterrupt posts a new interrupt, provided that no higher-priority interrupt is already pending.
@@ -857,6 +967,7 @@ func (e *InstructionEngine) PostInterrupt(i common.Interrupt) {
 // SetBaseRegister sets the base register identified by brIndex (0 to 15) to the given register
 func (e *InstructionEngine) SetBaseRegister(brIndex uint64, register *common.BaseRegister) {
 	e.baseRegisters[brIndex] = register
+	e.InvalidateInstructionCache()
 }
 
 func (e *InstructionEngine) SetExecOrUserARegister(regIndex uint64, value uint64) {
@@ -871,6 +982,39 @@ func (e *InstructionEngine) SetExecOrUserXRegister(regIndex uint64, value uint64
 	e.generalRegisterSet.SetRegisterValue(e.GetExecOrUserXRegisterIndex(regIndex), value)
 }
 
+// SetBlockTranslationEnabled enables or disables block translation mode (see blockTranslator.go).
+// Like the instruction cache, this has no architectural effect.
+func (e *InstructionEngine) SetBlockTranslationEnabled(flag bool) {
+	e.blockTranslationEnabled = flag
+	e.InvalidateInstructionCache()
+}
+
+// SetDirectDispatchEnabled selects dispatch through the flattened function tables (see lookupFunctionHandler)
+// or, if false, through the f-field entries of FunctionTable and the nested handlers beneath them.
+// The latter is the original (slower) scheme, and exists only as a baseline for measurement.
+// It also disables the instruction cache, which holds only final handlers.
+func (e *InstructionEngine) SetDirectDispatchEnabled(flag bool) {
+	e.directDispatchEnabled = flag
+	e.InvalidateInstructionCache()
+}
+
+// SetExecutiveRequestTable establishes (or, if nil, removes) the table of Go handlers for ER and SGNL instructions.
+func (e *InstructionEngine) SetExecutiveRequestTable(table *ExecutiveRequestTable) {
+	e.executiveRequestTable = table
+}
+
+// SetOperationTrapTable establishes (or, if nil, removes) the table of Go handlers for unimplemented instructions.
+func (e *InstructionEngine) SetOperationTrapTable(table *OperationTrapTable) {
+	e.operationTrapTable = table
+}
+
+// SetInstructionCacheEnabled enables or disables the use of the pre-decoded instruction cache.
+// The cache has no architectural effect; this exists for measurement and for isolating problems.
+func (e *InstructionEngine) SetInstructionCacheEnabled(flag bool) {
+	e.instructionCacheEnabled = flag
+	e.InvalidateInstructionCache()
+}
+
 func (e *InstructionEngine) SetLogInstructions(flag bool) {
 	e.logInstructions = flag
 }
@@ -892,11 +1036,14 @@ func (e *InstructionEngine) SetProgramCounter(counter uint64, preventIncrement b
 // Stop posts a system stop, providing a reason and optionally some detail.
 // This does not actually stop anything - it is up to whoever is managing the engine
 // to make some sense of this and do something appropriate.
+// Stop may be invoked from a goroutine other than the one which is running the engine.
 func (e *InstructionEngine) Stop(reason StopReason, detail common.Word36) {
 	fmt.Printf("Stopping Processor: Reason=%d, Detail=%012o\n", reason, detail)
-	e.isStopped = true
+	e.stopMutex.Lock()
 	e.stopReason = reason
 	e.stopDetail = detail
+	e.isStopped.Store(true)
+	e.stopMutex.Unlock()
 }
 
 // StoreConsecutiveOperands handles the general case of storing operands either to consecutive locations
@@ -969,6 +1116,11 @@ func (e *InstructionEngine) StoreConsecutiveOperands(
 			return
 		}
 
+		interrupt = e.checkStorageFaults(hardware.StorageWriteFault, absAddr, count)
+		if interrupt != nil {
+			return
+		}
+
 		var dest []common.Word36
 		dest, interrupt = e.mainStorage.GetSliceFromAddress(absAddr, count)
 		if interrupt != nil {
@@ -978,6 +1130,7 @@ func (e *InstructionEngine) StoreConsecutiveOperands(
 		for dx := uint64(0); dx < count; dx++ {
 			dest[dx].SetW(operands[dx])
 		}
+		e.instructionCache.Invalidate(absAddr.GetSegment(), absAddr.GetOffset(), count)
 
 		_, interrupt = e.checkBreakpointRange(BreakpointWrite, absAddr, count)
 	}
@@ -1066,6 +1219,11 @@ func (e *InstructionEngine) StoreOperand(
 			return
 		}
 
+		interrupt = e.mainStorage.CheckWriteFault(absAddr)
+		if interrupt != nil {
+			return
+		}
+
 		var found bool
 		found, interrupt = e.checkBreakpoint(BreakpointWrite, absAddr)
 		if found || interrupt != nil {
@@ -1082,6 +1240,7 @@ func (e *InstructionEngine) StoreOperand(
 		} else {
 			bReg.GetStorage()[offset].SetW(operand)
 		}
+		e.instructionCache.Invalidate(absAddr.GetSegment(), absAddr.GetOffset(), 1)
 	}
 
 	return
@@ -1269,20 +1428,26 @@ func (e *InstructionEngine) createJumpHistoryEntry(address common.VirtualAddress
 // Returns true if the instruction was complete, else false
 func (e *InstructionEngine) executeCurrentInstruction() (completed bool) {
 	if e.logInstructions {
-		code := dasm.DisassembleInstruction(e.activityStatePacket)
-		fmt.Printf("--[%012o  %s]\n", e.activityStatePacket.GetProgramAddressRegister().GetComposite(), code)
+		e.logCurrentInstruction()
 	}
 
 	dr := e.activityStatePacket.GetDesignatorRegister()
 	ci := e.activityStatePacket.GetCurrentInstruction()
 	e.preventPCUpdate = false
 
-	// Find the instruction handler for the instruction if it is not cached
+	// Find the instruction handler for the instruction if it was not found when the instruction was fetched
 	if e.cachedInstructionHandler == nil {
-		fTable := FunctionTable[dr.IsBasicModeEnabled()]
-		var found bool
-		e.cachedInstructionHandler, found = fTable[uint(ci.GetF())]
-		if !found {
+		if e.directDispatchEnabled {
+			e.cachedInstructionHandler = lookupFunctionHandler(dr.IsBasicModeEnabled(), ci)
+		} else {
+			e.cachedInstructionHandler = FunctionTable[dr.IsBasicModeEnabled()][uint(ci.GetF())]
+		}
+		if e.cachedInstructionHandler == nil {
+			// not an instruction we implement - give the embedder a chance to implement it
+			if handler, ok := e.findOperationTrapHandler(dr.IsBasicModeEnabled(), ci); ok {
+				return handler.Invoke(e)
+			}
+
 			// illegal instruction - post an interrupt, then note that we are between instructions.
 			e.PostInterrupt(common.NewInvalidInstructionInterrupt(common.InvalidInstructionBadFunctionCode))
 			e.SetInstructionPoint(BetweenInstructions)
@@ -1293,6 +1458,12 @@ func (e *InstructionEngine) executeCurrentInstruction() (completed bool) {
 	return e.cachedInstructionHandler(e)
 }
 
+// logCurrentInstruction displays the disassembled instruction in F0 along with PAR
+func (e *InstructionEngine) logCurrentInstruction() {
+	code := dasm.DisassembleInstruction(e.activityStatePacket)
+	fmt.Printf("--[%012o  %s]\n", e.activityStatePacket.GetProgramAddressRegister().GetComposite(), code)
+}
+
 // fetchInstructionWord retrieves the next instruction word from the appropriate bank.
 // For extended mode this is straight-forward.
 // For basic mode, we have to hunt around a bit to make sure we pull it from the most appropriate bank.
@@ -1341,15 +1512,38 @@ func (e *InstructionEngine) fetchInstructionWord() bool {
 		return false
 	}
 
-	pcOffset := programCounter - bReg.GetBankDescriptor().GetLowerLimitNormalized()
+	bDesc := bReg.GetBankDescriptor()
+	pcOffset := programCounter - bDesc.GetLowerLimitNormalized()
 	iw := common.InstructionWord(bReg.GetStorage()[pcOffset])
+	if e.mainStorage.GetFaultInjector() != nil && bDesc.GetBaseAddress() != nil {
+		baseAddr := bDesc.GetBaseAddress()
+		absAddr := common.NewAbsoluteAddress(baseAddr.GetSegment(), baseAddr.GetOffset()+bReg.GetSubsetting()+pcOffset)
+		interrupt := e.mainStorage.CheckReadFault(absAddr)
+		if interrupt != nil {
+			e.PostInterrupt(interrupt)
+			return false
+		}
+		iw = common.InstructionWord(e.mainStorage.ApplyStuckBits(absAddr, iw.GetW()))
+	}
+
 	asp := e.activityStatePacket
 	asp.SetCurrentInstruction(&iw)
 	asp.GetIndicatorKeyRegister().SetInstructionInF0(true)
 	asp.GetIndicatorKeyRegister().SetExecuteRepeatedInstruction(false)
 
-	_, absAddr, _ := e.translateAddress(brx, programCounter)
-	e.checkBreakpoint(BreakpointFetch, absAddr)
+	//	Find the pre-decoded instruction handler - if there is no handler (i.e., the instruction is not valid)
+	//	we let executeCurrentInstruction() deal with it.
+	e.cachedInstructionHandler = nil
+	if e.instructionCacheEnabled && e.directDispatchEnabled && bDesc.GetBaseAddress() != nil {
+		baseAddr := bDesc.GetBaseAddress()
+		absOffset := baseAddr.GetOffset() + bReg.GetSubsetting() + pcOffset
+		e.cachedInstructionHandler = e.instructionCache.lookup(baseAddr.GetSegment(), absOffset, iw.GetW(), basicMode)
+	}
+
+	if e.breakpointAddress != nil {
+		_, absAddr, _ := e.translateAddress(brx, programCounter)
+		e.checkBreakpoint(BreakpointFetch, absAddr)
+	}
 
 	return true
 }
@@ -5,6 +5,8 @@
 package ipEngine
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"khalehla/common"
@@ -547,3 +549,97 @@ func Test_GRSAddressing_Extended(t *testing.T) {
 //	TODO extended mode index register handling
 
 //	TODO extended mode addressing across multiple banks
+
+const multiBankSource = "         .SEG     2\n" +
+	"table    W        0_111111_222222\n" +
+	"         .SEG     3\n" +
+	"more     W        table\n" +
+	"         .SEG     0\n" +
+	"         IAR      1\n" +
+	"start    LX       X1,more,,B2\n" +
+	"         LA       A1,0,X1,B2\n" +
+	"         LA       A2,table,,B2\n" +
+	"         SA       A2,01000,,B5\n" +
+	"         IAR      0\n"
+
+func Test_Link_MultiBank(t *testing.T) {
+	sourceSet, _, _ := tasm.ParseSource("Test", strings.NewReader(multiBankSource))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	spec := tasm.NewLinkSpec().
+		AddBank(tasm.NewBankSpec(0600004, 0).SetGeneralPermissions(true, true, false)).
+		AddBank(tasm.NewBankSpec(0400010, 2, 3).SetLowerLimit(02000).SetGeneralPermissions(false, true, false)).
+		AddBank(tasm.NewBankSpec(0200020).SetSize(0100).SetGeneralPermissions(false, true, true)).
+		BaseOn(0, 0600004).
+		BaseOn(2, 0400010).
+		BaseOn(5, 0200020).
+		SetStartingSymbol("start")
+	e, diagnostics := tasm.Link(a.GetSegments(), spec)
+	if diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("%s\n", diagnostics.GetDiagnostics()[0].GetString())
+	}
+
+	ute := NewUnitTestExecutor()
+	err := ute.Load(e)
+	if err == nil {
+		err = ute.Run()
+	}
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	engine := ute.GetEngine()
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.X1, 02000)
+	checkRegister(t, engine, common.A1, 0_111111_222222)
+	checkRegister(t, engine, common.A2, 0_111111_222222)
+	workBankAddr := e.GetBanks()[0200020].GetBankDescriptor().GetBaseAddress()
+	checkMemory(t, engine, workBankAddr, 0, 0_111111_222222)
+}
+
+func Test_Link_AbsoluteExecutable(t *testing.T) {
+	sourceSet, _, _ := tasm.ParseSource("Test", strings.NewReader(multiBankSource))
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	spec := tasm.NewLinkSpec().
+		AddBank(tasm.NewBankSpec(0600004, 0).SetGeneralPermissions(true, true, false)).
+		AddBank(tasm.NewBankSpec(0400010, 2, 3).SetLowerLimit(02000).SetGeneralPermissions(false, true, false)).
+		AddBank(tasm.NewBankSpec(0200020).SetSize(0100).SetGeneralPermissions(false, true, true)).
+		BaseOn(0, 0600004).
+		BaseOn(2, 0400010).
+		BaseOn(5, 0200020).
+		SetStartingSymbol("start")
+	linked, diagnostics := tasm.Link(a.GetSegments(), spec)
+	if diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("%s\n", diagnostics.GetDiagnostics()[0].GetString())
+	}
+
+	buffer := &bytes.Buffer{}
+	err := linked.Write(buffer)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	e, err := tasm.ReadExecutable(buffer)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	ute := NewUnitTestExecutor()
+	err = ute.Load(e)
+	if err == nil {
+		err = ute.Run()
+	}
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	engine := ute.GetEngine()
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	checkRegister(t, engine, common.X1, 02000)
+	checkRegister(t, engine, common.A1, 0_111111_222222)
+	checkRegister(t, engine, common.A2, 0_111111_222222)
+	workBankAddr := e.GetBanks()[0200020].GetBankDescriptor().GetBaseAddress()
+	checkMemory(t, engine, workBankAddr, 0, 0_111111_222222)
+}
@@ -14,6 +14,8 @@ func ExecutiveRequest(e *InstructionEngine) (completed bool) {
 	if interrupt != nil {
 		e.PostInterrupt(interrupt)
 		return false
+	} else if handler, ok := e.findERHandler(erCode); ok {
+		return handler.Invoke(e, erCode)
 	} else {
 		i := common.NewSignalInterrupt(common.ERSignal, erCode)
 		e.PostInterrupt(i)
@@ -27,6 +29,8 @@ func SignalCondition(e *InstructionEngine) (completed bool) {
 	if interrupt != nil {
 		e.PostInterrupt(interrupt)
 		return false
+	} else if handler, ok := e.findSignalHandler(signalCode); ok {
+		return handler.Invoke(e, signalCode)
 	} else {
 		i := common.NewSignalInterrupt(common.SGNLSignal, signalCode)
 		e.PostInterrupt(i)
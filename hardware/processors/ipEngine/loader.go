@@ -0,0 +1,172 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"fmt"
+	"sort"
+
+	"khalehla/common"
+	"khalehla/hardware"
+	"khalehla/tasm"
+)
+
+// LoadExecutable places the banks of the given executable into main storage, builds bank descriptor tables
+// for them, and establishes the base registers, program address register, and designator register of the engine
+// so that the next cycle begins execution of the executable. This is the only loader - it is used both by
+// UnitTestEngine.Load and by the InstructionProcessor in the processors package.
+//
+// Each bank is placed in its own main storage segment, as is the bank descriptor table for each level
+// which is used; the BDT for level n is based on B16+n. Banks are placed in L,BDI order so that the
+// layout of storage is the same each time a given executable is loaded. The bank descriptors in the executable
+// are updated with the absolute addresses of their banks.
+//
+// Returns the absolute addresses of the BDTs, keyed by level.
+func LoadExecutable(
+	engine *InstructionEngine,
+	storage *hardware.MainStorage,
+	executable *tasm.Executable,
+) (map[uint64]*common.AbsoluteAddress, error) {
+
+	//	key is level (0 to 7), value is the absolute address of the BDT for that level
+	bdtAddresses := make(map[uint64]*common.AbsoluteAddress)
+
+	banks := executable.GetBanks()
+	bankIndices := make([]uint64, 0, len(banks))
+	for lbdi := range banks {
+		bankIndices = append(bankIndices, lbdi)
+	}
+	sort.Slice(bankIndices, func(i, j int) bool { return bankIndices[i] < bankIndices[j] })
+
+	for _, lbdi := range bankIndices {
+		//	allocate a segment from storage and copy the bank to the segment
+		//  there are no fix-ups required; all our binaries are self-contained.
+		bank := banks[lbdi]
+		bankSegIndex, err := storage.Allocate(bank.GetCodeLength())
+		if err != nil {
+			return nil, err
+		}
+		seg, _ := storage.GetSegment(bankSegIndex)
+		code := bank.GetCode()
+		for cx := 0; cx < len(code); cx++ {
+			seg[cx].SetW(code[cx])
+		}
+
+		//	now build a bank descriptor for the bank.
+		//	if this is the first bank with its level, then we have to allocate space for a bdt for the level.
+		level := lbdi >> 15
+		bdi := lbdi & 077777
+		newBDTLen := (bdi + 1) * 8
+
+		absAddr, ok := bdtAddresses[level]
+		var bdTable []common.Word36
+		if ok {
+			bdtSegment := absAddr.GetSegment()
+			bdTable, _ = storage.GetSegment(bdtSegment)
+			if uint64(len(bdTable)) < newBDTLen {
+				interrupt := storage.Resize(bdtSegment, newBDTLen)
+				if interrupt != nil {
+					return nil, fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
+				}
+				bdTable, _ = storage.GetSegment(bdtSegment)
+			}
+		} else {
+			bdtSegment, err := storage.Allocate(newBDTLen)
+			if err != nil {
+				return nil, err
+			}
+			bdTable, _ = storage.GetSegment(bdtSegment)
+			bdtAddresses[level] = common.NewAbsoluteAddress(bdtSegment, 0)
+		}
+
+		bank.GetBankDescriptor().SetBaseAddress(common.NewAbsoluteAddress(bankSegIndex, 0))
+		bdOffset := bdi * 8
+		bank.GetBankDescriptor().Serialize(bdTable[bdOffset : bdOffset+8])
+	}
+
+	for brx := uint64(0); brx < 32; brx++ {
+		engine.SetBaseRegister(brx, common.NewVoidBaseRegister())
+	}
+
+	//	Load BDT base registers B16 to B23. BDTable level 0 -> B16, 1 -> B17, etc.
+	//  For any level which does not have a BDT, the corresponding base register remains void.
+	for level, address := range bdtAddresses {
+		table, _ := storage.GetSegment(address.GetSegment())
+		lock := common.NewAccessLock(0, 0)
+		perms := common.NewAccessPermissions(false, true, false)
+		bd := common.NewBankDescriptor(false, lock, perms, perms, address, false, 0, 0, 0)
+		engine.SetBaseRegister(level+16, common.NewBaseRegisterFromBankDescriptor(bd, table))
+	}
+
+	//	Now load the lower base registers according to the executable, along with PAR.L,BDI and the ABTEs
+	par := engine.GetProgramAddressRegister()
+	for brx, lbdi := range executable.GetInitiallyBasedBanks() {
+		level := lbdi >> 15
+		index := lbdi & 077777
+		bdtAddr, ok := bdtAddresses[level]
+		if !ok {
+			return nil, fmt.Errorf("bank %06o for B%d is not in the executable", lbdi, brx)
+		}
+
+		bdSlice, interrupt := storage.GetSlice(bdtAddr.GetSegment(), bdtAddr.GetOffset()+index*8, 8)
+		if interrupt != nil {
+			return nil, fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
+		}
+
+		bd := common.NewBankDescriptorFromStorage(bdSlice)
+		bankSlice, interrupt := storage.GetSegment(bd.GetBaseAddress().GetSegment())
+		if interrupt != nil {
+			return nil, fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
+		}
+		engine.SetBaseRegister(brx, common.NewBaseRegisterFromBankDescriptor(bd, bankSlice))
+
+		//	We are not expecting to handle large banks.
+		if brx == 0 {
+			par.SetLevel(level).SetBankDescriptorIndex(index)
+		} else {
+			abte := engine.GetActiveBaseTableEntry(brx)
+			abte.SetBankLevel(level).SetBankDescriptorIndex(index).SetSubsetSpecification(0)
+		}
+	}
+
+	par.SetProgramCounter(executable.GetStartingAddress())
+
+	dr := engine.GetDesignatorRegister()
+	dr.Clear()
+	dr.SetProcessorPrivilege(executable.GetProcessorPrivilege())
+	dr.SetArithmeticExceptionEnabled(executable.IsArithmeticExceptionEnabled())
+	dr.SetBasicModeBaseRegisterSelection(executable.GetBaseRegisterSelection())
+	dr.SetBasicModeEnabled(executable.IsBasicMode())
+	dr.SetExecutive24BitIndexingEnabled(executable.IsExec24BitIndexingEnabled())
+	dr.SetExecRegisterSetSelected(executable.IsExecRegisterSetEnabled())
+	dr.SetOperationTrapEnabled(executable.IsOperationTrapEnabled())
+	dr.SetQuarterWordModeEnabled(executable.IsQuarterWordMode())
+
+	return bdtAddresses, nil
+}
+
+// SnapshotExecutable copies the current content of each bank of the given executable from main storage
+// back into the executable, so that it can be saved (and disassembled) as a memory snapshot.
+// The executable must have been loaded by LoadExecutable.
+func SnapshotExecutable(storage *hardware.MainStorage, executable *tasm.Executable) error {
+	for lbdi, bank := range executable.GetBanks() {
+		address := bank.GetBankDescriptor().GetBaseAddress()
+		if address == nil {
+			return fmt.Errorf("bank %06o has not been loaded", lbdi)
+		}
+
+		slice, interrupt := storage.GetSlice(address.GetSegment(), address.GetOffset(), bank.GetCodeLength())
+		if interrupt != nil {
+			return fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
+		}
+
+		code := bank.GetCode()
+		for wx, word := range slice {
+			code[wx] = word.GetW()
+		}
+	}
+
+	return nil
+}
@@ -62,8 +62,8 @@ func MaskedLoadUpper(e *InstructionEngine) (completed bool) {
 		return false
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
-		aValue := e.GetExecOrUserXRegister(ci.GetA()).GetW()
-		mask := e.GetExecOrUserRRegister(common.R2).GetW()
+		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
+		mask := e.GetExecOrUserRRegister(2).GetW()
 		notMask := common.Not(mask)
 		value := (result.operand & mask) | (aValue & notMask)
 		e.GetExecOrUserARegister(ci.GetA() + 1).SetW(value)
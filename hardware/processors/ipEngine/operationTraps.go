@@ -0,0 +1,128 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"khalehla/common"
+)
+
+// OperationTrapHandler implements, in Go code, an instruction which the engine does not otherwise implement.
+// It is invoked in place of posting an invalid instruction interrupt, with the instruction in F0 and the engine
+// in the same state in which a built-in instruction handler would find it. The handler may use any of the
+// engine's operand retrieval and storage functions, and its return value has the same meaning as for
+// any other instruction handler - if true, the instruction is complete. If false, the handler must have
+// posted an interrupt or stopped the engine.
+//
+// Note that this has nothing to do with the operation trap interrupt (class 18), nor with the
+// operation trap enable bit in the designator register.
+type OperationTrapHandler interface {
+	Invoke(e *InstructionEngine) (completed bool)
+}
+
+// OperationTrapHandlerFunc allows an ordinary function to be used as an OperationTrapHandler
+type OperationTrapHandlerFunc func(e *InstructionEngine) (completed bool)
+
+func (f OperationTrapHandlerFunc) Invoke(e *InstructionEngine) (completed bool) {
+	return f(e)
+}
+
+// OperationTrapTable maps unimplemented opcode slots to handlers which implement them.
+// A slot is identified by the execution mode and the f, j, and a fields of the instruction. Where the engine
+// does not decode a particular field for the instruction being implemented, the handler must be registered
+// for every value of that field (see RegisterAllA and RegisterAllJA).
+//
+// Handlers can only be registered for slots which the engine does not implement; built-in instructions
+// always take precedence. Instructions which are in neither place are passed to the fallback handler
+// if there is one, which is then responsible for posting the invalid instruction interrupt if it does not
+// wish to handle the instruction. If there is no fallback, the interrupt is posted as usual.
+//
+// A table may be shared among several engines, provided it is not updated while they are running.
+type OperationTrapTable struct {
+	handlers map[uint]OperationTrapHandler
+	fallback OperationTrapHandler
+}
+
+func NewOperationTrapTable() *OperationTrapTable {
+	return &OperationTrapTable{
+		handlers: make(map[uint]OperationTrapHandler),
+	}
+}
+
+// newOperationTrapKey creates the key under which a handler is stored, in the same form as the index
+// into the direct function tables, with the mode in the next bit up.
+func newOperationTrapKey(basicMode bool, f uint64, j uint64, a uint64) uint {
+	key := uint(f&077)<<8 | uint(j&017)<<4 | uint(a&017)
+	if basicMode {
+		key |= 1 << 14
+	}
+	return key
+}
+
+// IsImplemented returns true if the engine has a built-in handler for the given opcode slot
+func IsImplemented(basicMode bool, f uint64, j uint64, a uint64) bool {
+	iw := common.InstructionWord((f&077)<<30 | (j&017)<<26 | (a&017)<<22)
+	return lookupFunctionHandler(basicMode, &iw) != nil
+}
+
+func (ott *OperationTrapTable) GetHandler(basicMode bool, f uint64, j uint64, a uint64) (OperationTrapHandler, bool) {
+	handler, ok := ott.handlers[newOperationTrapKey(basicMode, f, j, a)]
+	return handler, ok
+}
+
+func (ott *OperationTrapTable) GetFallback() OperationTrapHandler {
+	return ott.fallback
+}
+
+// Register establishes a handler for the given opcode slot, replacing any previous handler.
+// Returns false (and does nothing) if the engine already implements an instruction in that slot.
+func (ott *OperationTrapTable) Register(basicMode bool, f uint64, j uint64, a uint64, handler OperationTrapHandler) bool {
+	if IsImplemented(basicMode, f, j, a) {
+		return false
+	}
+
+	ott.handlers[newOperationTrapKey(basicMode, f, j, a)] = handler
+	return true
+}
+
+// RegisterAllA establishes a handler for the given f and j fields, for every value of the a field
+// for which the engine does not already implement an instruction.
+func (ott *OperationTrapTable) RegisterAllA(basicMode bool, f uint64, j uint64, handler OperationTrapHandler) {
+	for a := uint64(0); a < 020; a++ {
+		ott.Register(basicMode, f, j, a, handler)
+	}
+}
+
+// RegisterAllJA establishes a handler for the given f field, for every value of the j and a fields
+// for which the engine does not already implement an instruction.
+func (ott *OperationTrapTable) RegisterAllJA(basicMode bool, f uint64, handler OperationTrapHandler) {
+	for j := uint64(0); j < 020; j++ {
+		ott.RegisterAllA(basicMode, f, j, handler)
+	}
+}
+
+// SetFallback establishes a handler which is invoked for any unimplemented instruction which does not have
+// a registered handler. Pass nil to remove the fallback.
+func (ott *OperationTrapTable) SetFallback(handler OperationTrapHandler) {
+	ott.fallback = handler
+}
+
+// Unregister removes the handler (if any) for the given opcode slot
+func (ott *OperationTrapTable) Unregister(basicMode bool, f uint64, j uint64, a uint64) {
+	delete(ott.handlers, newOperationTrapKey(basicMode, f, j, a))
+}
+
+// findOperationTrapHandler retrieves the handler for the given (unimplemented) instruction, if there is a table and
+// it contains either a specific handler or a fallback handler.
+func (e *InstructionEngine) findOperationTrapHandler(basicMode bool, iw *common.InstructionWord) (OperationTrapHandler, bool) {
+	if e.operationTrapTable == nil {
+		return nil, false
+	}
+
+	handler, ok := e.operationTrapTable.GetHandler(basicMode, iw.GetF(), iw.GetJ(), iw.GetA())
+	if !ok && e.operationTrapTable.fallback != nil {
+		handler, ok = e.operationTrapTable.fallback, true
+	}
+	return handler, ok
+}
@@ -0,0 +1,101 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"testing"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+// f=076 is not implemented in either mode - we use it for a made-up instruction which adds U to A(a)
+// and shifts the result left by one bit.
+const fTrap = 076
+
+var operationTrapExtendedMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	laSourceItemU(jU, regA3, 0, 05),
+	fjaxuSourceItem(fTrap, jU, regA3, 0, 03),
+	fjaxuSourceItem(fTrap, jU, regA4, 0, 01),
+	fjaxuSourceItem(fTrap, 0, regA0, 0, 0),
+	iarSourceItem(0),
+}
+
+func addAndShift(e *InstructionEngine) (completed bool) {
+	operand, interrupt := e.GetImmediateOperand()
+	if interrupt != nil {
+		e.PostInterrupt(interrupt)
+		return false
+	}
+
+	aReg := e.GetExecOrUserARegister(e.GetCurrentInstruction().GetA())
+	aReg.SetW(((aReg.GetW() + operand) << 1) & common.NegativeZero)
+	return true
+}
+
+func Test_OperationTrap_Registered(t *testing.T) {
+	if IsImplemented(false, fTrap, jU, regA3) {
+		t.Fatalf("f=%03o is now implemented - choose another opcode for this test", fTrap)
+	}
+
+	ute := loadTestProgram(t, operationTrapExtendedMode)
+	engine := ute.GetEngine()
+	table := NewOperationTrapTable()
+	table.RegisterAllA(false, fTrap, jU, OperationTrapHandlerFunc(addAndShift))
+	engine.SetOperationTrapTable(table)
+
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// f=076 j=0 has no handler and there is no fallback, so we expect an invalid instruction interrupt
+	checkInterrupt(t, engine, common.InvalidInstructionInterruptClass)
+	checkRegister(t, engine, common.A3, 020)
+	checkRegister(t, engine, common.A4, 02)
+}
+
+func Test_OperationTrap_Fallback(t *testing.T) {
+	ute := loadTestProgram(t, operationTrapExtendedMode)
+	engine := ute.GetEngine()
+	trapped := make([]uint64, 0)
+	table := NewOperationTrapTable()
+	table.SetFallback(OperationTrapHandlerFunc(func(e *InstructionEngine) bool {
+		ci := e.GetCurrentInstruction()
+		trapped = append(trapped, ci.GetF()<<8|ci.GetJ()<<4|ci.GetA())
+		return true
+	}))
+	engine.SetOperationTrapTable(table)
+
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	expected := []uint64{fTrap<<8 | jU<<4 | regA3, fTrap<<8 | jU<<4 | regA4, fTrap<<8 | 0<<4 | regA0}
+	if len(trapped) != len(expected) {
+		t.Fatalf("Expected %d trapped instructions, got %d", len(expected), len(trapped))
+	}
+	for tx := range expected {
+		if trapped[tx] != expected[tx] {
+			t.Errorf("Trapped instruction %d: expected %05o, got %05o", tx, expected[tx], trapped[tx])
+		}
+	}
+}
+
+func Test_OperationTrap_BuiltInTakesPrecedence(t *testing.T) {
+	table := NewOperationTrapTable()
+	if table.Register(false, fLA, jU, regA0, OperationTrapHandlerFunc(addAndShift)) {
+		t.Errorf("Expected registration over LA to be refused")
+	}
+	if !table.Register(true, fTrap, jU, regA0, OperationTrapHandlerFunc(addAndShift)) {
+		t.Errorf("Expected registration for f=%03o to be accepted", fTrap)
+	}
+	if _, ok := table.GetHandler(false, fTrap, jU, regA0); ok {
+		t.Errorf("Expected basic mode registration not to apply to extended mode")
+	}
+}
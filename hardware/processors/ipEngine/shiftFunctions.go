@@ -136,9 +136,7 @@ func LoadShiftAndCount(e *InstructionEngine) (completed bool) {
 			count = 35
 		} else {
 			for bitsMatch(value) {
-				partial := value & 01
-				value >>= 1
-				value |= partial << 35
+				value = ((value << 1) | (value >> 35)) & common.NegativeZero
 				count++
 			}
 		}
@@ -172,12 +170,10 @@ func DoubleLoadShiftAndCount(e *InstructionEngine) (completed bool) {
 			count = 71
 		} else {
 			for bitsMatch(value[0]) {
-				partial0 := value[0] & 01
-				partial1 := value[1] & 01
-				value[0] >>= 1
-				value[1] >>= 1
-				value[0] |= partial0 << 35
-				value[1] |= partial1 << 35
+				carry0 := value[0] >> 35
+				carry1 := value[1] >> 35
+				value[0] = ((value[0] << 1) | carry1) & common.NegativeZero
+				value[1] = ((value[1] << 1) | carry0) & common.NegativeZero
 				count++
 			}
 		}
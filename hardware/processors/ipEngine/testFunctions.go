@@ -214,7 +214,7 @@ func TestNotLessThanZero(e *InstructionEngine) (completed bool) {
 	if result.interrupt != nil {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
-		if common.IsPositive(result.operand) && result.operand != common.PositiveZero {
+		if common.IsPositive(result.operand) || result.operand == common.NegativeZero {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
 		}
@@ -290,7 +290,7 @@ func TestNegative(e *InstructionEngine) (completed bool) {
 	if result.interrupt != nil {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
-		if !common.IsNegative(result.operand) {
+		if common.IsNegative(result.operand) {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
 		}
@@ -475,7 +475,7 @@ func TestWithinRange(e *InstructionEngine) (completed bool) {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
-		ax := e.GetExecOrUserARegisterIndex(ci.GetA())
+		ax := ci.GetA()
 		a1 := e.GetExecOrUserARegister(ax).GetW()
 		a2 := e.GetExecOrUserARegister(ax + 1).GetW()
 		if common.Compare(common.Magnitude(result.operand), a1) > 0 &&
@@ -496,10 +496,10 @@ func TestNotWithinRange(e *InstructionEngine) (completed bool) {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
-		ax := e.GetExecOrUserARegisterIndex(ci.GetA())
+		ax := ci.GetA()
 		a1 := e.GetExecOrUserARegister(ax).GetW()
 		a2 := e.GetExecOrUserARegister(ax + 1).GetW()
-		if common.Compare(common.Magnitude(result.operand), a1) <= 0 &&
+		if common.Compare(common.Magnitude(result.operand), a1) <= 0 ||
 			common.Compare(common.Magnitude(result.operand), a2) > 0 {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -517,7 +517,7 @@ func MaskedTestEqual(e *InstructionEngine) (completed bool) {
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.And(result.operand, rValue) == common.And(aValue, rValue) {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -535,7 +535,7 @@ func MaskedTestNotEqual(e *InstructionEngine) (completed bool) {
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.And(result.operand, rValue) != common.And(aValue, rValue) {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -554,7 +554,7 @@ func MaskedTestLessThanOrEqual(e *InstructionEngine) (completed bool) {
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.Compare(common.And(result.operand, rValue), common.And(aValue, rValue)) <= 0 {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -573,7 +573,7 @@ func MaskedTestGreater(e *InstructionEngine) (completed bool) {
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.Compare(common.And(result.operand, rValue), common.And(aValue, rValue)) > 0 {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -586,15 +586,14 @@ func MaskedTestGreater(e *InstructionEngine) (completed bool) {
 // MaskedTestWithinRange (MTW) skips the next instruction if the operand AND R2
 // is greater than Aa AND R2 and less than or equal to Aa+1 AND R2
 func MaskedTestWithinRange(e *InstructionEngine) (completed bool) {
-	result := e.GetOperand(false, true, true, true, false)
+	result := e.GetOperand(false, true, false, false, false)
 	if result.interrupt != nil {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
-		ax := e.GetExecOrUserARegisterIndex(ci.GetA())
-		rVal := e.GetExecOrUserRRegister(common.R2).GetW()
-		a1Masked := common.And(e.GetExecOrUserARegister(ax).GetW(), rVal)
-		a2Masked := common.And(e.GetExecOrUserARegister(ax+1).GetW(), rVal)
+		rVal := e.GetExecOrUserRRegister(2).GetW()
+		a1Masked := common.And(e.GetExecOrUserARegister(ci.GetA()).GetW(), rVal)
+		a2Masked := common.And(e.GetExecOrUserARegister(ci.GetA()+1).GetW(), rVal)
 		opMasked := common.And(result.operand, rVal)
 
 		if common.Compare(common.Magnitude(opMasked), a1Masked) > 0 &&
@@ -610,15 +609,14 @@ func MaskedTestWithinRange(e *InstructionEngine) (completed bool) {
 // MaskedTestNotWithinRange (MTNW) skips the next instruction if the operand AND R2
 // is not greater than Aa AND R2 or not less than or equal to Aa+1 AND R2
 func MaskedTestNotWithinRange(e *InstructionEngine) (completed bool) {
-	result := e.GetOperand(false, true, true, true, false)
+	result := e.GetOperand(false, true, false, false, false)
 	if result.interrupt != nil {
 		e.PostInterrupt(result.interrupt)
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
-		ax := e.GetExecOrUserARegisterIndex(ci.GetA())
-		rVal := e.GetExecOrUserRRegister(common.R2).GetW()
-		a1Masked := common.And(e.GetExecOrUserARegister(ax).GetW(), rVal)
-		a2Masked := common.And(e.GetExecOrUserARegister(ax+1).GetW(), rVal)
+		rVal := e.GetExecOrUserRRegister(2).GetW()
+		a1Masked := common.And(e.GetExecOrUserARegister(ci.GetA()).GetW(), rVal)
+		a2Masked := common.And(e.GetExecOrUserARegister(ci.GetA()+1).GetW(), rVal)
 		opMasked := common.And(result.operand, rVal)
 
 		if common.Compare(common.Magnitude(opMasked), a1Masked) <= 0 ||
@@ -642,7 +640,7 @@ func MaskedAlphanumericTestLessThanOrEqual(e *InstructionEngine) (completed bool
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.And(result.operand, rValue) <= common.And(aValue, rValue) {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
@@ -663,7 +661,7 @@ func MaskedAlphanumericTestGreater(e *InstructionEngine) (completed bool) {
 	} else if result.complete {
 		ci := e.GetCurrentInstruction()
 		aValue := e.GetExecOrUserARegister(ci.GetA()).GetW()
-		rValue := e.GetExecOrUserRRegister(common.R2).GetW()
+		rValue := e.GetExecOrUserRRegister(2).GetW()
 		if common.And(result.operand, rValue) > common.And(aValue, rValue) {
 			pc := e.GetProgramAddressRegister().GetProgramCounter()
 			e.SetProgramCounter(pc+2, true)
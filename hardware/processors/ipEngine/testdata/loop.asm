@@ -0,0 +1,11 @@
+. loop.asm
+. Counts A0 up and A1 down, 0100 times round a tight loop (extended mode).
+. This is the source-file equivalent of loopExtendedMode in instructionCache_test.go.
+
+         .SEG    0
+         LA,U    A0,0
+         LA,U    A1,0100
+loop     AA,U    A0,1
+         ANA,U   A1,1
+         JNZ     A1,loop
+         IAR     0
@@ -54,141 +54,19 @@ func (ute *UnitTestEngine) GetEngine() *InstructionEngine {
 func (ute *UnitTestEngine) Load(executable *tasm.Executable) error {
 	fmt.Printf("\nLoading Executable...\n")
 	ute.Clear()
-	ute.executable = executable
-
-	// maps bdi to segment index of segment containing the bank
-	segIndexMap := make(map[uint64]uint)
-
-	for _, bank := range executable.GetBanks() {
-		//	allocate a segment from storage and copy the bank to the segment
-		//  there are no fix-ups required; all our binaries are self-contained.
-
-		lbdi := bank.GetBankDescriptorIndex()
-		bankSegIndex, err := ute.storage.Allocate(bank.GetCodeLength())
-		if err != nil {
-			return err
-		}
-		seg, _ := ute.storage.GetSegment(bankSegIndex)
-		segIndexMap[lbdi] = bankSegIndex
-
-		code := bank.GetCode()
-		for cx := 0; cx < len(code); cx++ {
-			seg[cx].SetW(code[cx])
-		}
-
-		bankAddress := common.NewAbsoluteAddress(bankSegIndex, 0)
-		ute.bankAddresses[lbdi] = bankAddress
-
-		//	now build a bank descriptor for the bank.
-		//	if this is the first bank with its level, then we have to allocate space for a bdt for the level.
-		level := lbdi >> 15
-		bdi := lbdi & 077777
-		newBDTLen := (bdi + 1) * 8
-
-		//	For this algorithm, each BDT gets its own segment and thus is always at offset 0 of the segment
-		absAddr, ok := ute.bankDescriptorTableAddresses[level]
-		var bdtSegment uint
-		var bdTable []common.Word36
-		if ok {
-			bdtSegment = absAddr.GetSegment()
-			bdTable, _ = ute.storage.GetSegment(bdtSegment)
-			if uint64(len(bdTable)) < newBDTLen {
-				interrupt := ute.storage.Resize(bdtSegment, newBDTLen)
-				if interrupt != nil {
-					return fmt.Errorf("interrupt:%s\n", common.GetInterruptString(interrupt))
-				}
-				bdTable, _ = ute.storage.GetSegment(bdtSegment)
-			}
-		} else {
-			bdtSegment, err = ute.storage.Allocate(newBDTLen)
-			if err != nil {
-				return err
-			}
-			bdTable, _ = ute.storage.GetSegment(bdtSegment)
-			absAddr = &common.AbsoluteAddress{}
-			absAddr.SetSegment(bdtSegment)
-			ute.bankDescriptorTableAddresses[level] = absAddr
-		}
-		bank.GetBankDescriptor().SetBaseAddress(bankAddress)
-
-		bdOffset := bdi * 8
-		bank.GetBankDescriptor().Serialize(bdTable[bdOffset : bdOffset+8])
-	}
 
-	//	Set up base registers
-	ute.engine = NewEngine("IPTEST", ute.storage)
-	for brx := uint64(0); brx < 16; brx++ {
-		ute.engine.SetBaseRegister(brx, common.NewVoidBaseRegister())
+	engine := NewEngine("IPTEST", ute.storage)
+	bdtAddresses, err := LoadExecutable(engine, ute.storage, executable)
+	if err != nil {
+		return err
 	}
 
-	//	Load BDT base registers B16 to B23. BDTable level 0 -> B16, 1 -> B17, etc.
-	//  For any level which does not have a BDT, we make the corresponding base register void.
-	fmt.Printf("  Loading base registers for bank descriptor tables...\n")
-	par := ute.engine.GetProgramAddressRegister()
-	for level, address := range ute.bankDescriptorTableAddresses {
-		table, _ := ute.storage.GetSegment(address.GetSegment())
-		brx := level + 16
-		lock := common.NewAccessLock(0, 0)
-		perms := common.NewAccessPermissions(false, true, false)
-		bd := common.NewBankDescriptor(false, lock, perms, perms, address, false, 0, 0, 0)
-		br := common.NewBaseRegisterFromBankDescriptor(bd, table)
-
-		ute.engine.SetBaseRegister(brx, br)
-		fmt.Printf("    Set B%d -> BDT for level %d\n", brx, level)
+	for lbdi, bank := range executable.GetBanks() {
+		ute.bankAddresses[lbdi] = bank.GetBankDescriptor().GetBaseAddress()
 	}
-
-	//	Now load the lower base registers according to the executable instructions.
-	//	This is also a convenient place to set PAR.PC
-	fmt.Printf("  Loading base registers and ABTEs with program bank information...\n")
-	for brx, bdi := range ute.executable.GetInitiallyBasedBanks() {
-		//	Find the bank descriptor (in memory) for this bank
-		level := bdi >> 15
-		index := bdi & 077777
-		bdAddr := ute.bankDescriptorTableAddresses[level]
-		bdOffset := index * 8
-		bdSlice, interrupt := ute.storage.GetSlice(bdAddr.GetSegment(), bdAddr.GetOffset()+bdOffset, 8)
-		if interrupt != nil {
-			return fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
-		}
-
-		//	Create an in-memory bank descriptor based on the bd in memory,
-		//	then we're ready to create the bank register.
-		bd := common.NewBankDescriptorFromStorage(bdSlice)
-
-		bankAddr := bd.GetBaseAddress()
-		bankSlice, interrupt := ute.storage.GetSegment(bankAddr.GetSegment())
-		if interrupt != nil {
-			return fmt.Errorf("interrupt:%s", common.GetInterruptString(interrupt))
-		}
-
-		br := common.NewBaseRegisterFromBankDescriptor(bd, bankSlice)
-		ute.engine.SetBaseRegister(brx, br)
-		fmt.Printf("    Set B%d -> %06o\n", brx, bdi)
-
-		//	Update PAR.BDI or an appropriate ABTE. We are not expecting to handle large banks.
-		if brx == 0 {
-			par.SetLevel(level).SetBankDescriptorIndex(index)
-		} else {
-			abte := ute.engine.GetActiveBaseTableEntry(brx)
-			abte.SetBankLevel(level).SetBankDescriptorIndex(index).SetSubsetSpecification(0)
-			fmt.Printf("    Set ABTE[%d]\n", brx)
-		}
-	}
-
-	//	Set program counter to initial address
-	par.SetProgramCounter(executable.GetStartingAddress())
-
-	//	BuildConfiguration designator register
-	dr := ute.engine.GetDesignatorRegister()
-	dr.Clear()
-	dr.SetProcessorPrivilege(ute.executable.GetProcessorPrivilege())
-	dr.SetArithmeticExceptionEnabled(ute.executable.IsArithmeticExceptionEnabled())
-	dr.SetBasicModeBaseRegisterSelection(ute.executable.GetBaseRegisterSelection())
-	dr.SetBasicModeEnabled(ute.executable.IsBasicMode())
-	dr.SetExecutive24BitIndexingEnabled(ute.executable.IsExec24BitIndexingEnabled())
-	dr.SetExecRegisterSetSelected(ute.executable.IsExecRegisterSetEnabled())
-	dr.SetOperationTrapEnabled(ute.executable.IsOperationTrapEnabled())
-	dr.SetQuarterWordModeEnabled(ute.executable.IsQuarterWordMode())
+	ute.bankDescriptorTableAddresses = bdtAddresses
+	ute.executable = executable
+	ute.engine = engine
 
 	ute.engine.SetLogInstructions(true)
 	ute.engine.SetLogInterrupts(true)
@@ -0,0 +1,304 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"khalehla/common"
+)
+
+// ER indices for the services provided by the UserModeEmulator
+const (
+	ErEXIT  = 011
+	ErABORT = 012
+	ErREAD  = 015
+	ErPRINT = 016
+	ErDATE  = 022
+	ErTIME  = 023
+	ErMCORE = 043
+	ErLCORE = 044
+)
+
+// UserModeEmulator services a small set of ER$ requests in Go code, so that single user programs can be
+// run and tested on an InstructionEngine without booting an operating system.
+//
+//	EXIT$   stops the engine with UserModeExitStop
+//	ABORT$  stops the engine with UserModeAbortStop
+//	PRINT$  A0 = (word count, address) of a Fieldata line, which is written to the output
+//	READ$   A0 = (word count, address) of a buffer, into which the next input line is stored in Fieldata.
+//	        The line is truncated or space-filled to fit the buffer. On return A0 contains the number of words
+//	        transferred, or is negative if there is no more input.
+//	DATE$   returns MMDDYY in A0 and HHMMSS in A1, both in Fieldata
+//	TIME$   returns the number of milliseconds since midnight in A0
+//	MCORE$  A0 = number of words by which to expand the data bank; on return A0 contains the new upper limit
+//	LCORE$  A0 = number of words by which to contract the data bank; on return A0 contains the new upper limit
+//
+// Buffer addresses are relative addresses, and are resolved against the banks currently based on B0 through B15
+// (or, in basic mode, the basic mode banks). The data bank for MCORE$ and LCORE$ is the bank based on the
+// base register selected by SetDataBankRegister, which defaults to B2 (the usual extended mode data bank).
+// Basic mode programs will generally want B12 through B15 instead.
+type UserModeEmulator struct {
+	reader           *bufio.Reader
+	writer           io.Writer
+	clock            func() time.Time
+	dataBankRegister uint64
+}
+
+func NewUserModeEmulator(reader io.Reader, writer io.Writer) *UserModeEmulator {
+	return &UserModeEmulator{
+		reader:           bufio.NewReader(reader),
+		writer:           writer,
+		clock:            time.Now,
+		dataBankRegister: 2,
+	}
+}
+
+// Register establishes handlers for all of our ER$ services in the given table
+func (ume *UserModeEmulator) Register(table *ExecutiveRequestTable) {
+	table.RegisterER(ErEXIT, ExecutiveRequestHandlerFunc(ume.exit))
+	table.RegisterER(ErABORT, ExecutiveRequestHandlerFunc(ume.abort))
+	table.RegisterER(ErREAD, ExecutiveRequestHandlerFunc(ume.read))
+	table.RegisterER(ErPRINT, ExecutiveRequestHandlerFunc(ume.print))
+	table.RegisterER(ErDATE, ExecutiveRequestHandlerFunc(ume.date))
+	table.RegisterER(ErTIME, ExecutiveRequestHandlerFunc(ume.time))
+	table.RegisterER(ErMCORE, ExecutiveRequestHandlerFunc(ume.mcore))
+	table.RegisterER(ErLCORE, ExecutiveRequestHandlerFunc(ume.lcore))
+}
+
+// SetClock replaces the source of the current time for DATE$ and TIME$ - mostly for testing
+func (ume *UserModeEmulator) SetClock(clock func() time.Time) {
+	ume.clock = clock
+}
+
+// SetDataBankRegister selects the base register describing the bank which is affected by MCORE$ and LCORE$
+func (ume *UserModeEmulator) SetDataBankRegister(brIndex uint64) {
+	ume.dataBankRegister = brIndex
+}
+
+func (ume *UserModeEmulator) exit(e *InstructionEngine, code uint64) bool {
+	e.Stop(UserModeExitStop, 0)
+	return true
+}
+
+func (ume *UserModeEmulator) abort(e *InstructionEngine, code uint64) bool {
+	e.Stop(UserModeAbortStop, 0)
+	return true
+}
+
+func (ume *UserModeEmulator) print(e *InstructionEngine, code uint64) bool {
+	a0 := e.GetExecOrUserARegister(0)
+	buffer, ok := ume.getBuffer(e, a0.GetH2(), a0.GetH1(), false)
+	if !ok {
+		return false
+	}
+
+	words := make([]uint64, len(buffer))
+	for wx := range buffer {
+		words[wx] = buffer[wx].GetW()
+	}
+
+	line := strings.TrimRight(common.FieldataToString(words), " ")
+	_, _ = fmt.Fprintf(ume.writer, "%s\n", line)
+	return true
+}
+
+func (ume *UserModeEmulator) read(e *InstructionEngine, code uint64) bool {
+	a0 := e.GetExecOrUserARegister(0)
+	buffer, ok := ume.getBuffer(e, a0.GetH2(), a0.GetH1(), true)
+	if !ok {
+		return false
+	}
+
+	line, err := ume.reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		a0.SetW(common.NegativeZero)
+		return true
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	words := common.StringToFieldata(line)
+	count := uint64(len(words))
+	if count > uint64(len(buffer)) {
+		count = uint64(len(buffer))
+	}
+	for wx := range buffer {
+		if uint64(wx) < count {
+			buffer[wx].SetW(words[wx])
+		} else {
+			buffer[wx].SetW(0_050505_050505)
+		}
+	}
+
+	a0.SetW(count)
+	return true
+}
+
+func (ume *UserModeEmulator) date(e *InstructionEngine, code uint64) bool {
+	now := ume.clock()
+	dateWords := common.StringToFieldata(now.Format("010206"))
+	timeWords := common.StringToFieldata(now.Format("150405"))
+	e.GetExecOrUserARegister(0).SetW(dateWords[0])
+	e.GetExecOrUserARegister(1).SetW(timeWords[0])
+	return true
+}
+
+func (ume *UserModeEmulator) time(e *InstructionEngine, code uint64) bool {
+	now := ume.clock()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	e.GetExecOrUserARegister(0).SetW(uint64(now.Sub(midnight).Milliseconds()))
+	return true
+}
+
+func (ume *UserModeEmulator) mcore(e *InstructionEngine, code uint64) bool {
+	a0 := e.GetExecOrUserARegister(0)
+	bd := e.baseRegisters[ume.dataBankRegister].GetBankDescriptor()
+	if bd == nil {
+		e.PostInterrupt(common.NewReferenceViolationInterrupt(common.ReferenceViolationStorageLimits, false))
+		return false
+	}
+
+	newUpperLimit := bd.GetUpperLimitNormalized() + a0.GetW()
+	if newUpperLimit > 0777777 {
+		newUpperLimit = 0777777
+	}
+
+	return ume.resizeDataBank(e, newUpperLimit)
+}
+
+func (ume *UserModeEmulator) lcore(e *InstructionEngine, code uint64) bool {
+	a0 := e.GetExecOrUserARegister(0)
+	bd := e.baseRegisters[ume.dataBankRegister].GetBankDescriptor()
+	if bd == nil {
+		e.PostInterrupt(common.NewReferenceViolationInterrupt(common.ReferenceViolationStorageLimits, false))
+		return false
+	}
+
+	// we always leave at least one word in the bank
+	newUpperLimit := bd.GetLowerLimitNormalized()
+	if bd.GetUpperLimitNormalized()-newUpperLimit > a0.GetW() {
+		newUpperLimit = bd.GetUpperLimitNormalized() - a0.GetW()
+	}
+
+	return ume.resizeDataBank(e, newUpperLimit)
+}
+
+// getBuffer resolves a buffer of the given length at the given relative address,
+// checking limits and access permissions as an instruction would for an operand.
+// If something is wrong, an interrupt is posted and ok is false.
+func (ume *UserModeEmulator) getBuffer(e *InstructionEngine, address uint64, length uint64, forWrite bool) (buffer []common.Word36, ok bool) {
+	var brx uint
+	if e.GetDesignatorRegister().IsBasicModeEnabled() {
+		brx = e.FindBasicModeBank(address)
+	} else {
+		for bx := uint(0); bx < 16; bx++ {
+			if e.isWithinLimits(e.baseRegisters[bx], address) {
+				brx = bx
+				break
+			}
+		}
+	}
+
+	bReg := e.baseRegisters[brx]
+	if !e.isWithinLimits(bReg, address) || length == 0 {
+		e.PostInterrupt(common.NewReferenceViolationInterrupt(common.ReferenceViolationStorageLimits, false))
+		return nil, false
+	}
+
+	key := e.activityStatePacket.GetIndicatorKeyRegister().GetAccessKey()
+	interrupt := e.checkAccessLimitsRange(bReg, address, length, !forWrite, forWrite, key)
+	if interrupt != nil {
+		e.PostInterrupt(interrupt)
+		return nil, false
+	}
+
+	offset := address - bReg.GetBankDescriptor().GetLowerLimitNormalized()
+	storage := bReg.GetStorage()
+	if offset+length > uint64(len(storage)) {
+		e.PostInterrupt(common.NewReferenceViolationInterrupt(common.ReferenceViolationStorageLimits, false))
+		return nil, false
+	}
+
+	buffer = storage[offset : offset+length]
+	if forWrite {
+		absAddr := bReg.GetBankDescriptor().GetBaseAddress()
+		e.instructionCache.Invalidate(absAddr.GetSegment(), absAddr.GetOffset()+offset, length)
+	}
+
+	return buffer, true
+}
+
+// resizeDataBank changes the upper limit of the data bank, resizing its storage segment and reloading
+// the base register. The bank descriptor in the bank descriptor table is updated to match.
+// Resizing replaces the segment's storage, so every other base register based on the same segment is reloaded
+// with the new storage (but keeps its own bank descriptor and limits).
+// On return, A0 contains the new upper limit.
+func (ume *UserModeEmulator) resizeDataBank(e *InstructionEngine, newUpperLimit uint64) bool {
+	brx := ume.dataBankRegister
+	bReg := e.baseRegisters[brx]
+	bd := bReg.GetBankDescriptor()
+	baseAddr := bd.GetBaseAddress()
+
+	newLength := baseAddr.GetOffset() + newUpperLimit - bd.GetLowerLimitNormalized() + 1
+	interrupt := e.mainStorage.Resize(baseAddr.GetSegment(), newLength)
+	if interrupt != nil {
+		e.PostInterrupt(interrupt)
+		return false
+	}
+
+	storage, interrupt := e.mainStorage.GetSegment(baseAddr.GetSegment())
+	if interrupt != nil {
+		e.PostInterrupt(interrupt)
+		return false
+	}
+
+	newBD := common.NewBankDescriptor(
+		bd.GetBankType() == common.BasicModeBankDescriptor,
+		bd.GetAccessLock(),
+		bd.GetGeneralAccessPermissions(),
+		bd.GetSpecialAccessPermissions(),
+		baseAddr,
+		false,
+		bd.GetLowerLimitNormalized(),
+		newUpperLimit,
+		0)
+	for bx, other := range e.baseRegisters {
+		if uint64(bx) == brx {
+			e.SetBaseRegister(brx, common.NewBaseRegisterFromBankDescriptorWithSubsetting(newBD, bReg.GetSubsetting(), storage))
+		} else if !other.IsVoid() &&
+			other.GetBankDescriptor().GetBaseAddress() != nil &&
+			other.GetBankDescriptor().GetBaseAddress().GetSegment() == baseAddr.GetSegment() {
+			e.SetBaseRegister(uint64(bx),
+				common.NewBaseRegisterFromBankDescriptorWithSubsetting(other.GetBankDescriptor(), other.GetSubsetting(), storage))
+		}
+	}
+
+	//	Find the bank descriptor in the BDT, and update it.
+	var level, bdi uint64
+	if brx == 0 {
+		par := e.activityStatePacket.GetProgramAddressRegister()
+		level = par.GetLevel()
+		bdi = par.GetBankDescriptorIndex()
+	} else if brx < 16 {
+		abte := e.activeBaseTable[brx]
+		level = abte.bankLevel
+		bdi = abte.bankDescriptorIndex
+	}
+
+	bdtReg := e.baseRegisters[L0BDTBaseRegister+level]
+	if brx < 16 && !bdtReg.IsVoid() {
+		bdtStorage := bdtReg.GetStorage()
+		if (bdi+1)*8 <= uint64(len(bdtStorage)) {
+			newBD.Serialize(bdtStorage[bdi*8 : bdi*8+8])
+		}
+	}
+
+	e.GetExecOrUserARegister(0).SetW(newUpperLimit)
+	return true
+}
@@ -0,0 +1,241 @@
+// khalehla Project
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package ipEngine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"khalehla/common"
+	"khalehla/tasm"
+)
+
+var helloWords = common.StringToFieldata("HELLO WORLD")
+
+var printReadBasicMode = []*tasm.SourceItem{
+	segSourceItem(077),
+	labelDataSourceItem("msg", []uint64{helloWords[0]}),
+	dataSourceItem([]uint64{helloWords[1]}),
+	tasm.NewSourceItem("printPkt", "hw", []string{"2", "msg"}),
+	labelDataSourceItem("buf0", []uint64{0}),
+	labelDataSourceItem("buf1", []uint64{0}),
+	labelDataSourceItem("buf2", []uint64{0}),
+	tasm.NewSourceItem("readPkt", "hw", []string{"3", "buf0"}),
+
+	segSourceItem(0),
+	laSourceItemHIRef(jW, regA0, 0, 0, 0, "printPkt"),
+	erSourceItemU(ErPRINT),
+	laSourceItemHIRef(jW, regA0, 0, 0, 0, "readPkt"),
+	erSourceItemU(ErREAD),
+	laSourceItemU(jW, regA5, 0, common.A0), // save A0
+	laSourceItemHIRef(jW, regA1, 0, 0, 0, "buf0"),
+	laSourceItemHIRef(jW, regA2, 0, 0, 0, "buf1"),
+	laSourceItemHIRef(jW, regA3, 0, 0, 0, "buf2"),
+	laSourceItemHIRef(jW, regA0, 0, 0, 0, "readPkt"),
+	erSourceItemU(ErREAD),
+	erSourceItemU(ErEXIT),
+	iarSourceItem(0),
+}
+
+var dateTimeBasicMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	erSourceItemU(ErTIME),
+	laSourceItemU(jW, regA5, 0, common.A0), // save A0
+	erSourceItemU(ErDATE),
+	erSourceItemU(ErABORT),
+	iarSourceItem(0),
+}
+
+var coreBasicMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	laSourceItemU(jU, regA0, 0, 01000),
+	erSourceItemU(ErMCORE),
+	laSourceItemU(jW, regA5, 0, common.A0), // save A0
+	laSourceItemU(jU, regA0, 0, 0400),
+	erSourceItemU(ErLCORE),
+	erSourceItemU(ErEXIT),
+	iarSourceItem(0),
+}
+
+var unhandledERBasicMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	erSourceItemU(01),
+	iarSourceItem(0),
+}
+
+var signalExtendedMode = []*tasm.SourceItem{
+	segSourceItem(0),
+	sgnlSourceItemU(077),
+	iarSourceItem(0),
+}
+
+// loadUserModeTest loads the given basic mode program (in a single bank based on B12),
+// and establishes the user mode services for the engine. The caller selects the data bank register, if necessary.
+func loadUserModeTest(t *testing.T, source []*tasm.SourceItem, ume *UserModeEmulator) *UnitTestEngine {
+	sourceSet := tasm.NewSourceSet("Test", source)
+	a := tasm.NewTinyAssembler()
+	a.Assemble(sourceSet)
+
+	e := tasm.Executable{}
+	e.LinkSimple(a.GetSegments(), false)
+
+	ute := NewUnitTestExecutor()
+	err := ute.Load(&e)
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	engine := ute.GetEngine()
+	engine.GetDesignatorRegister().SetBasicModeEnabled(true)
+
+	table := NewExecutiveRequestTable()
+	ume.Register(table)
+	engine.SetExecutiveRequestTable(table)
+	return ute
+}
+
+func Test_UserMode_PrintRead(t *testing.T) {
+	output := &bytes.Buffer{}
+	ume := NewUserModeEmulator(strings.NewReader("line one is long\n"), output)
+	ute := loadUserModeTest(t, printReadBasicMode, ume)
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	engine := ute.GetEngine()
+	checkStoppedReason(t, engine, UserModeExitStop, 0)
+
+	if output.String() != "HELLO WORLD\n" {
+		t.Errorf("Expected 'HELLO WORLD\\n', got '%s'", output.String())
+	}
+
+	expected := common.StringToFieldata("LINE ONE IS LONG")
+	checkRegister(t, engine, common.A5, 3)
+	checkRegister(t, engine, common.A1, expected[0])
+	checkRegister(t, engine, common.A2, expected[1])
+	checkRegister(t, engine, common.A3, expected[2])
+	checkRegister(t, engine, common.A0, common.NegativeZero)
+}
+
+func Test_UserMode_DateTime(t *testing.T) {
+	ume := NewUserModeEmulator(strings.NewReader(""), &bytes.Buffer{})
+	ume.SetClock(func() time.Time {
+		return time.Date(2024, time.March, 7, 13, 5, 9, 250_000_000, time.UTC)
+	})
+
+	ute := loadUserModeTest(t, dateTimeBasicMode, ume)
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	engine := ute.GetEngine()
+	checkStoppedReason(t, engine, UserModeAbortStop, 0)
+	checkRegister(t, engine, common.A5, ((13*60+5)*60+9)*1000+250)
+	checkRegister(t, engine, common.A0, common.StringToFieldata("030724")[0])
+	checkRegister(t, engine, common.A1, common.StringToFieldata("130509")[0])
+}
+
+func Test_UserMode_MCORE_LCORE(t *testing.T) {
+	ume := NewUserModeEmulator(strings.NewReader(""), &bytes.Buffer{})
+	ume.SetDataBankRegister(12)
+	ute := loadUserModeTest(t, coreBasicMode, ume)
+	engine := ute.GetEngine()
+	originalLimit := engine.GetBaseRegister(12).GetBankDescriptor().GetUpperLimitNormalized()
+
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, UserModeExitStop, 0)
+	checkRegister(t, engine, common.A5, originalLimit+01000)
+	checkRegister(t, engine, common.A0, originalLimit+0400)
+
+	bd := engine.GetBaseRegister(12).GetBankDescriptor()
+	if bd.GetUpperLimitNormalized() != originalLimit+0400 {
+		t.Errorf("Expected B12 upper limit %012o, got %012o", originalLimit+0400, bd.GetUpperLimitNormalized())
+	}
+
+	storage := engine.GetBaseRegister(12).GetStorage()
+	expectedLength := originalLimit + 0400 - bd.GetLowerLimitNormalized() + 1
+	if uint64(len(storage)) != expectedLength {
+		t.Errorf("Expected bank storage length %o, got %o", expectedLength, len(storage))
+	}
+}
+
+// With no data bank register selected, MCORE$ and LCORE$ resize the bank on B2. Here B2 describes the same bank
+// as B12 (the code bank), so B12 must also be reloaded with the new storage, and the program must still run
+// to its EXIT$.
+func Test_UserMode_MCORE_LCORE_SharedSegment(t *testing.T) {
+	ume := NewUserModeEmulator(strings.NewReader(""), &bytes.Buffer{})
+	ute := loadUserModeTest(t, coreBasicMode, ume)
+	engine := ute.GetEngine()
+	b12 := engine.GetBaseRegister(12)
+	originalLimit := b12.GetBankDescriptor().GetUpperLimitNormalized()
+	engine.SetBaseRegister(2, common.NewBaseRegisterFromBankDescriptor(b12.GetBankDescriptor(), b12.GetStorage()))
+
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, UserModeExitStop, 0)
+	checkRegister(t, engine, common.A5, originalLimit+01000)
+	checkRegister(t, engine, common.A0, originalLimit+0400)
+
+	b2 := engine.GetBaseRegister(2)
+	if b2.GetBankDescriptor().GetUpperLimitNormalized() != originalLimit+0400 {
+		t.Errorf("Expected B2 upper limit %012o, got %012o",
+			originalLimit+0400, b2.GetBankDescriptor().GetUpperLimitNormalized())
+	}
+
+	b12 = engine.GetBaseRegister(12)
+	if b12.GetBankDescriptor().GetUpperLimitNormalized() != originalLimit {
+		t.Errorf("Expected B12 upper limit to remain %012o, got %012o",
+			originalLimit, b12.GetBankDescriptor().GetUpperLimitNormalized())
+	}
+	if len(b12.GetStorage()) != len(b2.GetStorage()) || &b12.GetStorage()[0] != &b2.GetStorage()[0] {
+		t.Errorf("Expected B12 to be reloaded with the resized storage")
+	}
+}
+
+func Test_UserMode_UnhandledER(t *testing.T) {
+	ume := NewUserModeEmulator(strings.NewReader(""), &bytes.Buffer{})
+	ute := loadUserModeTest(t, unhandledERBasicMode, ume)
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	// ER 01 (IO$) has no handler, so it must still post a class 12 interrupt
+	checkInterrupt(t, ute.GetEngine(), common.SignalInterruptClass)
+}
+
+func Test_UserMode_SignalHandler(t *testing.T) {
+	signalled := uint64(0)
+	ute := loadTestProgram(t, signalExtendedMode)
+	engine := ute.GetEngine()
+	table := NewExecutiveRequestTable()
+	table.RegisterSignal(077, ExecutiveRequestHandlerFunc(
+		func(e *InstructionEngine, code uint64) bool {
+			signalled = code
+			return true
+		}))
+	engine.SetExecutiveRequestTable(table)
+
+	err := ute.Run()
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+
+	checkStoppedReason(t, engine, InitiateAutoRecoveryStop, 0)
+	if signalled != 077 {
+		t.Errorf("Expected SGNL handler to be invoked")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"sync"
 
+	"khalehla/hardware"
 	"khalehla/logger"
 )
 
@@ -17,6 +18,8 @@ type SystemProcessor struct {
 	name       string
 	processors map[UpiIndex]Processor // map of all Processor entities (including ourself)
 	mutex      sync.Mutex
+
+	faultInjector *hardware.FaultInjector // if not nil, may cause UPI interrupts to be lost
 }
 
 func NewSystemProcessor() *SystemProcessor {
@@ -79,14 +82,26 @@ func (sp *SystemProcessor) HandleInterrupt(source UpiIndex, details interface{})
 func (sp *SystemProcessor) SendInterrupt(source UpiIndex, destination UpiIndex, details interface{}) error {
 	sp.mutex.Lock()
 	defer sp.mutex.Unlock()
-	processor, ok := sp.processors[source]
+	processor, ok := sp.processors[destination]
 	if !ok {
-		return fmt.Errorf("destination processor %s not found for source %v", destination, source)
+		return fmt.Errorf("destination processor %v not found for source %v", destination, source)
+	}
+
+	if sp.faultInjector != nil && sp.faultInjector.Check(hardware.UPILossFault, processor.GetName()) {
+		// the interrupt is lost in transit - as far as the sender is concerned, it was sent
+		return nil
 	}
 
 	return processor.HandleInterrupt(source, details)
 }
 
+// SetFaultInjector establishes (or, if nil, removes) the fault injector which decides when UPI interrupts are lost
+func (sp *SystemProcessor) SetFaultInjector(injector *hardware.FaultInjector) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.faultInjector = injector
+}
+
 func (sp *SystemProcessor) Reset() (err error) {
 	logger.Log(logger.LevelTrace, sp.name, "Reset")
 	return
@@ -22,6 +22,20 @@ func main() {
 		err = packUtil.DoPrep(args[1:])
 	} else if args[0] == "show" {
 		err = packUtil.DoShow(args[1:])
+	} else if args[0] == "convert" {
+		err = packUtil.DoConvert(args[1:])
+	} else if args[0] == "key-create" {
+		err = packUtil.DoKeyCreate(args[1:])
+	} else if args[0] == "encrypt-init" {
+		err = packUtil.DoEncryptInit(args[1:])
+	} else if args[0] == "dedupe-verify" {
+		err = packUtil.DoDedupeVerify(args[1:])
+	} else if args[0] == "overlay-commit" {
+		err = packUtil.DoOverlayCommit(args[1:])
+	} else if args[0] == "overlay-discard" {
+		err = packUtil.DoOverlayDiscard(args[1:])
+	} else if args[0] == "overlay-snapshot" {
+		err = packUtil.DoOverlaySnapshot(args[1:])
 	} else {
 		packUtil.DoUsage()
 		os.Exit(1)
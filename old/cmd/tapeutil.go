@@ -5,11 +5,35 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"khalehla/old/tapeUtil"
 )
 
 func main() {
-	tapeUtil.DoMain(os.Args[1:])
+	args := os.Args[1:]
+	if len(args) < 1 {
+		tapeUtil.DoMain(args)
+		return
+	}
+
+	var err error
+	if args[0] == "import-simh" {
+		err = tapeUtil.DoImportSimh(args[1:])
+	} else if args[0] == "export-simh" {
+		err = tapeUtil.DoExportSimh(args[1:])
+	} else if args[0] == "import-aws" {
+		err = tapeUtil.DoImportAws(args[1:])
+	} else if args[0] == "export-aws" {
+		err = tapeUtil.DoExportAws(args[1:])
+	} else {
+		tapeUtil.DoMain(args)
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error:%v\n", err)
+		os.Exit(1)
+	}
 }
@@ -31,6 +31,7 @@ type TapeChannel struct {
 	packetMap  map[ioPackets2.IoPacket]*ChannelProgram
 	resetIos   bool
 	verbose    bool
+	faults     *hardware.FaultInjector
 	mutex      sync.Mutex
 }
 
@@ -68,6 +69,14 @@ func (ch *TapeChannel) SetVerbose(flag bool) {
 	ch.verbose = flag
 }
 
+// SetFaultInjector attaches a FaultInjector which may fail channel programs with channel or device errors,
+// or detaches it if nil is given.
+func (ch *TapeChannel) SetFaultInjector(injector *hardware.FaultInjector) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	ch.faults = injector
+}
+
 func (ch *TapeChannel) AssignDevice(nodeIdentifier hardware.NodeIdentifier, device devices2.Device) error {
 	if device.GetNodeDeviceType() != hardware2.NodeDeviceTape {
 		return fmt.Errorf("device is not a tape")
@@ -268,6 +277,18 @@ func (ch *TapeChannel) goRoutine() {
 				break
 			}
 
+			if ch.faults != nil && ch.faults.Check(hardware.ChannelErrorFault, ch.logName) {
+				channelProgram.IoStatus = ioPackets2.IosSystemError
+				if ch.verbose {
+					logger.LogErrorF(ch.logName, "ChannelError:%v", channelProgram.GetString())
+				}
+				if channelProgram.Listener != nil {
+					channelProgram.Listener.ChannelProgramComplete(channelProgram)
+				}
+				ch.mutex.Unlock()
+				break
+			}
+
 			dev.StartIo(ioPkt)
 			ch.packetMap[ioPkt] = channelProgram
 			ch.mutex.Unlock()
@@ -276,6 +297,10 @@ func (ch *TapeChannel) goRoutine() {
 			ch.mutex.Lock()
 			channelProgram, ok := ch.packetMap[ioPacket]
 			if ok {
+				// a device error replaces whatever status the device reported, so that no data is transferred
+				if ch.faults != nil && ch.faults.Check(hardware.DeviceErrorFault, fmt.Sprint(channelProgram.NodeIdentifier)) {
+					ioPacket.SetIoStatus(ioPackets2.IosSystemError)
+				}
 				ch.resolveIoPacket(channelProgram, ioPacket)
 				if channelProgram.Listener != nil {
 					channelProgram.Listener.ChannelProgramComplete(channelProgram)
@@ -7,6 +7,8 @@ package kasm
 
 import (
 	"fmt"
+
+	"khalehla/old/parser"
 )
 
 type LabelSpecification struct {
@@ -26,7 +28,9 @@ func NewLabelSpecification(symbol string, selectors []*Expression, levelCount in
 // ParseLabelSpecification parses a label subfield consisting of
 //
 //	symbol [ selectors ] [ levelers ]
-func (p *parser.Parser) ParseLabelSpecification(context *Context) (*LabelSpecification, error) {
+//
+// If the text does not begin with a symbol, we return nil with no error.
+func ParseLabelSpecification(p *parser.Parser, context *Context) (*LabelSpecification, error) {
 	p.SkipWhiteSpace()
 	symbol, err := p.ParseSymbol()
 	if err != nil {
@@ -40,7 +44,7 @@ func (p *parser.Parser) ParseLabelSpecification(context *Context) (*LabelSpecifi
 	}
 
 	//	parse optional arg list in parentheses
-	expList, err := p.ParseExpressionList(context)
+	expList, err := ParseExpressionList(p, context)
 	if err != nil {
 		return nil, err
 	}
@@ -51,5 +55,10 @@ func (p *parser.Parser) ParseLabelSpecification(context *Context) (*LabelSpecifi
 		levelCount++
 	}
 
+	p.SkipWhiteSpace()
+	if !p.AtEnd() {
+		return nil, fmt.Errorf("syntax error in label specification")
+	}
+
 	return NewLabelSpecification(*symbol, expList, levelCount), nil
 }
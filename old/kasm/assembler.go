@@ -5,82 +5,296 @@
 
 package kasm
 
-type assembledLine struct {
-	sourceName *string
-	sourceCode *string
-	lineNumber int
+import (
+	"fmt"
+	"strings"
+
+	"khalehla/tasm"
+)
+
+// maxProcedureDepth limits the nesting of procedure references, so that a procedure which (directly or otherwise)
+// references itself without end does not take down the assembler.
+const maxProcedureDepth = 64
+
+// sourceLine is a line of source, divided into fields and subfields.
+// The label field is nil if the line does not begin with a label.
+type sourceLine struct {
+	label     []string
+	operation []string
+	operands  [][]string
 }
 
 type Assembler struct {
-	assembledLines []assembledLine
-	context        *Context
+	context     *Context
+	dictionary  *Dictionary // outermost dictionary for the source being assembled
+	procDepth   int
+	sourceItems map[int]*tasm.SourceItem
+	sourceName  string
 }
 
+// NewAssembler creates an assembler with the standard register names, forms, and instruction procedures
+// already defined. These definitions are held in a dictionary which encloses the dictionary for the source.
+func NewAssembler() *Assembler {
+	system := NewTopLevelDictionary()
+	a := &Assembler{
+		context:     NewContext(system),
+		sourceItems: make(map[int]*tasm.SourceItem),
+	}
+
+	a.context.currentLineNumber = 0
+	for _, includes := range [][]string{axrIncludes, formIncludes, instructionIncludes} {
+		a.assembleLines(includes)
+	}
+
+	a.dictionary = NewSubLevelDictionary(system)
+	a.context.dictionary = a.dictionary
+	a.context.externals = make(map[string]bool)
+	a.context.frame = &frame{}
+	return a
+}
+
+// Assemble assembles the given source, returning true if there were no errors
 func (a *Assembler) Assemble(sourceName string, sourceCode []string) bool {
-	a.context.diagnostics.Clear()
-	a.context.currentLineIndex = 0
-	a.context.currentLocationCounter = 0
-	a.context.currentLiteralPool = 0
-	a.context.currentLineNumber = 1
-	for a.context.currentLineIndex < len(sourceCode) {
-		fields, ok := a.parseLine(a.context.currentLineIndex+1, sourceCode[a.context.currentLineIndex])
-		a.context.currentLineIndex++
+	a.sourceName = sourceName
+	for lx, text := range sourceCode {
+		if a.context.frame.ended {
+			break
+		}
 
+		a.context.currentLineNumber = lx + 1
+		line, ok := a.parseLine(text)
 		if !ok {
 			continue
 		}
 
-		a.interpretLine(fields)
+		a.sourceItems[a.context.currentLineNumber] = line.getSourceItem()
+		a.processLine(text, line)
 	}
 
+	a.checkFrameComplete()
 	errors, _, _ := a.context.diagnostics.GetDiagnosticCounters()
 	return errors == 0
 }
 
-func (a *Assembler) interpretLine(fields [][]string) {
-	var labelField []string
-	var operationField []string
-	var operandField []string
+// assembleLines assembles lines of text which are not part of the source proper - that is,
+// includes and the bodies of procedures. Diagnostics are attributed to the current line.
+func (a *Assembler) assembleLines(lines []string) {
+	for _, text := range lines {
+		if a.context.frame.ended {
+			break
+		}
+
+		line, ok := a.parseLine(text)
+		if ok {
+			a.processLine(text, line)
+		}
+	}
+}
+
+// checkFrameComplete reports a $PROC or $IF in the current frame which has no $END
+func (a *Assembler) checkFrameComplete() {
+	f := a.context.frame
+	if f.definition != nil {
+		a.context.AppendError(fmt.Sprintf("procedure %s has no $END", f.definition.name))
+	}
+	if len(f.conditionals) > 0 {
+		a.context.AppendError("$IF has no $END")
+	}
+}
 
-	if len(fields) > 0 {
-		labelField = fields[0]
-		if len(fields) > 1 {
-			operationField = fields[1]
-			if len(fields) > 2 {
-				operandField = fields[2]
+// GetDiagnostics returns the diagnostics produced by the assembly
+func (a *Assembler) GetDiagnostics() *Diagnostics {
+	return a.context.diagnostics
+}
+
+// defineLine adds a line of text to the procedure being defined, unless it is the $END which terminates
+// the definition. $NAME lines at the outer level of the procedure establish names for the procedure.
+func (a *Assembler) defineLine(text string, line *sourceLine) {
+	f := a.context.frame
+	tag := ""
+	if len(line.operation) > 0 {
+		tag = strings.ToUpper(line.operation[0])
+	}
+
+	switch tag {
+	case "$IF", "$PROC":
+		f.definitionDepth++
+	case "$END":
+		if f.definitionDepth == 0 {
+			f.definition = nil
+			return
+		}
+		f.definitionDepth--
+	case "$NAME":
+		if f.definitionDepth == 0 {
+			defineName(a.context, f.definition, len(f.definition.code), line.label, line.operands)
+		}
+	}
+
+	f.definition.code = append(f.definition.code, text)
+}
+
+// interpretLine assembles a line which is not part of a procedure definition
+func (a *Assembler) interpretLine(line *sourceLine) {
+	tag := ""
+	if len(line.operation) > 0 {
+		tag = strings.ToUpper(line.operation[0])
+	}
+
+	if !a.context.isActive() {
+		if tag == "$PROC" {
+			//	a procedure definition within skipped lines has an $END which must not terminate the $IF
+			a.context.frame.conditionals = append(a.context.frame.conditionals, &conditional{})
+		} else if conditionalDirectives[tag] {
+			InterpretDirective(a.context, line.label, line.operation, line.operands)
+		}
+		return
+	}
+
+	// If there is a label field and the first subfield contains a location counter, process it and
+	// strip the subfield from the label field.
+	labels := line.label
+	if len(labels) > 0 {
+		lcs, err := NewLocationCounterSpecification(a.context, labels[0])
+		if err != nil {
+			a.context.AppendErr(err)
+			labels = labels[1:]
+		} else if lcs != nil {
+			labels = labels[1:]
+			val, err := lcs.Evaluate(a.context)
+			if err != nil {
+				a.context.AppendErr(err)
+			} else {
+				a.context.currentLocationCounter = val
 			}
 		}
 	}
 
-	ok := InterpretDirective(a.context, labelField, operationField, operandField)
-	if !ok {
-		//	TODO something else - empty line? implied $GEN?
+	if len(line.operation) == 0 {
+		processLabels(a.context, labels)
+		if len(line.operands) > 0 {
+			a.context.AppendWarning(extraneousOperandSubfields)
+		}
+		return
+	}
+
+	if InterpretDirective(a.context, labels, line.operation, line.operands) {
+		return
+	}
+
+	entry, _ := a.context.dictionary.Lookup(line.operation[0])
+	switch value := entry.(type) {
+	case *Form:
+		processLabels(a.context, labels)
+		checkNoOperation(a.context, line.operation)
+		values := evaluateOperands(a.context, line.operands)
+		if len(values) != len(value.bitSizes) {
+			a.context.AppendError("wrong number of operands for form")
+			return
+		}
+		generateFormWord(a.context, value, values)
+	case *InternalNameValue:
+		pe := value.selectEntry(a.context.basicMode)
+		if pe == nil {
+			a.context.AppendError(fmt.Sprintf("%s is not valid in this mode", strings.ToUpper(line.operation[0])))
+			return
+		}
+		a.invokeProcedure(pe.procedure, pe.textIndex+1, pe.value, labels, line)
+	case *Procedure:
+		if !value.appliesTo(a.context.basicMode) {
+			a.context.AppendError(fmt.Sprintf("%s is not valid in this mode", strings.ToUpper(line.operation[0])))
+			return
+		}
+		a.invokeProcedure(value, 0, NewSimpleIntegerValue(0), labels, line)
+	default:
+		a.context.AppendError(fmt.Sprintf("unrecognized operation %s", strings.ToUpper(line.operation[0])))
+	}
+}
+
+// invokeProcedure assembles the lines of a procedure, beginning at the indicated line.
+// The labels (if any) are set to the current location counter. The fields of the referencing line are
+// presented to the procedure as a node named for the procedure: P(0,0) is the value associated with the
+// reference (from the $NAME line), P(0,n) are the subsequent operation subfields, and P(f,n) are the
+// subfields of operand field f. Flagged subfields (those with a leading asterisk) may be detected via P(f,*n).
+func (a *Assembler) invokeProcedure(procedure *Procedure, start int, value Value, labels []string, line *sourceLine) {
+	if a.procDepth >= maxProcedureDepth {
+		a.context.AppendError("procedure references are nested too deeply")
+		return
+	}
+
+	processLabels(a.context, labels)
+
+	evaluate := func(text string) Value {
+		value, err := evaluateText(a.context, text)
+		if err != nil {
+			a.context.AppendErr(err)
+			return NewSimpleIntegerValue(0)
+		}
+		return value
 	}
+
+	params := NewParameterNode()
+	operation := NewParameterNode().Set(0, value)
+	for sx, text := range line.operation[1:] {
+		operation.Set(uint64(sx+1), evaluate(text))
+	}
+	params.Set(0, operation)
+	for fx, field := range line.operands {
+		fieldNode := NewParameterNode()
+		for sx, text := range field {
+			fieldNode.Set(uint64(sx+1), evaluate(text))
+		}
+		params.Set(uint64(fx+1), fieldNode)
+	}
+
+	outerDictionary := a.context.dictionary
+	outerFrame := a.context.frame
+	a.context.dictionary = NewSubLevelDictionary(outerDictionary)
+	_ = a.context.dictionary.Establish(procedure.name, nil, 0, params)
+	a.context.frame = &frame{parent: outerFrame}
+	a.procDepth++
+
+	a.assembleLines(procedure.code[start:])
+	a.checkFrameComplete()
+
+	a.procDepth--
+	a.context.frame = outerFrame
+	a.context.dictionary = outerDictionary
 }
 
-func (a *Assembler) parseLine(lineNumber int, source string) ([][]string, bool) {
+// parseLine divides a line of source into fields and subfields. Fields are separated by blanks, and subfields
+// by commas (blanks following a comma are ignored). Blanks and commas within quotes or parentheses do not
+// separate anything. A period which is preceded and followed by blanks begins a comment.
+// Returns false (having posted a diagnostic) if the line cannot be parsed.
+func (a *Assembler) parseLine(source string) (*sourceLine, bool) {
 	fields := make([][]string, 0)
-	fieldNumber := 0
-	sx := 0
-	postComma := false // cannot be true if inQuote is true
+	subfields := make([]string, 0)
+	inField := false
 	inQuote := false
+	postComma := false
 	parenDepth := 0
-	prevSpace := false
 	staging := ""
 
-	for sx < len(source) {
-		char := source[sx : sx+1]
-		sx++
-		nextChar := " "
-		isLastChar := sx == len(source)
-		if !isLastChar {
-			nextChar = source[sx : sx+1]
+	isBlank := func(ch uint8) bool {
+		return ch == ' ' || ch == '\t'
+	}
+
+	endField := func() {
+		if inField {
+			fields = append(fields, append(subfields, staging))
+			subfields = make([]string, 0)
+			staging = ""
+			inField = false
 		}
+	}
 
+	for sx := 0; sx < len(source); sx++ {
+		ch := source[sx]
 		if inQuote {
-			staging += char
-			if char == "'" {
-				if !isLastChar && nextChar == "'" {
+			staging += string(ch)
+			if ch == '\'' {
+				if sx+1 < len(source) && source[sx+1] == '\'' {
+					staging += "'"
 					sx++
 				} else {
 					inQuote = false
@@ -89,88 +303,81 @@ func (a *Assembler) parseLine(lineNumber int, source string) ([][]string, bool)
 			continue
 		}
 
-		if char == "'" {
-			staging += char
+		if ch == '\'' {
 			inQuote = true
-			prevSpace = false
-			postComma = false
-			continue
-		}
-
-		if parenDepth > 0 {
-			staging += char
-			if char == ")" {
-				parenDepth--
-			}
-			continue
-		}
-
-		if char == ")" {
-			a.context.diagnostics.AppendError(lineNumber, "unexpected close-parenthesis")
-			return fields, false
-		}
-
-		if char == "(" {
-			staging += char
+		} else if ch == '(' {
 			parenDepth++
-			postComma = false
-			prevSpace = false
-			continue
-		}
-
-		if char == "," {
-			if fields[fieldNumber] == nil {
-				fields[fieldNumber] = make([]string, 0)
+		} else if ch == ')' {
+			if parenDepth == 0 {
+				a.context.AppendError("unexpected close-parenthesis")
+				return nil, false
 			}
-			fields[fieldNumber] = append(fields[fieldNumber], staging)
+			parenDepth--
+		} else if parenDepth > 0 {
+			// nothing special within parentheses
+		} else if ch == ',' {
+			subfields = append(subfields, staging)
 			staging = ""
+			inField = true
 			postComma = true
 			continue
-		}
-
-		if char == " " {
-			prevSpace = true
+		} else if isBlank(ch) {
 			if !postComma {
-				if fields[fieldNumber] == nil {
-					fields[fieldNumber] = make([]string, 0)
-				}
-				fields[fieldNumber] = append(fields[fieldNumber], staging)
-				fieldNumber++
-				staging = ""
+				endField()
 			}
 			continue
+		} else if ch == '.' && (sx == 0 || isBlank(source[sx-1])) && (sx+1 == len(source) || isBlank(source[sx+1])) {
+			break
 		}
 
-		if char == "." {
-			if sx == 0 || prevSpace {
-				prevSpace = false
-				if isLastChar || nextChar == " " {
-					break
-				}
-			}
-		}
+		staging += string(ch)
+		inField = true
+		postComma = false
 	}
 
 	if inQuote {
-		a.context.diagnostics.AppendError(lineNumber, "unterminated string literalExpressionItem")
-		return fields, false
+		a.context.AppendError("unterminated string literal")
+		return nil, false
 	}
 
 	if parenDepth > 0 {
-		a.context.diagnostics.AppendError(lineNumber, "unterminated grouping")
-		return fields, false
+		a.context.AppendError("unterminated grouping")
+		return nil, false
 	}
 
-	if len(staging) > 0 {
-		if fields[fieldNumber] == nil {
-			fields[fieldNumber] = make([]string, 0)
-		}
-		fields[fieldNumber] = append(fields[fieldNumber], staging)
+	endField()
+
+	if len(source) == 0 || isBlank(source[0]) {
+		fields = append([][]string{nil}, fields...)
 	}
 
-	return fields, true
+	line := &sourceLine{}
+	if len(fields) > 0 {
+		line.label = fields[0]
+	}
+	if len(fields) > 1 {
+		line.operation = fields[1]
+	}
+	if len(fields) > 2 {
+		line.operands = fields[2:]
+	}
+	return line, true
 }
 
-func (a *Assembler) display(allSource bool, undefinedReferences bool) {
+// processLine assembles a line, or adds it to the procedure being defined
+func (a *Assembler) processLine(text string, line *sourceLine) {
+	if a.context.frame.definition != nil {
+		a.defineLine(text, line)
+	} else {
+		a.interpretLine(line)
+	}
+}
 
+// getSourceItem represents the line in the form in which it is recorded in an object module
+func (sl *sourceLine) getSourceItem() *tasm.SourceItem {
+	operands := make([]string, len(sl.operands))
+	for fx, field := range sl.operands {
+		operands[fx] = strings.Join(field, ",")
+	}
+	return tasm.NewSourceItem(strings.Join(sl.label, ","), strings.Join(sl.operation, ","), operands)
 }
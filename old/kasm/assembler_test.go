@@ -0,0 +1,405 @@
+// khalehla Project
+// simple assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package kasm
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"khalehla/tasm"
+)
+
+// objectModuleContent is as much of the object module file format as the tests need in order to see
+// the code generated for each source line, and the references which are left for the linker
+type objectModuleContent struct {
+	Segments []struct {
+		Number uint64            `json:"number"`
+		Labels map[string]uint64 `json:"labels"`
+		Blocks []struct {
+			Line       uint64   `json:"line"`
+			Command    string   `json:"command"`
+			Code       []uint64 `json:"code"`
+			References []struct {
+				Symbol      string `json:"symbol"`
+				Offset      uint64 `json:"offset"`
+				StartingBit uint64 `json:"startingBit"`
+				BitCount    uint64 `json:"bitCount"`
+			} `json:"references"`
+		} `json:"blocks"`
+	} `json:"segments"`
+}
+
+func assembleTest(t *testing.T, source []string) *tasm.ObjectModule {
+	a := NewAssembler()
+	if !a.Assemble("test", source) {
+		t.Fatalf("Error unexpected diagnostics %v", a.GetDiagnostics().GetMessages())
+	}
+	return a.GetObjectModule("TEST")
+}
+
+func readObjectModule(t *testing.T, om *tasm.ObjectModule) *objectModuleContent {
+	buffer := &bytes.Buffer{}
+	err := om.Write(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	var content objectModuleContent
+	err = json.Unmarshal(buffer.Bytes(), &content)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	return &content
+}
+
+func checkSegmentCode(t *testing.T, om *tasm.ObjectModule, segmentNumber uint64, expected []uint64) {
+	segment, ok := om.GetSegments()[segmentNumber]
+	if !ok {
+		t.Fatalf("Error segment %03o was not generated", segmentNumber)
+	}
+
+	code := segment.GetCode()
+	if len(code) != len(expected) {
+		t.Fatalf("Error expected %d words in segment %03o, got %d: %012o", len(expected), segmentNumber, len(code), code)
+	}
+	for wx, word := range expected {
+		if code[wx] != word {
+			t.Errorf("Error segment %03o word %d expected %012o, got %012o", segmentNumber, wx, word, code[wx])
+		}
+	}
+}
+
+func Test_Assembler_Form(t *testing.T) {
+	source := []string{
+		"F        $FORM     6,12,18",
+		"         F         1,2,3",
+		"         F         077,-1,0777777",
+		"G        $FORM     18,18",
+		"         G         'AB',0123",
+	}
+
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{
+		0_010002_000003,
+		0_777776_777777,
+		0_000607_000123,
+	})
+}
+
+func Test_Assembler_FormWrongOperandCount(t *testing.T) {
+	source := []string{
+		"F        $FORM     6,12,18",
+		"         F         1,2",
+	}
+
+	a := NewAssembler()
+	if a.Assemble("test", source) {
+		t.Fatalf("Error expected an error for the wrong number of form operands")
+	}
+}
+
+func Test_Assembler_StringCodes(t *testing.T) {
+	source := []string{
+		"         $GEN      'AB'",
+		"         $ASCII",
+		"         $GEN      'ABCD'",
+		"         $GEN      'AB'",
+		"         $GEN      'ABCDE'",
+		"         $FDATA",
+		"         $GEN      'ABCDEF'",
+		"         $GEN      'ABCDEFGH'",
+	}
+
+	// strings are left-justified and space-filled, in quarter words for ASCII and sixth words for Fieldata
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{
+		0_060705_050505,
+		0_101102_103104,
+		0_101102_040040,
+		0_101102_103104, 0_105040_040040,
+		0_060710_111213,
+		0_060710_111213, 0_141505_050505,
+	})
+}
+
+func Test_Assembler_BasicAndExtendedMode(t *testing.T) {
+	source := []string{
+		"         LA        A1,05,X2,3",
+		"         $BASIC",
+		"         LA        A1,05,X2,3",
+		"         LA        A1,0177777",
+		"         $EXTEND",
+		"         LA        A1,05,X2,3",
+	}
+
+	// basic mode has a 16-bit u field and no b field, extended mode a 4-bit b field and a 12-bit d field
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{
+		0_100022_030005,
+		0_100022_000005,
+		0_100020_177777,
+		0_100022_030005,
+	})
+}
+
+func Test_Assembler_Info(t *testing.T) {
+	source := []string{
+		"VALUE    $EQU      3",
+		"         $INFO     'value is',VALUE,'or',VALUE*2",
+		"         $GEN      VALUE",
+	}
+
+	a := NewAssembler()
+	if !a.Assemble("test", source) {
+		t.Fatalf("Error unexpected diagnostics %v", a.GetDiagnostics().GetMessages())
+	}
+
+	messages := a.GetDiagnostics().GetMessages()
+	if len(messages) != 1 || messages[0] != "I:2:value is 3 or 6" {
+		t.Fatalf("Error expected a single informational message, got %v", messages)
+	}
+	checkSegmentCode(t, a.GetObjectModule("TEST"), 0, []uint64{3})
+}
+
+func Test_Assembler_ProcedureNames(t *testing.T) {
+	source := []string{
+		"P        $PROC",
+		"FIRST*   $NAME     1",
+		"         $GEN      P(0,0)+010",
+		"SECOND*  $NAME     2",
+		"         $GEN      P(0,0)+020",
+		"         $END",
+		"         FIRST",
+		"START*   SECOND",
+		"         P",
+	}
+
+	// each reference begins assembly of the procedure after the $NAME line for the name it uses,
+	// with P(0,0) taking the value from that line; a reference by the procedure name begins at the top
+	om := assembleTest(t, source)
+	content := readObjectModule(t, om)
+	if len(content.Segments) != 1 {
+		t.Fatalf("Error expected one segment, got %d", len(content.Segments))
+	}
+
+	expected := map[uint64][]uint64{
+		7: {011, 021},
+		8: {022},
+		9: {010, 020},
+	}
+	segment := content.Segments[0]
+	if len(segment.Blocks) != len(expected) {
+		t.Fatalf("Error expected %d blocks, got %d", len(expected), len(segment.Blocks))
+	}
+	for _, block := range segment.Blocks {
+		code, ok := expected[block.Line]
+		if !ok {
+			t.Fatalf("Error unexpected block for line %d", block.Line)
+		}
+		if len(block.Code) != len(code) {
+			t.Fatalf("Error line %d expected %012o, got %012o", block.Line, code, block.Code)
+		}
+		for wx, word := range code {
+			if block.Code[wx] != word {
+				t.Errorf("Error line %d word %d expected %012o, got %012o", block.Line, wx, word, block.Code[wx])
+			}
+		}
+		if len(block.References) != 0 {
+			t.Errorf("Error line %d expected no references, got %v", block.Line, block.References)
+		}
+	}
+
+	if offset, ok := segment.Labels["START"]; !ok || offset != 2 {
+		t.Errorf("Error expected START at offset 2, got %v", segment.Labels)
+	}
+}
+
+func Test_Assembler_Res(t *testing.T) {
+	source := []string{
+		"         $GEN      1",
+		"TABLE    $RES      3",
+		"         $GEN      TABLE",
+	}
+
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{1, 0, 0, 0, 1})
+}
+
+func Test_Assembler_IfElse(t *testing.T) {
+	source := []string{
+		"         $IF       1",
+		"         $GEN      011",
+		"         $ELSE",
+		"         $GEN      022",
+		"         $END",
+		"         $IF       0",
+		"         $GEN      033",
+		"         $ELSE",
+		"         $GEN      044",
+		"         $END",
+		"         $IF       1",
+		"         $IF       0",
+		"         $GEN      055",
+		"         $END",
+		"         $GEN      066",
+		"         $END",
+	}
+
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{011, 044, 066})
+}
+
+func Test_Assembler_IfWithoutEnd(t *testing.T) {
+	source := []string{
+		"         $IF       1",
+		"         $GEN      011",
+	}
+
+	a := NewAssembler()
+	if a.Assemble("test", source) {
+		t.Fatalf("Error expected an error for $IF without $END")
+	}
+}
+
+func Test_Assembler_Base(t *testing.T) {
+	source := []string{
+		"$(1)",
+		"DATA     $GEN      0",
+		"$(2)",
+		"MORE     $GEN      0",
+		"$(0)",
+		"         LA        A1,DATA",
+		"         $BASE     2",
+		"         LA        A1,DATA",
+		"         $USE      5,2",
+		"         LA        A1,DATA",
+		"         LA        A1,MORE",
+		"         LA        A1,MORE,,7",
+	}
+
+	// the displacements are left to the linker - only the b-fields are of interest here
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{
+		0_100020_000000,
+		0_100020_020000,
+		0_100020_020000,
+		0_100020_050000,
+		0_100020_070000,
+	})
+}
+
+func Test_Assembler_LocationCounterReferences(t *testing.T) {
+	source := []string{
+		"$(1)",
+		"DATA     $GEN      5",
+		"         $RES      2",
+		"$(0)",
+		"START*   LA        A1,DATA+2",
+		"         $GEN      DATA",
+	}
+
+	om := assembleTest(t, source)
+	checkSegmentCode(t, om, 0, []uint64{0_100020_000002, 0})
+	checkSegmentCode(t, om, 1, []uint64{5, 0, 0})
+
+	content := readObjectModule(t, om)
+
+	type reference struct {
+		symbol      string
+		offset      uint64
+		startingBit uint64
+		bitCount    uint64
+	}
+
+	references := make(map[uint64][]reference)
+	labels := make(map[uint64]map[string]uint64)
+	for _, segment := range content.Segments {
+		labels[segment.Number] = segment.Labels
+		for _, block := range segment.Blocks {
+			for _, ref := range block.References {
+				references[segment.Number] = append(references[segment.Number],
+					reference{ref.Symbol, ref.Offset, ref.StartingBit, ref.BitCount})
+			}
+		}
+	}
+
+	expected := []reference{
+		{tasm.GetLocationSymbol(1), 0, 24, 12},
+		{tasm.GetLocationSymbol(1), 1, 0, 36},
+	}
+	if len(references[0]) != len(expected) {
+		t.Fatalf("Error expected %d references in segment 000, got %v", len(expected), references[0])
+	}
+	for rx, ref := range expected {
+		if references[0][rx] != ref {
+			t.Errorf("Error expected reference %v, got %v", ref, references[0][rx])
+		}
+	}
+	if len(references[1]) != 0 {
+		t.Errorf("Error expected no references in segment 001, got %v", references[1])
+	}
+
+	if offset, ok := labels[1][tasm.GetLocationSymbol(1)]; !ok || offset != 0 {
+		t.Errorf("Error expected %s to label segment 001, got %v", tasm.GetLocationSymbol(1), labels[1])
+	}
+	if offset, ok := labels[0]["START"]; !ok || offset != 0 {
+		t.Errorf("Error expected START to label segment 000, got %v", labels[0])
+	}
+}
+
+func Test_Assembler_Link(t *testing.T) {
+	source := []string{
+		"$(1)",
+		"DATA     $GEN      5",
+		"         $RES      2",
+		"         $GEN      DATA+1",
+		"$(0)",
+		"         $USE      2,1",
+		"START*   LA        A1,DATA+2",
+		"         LA        A2,TARGET",
+		"TARGET   $GEN      DATA",
+	}
+
+	om := assembleTest(t, source)
+	spec := tasm.NewLinkSpec().
+		AddBank(tasm.NewBankSpec(0600004, 0).SetGeneralPermissions(true, true, false)).
+		AddBank(tasm.NewBankSpec(0600005, 1).SetLowerLimit(02000).SetGeneralPermissions(false, true, true)).
+		BaseOn(0, 0600004).
+		BaseOn(2, 0600005).
+		SetStartingSymbol("START")
+
+	e, diagnostics := tasm.Link(om.GetSegments(), spec)
+	if diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("Error unexpected diagnostics %v", diagnostics.GetDiagnostics())
+	}
+
+	if e.GetStartingAddress() != 01000 {
+		t.Errorf("Error expected starting address 01000, got %06o", e.GetStartingAddress())
+	}
+
+	code := e.GetBanks()[0600004].GetCode()
+	expected := []uint64{0_100020_022002, 0_100040_001002, 0_000000_002000}
+	if len(code) != len(expected) {
+		t.Fatalf("Error expected %d words in code bank, got %012o", len(expected), code)
+	}
+	for wx, word := range expected {
+		if code[wx] != word {
+			t.Errorf("Error code bank word %d expected %012o, got %012o", wx, word, code[wx])
+		}
+	}
+
+	data := e.GetBanks()[0600005].GetCode()
+	expected = []uint64{5, 0, 0, 02001}
+	if len(data) != len(expected) {
+		t.Fatalf("Error expected %d words in data bank, got %012o", len(expected), data)
+	}
+	for wx, word := range expected {
+		if data[wx] != word {
+			t.Errorf("Error data bank word %d expected %012o, got %012o", wx, word, data[wx])
+		}
+	}
+}
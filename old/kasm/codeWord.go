@@ -5,9 +5,161 @@
 
 package kasm
 
+import (
+	"fmt"
+
+	"khalehla/common"
+)
+
 // CodeWord represents a single word of generated code, with potential relocation and/or undefined
 // referenceExpressionItem information attached.
 type CodeWord struct {
-	baseValue uint64
-	offsets   []Offset
+	baseValue  uint64
+	lineNumber int
+	offsets    []Offset
+}
+
+// encodeField produces the ones-complement representation of the given value within a field of the given size,
+// posting a warning if the value is truncated.
+func encodeField(context *Context, value int64, bitSize int) uint64 {
+	mask := uint64(1)<<bitSize - 1
+	magnitude := uint64(value)
+	if value < 0 {
+		magnitude = uint64(-value)
+	}
+
+	if magnitude&mask != magnitude {
+		context.AppendWarning(fmt.Sprintf("value %d truncated to %d bits", value, bitSize))
+		magnitude &= mask
+	}
+
+	if value < 0 {
+		return magnitude ^ mask
+	}
+	return magnitude
+}
+
+// decodeField produces the value represented by the ones-complement content of a field of the given size
+func decodeField(field uint64, bitSize int) int64 {
+	mask := uint64(1)<<bitSize - 1
+	field &= mask
+	if bitSize > 1 && field&(uint64(1)<<(bitSize-1)) != 0 {
+		return -int64(field ^ mask)
+	}
+	return int64(field)
+}
+
+// getStringFieldValue packs the characters of a string value into an integer for use in a field of the given size.
+// The characters are right-justified unless the value is flagged as left-justified, in which case they are
+// left-justified and space-filled.
+func getStringFieldValue(context *Context, value *StringValue, bitSize int) int64 {
+	charSize := 6
+	codes := common.StringToFieldata(value.value)
+	if value.codeType == AsciiString {
+		charSize = 9
+		codes = common.StringToAscii(value.value)
+	}
+
+	charCount := bitSize / charSize
+	if len(value.value) > charCount {
+		context.AppendWarning("string truncated to fit field")
+	}
+
+	space := uint64(005)
+	if value.codeType == AsciiString {
+		space = ' '
+	}
+
+	perWord := 36 / charSize
+	var result uint64
+	for cx := 0; cx < charCount; cx++ {
+		code := space
+		if cx < len(value.value) {
+			code = (codes[cx/perWord] >> (36 - charSize*(cx%perWord+1))) & (uint64(1)<<charSize - 1)
+		} else if value.flags&LeftJustifiedFlag == 0 {
+			break
+		}
+		result = result<<charSize | code
+	}
+
+	if value.flags&LeftJustifiedFlag != 0 {
+		result <<= bitSize % charSize
+	}
+	return int64(result)
+}
+
+// generateFormWord composes a word from the given values according to the given form,
+// and appends it to the current location counter.
+func generateFormWord(context *Context, form *Form, values []Value) {
+	var word uint64
+	offsets := make([]Offset, 0)
+	bit := 0
+	for fx, bitSize := range form.bitSizes {
+		var fieldValue int64
+		switch value := values[fx].(type) {
+		case *IntegerValue:
+			if len(value.componentValues) != 1 {
+				context.AppendError("composite value cannot be used in a form field")
+			} else {
+				fieldValue = value.componentValues[0]
+				for _, offset := range value.offsets {
+					offsets = append(offsets, offset.ForField(bit, bitSize))
+				}
+			}
+		case *StringValue:
+			fieldValue = getStringFieldValue(context, value, bitSize)
+		default:
+			context.AppendError("invalid value type for form field")
+		}
+
+		word = word<<bitSize | encodeField(context, fieldValue, bitSize)
+		bit += bitSize
+	}
+
+	context.generate(word, offsets)
+}
+
+// generateValue appends the word or words which represent the given value to the current location counter.
+// Strings generate as many words as are required to contain them; double-precision integers generate two words.
+func generateValue(context *Context, value Value) {
+	switch v := value.(type) {
+	case *IntegerValue:
+		if v.flags&DoubleFlag != 0 {
+			if len(v.componentValues) != 1 || len(v.offsets) > 0 {
+				context.AppendError("double-precision values cannot be composite or relocatable")
+				return
+			}
+			magnitude := uint64(v.componentValues[0])
+			if v.componentValues[0] < 0 {
+				magnitude = uint64(-v.componentValues[0])
+			}
+			words := []uint64{magnitude >> 36, magnitude & common.NegativeZero}
+			if v.componentValues[0] < 0 {
+				words[0] ^= common.NegativeZero
+				words[1] ^= common.NegativeZero
+			}
+			context.generate(words[0], nil)
+			context.generate(words[1], nil)
+			return
+		}
+
+		values := make([]Value, len(v.componentValues))
+		for vx, comp := range v.componentValues {
+			values[vx] = NewSimpleIntegerValue(comp)
+		}
+		generateFormWord(context, v.form, values)
+		// the offsets of a composite value are already positioned within the word
+		words := context.code[context.currentLocationCounter]
+		words[len(words)-1].offsets = append(words[len(words)-1].offsets, v.offsets...)
+	case *StringValue:
+		codes := common.StringToFieldata(v.value)
+		if v.codeType == AsciiString {
+			codes = common.StringToAscii(v.value)
+		}
+		for _, code := range codes {
+			context.generate(code, nil)
+		}
+	default:
+		context.AppendError("value cannot be generated")
+	}
 }
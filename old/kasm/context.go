@@ -5,27 +5,54 @@
 
 package kasm
 
+import "strings"
+
+// conditional tracks the state of an $IF directive until its $END
+type conditional struct {
+	enclosingActive bool // lines surrounding the $IF are being assembled
+	active          bool // lines are currently being assembled
+	satisfied       bool // one of the $IF, $ELSF, or $ELSE branches has been taken
+}
+
+// frame tracks the state of the lines at one level of procedure nesting -
+// the outermost frame is the source being assembled, and a new frame is created for each procedure reference.
+type frame struct {
+	conditionals    []*conditional
+	definition      *Procedure // the procedure being defined, if any
+	definitionDepth int        // nesting of $PROC and $IF within the procedure being defined
+	ended           bool       // $END has been encountered, and no further lines are to be assembled
+	parent          *frame
+}
+
 type Context struct {
+	baseRegister           int // from $BASE
+	basicMode              bool
 	code                   map[int][]CodeWord
 	currentStringCodeType  StringCodeType
-	currentLineIndex       int
 	currentLineNumber      int
 	currentLocationCounter int
 	currentLiteralPool     int
 	diagnostics            *Diagnostics
 	dictionary             *Dictionary
+	externals              map[string]bool // labels which are externalized by the source
+	frame                  *frame
+	useRegisters           map[int]int // location counter to base register, from $USE
 }
 
 func NewContext(dictionary *Dictionary) *Context {
 	ctx := &Context{
+		baseRegister:           0,
+		basicMode:              false,
 		code:                   make(map[int][]CodeWord),
 		currentStringCodeType:  FieldataString,
-		currentLineIndex:       0,
 		currentLineNumber:      1,
 		currentLocationCounter: 0,
 		currentLiteralPool:     1,
 		dictionary:             dictionary,
-		diagnostics:            &Diagnostics{},
+		diagnostics:            NewDiagnostics(),
+		externals:              make(map[string]bool),
+		frame:                  &frame{},
+		useRegisters:           make(map[int]int),
 	}
 
 	return ctx
@@ -46,3 +73,42 @@ func (c *Context) AppendInfo(text string) {
 func (c *Context) AppendWarning(text string) {
 	c.diagnostics.AppendWarning(c.currentLineNumber, text)
 }
+
+// establish stores a value in the dictionary according to the given label specification.
+// In the outermost frame, levelers indicate that the label is to be externalized.
+func (c *Context) establish(spec *LabelSpecification, value Value) {
+	selectors := getValuesFromExpressions(c, spec.selectors)
+	level := spec.levelCount
+	if c.frame.parent == nil && level > 0 {
+		c.externals[strings.ToUpper(spec.symbol)] = true
+		level = 0
+	}
+
+	err := c.dictionary.Establish(spec.symbol, selectors, level, value)
+	if err != nil {
+		c.AppendErr(err)
+	}
+}
+
+// generate appends a word of code to the current location counter
+func (c *Context) generate(word uint64, offsets []Offset) {
+	c.code[c.currentLocationCounter] = append(c.code[c.currentLocationCounter], CodeWord{
+		baseValue:  word,
+		lineNumber: c.currentLineNumber,
+		offsets:    offsets,
+	})
+}
+
+// getLocationValue produces the current value of the given location counter, relative to the start thereof
+func (c *Context) getLocationValue(lcn int) *IntegerValue {
+	comp := int64(len(c.code[lcn]))
+	value, _ := NewIntegerValue([]int64{comp}, SimpleForm, []Offset{NewLocationCounterOffset(lcn)}, 0)
+	return value
+}
+
+// isActive indicates whether lines are currently being assembled, as opposed to being skipped
+// by virtue of an unsatisfied $IF
+func (c *Context) isActive() bool {
+	conds := c.frame.conditionals
+	return len(conds) == 0 || conds[len(conds)-1].active
+}
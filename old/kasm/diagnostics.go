@@ -5,6 +5,11 @@
 
 package kasm
 
+import (
+	"fmt"
+	"sort"
+)
+
 type diagnosticType int
 
 const (
@@ -31,6 +36,12 @@ type Diagnostics struct {
 	entries map[int][]diagnosticEntry
 }
 
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		entries: make(map[int][]diagnosticEntry),
+	}
+}
+
 func (d *Diagnostics) Clear() {
 	d.entries = make(map[int][]diagnosticEntry)
 }
@@ -87,3 +98,27 @@ func (d *Diagnostics) GetDiagnosticCounters() (int, int, int) {
 
 	return errors, warnings, infos
 }
+
+// GetMessages returns the text of all the diagnostics, in order by line number,
+// each prefixed by an indication of its type and by the line number.
+func (d *Diagnostics) GetMessages() []string {
+	lineNumbers := make([]int, 0, len(d.entries))
+	for lineNumber := range d.entries {
+		lineNumbers = append(lineNumbers, lineNumber)
+	}
+	sort.Ints(lineNumbers)
+
+	prefixes := map[diagnosticType]string{
+		INFO:    "I",
+		WARNING: "W",
+		ERROR:   "E",
+	}
+
+	messages := make([]string, 0)
+	for _, lineNumber := range lineNumbers {
+		for _, diag := range d.entries[lineNumber] {
+			messages = append(messages, fmt.Sprintf("%s:%d:%s", prefixes[diag.diagType], lineNumber, diag.text))
+		}
+	}
+	return messages
+}
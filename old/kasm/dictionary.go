@@ -37,20 +37,33 @@ func NewSubLevelDictionary(parent *Dictionary) *Dictionary {
 	}
 }
 
+// Establish stores a value in the dictionary (or in an enclosing dictionary, according to the level)
+// under the given tag, and (if there are selectors) at the indicated position in the node for the tag.
+// A procedure may be redefined, and an internal name which already exists acquires an additional procedure.
 func (d *Dictionary) Establish(tag string, selectors []Value, level int, entry Value) error {
 	if level > 0 && d.parent != nil {
 		return d.parent.Establish(tag, selectors, level-1, entry)
 	}
 
 	tagUpper := strings.ToUpper(tag)
-	entry, ok := d.entries[tagUpper]
+	existing, ok := d.entries[tagUpper]
 	if ok {
 		//	the tag exists in the dictionary
-		if entry.GetValueType() != NodeValueType || len(selectors) == 0 {
-			return fmt.Errorf("duplicate symbol")
+		if len(selectors) == 0 {
+			if existing.GetValueType() == ProcedureValueType && entry.GetValueType() == ProcedureValueType {
+				d.entries[tagUpper] = entry
+				return nil
+			} else if existing.GetValueType() == InternalNameValueType && entry.GetValueType() == InternalNameValueType {
+				existing.(*InternalNameValue).Merge(entry.(*InternalNameValue))
+				return nil
+			}
+		}
+
+		if existing.GetValueType() != NodeValueType || len(selectors) == 0 {
+			return fmt.Errorf("duplicate symbol %s", tagUpper)
 		}
 
-		return entry.(*NodeValue).Merge(selectors, entry)
+		return existing.(*NodeValue).Merge(selectors, entry)
 	} else {
 		//	the tag does not exist in the dictionary
 		if len(selectors) == 0 {
@@ -73,7 +86,7 @@ func (d *Dictionary) Lookup(tag string) (Value, error) {
 	if ok {
 		return entry, nil
 	} else if d.parent != nil {
-		return d.Lookup(tag)
+		return d.parent.Lookup(tag)
 	} else {
 		return nil, fmt.Errorf("symbol not found")
 	}
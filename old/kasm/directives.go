@@ -6,6 +6,7 @@
 package kasm
 
 import (
+	"fmt"
 	"strings"
 
 	"khalehla/old/parser"
@@ -13,9 +14,10 @@ import (
 
 type Directive interface {
 	GetToken() string
-	Interpret(context *Context, labels []string, operation []string, operands []string)
+	Interpret(context *Context, labels []string, operation []string, operands [][]string)
 }
 
+var extraneousLabels = "Ignoring labels"
 var extraneousOperationSubfields = "Ignoring extraneous operation subfields"
 var extraneousOperandSubfields = "Ignoring extraneous operand subfields"
 
@@ -43,43 +45,57 @@ type ResDirective struct{}
 type UseDirective struct{}
 
 var directives = []Directive{
-	//	TODO lots
+	//	TODO $DELETE, $ENDF, $GO, $INCLUDE
+	&AsciiDirective{},
+	&BaseDirective{},
+	&BasicDirective{},
+	&ElseDirective{},
+	&ElsfDirective{},
+	&EndDirective{},
 	&EquDirective{},
 	&EqufDirective{},
-	&EndDirective{},
+	&ExtendDirective{},
+	&FDataDirective{},
+	&FormDirective{},
 	&GenDirective{},
+	&IfDirective{},
+	&InfoDirective{},
 	&LitDirective{},
+	&NameDirective{},
+	&ProcDirective{},
+	&ResDirective{},
+	&UseDirective{},
 }
 
-// InterpretDirective processes the location counter subfield (if found) from the label field,
-// then passes all the other label subfields, the operation field, and the operand field to
-// successive literal Interpret methods until one of them succeeds.
-// Returns true if we process a literal, either successfully or otherwise.
-func InterpretDirective(context *Context, labels []string, operation []string, operands []string) bool {
-	// If there is a label field and the first subfield contains a location counter, process it and
-	// strip the subfield from the label field.
-	if labels != nil && len(labels) > 0 {
-		lcs, err := NewLocationCounterSpecification(context, labels[0])
-		if err != nil {
-			context.AppendErr(err)
-		} else if lcs != nil {
-			labels = labels[1:]
-			val, err := lcs.Evaluate(context)
-			if err != nil {
-				context.AppendErr(err)
-			} else {
-				context.currentLocationCounter = val
-			}
+// conditionalDirectives are those which are interpreted even while lines are being skipped
+// on account of an unsatisfied $IF, so that the nesting of $IF and $END can be tracked.
+var conditionalDirectives = map[string]bool{
+	"$ELSE": true,
+	"$ELSF": true,
+	"$END":  true,
+	"$IF":   true,
+}
+
+// FindDirective returns the directive corresponding to the given operation, or nil if there is none
+func FindDirective(operation string) Directive {
+	tag := strings.ToUpper(operation)
+	for _, dir := range directives {
+		if tag == dir.GetToken() {
+			return dir
 		}
 	}
+	return nil
+}
 
+// InterpretDirective passes the label field, the operation field, and the operand fields to the directive
+// indicated by the operation field, if there is one.
+// Returns true if we process a directive, either successfully or otherwise.
+func InterpretDirective(context *Context, labels []string, operation []string, operands [][]string) bool {
 	if len(operation) > 0 {
-		tag := strings.ToUpper(operation[0])
-		for _, dir := range directives {
-			if tag == strings.ToUpper(dir.GetToken()) {
-				dir.Interpret(context, labels, operation, operands)
-				return true
-			}
+		dir := FindDirective(operation[0])
+		if dir != nil {
+			dir.Interpret(context, labels, operation, operands)
+			return true
 		}
 	}
 
@@ -106,23 +122,114 @@ func getValuesFromExpressions(context *Context, expressions []*Expression) []Val
 	return values
 }
 
+// evaluateText parses and evaluates the expression comprising the given text.
+// Empty text produces a value of zero.
+func evaluateText(context *Context, text string) (Value, error) {
+	p := parser.NewParser(text)
+	exp, err := ParseExpression(p, context)
+	if err != nil {
+		return nil, err
+	} else if exp == nil {
+		if !p.AtEnd() {
+			return nil, fmt.Errorf("syntax error in expression")
+		}
+		return NewSimpleIntegerValue(0), nil
+	}
+
+	p.SkipWhiteSpace()
+	if !p.AtEnd() {
+		return nil, fmt.Errorf("syntax error in expression")
+	}
+
+	ec := NewExpressionContext(context)
+	err = exp.Evaluate(ec)
+	if err != nil {
+		return nil, err
+	}
+	return ec.PopValue()
+}
+
+// evaluateOperands evaluates all the subfields of the given operand fields, in order.
+// Subfields which cannot be evaluated are reported, and are replaced by zero.
+func evaluateOperands(context *Context, operands [][]string) []Value {
+	values := make([]Value, 0)
+	for _, field := range operands {
+		for _, subfield := range field {
+			value, err := evaluateText(context, subfield)
+			if err != nil {
+				context.AppendErr(err)
+				value = NewSimpleIntegerValue(0)
+			}
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// evaluateInteger evaluates the given text, which must produce a simple integer with no offsets
+func evaluateInteger(context *Context, text string) (int64, error) {
+	value, err := evaluateText(context, text)
+	if err != nil {
+		return 0, err
+	}
+
+	iVal, ok := value.(*IntegerValue)
+	if !ok || len(iVal.componentValues) != 1 || len(iVal.offsets) > 0 {
+		return 0, fmt.Errorf("expression must produce an absolute integer value")
+	}
+	return iVal.componentValues[0], nil
+}
+
+// getSingleOperand returns the text of the only operand subfield, warning about any others.
+// If there is no operand, an error is posted and false is returned.
+func getSingleOperand(context *Context, operands [][]string) (string, bool) {
+	if len(operands) == 0 || len(operands[0]) == 0 || len(operands[0][0]) == 0 {
+		context.AppendError("operand required")
+		return "", false
+	}
+
+	if len(operands) > 1 || len(operands[0]) > 1 {
+		context.AppendWarning(extraneousOperandSubfields)
+	}
+	return operands[0][0], true
+}
+
+// checkNoOperation warns about operation subfields for a directive which does not accept them
+func checkNoOperation(context *Context, operation []string) {
+	if len(operation) > 1 {
+		context.AppendWarning(extraneousOperationSubfields)
+	}
+}
+
+// checkNoOperands warns about operands for a directive which does not accept them
+func checkNoOperands(context *Context, operands [][]string) {
+	if len(operands) > 0 {
+		context.AppendWarning(extraneousOperandSubfields)
+	}
+}
+
+// ignoreLabels warns about labels for a directive which does not accept them
+func ignoreLabels(context *Context, labels []string) {
+	if len(labels) > 0 {
+		context.AppendWarning(extraneousLabels)
+	}
+}
+
 // processLabels processes the given labels, setting each of them to the current location counter
 func processLabels(context *Context, labels []string) {
-	offset := NewLocationCounterOffset(context.currentLocationCounter)
-	comp := int64(len(context.code[context.currentLocationCounter]))
-	lcValue, _ := NewIntegerValue([]int64{comp}, SimpleForm, []Offset{offset}, 0)
+	lcValue := context.getLocationValue(context.currentLocationCounter)
+	establishLabels(context, labels, lcValue)
+}
 
+// establishLabels processes the given labels, setting each of them to the given value
+func establishLabels(context *Context, labels []string, value Value) {
 	for _, label := range labels {
 		p := parser.NewParser(label)
-		ref, err := p.ParseLabelSpecification(context)
+		ref, err := ParseLabelSpecification(p, context)
 		if err != nil {
 			context.AppendErr(err)
 		} else if ref != nil {
-			values := getValuesFromExpressions(context, ref.selectors)
-			err = context.dictionary.Establish(ref.symbol, values, ref.levelCount, lcValue)
-			if err != nil {
-				context.AppendErr(err)
-			}
+			context.establish(ref, value)
 		} else {
 			//	Not a label reference, complain about it
 			context.AppendWarning("Non-label reference found in label field ignored")
@@ -130,6 +237,139 @@ func processLabels(context *Context, labels []string) {
 	}
 }
 
+//	$ASCII -------------------------------------------------------------------------------------------------------------
+
+func (d *AsciiDirective) GetToken() string {
+	return "$ASCII"
+}
+
+// Interpret causes subsequent string literals to be represented in ASCII
+func (d *AsciiDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+	context.currentStringCodeType = AsciiString
+}
+
+//	$BASE --------------------------------------------------------------------------------------------------------------
+
+func (d *BaseDirective) GetToken() string {
+	return "$BASE"
+}
+
+// Interpret establishes the base register to be used for references to location counters
+// which have not been associated with a base register via $USE
+func (d *BaseDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	text, ok := getSingleOperand(context, operands)
+	if !ok {
+		return
+	}
+
+	reg, err := evaluateInteger(context, text)
+	if err != nil {
+		context.AppendErr(err)
+	} else if reg < 0 || reg > 15 {
+		context.AppendError("invalid base register")
+	} else {
+		context.baseRegister = int(reg)
+	}
+}
+
+//	$BASIC -------------------------------------------------------------------------------------------------------------
+
+func (d *BasicDirective) GetToken() string {
+	return "$BASIC"
+}
+
+// Interpret selects basic mode for subsequent procedure references
+func (d *BasicDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+	context.basicMode = true
+}
+
+//	$ELSE --------------------------------------------------------------------------------------------------------------
+
+func (d *ElseDirective) GetToken() string {
+	return "$ELSE"
+}
+
+// Interpret begins the lines to be assembled if no preceding $IF or $ELSF condition was satisfied
+func (d *ElseDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	conds := context.frame.conditionals
+	if len(conds) == 0 {
+		context.AppendError("$ELSE without $IF")
+		return
+	}
+
+	cond := conds[len(conds)-1]
+	if !cond.enclosingActive {
+		return
+	}
+
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+	cond.active = !cond.satisfied
+	cond.satisfied = true
+}
+
+//	$ELSF --------------------------------------------------------------------------------------------------------------
+
+func (d *ElsfDirective) GetToken() string {
+	return "$ELSF"
+}
+
+// Interpret begins the lines to be assembled if the operand is true (non-zero)
+// and no preceding $IF or $ELSF condition was satisfied
+func (d *ElsfDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	conds := context.frame.conditionals
+	if len(conds) == 0 {
+		context.AppendError("$ELSF without $IF")
+		return
+	}
+
+	cond := conds[len(conds)-1]
+	if !cond.enclosingActive {
+		return
+	}
+
+	cond.active = false
+	if !cond.satisfied {
+		ignoreLabels(context, labels)
+		checkNoOperation(context, operation)
+		cond.active = evaluateCondition(context, operands)
+		cond.satisfied = cond.active
+	}
+}
+
+//	$END ---------------------------------------------------------------------------------------------------------------
+
+func (d *EndDirective) GetToken() string {
+	return "$END"
+}
+
+// Interpret terminates the innermost $IF, or (if there is none) the current procedure or the source
+func (d *EndDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	conds := context.frame.conditionals
+	if len(conds) > 0 {
+		cond := conds[len(conds)-1]
+		context.frame.conditionals = conds[:len(conds)-1]
+		if !cond.enclosingActive {
+			return
+		}
+	} else {
+		context.frame.ended = true
+	}
+
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+}
+
 //	$EQU ---------------------------------------------------------------------------------------------------------------
 
 type EquDirective struct {
@@ -139,8 +379,26 @@ func (d *EquDirective) GetToken() string {
 	return "$EQU"
 }
 
-func (d *EquDirective) Interpret(context *Context, labels []string, operation []string, operands []string) {
-	//	TODO
+// Interpret sets the labels to the value of the operand
+func (d *EquDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	if len(labels) == 0 {
+		context.AppendError("label required for $EQU")
+		return
+	}
+
+	text, ok := getSingleOperand(context, operands)
+	if !ok {
+		return
+	}
+
+	value, err := evaluateText(context, text)
+	if err != nil {
+		context.AppendErr(err)
+		return
+	}
+
+	establishLabels(context, labels, value)
 }
 
 //	$EQUF --------------------------------------------------------------------------------------------------------------
@@ -149,18 +407,77 @@ func (d *EqufDirective) GetToken() string {
 	return "$EQUF"
 }
 
-func (d *EqufDirective) Interpret(context *Context, labels []string, operation []string, operands []string) {
+func (d *EqufDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
 	//	TODO
+	context.AppendError("$EQUF is not yet supported")
 }
 
-//	$END ---------------------------------------------------------------------------------------------------------------
+//	$EXTEND ------------------------------------------------------------------------------------------------------------
 
-func (d *EndDirective) GetToken() string {
-	return "$END"
+func (d *ExtendDirective) GetToken() string {
+	return "$EXTEND"
 }
 
-func (d *EndDirective) Interpret(context *Context, labels []string, operation []string, operands []string) {
-	//	TODO
+// Interpret selects extended mode for subsequent procedure references
+func (d *ExtendDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+	context.basicMode = false
+}
+
+//	$FDATA -------------------------------------------------------------------------------------------------------------
+
+func (d *FDataDirective) GetToken() string {
+	return "$FDATA"
+}
+
+// Interpret causes subsequent string literals to be represented in Fieldata
+func (d *FDataDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+	context.currentStringCodeType = FieldataString
+}
+
+//	$FORM --------------------------------------------------------------------------------------------------------------
+
+func (d *FormDirective) GetToken() string {
+	return "$FORM"
+}
+
+// Interpret defines a form, with field sizes given by the operands, and sets the labels to refer to it
+func (d *FormDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	if len(labels) == 0 {
+		context.AppendError("label required for $FORM")
+		return
+	}
+
+	if len(operands) == 0 {
+		context.AppendError("field sizes required for $FORM")
+		return
+	} else if len(operands) > 1 {
+		context.AppendWarning(extraneousOperandSubfields)
+	}
+
+	sizes := make([]int, len(operands[0]))
+	for sx, text := range operands[0] {
+		size, err := evaluateInteger(context, text)
+		if err != nil {
+			context.AppendErr(err)
+			return
+		}
+		sizes[sx] = int(size)
+	}
+
+	form, err := NewForm(sizes)
+	if err != nil {
+		context.AppendErr(err)
+		return
+	}
+
+	establishLabels(context, labels, form)
 }
 
 //	$GEN ---------------------------------------------------------------------------------------------------------------
@@ -169,45 +486,268 @@ func (d *GenDirective) GetToken() string {
 	return "$GEN"
 }
 
-func (d *GenDirective) Interpret(context *Context, labels []string, operation []string, operands []string) {
-	//	TODO
+// Interpret generates a word (or words) for each operand subfield
+func (d *GenDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	processLabels(context, labels)
+	for _, value := range evaluateOperands(context, operands) {
+		generateValue(context, value)
+	}
 }
 
-//	$LIT ---------------------------------------------------------------------------------------------------------------
+//	$IF ----------------------------------------------------------------------------------------------------------------
 
-func (d *LitDirective) GetToken() string {
-	return "$LIT"
+func (d *IfDirective) GetToken() string {
+	return "$IF"
 }
 
-func (d *LitDirective) Interpret(context *Context, labels []string, operation []string, operands []string) {
-	if len(operation) > 0 {
-		context.AppendWarning(extraneousOperationSubfields)
+// evaluateCondition evaluates the operand of $IF or $ELSF - non-zero is true, zero is false
+func evaluateCondition(context *Context, operands [][]string) bool {
+	text, ok := getSingleOperand(context, operands)
+	if !ok {
+		return false
 	}
 
-	if operands != nil && len(operands) > 0 {
-		context.AppendWarning(extraneousOperandSubfields)
+	value, err := evaluateInteger(context, text)
+	if err != nil {
+		context.AppendErr(err)
+		return false
 	}
 
+	return value != 0
+}
+
+// Interpret begins the lines to be assembled only if the operand is true (non-zero)
+func (d *IfDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	cond := &conditional{
+		enclosingActive: context.isActive(),
+	}
+
+	if cond.enclosingActive {
+		ignoreLabels(context, labels)
+		checkNoOperation(context, operation)
+		cond.active = evaluateCondition(context, operands)
+		cond.satisfied = cond.active
+	}
+
+	context.frame.conditionals = append(context.frame.conditionals, cond)
+}
+
+//	$INFO --------------------------------------------------------------------------------------------------------------
+
+func (d *InfoDirective) GetToken() string {
+	return "$INFO"
+}
+
+// Interpret posts an informational diagnostic composed of the values of the operands
+func (d *InfoDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+
+	texts := make([]string, 0)
+	for _, value := range evaluateOperands(context, operands) {
+		switch v := value.(type) {
+		case *StringValue:
+			texts = append(texts, v.value)
+		case *IntegerValue:
+			for _, comp := range v.componentValues {
+				texts = append(texts, fmt.Sprintf("%d", comp))
+			}
+		case *FloatValue:
+			texts = append(texts, fmt.Sprintf("%v", v.value))
+		default:
+			context.AppendError("invalid value type for $INFO")
+		}
+	}
+
+	context.AppendInfo(strings.Join(texts, " "))
+}
+
+//	$LIT ---------------------------------------------------------------------------------------------------------------
+
+func (d *LitDirective) GetToken() string {
+	return "$LIT"
+}
+
+func (d *LitDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	checkNoOperands(context, operands)
+
 	if len(labels) > 1 {
-		subLabels := labels[:len(labels)-2]
+		processLabels(context, labels[:len(labels)-1])
 		labels = labels[len(labels)-1:]
-		processLabels(context, subLabels)
 	}
 
 	if len(labels) == 1 {
 		p := parser.NewParser(labels[0])
-		ref, err := p.ParseLabelSpecification(context)
+		ref, err := ParseLabelSpecification(p, context)
 		if err != nil {
 			context.AppendErr(err)
-		} else {
-			values := getValuesFromExpressions(context, ref.selectors)
-			fn := &LitFunction{locationCounter: context.currentLocationCounter}
-			err = context.dictionary.Establish(ref.symbol, values, ref.levelCount, fn)
-			if err != nil {
-				context.AppendErr(err)
-			}
+		} else if ref != nil {
+			context.establish(ref, &LitFunction{locationCounter: context.currentLocationCounter})
 		}
 	}
 
 	context.currentLiteralPool = context.currentLocationCounter
 }
+
+//	$NAME --------------------------------------------------------------------------------------------------------------
+
+func (d *NameDirective) GetToken() string {
+	return "$NAME"
+}
+
+// Interpret is invoked only when a $NAME line is encountered while a procedure is being assembled
+// (the names are established while the procedure is being defined), in which case it does nothing.
+func (d *NameDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	if context.frame.parent == nil {
+		context.AppendError("$NAME is valid only within a procedure")
+	}
+}
+
+// defineName establishes the labels of a $NAME line within the procedure being defined,
+// so that they may be used to reference the procedure.
+func defineName(context *Context, procedure *Procedure, textIndex int, labels []string, operands [][]string) {
+	if len(labels) == 0 {
+		context.AppendError("label required for $NAME")
+		return
+	}
+
+	var value Value = NewSimpleIntegerValue(0)
+	if len(operands) > 0 {
+		text, _ := getSingleOperand(context, operands)
+		var err error
+		value, err = evaluateText(context, text)
+		if err != nil {
+			context.AppendErr(err)
+			value = NewSimpleIntegerValue(0)
+		}
+	}
+
+	for _, label := range labels {
+		p := parser.NewParser(label)
+		ref, err := ParseLabelSpecification(p, context)
+		if err != nil {
+			context.AppendErr(err)
+		} else if ref != nil {
+			procedure.externalNames[strings.ToUpper(ref.symbol)] = textIndex
+			context.establish(ref, NewInternalNameValue(procedure, textIndex, value))
+		}
+	}
+}
+
+//	$PROC --------------------------------------------------------------------------------------------------------------
+
+func (d *ProcDirective) GetToken() string {
+	return "$PROC"
+}
+
+// Interpret begins the definition of a procedure. The first operand field (the maximum number of fields and
+// subfields in a reference) is not enforced. The second, if present, restricts the procedure to $BASIC or
+// to $EXTEND mode. Subsequent lines, through the corresponding $END, are saved as the body of the procedure.
+func (d *ProcDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	procedure := NewProcedure("P")
+	if len(labels) == 0 {
+		context.AppendError("label required for $PROC")
+	} else {
+		p := parser.NewParser(labels[0])
+		ref, err := ParseLabelSpecification(p, context)
+		if err != nil {
+			context.AppendErr(err)
+		} else if ref != nil {
+			procedure = NewProcedure(ref.symbol)
+			context.establish(ref, procedure)
+		}
+
+		if len(labels) > 1 {
+			context.AppendWarning(extraneousLabels)
+		}
+	}
+
+	if len(operands) > 1 {
+		for _, mode := range operands[1] {
+			switch strings.ToUpper(mode) {
+			case "$BASIC":
+				procedure.isBasicMode = true
+			case "$EXTEND":
+				procedure.isExtendedMode = true
+			default:
+				context.AppendError("invalid mode for $PROC")
+			}
+		}
+	}
+	if len(operands) > 2 {
+		context.AppendWarning(extraneousOperandSubfields)
+	}
+
+	context.frame.definition = procedure
+	context.frame.definitionDepth = 0
+}
+
+//	$RES ---------------------------------------------------------------------------------------------------------------
+
+func (d *ResDirective) GetToken() string {
+	return "$RES"
+}
+
+// Interpret reserves (and zero-fills) the number of words given by the operand
+func (d *ResDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	checkNoOperation(context, operation)
+	processLabels(context, labels)
+	text, ok := getSingleOperand(context, operands)
+	if !ok {
+		return
+	}
+
+	count, err := evaluateInteger(context, text)
+	if err != nil {
+		context.AppendErr(err)
+	} else if count < 0 || count > 0_777777 {
+		context.AppendError("invalid reservation size")
+	} else {
+		for cx := int64(0); cx < count; cx++ {
+			context.generate(0, nil)
+		}
+	}
+}
+
+//	$USE ---------------------------------------------------------------------------------------------------------------
+
+func (d *UseDirective) GetToken() string {
+	return "$USE"
+}
+
+// Interpret associates the base register given by the first operand subfield with the location counters
+// given by the remaining subfields. Thereafter, $BREG produces that register for references to those
+// location counters.
+func (d *UseDirective) Interpret(context *Context, labels []string, operation []string, operands [][]string) {
+	ignoreLabels(context, labels)
+	checkNoOperation(context, operation)
+	if len(operands) == 0 || len(operands[0]) < 2 {
+		context.AppendError("base register and location counter(s) required for $USE")
+		return
+	} else if len(operands) > 1 {
+		context.AppendWarning(extraneousOperandSubfields)
+	}
+
+	reg, err := evaluateInteger(context, operands[0][0])
+	if err != nil {
+		context.AppendErr(err)
+		return
+	} else if reg < 0 || reg > 15 {
+		context.AppendError("invalid base register")
+		return
+	}
+
+	for _, text := range operands[0][1:] {
+		lcn, err := evaluateInteger(context, text)
+		if err != nil {
+			context.AppendErr(err)
+		} else if lcn < 0 || lcn > 63 {
+			context.AppendError("invalid location counter")
+		} else {
+			context.useRegisters[int(lcn)] = int(reg)
+		}
+	}
+}
@@ -16,7 +16,9 @@ type ExpressionItem interface {
 	Evaluate(context *ExpressionContext) error
 }
 
-// Expression represents an evaluable expression
+// Expression represents an evaluable expression.
+// The items are held in postfix order, so that evaluation is a matter of evaluating each item in turn -
+// values push themselves onto the value stack, and operators pop their operands and push their results.
 type Expression struct {
 	items []ExpressionItem
 }
@@ -32,9 +34,8 @@ func (e *Expression) pushItem(item ExpressionItem) {
 }
 
 func (e *Expression) Evaluate(context *ExpressionContext) error {
-	ix := 0
-	for ix < len(e.items) {
-		err := e.items[ix].Evaluate(context)
+	for _, item := range e.items {
+		err := item.Evaluate(context)
 		if err != nil {
 			return err
 		}
@@ -47,6 +48,10 @@ func (e *Expression) Evaluate(context *ExpressionContext) error {
 	return nil
 }
 
+// ParseExpression parses an expression from the current position of the parser, stopping at the first character
+// which cannot continue the expression. Operators are arranged according to their precedence as they are parsed,
+// so that the resulting items are in postfix order. If there is no expression at the current position,
+// we return nil with no error.
 func ParseExpression(p *parser.Parser, context *Context) (*Expression, error) {
 	e := NewExpression()
 
@@ -58,61 +63,66 @@ func ParseExpression(p *parser.Parser, context *Context) (*Expression, error) {
 	//	instruction, or procedure call. This means MASM recognizes the format (LA,U A0,1) as a valid line item.
 	// So, yeah...
 
-	wantBinaryOperator := false
-	wantUnaryPostfixOperator := false
-	wantUnaryPrefixOperator := true
+	operators := make([]Operator, 0)
 	wantTerm := true
 
 	p.SkipWhiteSpace()
 	for !p.AtEnd() {
-
-		if wantUnaryPostfixOperator {
-			op := ParseUnaryPostfixOperator(p)
-			if op != nil {
-				e.pushItem(op)
-				p.SkipWhiteSpace()
-				continue
-			}
-		}
-
-		if wantUnaryPrefixOperator {
+		if wantTerm {
 			op := ParseUnaryPrefixOperator(p)
 			if op != nil {
-				e.pushItem(op)
-				p.SkipWhiteSpace()
-				continue
-			}
-		}
-
-		if wantBinaryOperator {
-			op := ParseBinaryOperator(p)
-			if op != nil {
-				wantBinaryOperator = false
-				wantUnaryPostfixOperator = false
-				wantUnaryPrefixOperator = true
-				wantTerm = true
-				e.pushItem(op)
+				operators = append(operators, op)
 				p.SkipWhiteSpace()
 				continue
 			}
-		}
 
-		if wantTerm {
 			term, err := ParseTerm(p, context)
 			if err != nil {
 				return nil, err
-			} else if term != nil {
-				wantBinaryOperator = true
-				wantUnaryPostfixOperator = true
-				wantUnaryPrefixOperator = false
-				wantTerm = false
-				e.pushItem(term)
-				p.SkipWhiteSpace()
-				continue
+			} else if term == nil {
+				if len(e.items) == 0 && len(operators) == 0 {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("syntax error in expression")
 			}
+
+			e.pushItem(term)
+			wantTerm = false
+			p.SkipWhiteSpace()
+			continue
+		}
+
+		//	postfix operators apply to the term (or result) immediately preceding them
+		op := ParseUnaryPostfixOperator(p)
+		if op != nil {
+			e.pushItem(op)
+			p.SkipWhiteSpace()
+			continue
+		}
+
+		op = ParseBinaryOperator(p)
+		if op == nil {
+			break
+		}
+
+		for len(operators) > 0 && operators[len(operators)-1].GetPrecedence() >= op.GetPrecedence() {
+			e.pushItem(operators[len(operators)-1])
+			operators = operators[:len(operators)-1]
+		}
+		operators = append(operators, op)
+		wantTerm = true
+		p.SkipWhiteSpace()
+	}
+
+	if wantTerm {
+		if len(e.items) == 0 && len(operators) == 0 {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("incomplete expression")
+	}
 
-		return nil, fmt.Errorf("syntax error in expression")
+	for ox := len(operators) - 1; ox >= 0; ox-- {
+		e.pushItem(operators[ox])
 	}
 
 	return e, nil
@@ -143,6 +153,7 @@ func ParseExpressionList(p *parser.Parser, context *Context) ([]*Expression, err
 		return nil, fmt.Errorf("syntax error in function arguments or node selectors")
 	}
 
+	expList = append(expList, exp)
 	p.SkipWhiteSpace()
 	for p.ParseCharacter(',') {
 		p.SkipWhiteSpace()
@@ -157,7 +168,7 @@ func ParseExpressionList(p *parser.Parser, context *Context) ([]*Expression, err
 		p.SkipWhiteSpace()
 	}
 
-	if !p.ParseCharacter('(') {
+	if !p.ParseCharacter(')') {
 		return nil, fmt.Errorf("unterminated function arguments or node selectors")
 	}
 
@@ -166,13 +177,21 @@ func ParseExpressionList(p *parser.Parser, context *Context) ([]*Expression, err
 
 // ParseTerm parses a term from the input text. A term is anything which is not an operator.
 func ParseTerm(p *parser.Parser, context *Context) (ExpressionItem, error) {
-	result, err := ParseLiteral(p, context)
+	literal, err := ParseLiteral(p, context)
+	if err != nil {
+		return nil, err
+	} else if literal != nil {
+		return literal, nil
+	}
 
-	if result == nil && err == nil {
-		result, err = ParseReference(p, context)
+	reference, err := ParseReference(p, context)
+	if err != nil {
+		return nil, err
+	} else if reference != nil {
+		return reference, nil
 	}
 
 	//	TODO more alternatives...
 
-	return result, err
+	return nil, nil
 }
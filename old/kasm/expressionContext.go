@@ -7,10 +7,10 @@ package kasm
 
 import (
 	"fmt"
-
-	"khalehla/parser"
 )
 
+var stackEmptyError = fmt.Errorf("internal error - stack is empty")
+
 type ExpressionContext struct {
 	context   *Context
 	values    []Value
@@ -28,7 +28,7 @@ func NewExpressionContext(context *Context) *ExpressionContext {
 func (ec *ExpressionContext) PeekOperator() (Operator, error) {
 	l := len(ec.operators)
 	if l == 0 {
-		return nil, parser.outOfData
+		return nil, stackEmptyError
 	} else {
 		op := ec.operators[l-1]
 		return op, nil
@@ -38,7 +38,7 @@ func (ec *ExpressionContext) PeekOperator() (Operator, error) {
 func (ec *ExpressionContext) PeekValue() (Value, error) {
 	l := len(ec.values)
 	if l == 0 {
-		return nil, parser.outOfData
+		return nil, stackEmptyError
 	} else {
 		v := ec.values[l-1]
 		return v, nil
@@ -48,7 +48,7 @@ func (ec *ExpressionContext) PeekValue() (Value, error) {
 func (ec *ExpressionContext) PopOperator() (Operator, error) {
 	l := len(ec.operators)
 	if l == 0 {
-		return nil, fmt.Errorf("internal error - value stack is empty")
+		return nil, stackEmptyError
 	} else {
 		op := ec.operators[l-1]
 		ec.operators = ec.operators[:l-1]
@@ -59,7 +59,7 @@ func (ec *ExpressionContext) PopOperator() (Operator, error) {
 func (ec *ExpressionContext) PopValue() (Value, error) {
 	l := len(ec.values)
 	if l == 0 {
-		return nil, parser.outOfData
+		return nil, stackEmptyError
 	} else {
 		v := ec.values[l-1]
 		ec.values = ec.values[:l-1]
@@ -69,18 +69,20 @@ func (ec *ExpressionContext) PopValue() (Value, error) {
 
 func (ec *ExpressionContext) PopVariableParameterList() ([]Value, error) {
 	count, err := ec.PopValue()
-	if err != nil || count.GetValueType() != IntegerValueType {
+	if err != nil {
 		return nil, err
+	} else if count.GetValueType() != IntegerValueType {
+		return nil, fmt.Errorf("internal error - parameter count is not an integer")
 	}
 
 	iCount := count.(*IntegerValue)
-	if len(iCount.components) > 1 || len(iCount.components[0].offsets) > 0 {
+	if len(iCount.componentValues) > 1 || len(iCount.offsets) > 0 {
 		return nil, fmt.Errorf("data type or relocation error popping function parameter list")
 	}
 
-	pCount := iCount.components[0].value
+	pCount := iCount.componentValues[0]
 	values := make([]Value, pCount)
-	for vx := pCount; vx > 1; vx-- {
+	for vx := pCount; vx > 0; vx-- {
 		values[vx-1], err = ec.PopValue()
 		if err != nil {
 			return nil, err
@@ -104,5 +106,5 @@ func (ec *ExpressionContext) PushVariableParameterList(values []Value) {
 		ec.PushValue(v)
 	}
 
-	ec.PushValue(NewSimpleIntegerValue(uint64(len(values))))
+	ec.PushValue(NewSimpleIntegerValue(int64(len(values))))
 }
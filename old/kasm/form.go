@@ -7,6 +7,8 @@ package kasm
 
 import "fmt"
 
+// Form describes the division of a word into fields, as established by $FORM.
+// A label which refers to a form may be used in the operation field to generate a word from the operands.
 type Form struct {
 	bitSizes []int
 }
@@ -22,6 +24,12 @@ func sumOf(values []int) int {
 }
 
 func NewForm(bitSizes []int) (*Form, error) {
+	for _, size := range bitSizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid field size in form")
+		}
+	}
+
 	if sumOf(bitSizes) == 36 {
 		f := &Form{
 			bitSizes: bitSizes,
@@ -46,3 +54,11 @@ func (f *Form) Equals(op *Form) bool {
 
 	return false
 }
+
+func (f *Form) Evaluate(ec *ExpressionContext) error {
+	return fmt.Errorf("a form cannot be used in an expression")
+}
+
+func (f *Form) GetValueType() ValueType {
+	return MasmDirectiveValueType
+}
@@ -51,14 +51,15 @@ type SSSFunction struct{}
 type TYPEFunction struct{}
 
 var Functions = map[string]Function{
-	"$":    &LCVFunction{},
-	"$CAS": &CASFunction{},
-	"$CFS": &CASFunction{},
-	"$LCN": &LCNFunction{},
-	"$LCV": &LCVFunction{},
-	"$SL":  &SLFunction{},
-	"$SR":  &SRFunction{},
-	"$SS":  &SSFunction{},
+	"$":     &LCVFunction{},
+	"$BREG": &BREGFunction{},
+	"$CAS":  &CASFunction{},
+	"$CFS":  &CFSFunction{},
+	"$LCN":  &LCNFunction{},
+	"$LCV":  &LCVFunction{},
+	"$SL":   &SLFunction{},
+	"$SR":   &SRFunction{},
+	"$SS":   &SSFunction{},
 }
 
 var invalidParameterError = fmt.Errorf("invalid parameter in function parameter list")
@@ -81,7 +82,7 @@ func (f *LitFunction) Evaluate(ec *ExpressionContext) error {
 	// TODO the parameters are portions of a word which is created in the literal pool defined by
 	//		f.locationCounter
 	// and the resulting value is the LC offset address of that literal.
-	return nil
+	return fmt.Errorf("literals are not yet supported")
 }
 
 func (f *LitFunction) GetValueType() ValueType {
@@ -90,7 +91,42 @@ func (f *LitFunction) GetValueType() ValueType {
 
 //	TODO  $AP
 //	TODO  $BA
-//	TODO  $BREG
+
+//	$BREG --------------------------------------------------------------------------------------------------------------
+
+// BREGFunction produces the number of the base register which is to be used for referencing the given value.
+// This is the register associated (via $USE) with the location counter to which the value is relative,
+// or the register specified by $BASE if there is no such association.
+func (f *BREGFunction) Evaluate(ec *ExpressionContext) error {
+	params, err := ec.PopVariableParameterList()
+	if err != nil {
+		return err
+	} else if len(params) != 1 {
+		return wrongNumberOfParameters
+	}
+
+	if params[0].GetValueType() != IntegerValueType {
+		return parameterTypeError
+	}
+
+	result := ec.context.baseRegister
+	for _, offset := range params[0].(*IntegerValue).offsets {
+		if offset.GetOffsetType() == LocationCounterOffsetType && !offset.IsNegative() {
+			reg, ok := ec.context.useRegisters[offset.(*LocationCounterOffset).locationCounter]
+			if ok {
+				result = reg
+			}
+			break
+		}
+	}
+
+	ec.PushValue(NewSimpleIntegerValue(int64(result)))
+	return nil
+}
+
+func (f *BREGFunction) GetValueType() ValueType {
+	return FunctionValueType
+}
 
 //	$CAS ---------------------------------------------------------------------------------------------------------------
 
@@ -154,32 +190,16 @@ func (f *CFSFunction) GetValueType() ValueType {
 
 // $LCN ----------------------------------------------------------------------------------------------------------------
 
+// LCNFunction produces the number of the current location counter
 func (f *LCNFunction) Evaluate(ec *ExpressionContext) error {
 	params, err := ec.PopVariableParameterList()
 	if err != nil {
 		return err
-	}
-
-	var lcn int
-	if len(params) == 0 {
-		lcn = ec.context.currentLocationCounter
-	} else if len(params) == 1 {
-		if params[0].GetValueType() != IntegerValueType {
-			return parameterTypeError
-		}
-
-		iv := params[0].(*IntegerValue)
-		if !iv.form.Equals(SimpleForm) || len(iv.offsets) > 0 {
-			return invalidParameterError
-		}
-
-		lcn = int(iv.componentValues[0])
-	} else {
+	} else if len(params) != 0 {
 		return wrongNumberOfParameters
 	}
 
-	iVal := int64(len(ec.context.code[lcn]))
-	ec.PushValue(NewSimpleIntegerValue(iVal))
+	ec.PushValue(NewSimpleIntegerValue(int64(ec.context.currentLocationCounter)))
 	return nil
 }
 
@@ -189,21 +209,33 @@ func (f *LCNFunction) GetValueType() ValueType {
 
 //	$LCV ---------------------------------------------------------------------------------------------------------------
 
+// LCVFunction produces the current value of the given location counter (or of the current location counter),
+// relative to the start of the location counter
 func (f *LCVFunction) Evaluate(ec *ExpressionContext) error {
 	params, err := ec.PopVariableParameterList()
 	if err != nil {
 		return err
-	} else if len(params) != 1 {
-		return wrongNumberOfParameters
 	}
 
-	if params[0].GetValueType() != StringValueType {
-		return parameterTypeError
+	var lcn int
+	if len(params) == 0 {
+		lcn = ec.context.currentLocationCounter
+	} else if len(params) == 1 {
+		if params[0].GetValueType() != IntegerValueType {
+			return parameterTypeError
+		}
+
+		iv := params[0].(*IntegerValue)
+		if !iv.form.Equals(SimpleForm) || len(iv.offsets) > 0 || iv.componentValues[0] < 0 || iv.componentValues[0] > 63 {
+			return invalidParameterError
+		}
+
+		lcn = int(iv.componentValues[0])
+	} else {
+		return wrongNumberOfParameters
 	}
 
-	sv := params[0].(*StringValue)
-	niv := NewSimpleIntegerValue(int64(len(sv.value)))
-	ec.PushValue(niv)
+	ec.PushValue(ec.context.getLocationValue(lcn))
 	return nil
 }
 
@@ -8,8 +8,8 @@ package kasm
 import (
 	"fmt"
 
+	"khalehla/common"
 	"khalehla/old/parser"
-	"khalehla/old/pkg"
 )
 
 type IntegerValue struct {
@@ -33,7 +33,9 @@ func (v *IntegerValue) ClearFlags(flags ValueFlags) {
 }
 
 func (v *IntegerValue) Copy() Value {
-	result, _ := NewIntegerValue(v.componentValues, v.form, v.offsets, v.flags)
+	values := append(make([]int64, 0, len(v.componentValues)), v.componentValues...)
+	offsets := append(make([]Offset, 0, len(v.offsets)), v.offsets...)
+	result, _ := NewIntegerValue(values, v.form, offsets, v.flags)
 	return result
 }
 
@@ -73,7 +75,7 @@ func ParseIntegerLiteral(p *parser.Parser) (Value, error) {
 		if ch >= '0' && ch <= '9' {
 			_ = p.Advance(1)
 			isOctal := ch == '0'
-			var value int64
+			value := int64(ch - '0')
 
 			for !p.AtEnd() {
 				ch, _ := p.PeekNextChar()
@@ -94,7 +96,7 @@ func ParseIntegerLiteral(p *parser.Parser) (Value, error) {
 				value += int64(ch - '0')
 			}
 
-			if value&pkg.NegativeZero != value {
+			if value&common.NegativeZero != value {
 				return nil, truncationError
 			}
 
@@ -1,12 +0,0 @@
-// khalehla Project
-// simple assembler
-// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
-// All Rights Reserved
-
-package kasm
-
-// Loadable is a self-contained executable with one or more defined banks
-// with loading instruction included per bank.
-type Loadable struct {
-	//	TODO
-}
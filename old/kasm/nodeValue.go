@@ -9,11 +9,11 @@ import (
 	"fmt"
 
 	"khalehla/common"
-	pkg2 "khalehla/old/pkg"
 )
 
 type NodeValue struct {
-	entries map[uint64]Value
+	entries        map[uint64]Value
+	defaultsToZero bool // references to entries which do not exist produce zero rather than an error
 }
 
 var invalidValueType = fmt.Errorf("invalid value type for selector")
@@ -27,6 +27,15 @@ func NewNodeValue() *NodeValue {
 	}
 }
 
+// NewParameterNode creates a node for the parameters of a procedure reference.
+// Subfields which were not specified on the referencing line produce a value of zero.
+func NewParameterNode() *NodeValue {
+	return &NodeValue{
+		entries:        make(map[uint64]Value),
+		defaultsToZero: true,
+	}
+}
+
 func NewNodeWithLeaf(selectors []Value, leaf Value) (*NodeValue, error) {
 	if len(selectors) == 0 {
 		return nil, fmt.Errorf("no selectors provided")
@@ -34,17 +43,16 @@ func NewNodeWithLeaf(selectors []Value, leaf Value) (*NodeValue, error) {
 
 	nv := NewNodeValue()
 	current := nv
-	sel := selectors
-	for len(sel) > 0 {
-		subSel := sel[1:]
-		ix, err := getIndexFromSelectorValue(sel[0])
+	for sx, sel := range selectors {
+		ix, err := getIndexFromSelectorValue(sel)
 		if err != nil {
 			return nil, err
 		}
 
-		if len(subSel) > 0 {
-			current.entries[ix] = NewNodeValue()
-			sel = subSel
+		if sx < len(selectors)-1 {
+			next := NewNodeValue()
+			current.entries[ix] = next
+			current = next
 		} else {
 			current.entries[ix] = leaf
 		}
@@ -72,74 +80,88 @@ func (nv *NodeValue) Evaluate(ec *ExpressionContext) error {
 	return nil
 }
 
+// Merge stores the given value in the node (or in a subordinate node) according to the given selectors,
+// creating subordinate nodes as necessary.
 func (nv *NodeValue) Merge(selectors []Value, value Value) error {
 	if len(selectors) == 0 {
 		return fmt.Errorf("attempt to set a node to a leaf value")
 	}
 
-	selector := selectors[0]
-	subSelectors := selectors[1:]
-	index, err := getIndexFromSelectorValue(selector)
-	if err != nil {
-		return err
-	}
-
-	val, err := nv.getValueAt(selector)
+	index, err := getIndexFromSelectorValue(selectors[0])
 	if err != nil {
 		return err
 	}
 
-	if val == nil {
+	subSelectors := selectors[1:]
+	val, ok := nv.entries[index]
+	if !ok {
 		// nothing at the given index
 		if len(subSelectors) == 0 {
 			nv.entries[index] = value
 		} else {
-			nv.entries[index], err = NewNodeWithLeaf(subSelectors, value)
+			node, err := NewNodeWithLeaf(subSelectors, value)
 			if err != nil {
 				return err
 			}
+			nv.entries[index] = node
 		}
 	} else if val.GetValueType() != NodeValueType {
 		//	Non-node at the given index
-		if len(selectors) > 0 {
+		if len(subSelectors) > 0 {
 			return fmt.Errorf("attempt to override a leaf with a node")
-		} else {
-			nv.entries[index] = value
 		}
+		nv.entries[index] = value
 	} else {
 		//	Node at the given index
-		if len(selectors) == 0 {
+		if len(subSelectors) == 0 {
 			return fmt.Errorf("attempt to override a node with a leaf")
-		} else {
-			return val.(*NodeValue).Merge(selectors[1:], value)
 		}
+		return val.(*NodeValue).Merge(subSelectors, value)
 	}
 
 	return nil
 }
 
+// Set stores a value in the node at the given index
+func (nv *NodeValue) Set(index uint64, value Value) *NodeValue {
+	nv.entries[index] = value
+	return nv
+}
+
+// eval resolves the given selectors against the node. With no selectors, the result is the number of entries
+// in the node. If the final selector is flagged (i.e., preceded by an asterisk) the result is 1 if the selected
+// value is flagged, else 0.
 func (nv *NodeValue) eval(selectors []Value) (Value, error) {
 	if len(selectors) == 0 {
-		return NewSimpleIntegerValue(uint64(len(nv.entries))), nil
+		return NewSimpleIntegerValue(int64(len(nv.entries))), nil
 	}
 
 	value, err := nv.getValueAt(selectors[0])
 	if err != nil {
 		return nil, err
 	} else if value == nil {
+		if nv.defaultsToZero {
+			return NewSimpleIntegerValue(0), nil
+		}
 		return nil, fmt.Errorf("cannot find selector %v in node", selectors[0])
 	}
 
 	subSelectors := selectors[1:]
 	if value.GetValueType() == NodeValueType {
-		nv := value.(*NodeValue)
-		return nv.eval(subSelectors)
+		return value.(*NodeValue).eval(subSelectors)
 	}
 
 	if len(subSelectors) > 0 {
 		return nil, fmt.Errorf("attempt to use selectors on a non-node value")
 	}
 
+	if sel, ok := selectors[0].(BasicValue); ok && sel.GetFlags()&FlaggedFlag != 0 {
+		if basic, ok := value.(BasicValue); ok && basic.GetFlags()&FlaggedFlag != 0 {
+			return NewSimpleIntegerValue(1), nil
+		}
+		return NewSimpleIntegerValue(0), nil
+	}
+
 	return value, nil
 }
 
@@ -149,20 +171,20 @@ func getIndexFromSelectorValue(selector Value) (uint64, error) {
 	}
 
 	iVal := selector.(*IntegerValue)
-	if len(iVal.components) != 1 {
+	if len(iVal.componentValues) != 1 {
 		return 0, compositeError
 	}
 
-	comp := iVal.components[0]
-	if len(comp.offsets) > 0 {
+	if len(iVal.offsets) > 0 {
 		return 0, undefinedOffsetError
 	}
 
-	if (comp.value&pkg2.NegativeZero != comp.value) || common.IsNegative(comp.value) {
+	comp := iVal.componentValues[0]
+	if comp < 0 || comp > common.NegativeZero {
 		return 0, invalidValue
 	}
 
-	return comp.value, nil
+	return uint64(comp), nil
 }
 
 func (nv *NodeValue) getValueAt(selector Value) (Value, error) {
@@ -0,0 +1,185 @@
+// khalehla Project
+// simple assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package kasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"khalehla/tasm"
+)
+
+// maxResolutionCount limits the number of symbol substitutions made for a single word,
+// so that symbols which are defined in terms of each other do not cause us to loop forever.
+const maxResolutionCount = 100
+
+// objectModuleBuilder accumulates the segments of an object module
+type objectModuleBuilder struct {
+	assembler *Assembler
+	segments  map[uint64]*tasm.Segment
+	sourceSet *tasm.SourceSet
+}
+
+// getSegment returns the segment corresponding to the given location counter, creating it if necessary
+func (omb *objectModuleBuilder) getSegment(lcn int) *tasm.Segment {
+	segment, ok := omb.segments[uint64(lcn)]
+	if !ok {
+		segment = tasm.NewSegment()
+		omb.segments[uint64(lcn)] = segment
+	}
+	return segment
+}
+
+// addToField adds a value to the indicated field of a word, in ones-complement arithmetic
+func addToField(context *Context, word uint64, startBit int, bitLength int, value int64) uint64 {
+	shift := 36 - startBit - bitLength
+	mask := uint64(1)<<bitLength - 1
+	sum := decodeField(word>>shift, bitLength) + value
+	return (word &^ (mask << shift)) | (encodeField(context, sum, bitLength) << shift)
+}
+
+// resolveWord produces the final content of a generated word, and the references which the linker must apply to it.
+// Location counter offsets become references to the origin of the corresponding segment. References to symbols
+// which are defined by the assembly are replaced by the values of those symbols; any others are left for
+// the linker to resolve against the labels of other modules.
+func (omb *objectModuleBuilder) resolveWord(cw CodeWord, segmentOffset uint64) (uint64, []*tasm.Reference) {
+	context := omb.assembler.context
+	word := cw.baseValue
+	references := make([]*tasm.Reference, 0)
+	pending := append(make([]Offset, 0, len(cw.offsets)), cw.offsets...)
+	resolutionCount := 0
+
+	for len(pending) > 0 {
+		offset := pending[0]
+		pending = pending[1:]
+		startBit := uint64(offset.GetStartBit())
+		bitLength := uint64(offset.GetBitLength())
+
+		switch o := offset.(type) {
+		case *LocationCounterOffset:
+			symbol := tasm.GetLocationSymbol(uint64(o.locationCounter))
+			omb.getSegment(o.locationCounter).SetLabel(symbol, 0)
+			ref := tasm.NewReference(symbol, startBit, bitLength, segmentOffset).SetSubtract(o.isNegative)
+			references = append(references, ref)
+
+		case *UndefinedReferenceOffset:
+			entry, _ := omb.assembler.dictionary.Lookup(o.symbol)
+			if entry == nil {
+				ref := tasm.NewReference(strings.ToUpper(o.symbol), startBit, bitLength, segmentOffset).
+					SetSubtract(o.isNegative)
+				references = append(references, ref)
+				continue
+			}
+
+			iVal, ok := entry.(*IntegerValue)
+			if !ok || len(iVal.componentValues) != 1 {
+				context.AppendError(fmt.Sprintf("symbol %s cannot be used as a reference", strings.ToUpper(o.symbol)))
+				continue
+			}
+
+			resolutionCount++
+			if resolutionCount > maxResolutionCount {
+				context.AppendError(fmt.Sprintf("circular definition involving symbol %s", strings.ToUpper(o.symbol)))
+				return word, references
+			}
+
+			value := iVal.componentValues[0]
+			if o.isNegative {
+				value = -value
+			}
+			word = addToField(context, word, o.startBit, o.bitLength, value)
+
+			for _, symbolOffset := range iVal.offsets {
+				newOffset := symbolOffset.ForField(o.startBit, o.bitLength)
+				if o.isNegative {
+					newOffset = newOffset.Negate()
+				}
+				pending = append(pending, newOffset)
+			}
+		}
+	}
+
+	return word, references
+}
+
+// GetObjectModule packages the code generated by the assembly as an object module with the given name,
+// in the format which is consumed by the linker. Each location counter becomes the segment of the same number.
+// Labels which are externalized (with a leveler, at the outermost level of the source) become labels
+// of the corresponding segments.
+func (a *Assembler) GetObjectModule(name string) *tasm.ObjectModule {
+	lineNumbers := make([]int, 0, len(a.sourceItems))
+	for lineNumber := range a.sourceItems {
+		lineNumbers = append(lineNumbers, lineNumber)
+	}
+	sort.Ints(lineNumbers)
+
+	items := make([]*tasm.SourceItem, len(lineNumbers))
+	for lx, lineNumber := range lineNumbers {
+		items[lx] = a.sourceItems[lineNumber]
+	}
+
+	omb := &objectModuleBuilder{
+		assembler: a,
+		segments:  make(map[uint64]*tasm.Segment),
+		sourceSet: tasm.NewSourceSet(a.sourceName, items),
+	}
+
+	lcns := make([]int, 0, len(a.context.code))
+	for lcn := range a.context.code {
+		lcns = append(lcns, lcn)
+	}
+	sort.Ints(lcns)
+
+	savedLineNumber := a.context.currentLineNumber
+	for _, lcn := range lcns {
+		segment := omb.getSegment(lcn)
+		var cb *tasm.CodeBlock
+		for wx, cw := range a.context.code[lcn] {
+			if cb == nil || cw.lineNumber != a.context.currentLineNumber {
+				if cb != nil {
+					segment.AppendCodeBlock(cb)
+				}
+
+				a.context.currentLineNumber = cw.lineNumber
+				item, ok := a.sourceItems[cw.lineNumber]
+				if !ok {
+					item = tasm.NewSourceItem("", "", nil)
+				}
+				cb = tasm.NewCodeBlock(omb.sourceSet, item, uint64(cw.lineNumber), uint64(lcn), uint64(wx))
+			}
+
+			word, references := omb.resolveWord(cw, uint64(wx))
+			cb.AppendWord(word, references...)
+		}
+
+		if cb != nil {
+			segment.AppendCodeBlock(cb)
+		}
+	}
+
+	a.context.currentLineNumber = 0
+	externals := make([]string, 0, len(a.context.externals))
+	for symbol := range a.context.externals {
+		externals = append(externals, symbol)
+	}
+	sort.Strings(externals)
+
+	for _, symbol := range externals {
+		entry, _ := a.dictionary.Lookup(symbol)
+		iVal, ok := entry.(*IntegerValue)
+		if ok && len(iVal.componentValues) == 1 && len(iVal.offsets) == 1 &&
+			iVal.offsets[0].GetOffsetType() == LocationCounterOffsetType && !iVal.offsets[0].IsNegative() {
+			lcn := iVal.offsets[0].(*LocationCounterOffset).locationCounter
+			omb.getSegment(lcn).SetLabel(symbol, uint64(iVal.componentValues[0]))
+		} else {
+			a.context.AppendWarning(fmt.Sprintf("%s cannot be externalized - it is not a location", symbol))
+		}
+	}
+
+	a.context.currentLineNumber = savedLineNumber
+	return tasm.NewObjectModule(name, omb.segments)
+}
@@ -15,10 +15,12 @@ const (
 type Offset interface {
 	Equals(comp Offset) bool
 	EqualsNegative(comp Offset) bool
+	ForField(startBit int, bitLength int) Offset
 	GetStartBit() int
 	GetBitLength() int
 	GetOffsetType() OffsetType
 	IsNegative() bool
+	Negate() Offset
 }
 
 type LocationCounterOffset struct {
@@ -75,6 +77,16 @@ func (lco *LocationCounterOffset) EqualsNegative(comp Offset) bool {
 	return false
 }
 
+// ForField returns a copy of the offset which applies to the field described by the given bit position and length
+func (lco *LocationCounterOffset) ForField(startBit int, bitLength int) Offset {
+	return &LocationCounterOffset{
+		locationCounter: lco.locationCounter,
+		startBit:        startBit,
+		bitLength:       bitLength,
+		isNegative:      lco.isNegative,
+	}
+}
+
 func (lco *LocationCounterOffset) GetBitLength() int {
 	return lco.bitLength
 }
@@ -91,6 +103,16 @@ func (lco *LocationCounterOffset) IsNegative() bool {
 	return lco.isNegative
 }
 
+// Negate returns a copy of the offset which is subtracted from, rather than added to, the field
+func (lco *LocationCounterOffset) Negate() Offset {
+	return &LocationCounterOffset{
+		locationCounter: lco.locationCounter,
+		startBit:        lco.startBit,
+		bitLength:       lco.bitLength,
+		isNegative:      !lco.isNegative,
+	}
+}
+
 func (uro *UndefinedReferenceOffset) Equals(comp Offset) bool {
 	if comp.GetOffsetType() == UndefinedReferenceOffsetType {
 		uroComp := comp.(*UndefinedReferenceOffset)
@@ -113,6 +135,16 @@ func (uro *UndefinedReferenceOffset) EqualsNegative(comp Offset) bool {
 	return false
 }
 
+// ForField returns a copy of the offset which applies to the field described by the given bit position and length
+func (uro *UndefinedReferenceOffset) ForField(startBit int, bitLength int) Offset {
+	return &UndefinedReferenceOffset{
+		symbol:     uro.symbol,
+		startBit:   startBit,
+		bitLength:  bitLength,
+		isNegative: uro.isNegative,
+	}
+}
+
 func (uro *UndefinedReferenceOffset) GetBitLength() int {
 	return uro.bitLength
 }
@@ -129,20 +161,28 @@ func (uro *UndefinedReferenceOffset) IsNegative() bool {
 	return uro.isNegative
 }
 
+// Negate returns a copy of the offset which is subtracted from, rather than added to, the field
+func (uro *UndefinedReferenceOffset) Negate() Offset {
+	return &UndefinedReferenceOffset{
+		symbol:     uro.symbol,
+		startBit:   uro.startBit,
+		bitLength:  uro.bitLength,
+		isNegative: !uro.isNegative,
+	}
+}
+
 // CollapseOffsetList returns a copy of a given offset list with arithmetic inverse items removed.
 // This allows us to make sense of, for example, TAG2-TAG1 as the distance between two symbols which represent
 // locations in a common location counter pool
 func CollapseOffsetList(offsetList []Offset) []Offset {
-	temp := offsetList[:]
+	temp := append(make([]Offset, 0, len(offsetList)), offsetList...)
 	for tx := 0; tx < len(temp)-1; {
-		ty := tx + 1
 		found := false
-		for ty < len(temp) {
+		for ty := tx + 1; ty < len(temp); ty++ {
 			if temp[tx].EqualsNegative(temp[ty]) {
 				found = true
-				temp = append(temp[:tx], temp[tx+1:]...)
-				ty--
 				temp = append(temp[:ty], temp[ty+1:]...)
+				temp = append(temp[:tx], temp[tx+1:]...)
 				break
 			}
 		}
@@ -159,8 +199,8 @@ func CollapseOffsetList(offsetList []Offset) []Offset {
 // collective other.
 func OffsetListsAreEqual(offsetList1 []Offset, offsetList2 []Offset) bool {
 	//	This is made more interesting by the fact that the offsets do not have to be in equal order.
-	temp1 := offsetList1[:]
-	temp2 := offsetList2[:]
+	temp1 := append(make([]Offset, 0, len(offsetList1)), offsetList1...)
+	temp2 := append(make([]Offset, 0, len(offsetList2)), offsetList2...)
 	if len(temp1) == len(temp2) {
 		for len(temp1) > 0 {
 			off1 := temp1[0]
@@ -442,7 +442,7 @@ func (op addOperator) Evaluate(context *ExpressionContext) error {
 			values[vx] = lhsInt.componentValues[vx] + rhsInt.componentValues[vx]
 		}
 
-		offsets := CollapseOffsetList(append(lhsInt.offsets, rhsInt.offsets...))
+		offsets := mergeOffsets(lhsInt.offsets, rhsInt.offsets)
 		lcCount := 0
 		for _, offset := range offsets {
 			if offset.GetOffsetType() == LocationCounterOffsetType {
@@ -1021,6 +1021,9 @@ func (op negativeOperator) Evaluate(context *ExpressionContext) error {
 		for vx := 0; vx < len(value.componentValues); vx++ {
 			value.componentValues[vx] = -value.componentValues[vx]
 		}
+		for ox := 0; ox < len(value.offsets); ox++ {
+			value.offsets[ox] = value.offsets[ox].Negate()
+		}
 		context.PushValue(value)
 	} else {
 		return fmt.Errorf("internal error")
@@ -1256,7 +1259,7 @@ func (op subtractOperator) Evaluate(context *ExpressionContext) error {
 	}
 
 	if lhs.GetValueType() == FloatValueType {
-		value := NewFloatValue(lhs.(*FloatValue).value + rhs.(*FloatValue).value)
+		value := NewFloatValue(lhs.(*FloatValue).value - rhs.(*FloatValue).value)
 		context.PushValue(value)
 		return nil
 	} else if lhs.GetValueType() == IntegerValueType {
@@ -1267,7 +1270,12 @@ func (op subtractOperator) Evaluate(context *ExpressionContext) error {
 			values[vx] = lhsInt.componentValues[vx] - rhsInt.componentValues[vx]
 		}
 
-		offsets := CollapseOffsetList(append(lhsInt.offsets, rhsInt.offsets...))
+		negated := make([]Offset, len(rhsInt.offsets))
+		for ox, offset := range rhsInt.offsets {
+			negated[ox] = offset.Negate()
+		}
+
+		offsets := mergeOffsets(lhsInt.offsets, negated)
 		lcCount := 0
 		for _, offset := range offsets {
 			if offset.GetOffsetType() == LocationCounterOffsetType {
@@ -5,10 +5,84 @@
 
 package kasm
 
-// Procedure defines a proc
+import "fmt"
+
+// Procedure defines a proc - the lines of source between a $PROC directive and its corresponding $END.
+// The lines are saved as text, and are assembled each time the procedure is referenced.
 type Procedure struct {
+	name           string
 	isBasicMode    bool
 	isExtendedMode bool
 	code           []string
 	externalNames  map[string]int // maps a $NAME to the textIndex of the line which contains it
 }
+
+func NewProcedure(name string) *Procedure {
+	return &Procedure{
+		name:          name,
+		code:          make([]string, 0),
+		externalNames: make(map[string]int),
+	}
+}
+
+func (p *Procedure) Evaluate(ec *ExpressionContext) error {
+	return fmt.Errorf("procedure %s cannot be used in an expression", p.name)
+}
+
+func (p *Procedure) GetValueType() ValueType {
+	return ProcedureValueType
+}
+
+// appliesTo indicates whether the procedure may be referenced in the given mode.
+// A procedure which is restricted to neither mode may be referenced in either.
+func (p *Procedure) appliesTo(basicMode bool) bool {
+	if basicMode {
+		return p.isBasicMode || !p.isExtendedMode
+	} else {
+		return p.isExtendedMode || !p.isBasicMode
+	}
+}
+
+// procedureEntry is one of the procedures which may be referenced by an internal name
+type procedureEntry struct {
+	procedure *Procedure
+	textIndex int   // index of the $NAME line - assembly of the procedure begins with the following line
+	value     Value // the value given on the $NAME line, which is presented to the procedure as P(0,0)
+}
+
+// InternalNameValue is the value of a label on a $NAME line within a procedure.
+// The same name may be defined in more than one procedure (for example, one for basic mode and one for
+// extended mode), in which case a reference selects the most recently defined procedure which applies
+// to the current mode.
+type InternalNameValue struct {
+	entries []*procedureEntry
+}
+
+func NewInternalNameValue(procedure *Procedure, textIndex int, value Value) *InternalNameValue {
+	return &InternalNameValue{
+		entries: []*procedureEntry{{procedure, textIndex, value}},
+	}
+}
+
+func (v *InternalNameValue) Evaluate(ec *ExpressionContext) error {
+	return fmt.Errorf("procedure name cannot be used in an expression")
+}
+
+func (v *InternalNameValue) GetValueType() ValueType {
+	return InternalNameValueType
+}
+
+// Merge adds the procedures of another internal name to this one
+func (v *InternalNameValue) Merge(other *InternalNameValue) {
+	v.entries = append(v.entries, other.entries...)
+}
+
+// selectEntry finds the procedure to be used for a reference in the given mode
+func (v *InternalNameValue) selectEntry(basicMode bool) *procedureEntry {
+	for ex := len(v.entries) - 1; ex >= 0; ex-- {
+		if v.entries[ex].procedure.appliesTo(basicMode) {
+			return v.entries[ex]
+		}
+	}
+	return nil
+}
@@ -64,7 +64,32 @@ func NewValueReference(value BasicValue) *ValueReference {
 	}
 }
 
+// evaluateArguments evaluates each of the given expressions, and pushes the results onto the value stack
+// as a variable parameter list, for consumption by a function or a node.
+func evaluateArguments(ec *ExpressionContext, arguments []*Expression) error {
+	values := make([]Value, len(arguments))
+	for ax, arg := range arguments {
+		subContext := NewExpressionContext(ec.context)
+		err := arg.Evaluate(subContext)
+		if err != nil {
+			return err
+		}
+
+		values[ax], err = subContext.PopValue()
+		if err != nil {
+			return err
+		}
+	}
+
+	ec.PushVariableParameterList(values)
+	return nil
+}
+
 func (r *FunctionReference) Evaluate(ec *ExpressionContext) error {
+	err := evaluateArguments(ec, r.arguments)
+	if err != nil {
+		return err
+	}
 	return r.function.Evaluate(ec)
 }
 
@@ -73,6 +98,10 @@ func (r *FunctionReference) GetValueType() ValueType {
 }
 
 func (r *NodeReference) Evaluate(ec *ExpressionContext) error {
+	err := evaluateArguments(ec, r.selectors)
+	if err != nil {
+		return err
+	}
 	return r.node.Evaluate(ec)
 }
 
@@ -129,6 +158,6 @@ func ParseReference(p *parser.Parser, context *Context) (Reference, error) {
 		entry.GetValueType() == FloatValueType {
 		return NewValueReference(entry.(BasicValue)), nil
 	} else {
-		return nil, fmt.Errorf("improper reference item for expression")
+		return nil, fmt.Errorf("improper reference to %s in expression", *symbol)
 	}
 }
@@ -5,10 +5,12 @@
 package packUtil
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"khalehla/hardware"
@@ -20,6 +22,7 @@ import (
 	ioPackets2 "khalehla/old/hardware/ioPackets"
 	"khalehla/old/kexec/mfdMgr"
 	pkg2 "khalehla/old/pkg"
+	"khalehla/old/storage"
 	"khalehla/pkg"
 )
 
@@ -27,6 +30,13 @@ func DoUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("    packUtil prep {file_name} {pack_name} {prep_factor} {track_count} [ REM ]")
 	fmt.Println("    packUtil show {file_name}")
+	fmt.Println("    packUtil convert {source_file_name} {dest_file_name} {FILE | PACKED | SPARSE}")
+	fmt.Println("    packUtil key-create {key_file_name}")
+	fmt.Println("    packUtil encrypt-init {pack_file_name} {key_file_name | -}")
+	fmt.Println("    packUtil dedupe-verify {store_file_name} {index_file_name}")
+	fmt.Println("    packUtil overlay-snapshot {delta_file_name} {snapshot_file_name}")
+	fmt.Println("    packUtil overlay-commit {pack_file_name} {delta_file_name}")
+	fmt.Println("    packUtil overlay-discard {delta_file_name}")
 }
 
 func DoPrep(args []string) error {
@@ -119,6 +129,112 @@ func DoPrep(args []string) error {
 	return nil
 }
 
+// DoDedupeVerify checks the store and index of a dedupe aggregator for consistency
+func DoDedupeVerify(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("incorrect number of arguments for dedupe-verify command")
+	}
+
+	for _, fileName := range args {
+		if _, err := os.Stat(fileName); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("file %v does not exist", fileName)
+		}
+	}
+
+	problems, err := storage.VerifyDedupeStore(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%v problem(s) found", len(problems))
+	}
+
+	fmt.Println("dedupe store is consistent")
+	return nil
+}
+
+// DoConvert copies a pack to a new pack file of the given format, preserving its label and geometry
+func DoConvert(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("incorrect number of arguments for convert command")
+	}
+
+	destType, ok := storage.PackFormatTable[strings.ToUpper(args[2])]
+	if !ok {
+		return fmt.Errorf("invalid pack format (use FILE, PACKED, or SPARSE)")
+	}
+
+	return storage.ConvertPack(args[0], args[1], destType)
+}
+
+// DoEncryptInit prepares a pack to be used as an encrypted pack. Its keys come from the named key file,
+// or if the key file name is '-', from a passphrase read from standard input.
+func DoEncryptInit(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("incorrect number of arguments for encrypt-init command")
+	}
+
+	var keySource storage.EncryptionKeySource
+	if args[1] == "-" {
+		fmt.Print("Passphrase: ")
+		passphrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		passphrase = strings.TrimRight(passphrase, "\r\n")
+		if err != nil && len(passphrase) == 0 {
+			return fmt.Errorf("no passphrase provided")
+		}
+		keySource = storage.EncryptionKeyFromPassphrase(passphrase)
+	} else {
+		keySource = storage.EncryptionKeyFromFile(args[1])
+	}
+
+	return storage.InitializeEncryptedPack(args[0], keySource)
+}
+
+// DoKeyCreate creates a key file for use with encrypted packs
+func DoKeyCreate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("incorrect number of arguments for key-create command")
+	}
+
+	return storage.CreateEncryptionKeyFile(args[0])
+}
+
+// DoOverlayCommit writes the changes held in an overlay delta file into the base pack, and removes the delta
+func DoOverlayCommit(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("incorrect number of arguments for overlay-commit command")
+	}
+
+	base, err := storage.NewBlockDeviceForPack(args[0])
+	if err != nil {
+		return err
+	}
+
+	return storage.CommitOverlay(&base, args[1])
+}
+
+// DoOverlayDiscard throws away the changes held in an overlay delta file
+func DoOverlayDiscard(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("incorrect number of arguments for overlay-discard command")
+	}
+
+	return storage.DiscardOverlay(args[0])
+}
+
+// DoOverlaySnapshot saves a copy of an overlay delta file, which can later be used in its place
+func DoOverlaySnapshot(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("incorrect number of arguments for overlay-snapshot command")
+	}
+
+	return storage.SnapshotOverlay(args[0], args[1])
+}
+
 func DoShow(args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("incorrect number of arguments for show command")
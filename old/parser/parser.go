@@ -141,6 +141,7 @@ func (p *Parser) ParseSymbol() (*string, error) {
 	return nil, nil
 }
 
+// ParseToken consumes the given token if it appears at the current position
 func (p *Parser) ParseToken(token string) bool {
 	if p.Remaining() >= len(token) {
 		px := p.index
@@ -153,12 +154,14 @@ func (p *Parser) ParseToken(token string) bool {
 				tx++
 			}
 		}
+		p.index = px
 		return true
 	} else {
 		return false
 	}
 }
 
+// ParseTokenCaseInsensitive consumes the given token, without regard to case, if it appears at the current position
 func (p *Parser) ParseTokenCaseInsensitive(token string) bool {
 	if p.Remaining() >= len(token) {
 		px := p.index
@@ -173,6 +176,7 @@ func (p *Parser) ParseTokenCaseInsensitive(token string) bool {
 				tx++
 			}
 		}
+		p.index = px
 		return true
 	} else {
 		return false
@@ -184,7 +188,7 @@ func (p *Parser) Remaining() int {
 }
 
 func (p *Parser) SetPosition(index int) error {
-	if index >= len(p.text) {
+	if index < 0 || index > len(p.text) {
 		return invalidPosition
 	} else {
 		p.index = index
@@ -21,6 +21,8 @@ const (
 	AggregatorTypeSimple = iota
 	AggregatorTypeCache
 	AggregatorTypeDedupe
+	AggregatorTypeMirror
+	AggregatorTypeStripe
 	//	TODO others?
 )
 
@@ -45,6 +47,127 @@ type BlockIORequest struct {
 	aggregatorStatus AggregatorStatus
 	deviceStatus     pkg.DeviceStatus
 	systemError      error
+	done             chan struct{}
+	callback         func(request *BlockIORequest)
+}
+
+// NewBlockIORequest creates a request which may be passed to Aggregator.StartIO.
+// buffer is required for read and write functions, and must be large enough for blockCount blocks.
+func NewBlockIORequest(
+	function AggregatorFunction,
+	deviceIndex pkg.DeviceIndex,
+	blockId pkg.BlockId,
+	blockCount pkg.BlockCount,
+	buffer []pkg2.Word36,
+) *BlockIORequest {
+	return &BlockIORequest{
+		function:         function,
+		deviceIndex:      deviceIndex,
+		blockId:          blockId,
+		blockCount:       blockCount,
+		buffer:           buffer,
+		aggregatorStatus: AggregatorStatusSuccessful,
+		deviceStatus:     DeviceStatusSuccessful,
+		done:             make(chan struct{}),
+	}
+}
+
+// complete posts the final status of the request, wakes up anyone waiting for it,
+// and invokes its completion callback, if it has one.
+func (req *BlockIORequest) complete(aggregatorStatus AggregatorStatus, res DeviceResult) {
+	req.aggregatorStatus = aggregatorStatus
+	req.deviceStatus = res.status
+	req.systemError = res.systemError
+	if req.done != nil {
+		close(req.done)
+	}
+	if req.callback != nil {
+		req.callback(req)
+	}
+}
+
+func (req *BlockIORequest) GetAggregatorStatus() AggregatorStatus {
+	return req.aggregatorStatus
+}
+
+func (req *BlockIORequest) GetDeviceStatus() pkg.DeviceStatus {
+	return req.deviceStatus
+}
+
+func (req *BlockIORequest) GetSystemError() error {
+	return req.systemError
+}
+
+// SetCompletionCallback establishes a function to be invoked when the request completes, as an alternative
+// to WaitForCompletion. It must be set before the request is passed to StartIO.
+// The callback is invoked on whatever goroutine completes the request (which, for a request which fails
+// immediately, is the one which called StartIO), so it should not do any lengthy work itself.
+func (req *BlockIORequest) SetCompletionCallback(callback func(request *BlockIORequest)) {
+	req.callback = callback
+}
+
+// WaitForCompletion blocks until the aggregator has finished with the request.
+// It returns immediately for requests which were not created by NewBlockIORequest.
+func (req *BlockIORequest) WaitForCompletion() {
+	if req.done != nil {
+		<-req.done
+	}
+}
+
+// checkRequestRange verifies the block range and buffer of a read or write request.
+// Aggregators which satisfy requests without reaching the device use this to
+// report the same errors that the device would have reported.
+func checkRequestRange(request *BlockIORequest, wordsPerBlock int, blockCount pkg.BlockCount) DeviceResult {
+	return checkBlockRange(request.blockId, request.blockCount, len(request.buffer), wordsPerBlock, blockCount)
+}
+
+// checkBlockRange verifies a block range against the geometry of a device, along with the size of the buffer
+// for the range (if bufferLength is negative, the buffer is not checked).
+func checkBlockRange(
+	blockId pkg.BlockId,
+	blockCount pkg.BlockCount,
+	bufferLength int,
+	wordsPerBlock int,
+	limit pkg.BlockCount,
+) DeviceResult {
+	if bufferLength >= 0 && bufferLength != int(blockCount)*wordsPerBlock {
+		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
+	}
+
+	if int(blockId) >= int(limit) {
+		return DeviceResult{DeviceStatusInvalidBlockId, nil}
+	}
+
+	if int(blockId)+int(blockCount) > int(limit) {
+		return DeviceResult{DeviceStatusMaxBlocksExceeded, nil}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// serviceBlockDeviceRequest carries out a request synchronously against a block device which is safe
+// for concurrent use, then completes the request.
+func serviceBlockDeviceRequest(device BlockDevice, request *BlockIORequest) {
+	var res DeviceResult
+	switch request.function {
+	case AggregatorFunctionAllocate:
+		res = device.AllocateBlocks(request.blockId, request.blockCount)
+	case AggregatorFunctionRead:
+		res = device.ReadBlocks(request.blockId, request.blockCount, request.buffer)
+	case AggregatorFunctionRelease:
+		res = device.ReleaseBlocks(request.blockId, request.blockCount)
+	case AggregatorFunctionWrite:
+		res = device.WriteBlocks(request.blockId, request.blockCount, request.buffer)
+	default:
+		request.complete(AggregatorStatusInvalidFunction, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	if res.status == DeviceStatusSuccessful {
+		request.complete(AggregatorStatusSuccessful, res)
+	} else {
+		request.complete(AggregatorStatusDeviceError, res)
+	}
 }
 
 type AggregatorResult struct {
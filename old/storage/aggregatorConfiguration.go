@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// AggregatorTypeTable maps the value of the AGGREGATOR attribute of a disk node to an aggregator type
+var AggregatorTypeTable = map[string]AggregatorType{
+	"SIMPLE": AggregatorTypeSimple,
+	"CACHE":  AggregatorTypeCache,
+	"DEDUPE": AggregatorTypeDedupe,
+	"MIRROR": AggregatorTypeMirror,
+	"STRIPE": AggregatorTypeStripe,
+}
+
+// NewAggregatorForNode creates an aggregator for a disk node of the configuration file, such as
+//
+//	NODE 'DISK8' IS FILE-SYSTEM-DISK PACK='media/m0.pack,media/m1.pack' AGGREGATOR=MIRROR CONNECTS TO 'CHDSK0'
+//
+// A block device is created for each of the named packs (see NewBlockDeviceForPack),
+// and registered with the aggregator under the given device index. The attributes (keys in upper case) which are recognized are:
+//
+//	AGGREGATOR      SIMPLE (the default), CACHE, DEDUPE, MIRROR, or STRIPE
+//	CACHE-BLOCKS    number of blocks held by a CACHE aggregator (default 1024)
+//	CACHE-MODE      WRITE-THROUGH (the default) or WRITE-BACK for a CACHE aggregator
+//	READ-AHEAD      number of blocks read ahead by a CACHE aggregator (default 0)
+//	STORE           name of the store file for a DEDUPE aggregator
+//	INDEX           name of the index file for a DEDUPE aggregator
+//	STRIPE-UNIT     number of consecutive blocks on each member of a STRIPE aggregator (default 64)
+//	KEY-FILE        name of a key file - every pack is encrypted (see EncryptedBlockDevice) with keys from it
+//	PASSPHRASE-FILE name of a file holding a passphrase, used instead of KEY-FILE
+//
+// MIRROR and STRIPE accept any number of packs - the others require exactly one.
+//
+// Nothing calls this yet, as the configuration file is not yet parsed (see config.Configuration.UpdateFromFile).
+func NewAggregatorForNode(
+	deviceIndex pkg.DeviceIndex,
+	packNames []string,
+	attributes map[string]string,
+) (Aggregator, error) {
+	aggType := AggregatorType(AggregatorTypeSimple)
+	if name, ok := attributes["AGGREGATOR"]; ok {
+		aggType, ok = AggregatorTypeTable[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown aggregator %v", name)
+		}
+	}
+
+	if len(packNames) == 0 {
+		return nil, fmt.Errorf("no packs specified")
+	} else if len(packNames) > 1 && aggType != AggregatorTypeMirror && aggType != AggregatorTypeStripe {
+		return nil, fmt.Errorf("only MIRROR and STRIPE aggregators accept more than one pack")
+	}
+
+	numeric := func(key string, defaultValue uint64, minimum uint64) (uint64, error) {
+		value, ok := attributes[key]
+		if !ok {
+			return defaultValue, nil
+		}
+		number, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || number < minimum {
+			return 0, fmt.Errorf("invalid value for %v", key)
+		}
+		return number, nil
+	}
+
+	var agg Aggregator
+	switch aggType {
+	case AggregatorTypeSimple:
+		agg = NewSimpleAggregator()
+
+	case AggregatorTypeCache:
+		blocks, err := numeric("CACHE-BLOCKS", 1024, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		readAhead, err := numeric("READ-AHEAD", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := CacheModeWriteThrough
+		switch strings.ToUpper(attributes["CACHE-MODE"]) {
+		case "", "WRITE-THROUGH":
+		case "WRITE-BACK":
+			mode = CacheModeWriteBack
+		default:
+			return nil, fmt.Errorf("invalid value for CACHE-MODE")
+		}
+		agg = NewCacheAggregator(int(blocks), mode, pkg.BlockCount(readAhead))
+
+	case AggregatorTypeDedupe:
+		storeName, ok := attributes["STORE"]
+		indexName, ok2 := attributes["INDEX"]
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("DEDUPE aggregator requires STORE and INDEX")
+		}
+		var store BlockDevice = NewFileBlockDevice(storeName)
+		agg = NewDedupeAggregator(&store, indexName)
+
+	case AggregatorTypeMirror:
+		agg = NewMirrorAggregator()
+
+	case AggregatorTypeStripe:
+		unit, err := numeric("STRIPE-UNIT", 64, 1)
+		if err != nil {
+			return nil, err
+		}
+		agg = NewStripeAggregator(pkg.BlockCount(unit))
+	}
+
+	var keySource EncryptionKeySource
+	if keyFileName, ok := attributes["KEY-FILE"]; ok {
+		keySource = EncryptionKeyFromFile(keyFileName)
+	} else if passphraseFileName, ok := attributes["PASSPHRASE-FILE"]; ok {
+		passphrase, err := os.ReadFile(passphraseFileName)
+		if err != nil {
+			return nil, err
+		}
+		keySource = EncryptionKeyFromPassphrase(strings.TrimRight(string(passphrase), "\r\n"))
+	}
+
+	for _, packName := range packNames {
+		device, err := NewBlockDeviceForPack(packName)
+		if err != nil {
+			return nil, err
+		}
+		if keySource != nil {
+			base := device
+			device = NewEncryptedBlockDevice(&base, keySource)
+		}
+		agg.RegisterDevice(deviceIndex, &device)
+	}
+
+	return agg, nil
+}
+
+// NewBlockDeviceForPack creates a block device for a pack path from the configuration file.
+// The path names a pack file, optionally followed by '+' and the name of an overlay delta file, such as
+//
+//	PACK='media/fix000.pack+media/fix000.delta'
+//
+// A FileBlockDevice, PackedBlockDevice, or SparseBlockDevice is created for the pack file,
+// according to the identifier at the front of the file.
+// If a delta file is named, the device is wrapped in an OverlayBlockDevice.
+// This is reached only through NewAggregatorForNode, so the form is not yet usable from the configuration file.
+func NewBlockDeviceForPack(packPath string) (BlockDevice, error) {
+	baseName, deltaName, isOverlay := strings.Cut(packPath, "+")
+
+	file, err := os.Open(baseName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	bytes := make([]byte, 8)
+	_, err = file.ReadAt(bytes, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read identifier of pack %v: %v", baseName, err)
+	}
+
+	var base BlockDevice
+	ident := (*pkg2.Word36)(unsafe.Pointer(&bytes[0])).ToStringAsFieldata()
+	switch {
+	case string(bytes) == sparseIdentifier:
+		base = NewSparseBlockDevice(baseName)
+	case ident == fileIdentifierConstant:
+		base = NewFileBlockDevice(baseName)
+	case ident == packedIdentifierConstant:
+		base = NewPackedBlockDevice(baseName)
+	default:
+		return nil, fmt.Errorf("pack %v has an unrecognized identifier", baseName)
+	}
+
+	if !isOverlay {
+		return base, nil
+	}
+	return NewOverlayBlockDevice(&base, deltaName), nil
+}
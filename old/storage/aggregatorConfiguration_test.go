@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// createConfigurationTestPacks creates the given number of empty 16-block file packs,
+// returning their names as they would appear in the PACK attribute of a disk node
+func createConfigurationTestPacks(t *testing.T, count int) []string {
+	directory := t.TempDir()
+	packNames := make([]string, count)
+	for px := range packNames {
+		packNames[px] = filepath.Join(directory, fmt.Sprintf("pack%d.pack", px))
+		if res := CreateFileBlockDevice(packNames[px], "PACK01", 1792, 16, false); res.status != DeviceStatusSuccessful {
+			t.Fatalf("Error creating pack: %v", res)
+		}
+	}
+	return packNames
+}
+
+// readConfigurationTestPack returns the first word of each of the given blocks of a pack
+func readConfigurationTestPack(t *testing.T, packName string, blockIds []pkg.BlockId) []pkg2.Word36 {
+	bd := NewFileBlockDevice(packName)
+	if res := bd.Open(true, false); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error opening pack: %v", res)
+	}
+	defer bd.Close()
+
+	result := make([]pkg2.Word36, len(blockIds))
+	buffer := make([]pkg2.Word36, 1792)
+	for bx, blockId := range blockIds {
+		bd.ReadBlocks(blockId, 1, buffer)
+		result[bx] = buffer[0]
+	}
+	return result
+}
+
+func Test_AggregatorConfiguration_Mirror(t *testing.T) {
+	packNames := createConfigurationTestPacks(t, 2)
+	agg, err := NewAggregatorForNode(1, packNames, map[string]string{"AGGREGATOR": "mirror"})
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	mirror, ok := agg.(*MirrorAggregator)
+	if !ok {
+		t.Fatalf("Error expected a MirrorAggregator, got %T", agg)
+	}
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+
+	statuses, _ := mirror.GetMemberStatus(1)
+	if len(statuses) != 2 {
+		t.Fatalf("Error expected 2 mirror members, got %d", len(statuses))
+	}
+
+	buffer := make([]pkg2.Word36, 1792)
+	buffer[0] = 0_123456_654321
+	if req := aggregatorTestIO(agg, AggregatorFunctionWrite, 3, buffer); req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Fatalf("Error writing: %d", req.GetAggregatorStatus())
+	}
+	agg.Close()
+
+	for _, packName := range packNames {
+		words := readConfigurationTestPack(t, packName, []pkg.BlockId{3})
+		if words[0] != 0_123456_654321 {
+			t.Errorf("Error pack %v block 3 expected %012o, got %012o", packName, 0_123456_654321, words[0])
+		}
+	}
+}
+
+func Test_AggregatorConfiguration_Stripe(t *testing.T) {
+	packNames := createConfigurationTestPacks(t, 2)
+	agg, err := NewAggregatorForNode(1, packNames, map[string]string{"AGGREGATOR": "STRIPE", "STRIPE-UNIT": "2"})
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	stripe, ok := agg.(*StripeAggregator)
+	if !ok {
+		t.Fatalf("Error expected a StripeAggregator, got %T", agg)
+	}
+	if stripe.unitCount != 2 {
+		t.Fatalf("Error expected a stripe unit of 2, got %d", stripe.unitCount)
+	}
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+
+	geometry, _ := GetBlockGeometry(agg, 1)
+	if geometry.blockCount != 32 {
+		t.Fatalf("Error expected 32 blocks, got %d", geometry.blockCount)
+	}
+
+	//	blocks 0 and 1 go to the first pack, and blocks 2 and 3 to the second
+	buffer := make([]pkg2.Word36, 4*1792)
+	for bx := 0; bx < 4; bx++ {
+		buffer[bx*1792] = pkg2.Word36(bx + 1)
+	}
+	if req := aggregatorTestIO(agg, AggregatorFunctionWrite, 0, buffer); req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Fatalf("Error writing: %d", req.GetAggregatorStatus())
+	}
+	agg.Close()
+
+	expected := [][]pkg2.Word36{{1, 2}, {3, 4}}
+	for px, packName := range packNames {
+		words := readConfigurationTestPack(t, packName, []pkg.BlockId{0, 1})
+		for wx, word := range expected[px] {
+			if words[wx] != word {
+				t.Errorf("Error pack %d block %d expected %d, got %d", px, wx, word, words[wx])
+			}
+		}
+	}
+}
+
+func Test_AggregatorConfiguration_Invalid(t *testing.T) {
+	packNames := createConfigurationTestPacks(t, 2)
+	invalid := []map[string]string{
+		{},
+		{"AGGREGATOR": "RAID5"},
+		{"AGGREGATOR": "STRIPE", "STRIPE-UNIT": "0"},
+		{"AGGREGATOR": "CACHE"},
+	}
+	for _, attributes := range invalid {
+		if _, err := NewAggregatorForNode(1, packNames, attributes); err == nil {
+			t.Errorf("Error expected %v to be rejected for two packs", attributes)
+		}
+	}
+}
@@ -1,11 +1,25 @@
 package storage
 
+import "sync"
+
+// blockDeviceQueue accepts requests for a single block device, and services them with a fixed number
+// of worker routines, so that the device has up to that many requests in progress at once.
+// The device must be safe for concurrent use. Requests are started in the order in which they are queued,
+// but may complete in any order.
 type blockDeviceQueue struct {
-	channel chan *BlockIORequest
-	device  *BlockDevice
+	channel   chan *BlockIORequest
+	device    *BlockDevice
+	depth     int
+	workers   int
+	waitGroup sync.WaitGroup
 }
 
+// Close waits for the queued requests to complete, then closes the device.
+// No requests may be queued once Close has been called.
 func (dq *blockDeviceQueue) Close() AggregatorResult {
+	close(dq.channel)
+	dq.waitGroup.Wait()
+
 	res := (*dq.device).Close()
 	if res.status != DeviceStatusSuccessful {
 		return AggregatorResult{AggregatorStatusDeviceError, &res}
@@ -14,38 +28,44 @@ func (dq *blockDeviceQueue) Close() AggregatorResult {
 	}
 }
 
+// Open opens the device, and starts the worker routines
 func (dq *blockDeviceQueue) Open(writeProtected bool, writeThrough bool) AggregatorResult {
 	res := (*dq.device).Open(writeProtected, writeThrough)
 	if res.status != DeviceStatusSuccessful {
 		return AggregatorResult{AggregatorStatusDeviceError, &res}
-	} else {
-		return AggregatorResult{AggregatorStatusSuccessful, nil}
 	}
+
+	dq.channel = make(chan *BlockIORequest, dq.depth)
+	for wx := 0; wx < dq.workers; wx++ {
+		dq.waitGroup.Add(1)
+		go dq.routine()
+	}
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// enqueue queues a request for the device. If the queue is full, it waits for room.
+func (dq *blockDeviceQueue) enqueue(request *BlockIORequest) {
+	request.aggregatorStatus = AggregatorStatusInProgress
+	dq.channel <- request
 }
 
 func (dq *blockDeviceQueue) routine() {
-	ok := true
-	for ok {
-		ioreq, ok := <-dq.channel
-		if ok {
-			if ioreq.function == AggregatorFunctionAllocate {
-				// TODO
-			} else if ioreq.function == AggregatorFunctionRelease {
-				// TODO
-			} else if ioreq.function == AggregatorFunctionRead {
-				// TODO
-			} else if ioreq.function == AggregatorFunctionWrite {
-				// TODO
-			} else {
-				ioreq.aggregatorStatus = AggregatorStatusInvalidFunction
-			}
-		}
+	defer dq.waitGroup.Done()
+	for ioreq := range dq.channel {
+		serviceBlockDeviceRequest(*dq.device, ioreq)
 	}
 }
 
-func NewBlockDeviceQueue(device *BlockDevice) blockDeviceQueue {
-	return blockDeviceQueue{
-		channel: make(chan *BlockIORequest),
+// NewBlockDeviceQueue creates a queue for the given device, which holds up to depth requests
+// waiting to be started, and has up to workers requests in progress at once.
+func NewBlockDeviceQueue(device *BlockDevice, depth int, workers int) *blockDeviceQueue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &blockDeviceQueue{
 		device:  device,
+		depth:   depth,
+		workers: workers,
 	}
 }
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// blockFileZero is the header at the front of the system file for a FileBlockDevice or a PackedBlockDevice
+type blockFileZero struct {
+	ident         pkg2.Word36
+	label         pkg2.Word36
+	wordsPerBlock pkg2.Word36
+	blockCount    pkg2.Word36
+}
+
+const blockFileZeroSize = int(unsafe.Sizeof(blockFileZero{}))
+
+// blockFileDataOffset is the offset in the system file of block 0 - the header has the space before it to itself
+const blockFileDataOffset = 4096
+
+// A blockCodec converts between words and the bytes which represent them in a system file
+type blockCodec interface {
+	// bytesPerBlock is the number of bytes of the file which are occupied by one block
+	bytesPerBlock(wordsPerBlock pkg.BlockSize) pkg.BlockSize
+
+	// readAt reads consecutive blocks into buffer, from the given offset.
+	// Any part of the range beyond the end of the file reads as zeroes.
+	readAt(file *os.File, offset int64, wordsPerBlock int, buffer []pkg2.Word36) error
+
+	// writeAt writes consecutive blocks from buffer, at the given offset
+	writeAt(file *os.File, offset int64, wordsPerBlock int, buffer []pkg2.Word36) error
+}
+
+// blockFile implements the BlockDevice methods which FileBlockDevice and PackedBlockDevice have in common.
+// All I/O is positional, so any number of requests may be in progress at once. Each one holds
+// the mutex shared, so that the file cannot be closed (or reopened) from under it.
+type blockFile struct {
+	fileName       string
+	identifier     string
+	codec          blockCodec
+	geometry       BlockGeometry
+	file           *os.File
+	writeProtected bool
+	mutex          sync.RWMutex
+}
+
+// AllocateBlocks extends the file, if necessary, so that it includes the indicated blocks
+func (bf *blockFile) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	res := bf.checkUpdate(blockId, blockCount, -1)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	limitOffset := bf.blockOffset(blockId + pkg.BlockId(blockCount))
+	fi, err := bf.file.Stat()
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if fi.Size() < limitOffset {
+		err := bf.file.Truncate(limitOffset)
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) Close() DeviceResult {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	if !bf.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	err := bf.file.Close()
+	bf.file = nil
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !bf.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return bf.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) IsOpen() bool {
+	return bf.file != nil
+}
+
+func (bf *blockFile) IsWriteProtected() bool {
+	return bf.writeProtected
+}
+
+func (bf *blockFile) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	if bf.IsOpen() {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	flags := os.O_RDWR
+	if writeProtected {
+		flags = os.O_RDONLY
+	} else if writeThrough {
+		flags |= os.O_SYNC
+	}
+
+	file, err := os.OpenFile(bf.fileName, flags, 0644)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	bz := blockFileZero{}
+	_, err = file.ReadAt(unsafe.Slice((*byte)(unsafe.Pointer(&bz)), blockFileZeroSize), 0)
+	if err != nil {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if bz.ident.ToStringAsFieldata() != bf.identifier {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusInvalidIdentifierConstant, nil}
+	}
+
+	wordsPerBlock := pkg.BlockSize(bz.wordsPerBlock.GetW())
+	if !IsWordsPerBlockValid(wordsPerBlock) {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusInvalidBlockSize, nil}
+	}
+
+	bf.geometry = BlockGeometry{
+		label:          bz.label.ToStringAsFieldata(),
+		blockCount:     pkg.BlockCount(bz.blockCount.GetW()),
+		wordsPerBlock:  wordsPerBlock,
+		bytesPerBlock:  bf.codec.bytesPerBlock(wordsPerBlock),
+		blocksPerTrack: pkg.BlockCount(1792 / wordsPerBlock),
+	}
+	bf.file = file
+	bf.writeProtected = writeProtected
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	if !bf.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	wordsPerBlock := int(bf.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, len(buffer), wordsPerBlock, bf.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful || blockCount == 0 {
+		return res
+	}
+
+	err := bf.codec.readAt(bf.file, bf.blockOffset(blockId), wordsPerBlock, buffer)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// ReleaseBlocks releases the indicated blocks by truncating the file, but ONLY if the indicated extent reaches
+// or surpasses the physical end of the file (so that we do not remove data which follows the indicated extent).
+// Blocks which are released in the middle of the file are left as they are.
+func (bf *blockFile) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	res := bf.checkUpdate(blockId, blockCount, -1)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	firstOffset := bf.blockOffset(blockId)
+	limitOffset := bf.blockOffset(blockId + pkg.BlockId(blockCount))
+	fi, err := bf.file.Stat()
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if firstOffset < fi.Size() && fi.Size() <= limitOffset {
+		err := bf.file.Truncate(firstOffset)
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	res := bf.checkUpdate(blockId, blockCount, len(buffer))
+	if res.status != DeviceStatusSuccessful || blockCount == 0 {
+		return res
+	}
+
+	err := bf.codec.writeAt(bf.file, bf.blockOffset(blockId), int(bf.geometry.wordsPerBlock), buffer)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bf *blockFile) blockOffset(blockId pkg.BlockId) int64 {
+	return blockFileDataOffset + int64(blockId)*int64(bf.geometry.bytesPerBlock)
+}
+
+// checkUpdate verifies that an allocate, release, or write request may proceed.
+// bufferLength is negative for requests which have no buffer.
+func (bf *blockFile) checkUpdate(blockId pkg.BlockId, blockCount pkg.BlockCount, bufferLength int) DeviceResult {
+	if !bf.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	if bf.IsWriteProtected() {
+		return DeviceResult{DeviceStatusWriteProtected, nil}
+	}
+
+	return checkBlockRange(blockId, blockCount, bufferLength, int(bf.geometry.wordsPerBlock), bf.geometry.blockCount)
+}
+
+// readFileAt reads len(bytes) bytes at the given offset, zeroing whatever lies beyond the end of the file
+func readFileAt(file *os.File, offset int64, bytes []byte) error {
+	count, err := file.ReadAt(bytes, offset)
+	if err == io.EOF {
+		for bx := count; bx < len(bytes); bx++ {
+			bytes[bx] = 0
+		}
+		err = nil
+	}
+	return err
+}
+
+// createBlockFile creates the system file for a FileBlockDevice or a PackedBlockDevice,
+// replacing any file which already exists.
+func createBlockFile(
+	fileName string,
+	identifier string,
+	codec blockCodec,
+	label string,
+	wordsPerBlock pkg.BlockSize,
+	blockCount pkg.BlockCount,
+	preallocate bool,
+) DeviceResult {
+	if !IsLabelValid(label) {
+		return DeviceResult{DeviceStatusInvalidLabel, nil}
+	}
+
+	if !IsWordsPerBlockValid(wordsPerBlock) {
+		return DeviceResult{DeviceStatusInvalidBlockSize, nil}
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	bz := blockFileZero{
+		wordsPerBlock: pkg2.Word36(wordsPerBlock),
+		blockCount:    pkg2.Word36(blockCount),
+	}
+	bz.ident.FromStringToFieldata([]byte(identifier))
+	bz.label.FromStringToFieldata([]byte(label + "     "))
+
+	_, err = file.WriteAt(unsafe.Slice((*byte)(unsafe.Pointer(&bz)), blockFileZeroSize), 0)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	//	The file always includes the space reserved for the header. If we are to preallocate,
+	//	it includes all the blocks as well - the host system may or may not actually assign space to them.
+	limit := int64(blockFileDataOffset)
+	if preallocate {
+		limit += int64(blockCount) * int64(codec.bytesPerBlock(wordsPerBlock))
+	}
+
+	err = file.Truncate(limit)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
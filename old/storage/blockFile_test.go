@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+type blockFileTestFormat struct {
+	name       string
+	create     func(fileName string, label string, wordsPerBlock pkg.BlockSize, blockCount pkg.BlockCount, preallocate bool) DeviceResult
+	newDevice  func(fileName string) BlockDevice
+	deviceType pkg.DeviceType
+}
+
+var blockFileTestFormats = []blockFileTestFormat{
+	{
+		"File",
+		CreateFileBlockDevice,
+		func(fileName string) BlockDevice { return NewFileBlockDevice(fileName) },
+		DeviceTypeFileBlock,
+	},
+	{
+		"Packed",
+		CreatePackedBlockDevice,
+		func(fileName string) BlockDevice { return NewPackedBlockDevice(fileName) },
+		DeviceTypePackedBlock,
+	},
+}
+
+func newBlockFileTestDevice(tb testing.TB, format blockFileTestFormat, wordsPerBlock pkg.BlockSize, blockCount pkg.BlockCount) BlockDevice {
+	fileName := filepath.Join(tb.TempDir(), "test.pack")
+	if res := format.create(fileName, "PACK01", wordsPerBlock, blockCount, false); res.status != DeviceStatusSuccessful {
+		tb.Fatalf("Error creating device: %v", res)
+	}
+
+	bd := format.newDevice(fileName)
+	if res := bd.Open(false, false); res.status != DeviceStatusSuccessful {
+		tb.Fatalf("Error opening device: %v", res)
+	}
+	return bd
+}
+
+// blockFileTestPattern produces a recognizable 36-bit value for a word of a block
+func blockFileTestPattern(blockId pkg.BlockId, wx int) pkg2.Word36 {
+	return pkg2.Word36((uint64(blockId)<<24 | uint64(wx) | 0400000000000) & 0777777777777)
+}
+
+func Test_BlockFile_ReadWrite(t *testing.T) {
+	for _, format := range blockFileTestFormats {
+		t.Run(format.name, func(t *testing.T) {
+			bd := newBlockFileTestDevice(t, format, 28, 1000)
+			geo, _ := bd.GetGeometry()
+			if geo.label != "PACK01" || geo.wordsPerBlock != 28 || geo.blockCount != 1000 || geo.blocksPerTrack != 64 {
+				t.Errorf("Error unexpected geometry %+v", geo)
+			}
+			if bd.GetDeviceType() != format.deviceType {
+				t.Errorf("Error unexpected device type %03o", bd.GetDeviceType())
+			}
+
+			buffer := make([]pkg2.Word36, 3*28)
+			for wx := range buffer {
+				buffer[wx] = blockFileTestPattern(pkg.BlockId(wx/28), wx%28)
+			}
+			for _, bid := range []pkg.BlockId{0, 500, 997} {
+				if res := bd.WriteBlocks(bid, 3, buffer); res.status != DeviceStatusSuccessful {
+					t.Fatalf("Error writing block %d: %v", bid, res)
+				}
+			}
+
+			//	the blocks survive a reopen - and blocks which were never written read as zeroes
+			bd.Close()
+			bd.Open(true, false)
+			defer bd.Close()
+			written := map[pkg.BlockId]int{0: 0, 1: 1, 2: 2, 500: 0, 501: 1, 502: 2, 997: 0, 998: 1, 999: 2}
+			result := make([]pkg2.Word36, 5*28)
+			for _, bid := range []pkg.BlockId{0, 500, 995} {
+				res := bd.ReadBlocks(bid, 5, result)
+				if res.status != DeviceStatusSuccessful {
+					t.Fatalf("Error reading block %d: %v", bid, res)
+				}
+				for wx := range result {
+					block := bid + pkg.BlockId(wx/28)
+					expected := pkg2.Word36(0)
+					if bx, ok := written[block]; ok {
+						expected = buffer[bx*28+wx%28]
+					}
+					if result[wx] != expected {
+						t.Fatalf("Error block %d word %d expected %012o, got %012o", block, wx%28, expected, result[wx])
+					}
+				}
+			}
+
+			if res := bd.WriteBlocks(0, 1, buffer[:28]); res.status != DeviceStatusWriteProtected {
+				t.Errorf("Error expected write protected, got %v", res)
+			}
+			if res := bd.ReadBlocks(998, 3, make([]pkg2.Word36, 3*28)); res.status != DeviceStatusMaxBlocksExceeded {
+				t.Errorf("Error expected max blocks exceeded, got %v", res)
+			}
+		})
+	}
+}
+
+func Test_BlockFile_Identifier(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.pack")
+	CreateFileBlockDevice(fileName, "PACK01", 1792, 10, true)
+
+	if res := NewPackedBlockDevice(fileName).Open(true, false); res.status != DeviceStatusInvalidIdentifierConstant {
+		t.Errorf("Error expected invalid identifier, got %v", res)
+	}
+
+	bd, err := NewBlockDeviceForPack(fileName)
+	if err != nil || bd.GetDeviceType() != DeviceTypeFileBlock {
+		t.Errorf("Error pack was not recognized: %v", err)
+	}
+}
+
+func Test_BlockFile_ConvertPack(t *testing.T) {
+	bd := newBlockFileTestDevice(t, blockFileTestFormats[0], 224, 50)
+	buffer := make([]pkg2.Word36, 224)
+	for _, bid := range []pkg.BlockId{0, 17, 49} {
+		buffer[223] = blockFileTestPattern(bid, 223)
+		bd.WriteBlocks(bid, 1, buffer)
+	}
+	bd.Close()
+
+	//	File to Sparse to Packed, and the blocks, label, and geometry come along
+	directory := filepath.Dir(bd.(*FileBlockDevice).fileName)
+	sparseName := filepath.Join(directory, "test.sparse")
+	packedName := filepath.Join(directory, "test.packed")
+	if err := ConvertPack(bd.(*FileBlockDevice).fileName, sparseName, DeviceTypeSparseBlock); err != nil {
+		t.Fatalf("Error converting to sparse: %v", err)
+	}
+	if err := ConvertPack(sparseName, packedName, DeviceTypePackedBlock); err != nil {
+		t.Fatalf("Error converting to packed: %v", err)
+	}
+
+	packed := NewPackedBlockDevice(packedName)
+	packed.Open(true, false)
+	defer packed.Close()
+	geo, _ := packed.GetGeometry()
+	if geo.label != "PACK01" || geo.wordsPerBlock != 224 || geo.blockCount != 50 {
+		t.Errorf("Error geometry not preserved: %+v", geo)
+	}
+	for _, bid := range []pkg.BlockId{0, 17, 49} {
+		packed.ReadBlocks(bid, 1, buffer)
+		if buffer[223] != blockFileTestPattern(bid, 223) {
+			t.Errorf("Error block %d not converted", bid)
+		}
+	}
+}
+
+func Test_BlockFile_Concurrent(t *testing.T) {
+	for _, format := range blockFileTestFormats {
+		t.Run(format.name, func(t *testing.T) {
+			bd := newBlockFileTestDevice(t, format, 1792, 256)
+			defer bd.Close()
+
+			//	each routine owns a set of blocks, which it writes and reads back while the others do likewise
+			var waitGroup sync.WaitGroup
+			var failures atomic.Int32
+			for rx := 0; rx < 16; rx++ {
+				waitGroup.Add(1)
+				go func(rx int) {
+					defer waitGroup.Done()
+					buffer := make([]pkg2.Word36, 1792)
+					result := make([]pkg2.Word36, 1792)
+					for bid := pkg.BlockId(rx); bid < 256; bid += 16 {
+						for wx := range buffer {
+							buffer[wx] = blockFileTestPattern(bid, wx)
+						}
+						bd.WriteBlocks(bid, 1, buffer)
+						bd.ReadBlocks(bid, 1, result)
+						if result[1791] != buffer[1791] || result[0] != buffer[0] {
+							failures.Add(1)
+						}
+					}
+				}(rx)
+			}
+			waitGroup.Wait()
+
+			if failures.Load() > 0 {
+				t.Errorf("Error %d blocks were not read back correctly", failures.Load())
+			}
+		})
+	}
+}
+
+func Test_SimpleAggregator_Callbacks(t *testing.T) {
+	var device BlockDevice = newBlockFileTestDevice(t, blockFileTestFormats[1], 1792, 100)
+	device.Close()
+
+	agg := NewSimpleAggregator()
+	agg.RegisterDevice(3, &device)
+	if res := agg.Open(); res.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", res)
+	}
+
+	var waitGroup sync.WaitGroup
+	var failures atomic.Int32
+	callback := func(request *BlockIORequest) {
+		if request.GetAggregatorStatus() != AggregatorStatusSuccessful {
+			failures.Add(1)
+		}
+		waitGroup.Done()
+	}
+
+	for bid := pkg.BlockId(0); bid < 100; bid++ {
+		buffer := make([]pkg2.Word36, 1792)
+		buffer[0] = pkg2.Word36(bid)
+		request := NewBlockIORequest(AggregatorFunctionWrite, 3, bid, 1, buffer)
+		request.SetCompletionCallback(callback)
+		waitGroup.Add(1)
+		agg.StartIO(request)
+	}
+	waitGroup.Wait()
+
+	//	errors are reported through the callback as well
+	request := NewBlockIORequest(AggregatorFunctionRead, 4, 0, 1, make([]pkg2.Word36, 1792))
+	request.SetCompletionCallback(callback)
+	waitGroup.Add(1)
+	agg.StartIO(request)
+	waitGroup.Wait()
+	if failures.Load() != 1 || request.GetAggregatorStatus() != AggregatorStatusInvalidDeviceIndex {
+		t.Errorf("Error expected 1 failure, got %d", failures.Load())
+	}
+
+	buffer := make([]pkg2.Word36, 100*1792)
+	request = NewBlockIORequest(AggregatorFunctionRead, 3, 0, 100, buffer)
+	agg.StartIO(request)
+	request.WaitForCompletion()
+	for bid := 0; bid < 100; bid++ {
+		if buffer[bid*1792] != pkg2.Word36(bid) {
+			t.Fatalf("Error block %d expected %d, got %d", bid, bid, buffer[bid*1792])
+		}
+	}
+
+	agg.Close()
+	if device.IsOpen() {
+		t.Errorf("Error device was left open")
+	}
+}
+
+// benchmarkBlockFileConcurrentIO runs readers and writers against random blocks of a device, in parallel
+func benchmarkBlockFileConcurrentIO(b *testing.B, format blockFileTestFormat, writePercent int) {
+	bd := newBlockFileTestDevice(b, format, 1792, 4096)
+	defer bd.Close()
+
+	b.SetBytes(1792 * 8)
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewSource(rand.Int63()))
+		buffer := make([]pkg2.Word36, 1792)
+		for pb.Next() {
+			bid := pkg.BlockId(random.Intn(4096))
+			var res DeviceResult
+			if random.Intn(100) < writePercent {
+				res = bd.WriteBlocks(bid, 1, buffer)
+			} else {
+				res = bd.ReadBlocks(bid, 1, buffer)
+			}
+			if res.status != DeviceStatusSuccessful {
+				b.Errorf("Error in I/O: %v", res)
+			}
+		}
+	})
+}
+
+func Benchmark_BlockFile_ConcurrentIO(b *testing.B) {
+	for _, format := range blockFileTestFormats {
+		for _, writePercent := range []int{0, 25, 100} {
+			b.Run(fmt.Sprintf("%v/writes=%d%%", format.name, writePercent), func(b *testing.B) {
+				benchmarkBlockFileConcurrentIO(b, format, writePercent)
+			})
+		}
+	}
+}
+
+func Benchmark_SimpleAggregator_ConcurrentIO(b *testing.B) {
+	var device BlockDevice = newBlockFileTestDevice(b, blockFileTestFormats[1], 1792, 4096)
+	device.Close()
+
+	agg := NewSimpleAggregator()
+	agg.RegisterDevice(0, &device)
+	agg.Open()
+	defer agg.Close()
+
+	b.SetBytes(1792 * 8)
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewSource(rand.Int63()))
+		buffer := make([]pkg2.Word36, 1792)
+		for pb.Next() {
+			function := AggregatorFunction(AggregatorFunctionRead)
+			if random.Intn(4) == 0 {
+				function = AggregatorFunctionWrite
+			}
+			request := NewBlockIORequest(function, 0, pkg.BlockId(random.Intn(4096)), 1, buffer)
+			agg.StartIO(request)
+			request.WaitForCompletion()
+			if request.GetAggregatorStatus() != AggregatorStatusSuccessful {
+				b.Errorf("Error in I/O: %v", request.GetDeviceStatus())
+			}
+		}
+	})
+}
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+type CacheMode int
+
+const (
+	// CacheModeWriteThrough writes blocks to the underlying device before the write request completes
+	CacheModeWriteThrough CacheMode = iota
+	// CacheModeWriteBack holds written blocks in the cache until they are evicted or flushed
+	CacheModeWriteBack
+)
+
+type cacheKey struct {
+	deviceIndex pkg.DeviceIndex
+	blockId     pkg.BlockId
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	buffer  []pkg2.Word36
+	isDirty bool
+	element *list.Element
+}
+
+type cachedDevice struct {
+	device        *BlockDevice
+	wordsPerBlock int
+	blockCount    pkg.BlockCount
+	nextBlockId   pkg.BlockId // block following the most recent read, for detecting sequential access
+}
+
+// CacheStatistics describes the effectiveness of a CacheAggregator
+type CacheStatistics struct {
+	hits            uint64
+	misses          uint64
+	readAheadBlocks uint64
+	writeBacks      uint64
+	evictions       uint64
+}
+
+func (cs CacheStatistics) GetEvictions() uint64 {
+	return cs.evictions
+}
+
+func (cs CacheStatistics) GetHits() uint64 {
+	return cs.hits
+}
+
+func (cs CacheStatistics) GetMisses() uint64 {
+	return cs.misses
+}
+
+func (cs CacheStatistics) GetReadAheadBlocks() uint64 {
+	return cs.readAheadBlocks
+}
+
+func (cs CacheStatistics) GetWriteBacks() uint64 {
+	return cs.writeBacks
+}
+
+// CacheAggregator fronts a set of block devices with a least-recently-used cache of blocks.
+// In write-through mode, writes are persisted to the device before the request completes.
+// In write-back mode, written blocks are persisted only when they are evicted from the cache,
+// when Flush() is invoked, or when the aggregator is closed.
+// When a read request immediately follows the previous read request for the same device,
+// the aggregator reads ahead by a configurable number of blocks once the request has completed.
+// Each request is serviced on its own goroutine, but the cache (and the I/O it causes) is protected
+// by a single mutex, so that requests against any one block are always seen in the order they are serviced.
+type CacheAggregator struct {
+	devices        map[pkg.DeviceIndex]*cachedDevice
+	entries        map[cacheKey]*cacheEntry
+	lru            *list.List // most recently used entries are at the front
+	blockLimit     int
+	mode           CacheMode
+	readAheadCount pkg.BlockCount
+	isOpen         bool
+	mutex          sync.Mutex
+	pending        sync.WaitGroup
+	statistics     CacheStatistics
+}
+
+func (agg *CacheAggregator) Close() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.pending.Wait()
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+
+	result := agg.flush()
+	for _, cd := range agg.devices {
+		res := (*cd.device).Close()
+		if res.status != DeviceStatusSuccessful && result.aggregatorStatus == AggregatorStatusSuccessful {
+			result = AggregatorResult{AggregatorStatusDeviceError, &res}
+		}
+	}
+
+	agg.entries = make(map[cacheKey]*cacheEntry)
+	agg.lru.Init()
+	agg.isOpen = false
+	return result
+}
+
+// Flush writes all modified blocks in the cache to their devices.
+// The blocks remain in the cache.
+func (agg *CacheAggregator) Flush() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	return agg.flush()
+}
+
+func (agg *CacheAggregator) GetDevice(deviceIndex pkg.DeviceIndex) (*BlockDevice, AggregatorResult) {
+	cd, ok := agg.devices[deviceIndex]
+	if ok {
+		return cd.device, AggregatorResult{AggregatorStatusSuccessful, nil}
+	} else {
+		return nil, AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+}
+
+// GetStatistics retrieves a snapshot of the cache statistics
+func (agg *CacheAggregator) GetStatistics() CacheStatistics {
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	return agg.statistics
+}
+
+func (agg *CacheAggregator) IsOpen() bool {
+	return agg.isOpen
+}
+
+func (agg *CacheAggregator) Open() AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	for _, cd := range agg.devices {
+		res := (*cd.device).Open(false, true)
+		if res.status == DeviceStatusSuccessful {
+			var geo BlockGeometry
+			geo, res = (*cd.device).GetGeometry()
+			cd.wordsPerBlock = int(geo.wordsPerBlock)
+			cd.blockCount = geo.blockCount
+			cd.nextBlockId = 0
+		}
+
+		if res.status != DeviceStatusSuccessful {
+			for _, cd2 := range agg.devices {
+				_ = (*cd2.device).Close()
+			}
+			return AggregatorResult{AggregatorStatusDeviceError, &res}
+		}
+	}
+
+	agg.isOpen = true
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// RegisterDevice adds a device to the aggregator. Devices cannot be added while the aggregator is open.
+func (agg *CacheAggregator) RegisterDevice(deviceIndex pkg.DeviceIndex, device *BlockDevice) AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	_, ok := agg.devices[deviceIndex]
+	if ok {
+		return AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+
+	agg.devices[deviceIndex] = &cachedDevice{device: device}
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *CacheAggregator) StartIO(request *BlockIORequest) {
+	if !agg.IsOpen() {
+		request.complete(AggregatorStatusNotOpen, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	cd, ok := agg.devices[request.deviceIndex]
+	if !ok {
+		request.complete(AggregatorStatusInvalidDeviceIndex, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	request.aggregatorStatus = AggregatorStatusInProgress
+	agg.pending.Add(1)
+	go agg.service(cd, request)
+}
+
+// service carries out a single request, then reads ahead if the request was one of a sequential series of reads.
+func (agg *CacheAggregator) service(cd *cachedDevice, request *BlockIORequest) {
+	defer agg.pending.Done()
+
+	agg.mutex.Lock()
+	var res DeviceResult
+	switch request.function {
+	case AggregatorFunctionAllocate:
+		res = (*cd.device).AllocateBlocks(request.blockId, request.blockCount)
+	case AggregatorFunctionRead:
+		res = agg.read(cd, request)
+	case AggregatorFunctionRelease:
+		agg.discard(request.deviceIndex, request.blockId, request.blockCount)
+		res = (*cd.device).ReleaseBlocks(request.blockId, request.blockCount)
+	case AggregatorFunctionWrite:
+		res = agg.write(cd, request)
+	default:
+		agg.mutex.Unlock()
+		request.complete(AggregatorStatusInvalidFunction, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	readAhead := false
+	if request.function == AggregatorFunctionRead && res.status == DeviceStatusSuccessful {
+		readAhead = agg.readAheadCount > 0 && cd.nextBlockId == request.blockId
+		cd.nextBlockId = request.blockId + pkg.BlockId(request.blockCount)
+	}
+	agg.mutex.Unlock()
+
+	if res.status == DeviceStatusSuccessful {
+		request.complete(AggregatorStatusSuccessful, res)
+	} else {
+		request.complete(AggregatorStatusDeviceError, res)
+	}
+
+	if readAhead {
+		agg.readAhead(cd, request.deviceIndex, request.blockId+pkg.BlockId(request.blockCount))
+	}
+}
+
+// discard drops the indicated blocks from the cache, without writing them back
+func (agg *CacheAggregator) discard(deviceIndex pkg.DeviceIndex, blockId pkg.BlockId, blockCount pkg.BlockCount) {
+	for bx := pkg.BlockCount(0); bx < blockCount; bx++ {
+		key := cacheKey{deviceIndex, blockId + pkg.BlockId(bx)}
+		entry, ok := agg.entries[key]
+		if ok {
+			agg.lru.Remove(entry.element)
+			delete(agg.entries, key)
+		}
+	}
+}
+
+// evict removes the least recently used entry from the cache, writing it back first if it is dirty.
+// If the write-back fails, the entry remains in the cache.
+func (agg *CacheAggregator) evict() DeviceResult {
+	entry := agg.lru.Back().Value.(*cacheEntry)
+	if entry.isDirty {
+		res := agg.writeBack(entry)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	agg.lru.Remove(entry.element)
+	delete(agg.entries, entry.key)
+	agg.statistics.evictions++
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// flush writes all dirty entries to their devices. The mutex must be held.
+func (agg *CacheAggregator) flush() AggregatorResult {
+	for _, entry := range agg.entries {
+		if entry.isDirty {
+			res := agg.writeBack(entry)
+			if res.status != DeviceStatusSuccessful {
+				return AggregatorResult{AggregatorStatusDeviceError, &res}
+			}
+		}
+	}
+
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// store places a copy of the given block into the cache, evicting entries as necessary to make room.
+// The mutex must be held.
+func (agg *CacheAggregator) store(key cacheKey, buffer []pkg2.Word36, isDirty bool) DeviceResult {
+	entry, ok := agg.entries[key]
+	if ok {
+		copy(entry.buffer, buffer)
+		entry.isDirty = entry.isDirty || isDirty
+		agg.lru.MoveToFront(entry.element)
+		return DeviceResult{DeviceStatusSuccessful, nil}
+	}
+
+	for len(agg.entries) >= agg.blockLimit {
+		res := agg.evict()
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	entry = &cacheEntry{
+		key:     key,
+		buffer:  make([]pkg2.Word36, len(buffer)),
+		isDirty: isDirty,
+	}
+	copy(entry.buffer, buffer)
+	entry.element = agg.lru.PushFront(entry)
+	agg.entries[key] = entry
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (agg *CacheAggregator) read(cd *cachedDevice, request *BlockIORequest) DeviceResult {
+	res := checkRequestRange(request, cd.wordsPerBlock, cd.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	wpb := cd.wordsPerBlock
+	for bx := 0; bx < int(request.blockCount); {
+		key := cacheKey{request.deviceIndex, request.blockId + pkg.BlockId(bx)}
+		entry, ok := agg.entries[key]
+		if ok {
+			copy(request.buffer[bx*wpb:(bx+1)*wpb], entry.buffer)
+			agg.lru.MoveToFront(entry.element)
+			agg.statistics.hits++
+			bx++
+			continue
+		}
+
+		//	Read the entire run of consecutive missing blocks in one go
+		run := 1
+		for bx+run < int(request.blockCount) {
+			_, ok := agg.entries[cacheKey{request.deviceIndex, key.blockId + pkg.BlockId(run)}]
+			if ok {
+				break
+			}
+			run++
+		}
+
+		sub := request.buffer[bx*wpb : (bx+run)*wpb]
+		res := (*cd.device).ReadBlocks(key.blockId, pkg.BlockCount(run), sub)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+
+		agg.statistics.misses += uint64(run)
+		for rx := 0; rx < run; rx++ {
+			res = agg.store(cacheKey{request.deviceIndex, key.blockId + pkg.BlockId(rx)}, sub[rx*wpb:(rx+1)*wpb], false)
+			if res.status != DeviceStatusSuccessful {
+				return res
+			}
+		}
+		bx += run
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// readAhead brings the blocks following a sequential read into the cache.
+// Errors are ignored - the client will see them if and when it reads the blocks itself.
+func (agg *CacheAggregator) readAhead(cd *cachedDevice, deviceIndex pkg.DeviceIndex, blockId pkg.BlockId) {
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+
+	buffer := make([]pkg2.Word36, cd.wordsPerBlock)
+	for bx := pkg.BlockCount(0); bx < agg.readAheadCount; bx++ {
+		bid := blockId + pkg.BlockId(bx)
+		if int(bid) >= int(cd.blockCount) {
+			break
+		}
+
+		key := cacheKey{deviceIndex, bid}
+		_, ok := agg.entries[key]
+		if ok {
+			continue
+		}
+
+		res := (*cd.device).ReadBlocks(bid, 1, buffer)
+		if res.status != DeviceStatusSuccessful {
+			break
+		}
+
+		res = agg.store(key, buffer, false)
+		if res.status != DeviceStatusSuccessful {
+			break
+		}
+		agg.statistics.readAheadBlocks++
+	}
+}
+
+func (agg *CacheAggregator) write(cd *cachedDevice, request *BlockIORequest) DeviceResult {
+	res := checkRequestRange(request, cd.wordsPerBlock, cd.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	isDirty := agg.mode == CacheModeWriteBack
+	if !isDirty {
+		res = (*cd.device).WriteBlocks(request.blockId, request.blockCount, request.buffer)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	wpb := cd.wordsPerBlock
+	for bx := 0; bx < int(request.blockCount); bx++ {
+		key := cacheKey{request.deviceIndex, request.blockId + pkg.BlockId(bx)}
+		res = agg.store(key, request.buffer[bx*wpb:(bx+1)*wpb], isDirty)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// writeBack persists a dirty entry to its device, and marks it clean
+func (agg *CacheAggregator) writeBack(entry *cacheEntry) DeviceResult {
+	cd := agg.devices[entry.key.deviceIndex]
+	res := (*cd.device).WriteBlocks(entry.key.blockId, 1, entry.buffer)
+	if res.status == DeviceStatusSuccessful {
+		entry.isDirty = false
+		agg.statistics.writeBacks++
+	}
+	return res
+}
+
+// NewCacheAggregator creates a cache aggregator.
+// blockLimit is the maximum number of blocks (across all devices) held in the cache.
+// readAheadCount is the number of blocks to be read ahead for sequential reads - zero disables read-ahead.
+func NewCacheAggregator(blockLimit int, mode CacheMode, readAheadCount pkg.BlockCount) *CacheAggregator {
+	if blockLimit < 1 {
+		blockLimit = 1
+	}
+
+	return &CacheAggregator{
+		devices:        make(map[pkg.DeviceIndex]*cachedDevice),
+		entries:        make(map[cacheKey]*cacheEntry),
+		lru:            list.New(),
+		blockLimit:     blockLimit,
+		mode:           mode,
+		readAheadCount: readAheadCount,
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func newCacheTestAggregator(t *testing.T, blockLimit int, mode CacheMode, readAhead pkg.BlockCount) (*CacheAggregator, BlockDevice) {
+	tbd, res := NewTemporaryBlockDevice("CACHE", 256)
+	if res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error creating device: %v", res)
+	}
+
+	var bd BlockDevice = tbd
+	agg := NewCacheAggregator(blockLimit, mode, readAhead)
+	agg.RegisterDevice(1, &bd)
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+	return agg, bd
+}
+
+func cacheTestIO(agg *CacheAggregator, function AggregatorFunction, blockId pkg.BlockId, buffer []pkg2.Word36) *BlockIORequest {
+	req := NewBlockIORequest(function, 1, blockId, pkg.BlockCount(len(buffer)/1792), buffer)
+	agg.StartIO(req)
+	req.WaitForCompletion()
+	return req
+}
+
+func fillCacheTestBlock(buffer []pkg2.Word36, seed uint64) {
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(seed<<16 | uint64(wx))
+	}
+}
+
+func Test_CacheAggregator_ConcurrentIO(t *testing.T) {
+	agg, bd := newCacheTestAggregator(t, 16, CacheModeWriteBack, 2)
+
+	wg := sync.WaitGroup{}
+	for gx := 0; gx < 8; gx++ {
+		wg.Add(1)
+		go func(gx int) {
+			defer wg.Done()
+			buffer := make([]pkg2.Word36, 1792)
+			for bx := 0; bx < 20; bx++ {
+				bid := pkg.BlockId(gx*20 + bx)
+				fillCacheTestBlock(buffer, uint64(bid))
+				req := cacheTestIO(agg, AggregatorFunctionWrite, bid, buffer)
+				if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+					t.Errorf("Error writing block %d: %d", bid, req.GetAggregatorStatus())
+				}
+			}
+
+			expected := make([]pkg2.Word36, 1792)
+			for bx := 0; bx < 20; bx++ {
+				bid := pkg.BlockId(gx*20 + bx)
+				fillCacheTestBlock(expected, uint64(bid))
+				req := cacheTestIO(agg, AggregatorFunctionRead, bid, buffer)
+				if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+					t.Errorf("Error reading block %d: %d", bid, req.GetAggregatorStatus())
+				} else if buffer[5] != expected[5] || buffer[1791] != expected[1791] {
+					t.Errorf("Error block %d read back incorrectly", bid)
+				}
+			}
+		}(gx)
+	}
+	wg.Wait()
+
+	if ar := agg.Flush(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error flushing: %v", ar)
+	}
+
+	buffer := make([]pkg2.Word36, 1792)
+	for bid := pkg.BlockId(0); bid < 160; bid++ {
+		bd.ReadBlocks(bid, 1, buffer)
+		if buffer[7] != pkg2.Word36(uint64(bid)<<16|7) {
+			t.Errorf("Error block %d not written to device", bid)
+		}
+	}
+
+	stats := agg.GetStatistics()
+	if stats.GetWriteBacks() != 160 {
+		t.Errorf("Error expected 160 write-backs, got %d", stats.GetWriteBacks())
+	}
+}
+
+func Test_CacheAggregator_WriteThroughAndStatistics(t *testing.T) {
+	agg, bd := newCacheTestAggregator(t, 64, CacheModeWriteThrough, 4)
+	defer agg.Close()
+
+	buffer := make([]pkg2.Word36, 2*1792)
+	fillCacheTestBlock(buffer, 077)
+	cacheTestIO(agg, AggregatorFunctionWrite, 10, buffer)
+
+	direct := make([]pkg2.Word36, 1792)
+	bd.ReadBlocks(11, 1, direct)
+	if direct[0] != buffer[1792] {
+		t.Errorf("Error write-through did not reach the device")
+	}
+
+	//	blocks 10 and 11 are hits, 0 through 9 are misses
+	//	the read is sequential from block zero, so blocks 12 through 15 are read ahead once it completes
+	cacheTestIO(agg, AggregatorFunctionRead, 0, make([]pkg2.Word36, 12*1792))
+	agg.pending.Wait()
+	stats := agg.GetStatistics()
+	if stats.GetHits() != 2 || stats.GetMisses() != 10 || stats.GetReadAheadBlocks() != 4 {
+		t.Errorf("Error expected 2 hits, 10 misses, 4 read-ahead blocks, got %d, %d, %d",
+			stats.GetHits(), stats.GetMisses(), stats.GetReadAheadBlocks())
+	}
+
+	cacheTestIO(agg, AggregatorFunctionRead, 12, make([]pkg2.Word36, 4*1792))
+	agg.pending.Wait()
+	stats = agg.GetStatistics()
+	if stats.GetHits() != 6 || stats.GetMisses() != 10 || stats.GetReadAheadBlocks() != 8 {
+		t.Errorf("Error expected 6 hits, 10 misses, 8 read-ahead blocks, got %d, %d, %d",
+			stats.GetHits(), stats.GetMisses(), stats.GetReadAheadBlocks())
+	}
+
+	req := cacheTestIO(agg, AggregatorFunctionRead, 255, make([]pkg2.Word36, 2*1792))
+	if req.GetAggregatorStatus() != AggregatorStatusDeviceError || req.GetDeviceStatus() != DeviceStatusMaxBlocksExceeded {
+		t.Errorf("Error expected max blocks exceeded, got %d %d", req.GetAggregatorStatus(), req.GetDeviceStatus())
+	}
+}
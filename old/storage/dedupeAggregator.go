@@ -0,0 +1,564 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// dedupeStoreBlock describes a block of the store device which holds content for one or more client blocks
+type dedupeStoreBlock struct {
+	Hash       string `json:"hash"`
+	References uint64 `json:"references"`
+}
+
+// dedupeIndex is the persistent state of a DedupeAggregator.
+// Client blocks which do not appear in a volume map have never been written, or contain all zeroes.
+type dedupeIndex struct {
+	StoreBlocks map[pkg.BlockId]*dedupeStoreBlock               `json:"storeBlocks"`
+	Volumes     map[pkg.DeviceIndex]map[pkg.BlockId]pkg.BlockId `json:"volumes"`
+}
+
+type dedupeVolume struct {
+	device        *BlockDevice
+	wordsPerBlock int
+	blockCount    pkg.BlockCount
+}
+
+// DedupeAggregator stores the blocks of all of its registered devices on a single store device,
+// keeping only one copy of any particular block content. Blocks are identified by the SHA-256 hash of their content.
+// The mapping from client blocks to store blocks, along with the reference counts of the store blocks,
+// is kept in an index file which is rewritten when the aggregator is flushed or closed.
+// Store blocks which are released are not reused until the index has been saved, so that the most recently
+// saved index always describes valid content in the store.
+//
+// The registered devices provide the geometry which the client sees, and the initial content of the volume.
+// The first time the aggregator is opened with a particular device index, the content of that device
+// is imported into the store. Thereafter, the device is never read or written - the store and the index
+// are the only copy of the volume.
+// Block zero of the store is never used, since some devices reserve it for their own purposes.
+type DedupeAggregator struct {
+	indexFileName  string
+	store          *BlockDevice
+	storeGeometry  BlockGeometry
+	volumes        map[pkg.DeviceIndex]*dedupeVolume
+	index          *dedupeIndex
+	hashes         map[string]pkg.BlockId
+	freeBlocks     []pkg.BlockId // store blocks which may be reused
+	releasedBlocks []pkg.BlockId // store blocks which have been released since the index was last saved
+	nextBlockId    pkg.BlockId   // lowest store block which has never been used
+	isModified     bool          // index has changed since it was last saved
+	isOpen         bool
+	mutex          sync.Mutex
+	pending        sync.WaitGroup
+}
+
+func (agg *DedupeAggregator) Close() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.pending.Wait()
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+
+	result := agg.saveIndex()
+	for _, vol := range agg.volumes {
+		_ = (*vol.device).Close()
+	}
+
+	res := (*agg.store).Close()
+	if res.status != DeviceStatusSuccessful && result.aggregatorStatus == AggregatorStatusSuccessful {
+		result = AggregatorResult{AggregatorStatusDeviceError, &res}
+	}
+
+	agg.isOpen = false
+	return result
+}
+
+// Flush saves the index if it has changed.
+// Data is always written to the store before the request which wrote it completes.
+func (agg *DedupeAggregator) Flush() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	return agg.saveIndex()
+}
+
+func (agg *DedupeAggregator) GetDevice(deviceIndex pkg.DeviceIndex) (*BlockDevice, AggregatorResult) {
+	vol, ok := agg.volumes[deviceIndex]
+	if ok {
+		return vol.device, AggregatorResult{AggregatorStatusSuccessful, nil}
+	} else {
+		return nil, AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+}
+
+// GetStoreBlockCount retrieves the number of store blocks currently holding content
+func (agg *DedupeAggregator) GetStoreBlockCount() int {
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	return len(agg.index.StoreBlocks)
+}
+
+func (agg *DedupeAggregator) IsOpen() bool {
+	return agg.isOpen
+}
+
+func (agg *DedupeAggregator) Open() AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	res := (*agg.store).Open(false, true)
+	if res.status == DeviceStatusSuccessful {
+		agg.storeGeometry, res = (*agg.store).GetGeometry()
+	}
+	if res.status != DeviceStatusSuccessful {
+		return AggregatorResult{AggregatorStatusDeviceError, &res}
+	}
+
+	err := agg.loadIndex()
+	if err != nil {
+		_ = (*agg.store).Close()
+		return AggregatorResult{AggregatorStatusSystemError, &DeviceResult{DeviceStatusSystemError, err}}
+	}
+
+	opened := make([]*dedupeVolume, 0)
+	abort := func(result AggregatorResult) AggregatorResult {
+		for _, vol := range opened {
+			_ = (*vol.device).Close()
+		}
+		_ = (*agg.store).Close()
+		return result
+	}
+
+	for deviceIndex, vol := range agg.volumes {
+		res := (*vol.device).Open(false, true)
+		if res.status != DeviceStatusSuccessful {
+			return abort(AggregatorResult{AggregatorStatusDeviceError, &res})
+		}
+		opened = append(opened, vol)
+
+		var geo BlockGeometry
+		geo, res = (*vol.device).GetGeometry()
+		if res.status == DeviceStatusSuccessful && geo.wordsPerBlock != agg.storeGeometry.wordsPerBlock {
+			res = DeviceResult{DeviceStatusInvalidBlockSize, nil}
+		}
+		if res.status != DeviceStatusSuccessful {
+			return abort(AggregatorResult{AggregatorStatusDeviceError, &res})
+		}
+
+		vol.wordsPerBlock = int(geo.wordsPerBlock)
+		vol.blockCount = geo.blockCount
+		_, ok := agg.index.Volumes[deviceIndex]
+		if !ok {
+			agg.index.Volumes[deviceIndex] = make(map[pkg.BlockId]pkg.BlockId)
+			agg.isModified = true
+			res = agg.importVolume(deviceIndex, vol)
+			if res.status != DeviceStatusSuccessful {
+				return abort(AggregatorResult{AggregatorStatusDeviceError, &res})
+			}
+		}
+	}
+
+	if agg.isModified {
+		result := agg.saveIndex()
+		if result.aggregatorStatus != AggregatorStatusSuccessful {
+			return abort(result)
+		}
+	}
+
+	agg.isOpen = true
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// RegisterDevice adds a volume to the aggregator. Devices cannot be added while the aggregator is open.
+func (agg *DedupeAggregator) RegisterDevice(deviceIndex pkg.DeviceIndex, device *BlockDevice) AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	_, ok := agg.volumes[deviceIndex]
+	if ok {
+		return AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+
+	agg.volumes[deviceIndex] = &dedupeVolume{device: device}
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *DedupeAggregator) StartIO(request *BlockIORequest) {
+	if !agg.IsOpen() {
+		request.complete(AggregatorStatusNotOpen, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	vol, ok := agg.volumes[request.deviceIndex]
+	if !ok {
+		request.complete(AggregatorStatusInvalidDeviceIndex, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	request.aggregatorStatus = AggregatorStatusInProgress
+	agg.pending.Add(1)
+	go agg.service(vol, request)
+}
+
+// Verify checks the consistency of the index against itself and against the content of the store.
+// It returns a description of each problem found - an empty slice indicates a consistent store.
+func (agg *DedupeAggregator) Verify() []string {
+	if !agg.IsOpen() {
+		return []string{"aggregator is not open"}
+	}
+
+	agg.pending.Wait()
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+
+	problems := make([]string, 0)
+	references := make(map[pkg.BlockId]uint64)
+	for deviceIndex, mapping := range agg.index.Volumes {
+		for blockId, storeId := range mapping {
+			_, ok := agg.index.StoreBlocks[storeId]
+			if !ok {
+				problems = append(problems,
+					fmt.Sprintf("device %v block %v refers to unused store block %v", deviceIndex, blockId, storeId))
+			}
+			references[storeId]++
+		}
+	}
+
+	hashes := make(map[string]pkg.BlockId)
+	buffer := make([]pkg2.Word36, agg.storeGeometry.wordsPerBlock)
+	for storeId, sb := range agg.index.StoreBlocks {
+		if storeId == 0 || int(storeId) >= int(agg.storeGeometry.blockCount) {
+			problems = append(problems, fmt.Sprintf("store block %v is out of range", storeId))
+			continue
+		}
+
+		if sb.References != references[storeId] {
+			problems = append(problems, fmt.Sprintf("store block %v has reference count %v but %v references",
+				storeId, sb.References, references[storeId]))
+		}
+
+		otherId, ok := hashes[sb.Hash]
+		if ok {
+			problems = append(problems, fmt.Sprintf("store blocks %v and %v have the same hash", otherId, storeId))
+		}
+		hashes[sb.Hash] = storeId
+
+		res := (*agg.store).ReadBlocks(storeId, 1, buffer)
+		if res.status != DeviceStatusSuccessful {
+			problems = append(problems, fmt.Sprintf("store block %v cannot be read: status %v", storeId, res.status))
+		} else if hashBlock(buffer) != sb.Hash {
+			problems = append(problems, fmt.Sprintf("store block %v content does not match its hash", storeId))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// allocateStoreBlock finds an unused store block. Returns zero if the store is full.
+func (agg *DedupeAggregator) allocateStoreBlock() pkg.BlockId {
+	if len(agg.freeBlocks) > 0 {
+		storeId := agg.freeBlocks[len(agg.freeBlocks)-1]
+		agg.freeBlocks = agg.freeBlocks[:len(agg.freeBlocks)-1]
+		return storeId
+	}
+
+	if int(agg.nextBlockId) >= int(agg.storeGeometry.blockCount) {
+		return 0
+	}
+
+	storeId := agg.nextBlockId
+	agg.nextBlockId++
+	return storeId
+}
+
+// dereference drops one reference to a store block, releasing the block when no references remain
+func (agg *DedupeAggregator) dereference(storeId pkg.BlockId) {
+	sb := agg.index.StoreBlocks[storeId]
+	sb.References--
+	if sb.References == 0 {
+		delete(agg.index.StoreBlocks, storeId)
+		delete(agg.hashes, sb.Hash)
+		_ = (*agg.store).ReleaseBlocks(storeId, 1)
+		agg.releasedBlocks = append(agg.releasedBlocks, storeId)
+	}
+}
+
+// importVolume copies the content of a newly-registered device into the store
+func (agg *DedupeAggregator) importVolume(deviceIndex pkg.DeviceIndex, vol *dedupeVolume) DeviceResult {
+	buffer := make([]pkg2.Word36, vol.wordsPerBlock)
+	for blockId := pkg.BlockId(0); int(blockId) < int(vol.blockCount); blockId++ {
+		res := (*vol.device).ReadBlocks(blockId, 1, buffer)
+		if res.status == DeviceStatusSuccessful {
+			res = agg.writeBlock(deviceIndex, blockId, buffer)
+		}
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// loadIndex reads the index file, or creates an empty index if there is no such file,
+// and rebuilds the in-memory structures derived from it.
+func (agg *DedupeAggregator) loadIndex() error {
+	agg.index = &dedupeIndex{
+		StoreBlocks: make(map[pkg.BlockId]*dedupeStoreBlock),
+		Volumes:     make(map[pkg.DeviceIndex]map[pkg.BlockId]pkg.BlockId),
+	}
+
+	content, err := os.ReadFile(agg.indexFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if err == nil {
+		err = json.Unmarshal(content, agg.index)
+		if err != nil {
+			return fmt.Errorf("index file %s is corrupt: %v", agg.indexFileName, err)
+		}
+	}
+
+	agg.hashes = make(map[string]pkg.BlockId)
+	agg.isModified = false
+	agg.nextBlockId = 1
+	for storeId, sb := range agg.index.StoreBlocks {
+		agg.hashes[sb.Hash] = storeId
+		if storeId >= agg.nextBlockId {
+			agg.nextBlockId = storeId + 1
+		}
+	}
+
+	agg.freeBlocks = make([]pkg.BlockId, 0)
+	agg.releasedBlocks = make([]pkg.BlockId, 0)
+	for storeId := agg.nextBlockId - 1; storeId > 0; storeId-- {
+		_, ok := agg.index.StoreBlocks[storeId]
+		if !ok {
+			agg.freeBlocks = append(agg.freeBlocks, storeId)
+		}
+	}
+
+	return nil
+}
+
+func (agg *DedupeAggregator) read(vol *dedupeVolume, request *BlockIORequest) DeviceResult {
+	res := checkRequestRange(request, vol.wordsPerBlock, vol.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	mapping := agg.index.Volumes[request.deviceIndex]
+	wpb := vol.wordsPerBlock
+	for bx := 0; bx < int(request.blockCount); bx++ {
+		sub := request.buffer[bx*wpb : (bx+1)*wpb]
+		storeId, ok := mapping[request.blockId+pkg.BlockId(bx)]
+		if ok {
+			res = (*agg.store).ReadBlocks(storeId, 1, sub)
+			if res.status != DeviceStatusSuccessful {
+				return res
+			}
+		} else {
+			for wx := range sub {
+				sub[wx] = 0
+			}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (agg *DedupeAggregator) release(vol *dedupeVolume, request *BlockIORequest) DeviceResult {
+	if int(request.blockId)+int(request.blockCount) > int(vol.blockCount) {
+		return DeviceResult{DeviceStatusMaxBlocksExceeded, nil}
+	}
+
+	mapping := agg.index.Volumes[request.deviceIndex]
+	for bx := pkg.BlockCount(0); bx < request.blockCount; bx++ {
+		blockId := request.blockId + pkg.BlockId(bx)
+		storeId, ok := mapping[blockId]
+		if ok {
+			agg.isModified = true
+			delete(mapping, blockId)
+			agg.dereference(storeId)
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// saveIndex writes the index to a temporary file, then replaces the index file with it.
+// Once that is done, released store blocks may be reused.
+func (agg *DedupeAggregator) saveIndex() AggregatorResult {
+	if !agg.isModified {
+		return AggregatorResult{AggregatorStatusSuccessful, nil}
+	}
+
+	content, err := json.Marshal(agg.index)
+	if err == nil {
+		tempName := agg.indexFileName + ".tmp"
+		err = os.WriteFile(tempName, content, 0644)
+		if err == nil {
+			err = os.Rename(tempName, agg.indexFileName)
+		}
+	}
+
+	if err != nil {
+		return AggregatorResult{AggregatorStatusSystemError, &DeviceResult{DeviceStatusSystemError, err}}
+	}
+
+	agg.freeBlocks = append(agg.freeBlocks, agg.releasedBlocks...)
+	agg.releasedBlocks = agg.releasedBlocks[:0]
+	agg.isModified = false
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *DedupeAggregator) service(vol *dedupeVolume, request *BlockIORequest) {
+	defer agg.pending.Done()
+
+	agg.mutex.Lock()
+	var res DeviceResult
+	switch request.function {
+	case AggregatorFunctionAllocate:
+		//	unwritten blocks read as zeroes, so there is nothing to be done
+		res = DeviceResult{DeviceStatusSuccessful, nil}
+	case AggregatorFunctionRead:
+		res = agg.read(vol, request)
+	case AggregatorFunctionRelease:
+		res = agg.release(vol, request)
+	case AggregatorFunctionWrite:
+		res = agg.write(vol, request)
+	default:
+		agg.mutex.Unlock()
+		request.complete(AggregatorStatusInvalidFunction, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+	agg.mutex.Unlock()
+
+	if res.status == DeviceStatusSuccessful {
+		request.complete(AggregatorStatusSuccessful, res)
+	} else {
+		request.complete(AggregatorStatusDeviceError, res)
+	}
+}
+
+func (agg *DedupeAggregator) write(vol *dedupeVolume, request *BlockIORequest) DeviceResult {
+	res := checkRequestRange(request, vol.wordsPerBlock, vol.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	wpb := vol.wordsPerBlock
+	for bx := 0; bx < int(request.blockCount); bx++ {
+		res = agg.writeBlock(request.deviceIndex, request.blockId+pkg.BlockId(bx), request.buffer[bx*wpb:(bx+1)*wpb])
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// writeBlock maps a client block to a store block with the same content, writing a new store block if necessary.
+// Blocks of all zeroes are not stored at all.
+func (agg *DedupeAggregator) writeBlock(deviceIndex pkg.DeviceIndex, blockId pkg.BlockId, buffer []pkg2.Word36) DeviceResult {
+	mapping := agg.index.Volumes[deviceIndex]
+	oldId, wasMapped := mapping[blockId]
+	agg.isModified = true
+
+	if isZeroBlock(buffer) {
+		if wasMapped {
+			delete(mapping, blockId)
+			agg.dereference(oldId)
+		}
+		return DeviceResult{DeviceStatusSuccessful, nil}
+	}
+
+	hash := hashBlock(buffer)
+	storeId, ok := agg.hashes[hash]
+	if ok {
+		agg.index.StoreBlocks[storeId].References++
+	} else {
+		storeId = agg.allocateStoreBlock()
+		if storeId == 0 {
+			return DeviceResult{DeviceStatusMaxBlocksExceeded, nil}
+		}
+
+		res := (*agg.store).WriteBlocks(storeId, 1, buffer)
+		if res.status != DeviceStatusSuccessful {
+			agg.freeBlocks = append(agg.freeBlocks, storeId)
+			return res
+		}
+
+		agg.index.StoreBlocks[storeId] = &dedupeStoreBlock{Hash: hash, References: 1}
+		agg.hashes[hash] = storeId
+	}
+
+	mapping[blockId] = storeId
+	if wasMapped {
+		agg.dereference(oldId)
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func hashBlock(buffer []pkg2.Word36) string {
+	h := sha256.New()
+	bytes := make([]byte, 8)
+	for _, word := range buffer {
+		binary.BigEndian.PutUint64(bytes, uint64(word))
+		h.Write(bytes)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isZeroBlock(buffer []pkg2.Word36) bool {
+	for _, word := range buffer {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDedupeAggregator creates a dedupe aggregator which keeps block content on the given store device,
+// and the mapping of client blocks to store blocks in the given index file.
+func NewDedupeAggregator(store *BlockDevice, indexFileName string) *DedupeAggregator {
+	return &DedupeAggregator{
+		indexFileName: indexFileName,
+		store:         store,
+		volumes:       make(map[pkg.DeviceIndex]*dedupeVolume),
+	}
+}
+
+// VerifyDedupeStore opens the store held in a FileBlockDevice along with its index,
+// and checks them for consistency. It returns a description of each problem found.
+func VerifyDedupeStore(storeFileName string, indexFileName string) ([]string, error) {
+	var store BlockDevice = NewFileBlockDevice(storeFileName)
+	agg := NewDedupeAggregator(&store, indexFileName)
+	res := agg.Open()
+	if res.aggregatorStatus != AggregatorStatusSuccessful {
+		if res.deviceResult != nil && res.deviceResult.systemError != nil {
+			return nil, res.deviceResult.systemError
+		}
+		return nil, fmt.Errorf("cannot open dedupe store: aggregator status %v", res.aggregatorStatus)
+	}
+
+	defer agg.Close()
+	return agg.Verify(), nil
+}
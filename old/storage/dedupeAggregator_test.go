@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func newDedupeTestAggregator(t *testing.T, indexFileName string) (*DedupeAggregator, BlockDevice) {
+	tbd, _ := NewTemporaryBlockDevice("STORE", 64)
+	var store BlockDevice = tbd
+	agg := NewDedupeAggregator(&store, indexFileName)
+	for dx := pkg.DeviceIndex(1); dx <= 2; dx++ {
+		vbd, _ := NewTemporaryBlockDevice("VOLUME", 256)
+		var vol BlockDevice = vbd
+		agg.RegisterDevice(dx, &vol)
+	}
+
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+	return agg, store
+}
+
+func dedupeTestIO(agg *DedupeAggregator, function AggregatorFunction, deviceIndex pkg.DeviceIndex, blockId pkg.BlockId, blockCount pkg.BlockCount, seed uint64) *BlockIORequest {
+	var buffer []pkg2.Word36
+	if function == AggregatorFunctionRead || function == AggregatorFunctionWrite {
+		buffer = make([]pkg2.Word36, int(blockCount)*1792)
+		if function == AggregatorFunctionWrite && seed != 0 {
+			fillCacheTestBlock(buffer, seed)
+		}
+	}
+
+	req := NewBlockIORequest(function, deviceIndex, blockId, blockCount, buffer)
+	agg.StartIO(req)
+	req.WaitForCompletion()
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		return req
+	}
+
+	if function == AggregatorFunctionRead && seed != 0 {
+		expected := make([]pkg2.Word36, len(buffer))
+		fillCacheTestBlock(expected, seed)
+		for wx := range buffer {
+			if buffer[wx] != expected[wx] {
+				req.aggregatorStatus = AggregatorStatusSystemError
+				break
+			}
+		}
+	}
+	return req
+}
+
+func Test_DedupeAggregator_SharedContent(t *testing.T) {
+	indexFileName := filepath.Join(t.TempDir(), "dedupe.json")
+	agg, store := newDedupeTestAggregator(t, indexFileName)
+	defer agg.Close()
+
+	//	the same single-block content in ten blocks on each of two volumes is stored once
+	for dx := pkg.DeviceIndex(1); dx <= 2; dx++ {
+		for bid := pkg.BlockId(0); bid < 10; bid++ {
+			dedupeTestIO(agg, AggregatorFunctionWrite, dx, bid*3, 1, 0123)
+		}
+	}
+	dedupeTestIO(agg, AggregatorFunctionWrite, 2, 100, 1, 0456)
+	if agg.GetStoreBlockCount() != 2 {
+		t.Fatalf("Error expected 2 store blocks, got %d", agg.GetStoreBlockCount())
+	}
+
+	req := dedupeTestIO(agg, AggregatorFunctionRead, 1, 27, 1, 0123)
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Errorf("Error reading shared block: %d", req.GetAggregatorStatus())
+	}
+	req = dedupeTestIO(agg, AggregatorFunctionRead, 2, 100, 1, 0456)
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Errorf("Error reading unique block: %d", req.GetAggregatorStatus())
+	}
+
+	//	releasing all but one reference keeps the content; releasing the last frees the store block
+	dedupeTestIO(agg, AggregatorFunctionRelease, 1, 0, 30, 0)
+	dedupeTestIO(agg, AggregatorFunctionRelease, 2, 0, 27, 0)
+	if agg.GetStoreBlockCount() != 2 {
+		t.Errorf("Error expected 2 store blocks after partial release, got %d", agg.GetStoreBlockCount())
+	}
+	req = dedupeTestIO(agg, AggregatorFunctionRead, 2, 27, 1, 0123)
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Errorf("Error reading last reference: %d", req.GetAggregatorStatus())
+	}
+	dedupeTestIO(agg, AggregatorFunctionWrite, 2, 27, 1, 0)
+	if agg.GetStoreBlockCount() != 1 {
+		t.Errorf("Error expected 1 store block after overwrite with zeroes, got %d", agg.GetStoreBlockCount())
+	}
+
+	if problems := agg.Verify(); len(problems) != 0 {
+		t.Errorf("Error unexpected problems %v", problems)
+	}
+
+	//	the index survives the aggregator
+	if ar := agg.Flush(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error flushing: %v", ar)
+	}
+	other := NewDedupeAggregator(&store, indexFileName)
+	if err := other.loadIndex(); err != nil {
+		t.Fatalf("Error loading index: %v", err)
+	}
+	if len(other.index.StoreBlocks) != 1 || len(other.index.Volumes[2]) != 1 || other.nextBlockId != 3 {
+		t.Errorf("Error index not reloaded correctly: %v", other.index)
+	}
+}
+
+func Test_DedupeAggregator_Verify(t *testing.T) {
+	indexFileName := filepath.Join(t.TempDir(), "dedupe.json")
+	agg, store := newDedupeTestAggregator(t, indexFileName)
+	defer agg.Close()
+
+	dedupeTestIO(agg, AggregatorFunctionWrite, 1, 0, 4, 077)
+	dedupeTestIO(agg, AggregatorFunctionWrite, 2, 0, 4, 077)
+	if problems := agg.Verify(); len(problems) != 0 {
+		t.Fatalf("Error unexpected problems %v", problems)
+	}
+
+	buffer := make([]pkg2.Word36, 1792)
+	store.WriteBlocks(2, 1, buffer)
+	agg.index.StoreBlocks[3].References++
+	problems := agg.Verify()
+	if len(problems) != 2 {
+		t.Errorf("Error expected 2 problems, got %v", problems)
+	}
+
+	if _, err := os.Stat(indexFileName); err != nil {
+		t.Errorf("Error index file not written: %v", err)
+	}
+}
+
+func Test_DedupeAggregator_StoreFull(t *testing.T) {
+	agg, _ := newDedupeTestAggregator(t, filepath.Join(t.TempDir(), "dedupe.json"))
+	defer agg.Close()
+
+	//	block zero of the store is never used, so 63 unique blocks fit
+	req := dedupeTestIO(agg, AggregatorFunctionWrite, 1, 0, 63, 01)
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Fatalf("Error filling store: %d", req.GetAggregatorStatus())
+	}
+	req = dedupeTestIO(agg, AggregatorFunctionWrite, 1, 100, 1, 02)
+	if req.GetDeviceStatus() != DeviceStatusMaxBlocksExceeded {
+		t.Errorf("Error expected max blocks exceeded, got %d", req.GetDeviceStatus())
+	}
+}
@@ -9,6 +9,11 @@ const (
 	DeviceTypeFileBlock      pkg.DeviceType = 011
 	DeviceTypePackedBlock    pkg.DeviceType = 012
 	DeviceTypeTemporaryBlock pkg.DeviceType = 014
+	DeviceTypeMirroredBlock  pkg.DeviceType = 015
+	DeviceTypeStripedBlock   pkg.DeviceType = 016
+	DeviceTypeOverlayBlock   pkg.DeviceType = 017
+	DeviceTypeSparseBlock    pkg.DeviceType = 020
+	DeviceTypeEncryptedBlock pkg.DeviceType = 021
 )
 
 const (
@@ -24,6 +29,7 @@ const (
 	DeviceStatusMaxBlocksExceeded
 	DeviceStatusInvalidLabel
 	DeviceStatusInvalidIdentifierConstant
+	DeviceStatusAuthenticationFailed
 )
 
 type DeviceResult struct {
@@ -0,0 +1,641 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+
+	"khalehla/common"
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// Encrypted layout on the base device, which has N blocks of W words:
+//
+//	blocks 0 to D-1:   block data, encrypted with AES-256-GCM
+//	blocks D to N-2:   authentication table - one entry per data block
+//	block N-1:         header - identifier, salt, key check value, and D
+//
+// The W words of a data block are packed two words to nine bytes, and encrypted in place,
+// so that the ciphertext again fills exactly W 36-bit words. The block id is the additional
+// authenticated data, so that a block cannot be moved to another id without detection.
+// A table entry holds the nonce (12 bytes) and the authentication tag (16 bytes) of one data block,
+// four bytes to a word. A block which has never been written (or has been released) reads as zeroes -
+// its entry holds the nonce and tag of an empty message sealed with the block id and a 'free' flag,
+// so that whether a block has been written is authenticated as well. In particular, an all-zero entry
+// fails authentication. The header holds its bytes four to a word, as well.
+//
+// Restoring the whole base device (or a block and its entry) to an earlier state is not detected.
+const encryptedIdentifier = "KHENCR02"
+const encryptedEntryWords = 7
+const encryptedNonceSize = 12
+const encryptedSaltSize = 16
+const encryptedKeyCheckSize = 16
+const encryptionKeySize = 32
+
+// An EncryptionKeySource produces the key for an encrypted pack from the salt stored in the pack
+type EncryptionKeySource func(salt []byte) ([]byte, error)
+
+// EncryptionKeyFromFile produces keys from the master key in a key file (see CreateEncryptionKeyFile).
+// Each pack's key is derived from the master key and the pack's salt, so no two packs share a key.
+func EncryptionKeyFromFile(fileName string) EncryptionKeySource {
+	return func(salt []byte) ([]byte, error) {
+		text, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		master, err := hex.DecodeString(strings.TrimSpace(string(text)))
+		if err != nil || len(master) != encryptionKeySize {
+			return nil, fmt.Errorf("key file %v does not contain a %v-byte hexadecimal key", fileName, encryptionKeySize)
+		}
+
+		key := make([]byte, encryptionKeySize)
+		_, err = io.ReadFull(hkdf.New(sha256.New, master, salt, []byte(encryptedIdentifier)), key)
+		return key, err
+	}
+}
+
+// EncryptionKeyFromPassphrase produces keys from a passphrase, stretched with scrypt
+func EncryptionKeyFromPassphrase(passphrase string) EncryptionKeySource {
+	return func(salt []byte) ([]byte, error) {
+		return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, encryptionKeySize)
+	}
+}
+
+// CreateEncryptionKeyFile creates a key file holding a new random master key, readable only by its owner.
+// An existing file is never overwritten, as that would make every pack encrypted with it unreadable.
+func CreateEncryptionKeyFile(fileName string) error {
+	master := make([]byte, encryptionKeySize)
+	_, err := rand.Read(master)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(hex.EncodeToString(master) + "\n")
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encryptedLayout determines the number of data blocks, and the number of table entries per table block,
+// for a base device of the given geometry
+func encryptedLayout(baseGeometry BlockGeometry) (pkg.BlockCount, int) {
+	entriesPerBlock := int(baseGeometry.wordsPerBlock) / encryptedEntryWords
+	if baseGeometry.blockCount < 2 {
+		return 0, entriesPerBlock
+	}
+
+	usable := uint64(baseGeometry.blockCount) - 1
+	dataBlocks := usable * uint64(entriesPerBlock) / uint64(entriesPerBlock+1)
+	return pkg.BlockCount(dataBlocks), entriesPerBlock
+}
+
+// encryptedKeyCheck produces the value which is kept in the header to recognize the correct key
+func encryptedKeyCheck(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encryptedIdentifier))
+	return mac.Sum(nil)[:encryptedKeyCheckSize]
+}
+
+// bytesToWords stores bytes four to a word - the length of source must be a multiple of four
+func bytesToWords(source []byte, destination []pkg2.Word36) {
+	for wx := 0; wx < len(source)/4; wx++ {
+		destination[wx] = pkg2.Word36(binary.BigEndian.Uint32(source[wx*4:]))
+	}
+}
+
+// wordsToBytes retrieves bytes stored four to a word by bytesToWords
+func wordsToBytes(source []pkg2.Word36, destination []byte) {
+	for wx := 0; wx < len(destination)/4; wx++ {
+		binary.BigEndian.PutUint32(destination[wx*4:], uint32(source[wx]))
+	}
+}
+
+// encryptedTable gives access to the entries of the authentication table, one table block at a time
+type encryptedTable struct {
+	device   *EncryptedBlockDevice
+	blockId  pkg.BlockId
+	buffer   []pkg2.Word36
+	isLoaded bool
+	isDirty  bool
+}
+
+// entry retrieves the words of the table entry for a data block, reading the table block which contains it
+// (and writing the previous table block, if it was updated) as necessary
+func (t *encryptedTable) entry(dataBlockId pkg.BlockId) ([]pkg2.Word36, DeviceResult) {
+	entriesPerBlock := pkg.BlockId(t.device.entriesPerBlock)
+	blockId := pkg.BlockId(t.device.geometry.blockCount) + dataBlockId/entriesPerBlock
+	if !t.isLoaded || blockId != t.blockId {
+		res := t.flush()
+		if res.status != DeviceStatusSuccessful {
+			return nil, res
+		}
+
+		res = (*t.device.base).ReadBlocks(blockId, 1, t.buffer)
+		if res.status != DeviceStatusSuccessful {
+			return nil, res
+		}
+		t.blockId = blockId
+		t.isLoaded = true
+	}
+
+	wx := int(dataBlockId%entriesPerBlock) * encryptedEntryWords
+	return t.buffer[wx : wx+encryptedEntryWords], DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// flush writes the loaded table block, if it has been updated
+func (t *encryptedTable) flush() DeviceResult {
+	if t.isDirty {
+		res := (*t.device.base).WriteBlocks(t.blockId, 1, t.buffer)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+		t.isDirty = false
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// EncryptedBlockDevice presents the content of any base block device, encrypted at rest.
+// Each block is separately encrypted and authenticated, so that a block which has been damaged or tampered with
+// is reported as DeviceStatusAuthenticationFailed instead of being returned. The last few blocks of the base
+// device hold the authentication data, so the encrypted device has somewhat fewer blocks than its base.
+// The base device must be prepared with InitializeEncryptedBlockDevice before it is first used.
+//
+// If the base is already open when the device is opened, it is used as it is, and is left open
+// when the device is closed. Otherwise, the device opens it in the same way that it is itself opened,
+// and closes it again.
+type EncryptedBlockDevice struct {
+	base            *BlockDevice
+	keySource       EncryptionKeySource
+	aead            cipher.AEAD
+	geometry        BlockGeometry
+	entriesPerBlock int
+	ownsBase        bool
+	writeProtected  bool
+	mutex           sync.Mutex
+}
+
+func (bd *EncryptedBlockDevice) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	return (*bd.base).AllocateBlocks(blockId, blockCount)
+}
+
+func (bd *EncryptedBlockDevice) Close() DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	bd.aead = nil
+	if bd.ownsBase {
+		return (*bd.base).Close()
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *EncryptedBlockDevice) GetDeviceType() pkg.DeviceType {
+	return DeviceTypeEncryptedBlock
+}
+
+func (bd *EncryptedBlockDevice) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !bd.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return bd.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *EncryptedBlockDevice) IsOpen() bool {
+	return bd.aead != nil
+}
+
+func (bd *EncryptedBlockDevice) IsWriteProtected() bool {
+	return bd.writeProtected
+}
+
+// Open opens the device, and verifies the key against the header.
+// An incorrect key is reported as DeviceStatusAuthenticationFailed.
+func (bd *EncryptedBlockDevice) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if bd.IsOpen() {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	bd.ownsBase = !(*bd.base).IsOpen()
+	if bd.ownsBase {
+		res := (*bd.base).Open(writeProtected, writeThrough)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	aead, geometry, res := openEncryptedBase(*bd.base, bd.keySource)
+	if res.status != DeviceStatusSuccessful {
+		bd.closeBase()
+		return res
+	}
+
+	bd.aead = aead
+	bd.geometry = geometry
+	_, bd.entriesPerBlock = encryptedLayout(geometry)
+	bd.writeProtected = writeProtected || (*bd.base).IsWriteProtected()
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// ReadBlocks reads and decrypts the indicated blocks.
+// If any block fails authentication, the buffer is cleared and DeviceStatusAuthenticationFailed is returned.
+func (bd *EncryptedBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	wordsPerBlock := int(bd.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, len(buffer), wordsPerBlock, bd.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	res = (*bd.base).ReadBlocks(blockId, blockCount, buffer)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	table := bd.newTable()
+	for bx := 0; bx < int(blockCount); bx++ {
+		bid := blockId + pkg.BlockId(bx)
+		entry, res := table.entry(bid)
+		if res.status == DeviceStatusSuccessful {
+			res = bd.decryptBlock(bid, entry, buffer[bx*wordsPerBlock:(bx+1)*wordsPerBlock])
+		}
+		if res.status != DeviceStatusSuccessful {
+			for wx := range buffer {
+				buffer[wx] = 0
+			}
+			return res
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *EncryptedBlockDevice) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	table := bd.newTable()
+	for bx := 0; bx < int(blockCount); bx++ {
+		entry, res := table.entry(blockId + pkg.BlockId(bx))
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+		err := sealFreeEntry(bd.aead, blockId+pkg.BlockId(bx), entry)
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+		table.isDirty = true
+	}
+
+	res = table.flush()
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+	return (*bd.base).ReleaseBlocks(blockId, blockCount)
+}
+
+// WriteBlocks encrypts and writes the indicated blocks, each with a new random nonce.
+// The data blocks are written before their table entries.
+func (bd *EncryptedBlockDevice) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	wordsPerBlock := int(bd.geometry.wordsPerBlock)
+	if len(buffer) != int(blockCount)*wordsPerBlock {
+		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
+	}
+
+	encrypted := make([]pkg2.Word36, len(buffer))
+	entries := make([]pkg2.Word36, int(blockCount)*encryptedEntryWords)
+	for bx := 0; bx < int(blockCount); bx++ {
+		err := bd.encryptBlock(
+			blockId+pkg.BlockId(bx),
+			buffer[bx*wordsPerBlock:(bx+1)*wordsPerBlock],
+			encrypted[bx*wordsPerBlock:(bx+1)*wordsPerBlock],
+			entries[bx*encryptedEntryWords:(bx+1)*encryptedEntryWords])
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+	}
+
+	res = (*bd.base).WriteBlocks(blockId, blockCount, encrypted)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	table := bd.newTable()
+	for bx := 0; bx < int(blockCount); bx++ {
+		entry, res := table.entry(blockId + pkg.BlockId(bx))
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+		copy(entry, entries[bx*encryptedEntryWords:])
+		table.isDirty = true
+	}
+
+	return table.flush()
+}
+
+// checkUpdate verifies that an allocate, release, or write request may proceed. The mutex must be held.
+func (bd *EncryptedBlockDevice) checkUpdate(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	if bd.IsWriteProtected() {
+		return DeviceResult{DeviceStatusWriteProtected, nil}
+	}
+
+	return checkBlockRange(blockId, blockCount, -1, 0, bd.geometry.blockCount)
+}
+
+func (bd *EncryptedBlockDevice) closeBase() {
+	if bd.ownsBase {
+		_ = (*bd.base).Close()
+	}
+}
+
+// decryptBlock decrypts one block in place, according to its table entry.
+// The entry is checked first as that of a free block (which is cheap), and then as that of a written block.
+func (bd *EncryptedBlockDevice) decryptBlock(blockId pkg.BlockId, entry []pkg2.Word36, block []pkg2.Word36) DeviceResult {
+	entryBytes := make([]byte, encryptedEntryWords*4)
+	wordsToBytes(entry, entryBytes)
+	nonce := entryBytes[:encryptedNonceSize]
+	_, err := bd.aead.Open(nil, nonce, entryBytes[encryptedNonceSize:], encryptedBlockAAD(blockId, false))
+	if err == nil {
+		for wx := range block {
+			block[wx] = 0
+		}
+		return DeviceResult{DeviceStatusSuccessful, nil}
+	}
+
+	sealed := append(packBlockWords(block), entryBytes[encryptedNonceSize:]...)
+	plain, err := bd.aead.Open(sealed[:0], nonce, sealed, encryptedBlockAAD(blockId, true))
+	if err != nil {
+		return DeviceResult{DeviceStatusAuthenticationFailed, fmt.Errorf("block %v failed authentication", blockId)}
+	}
+
+	unpackBlockWords(plain, block)
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// encryptBlock encrypts one block, producing the encrypted words and the table entry for the block
+func (bd *EncryptedBlockDevice) encryptBlock(blockId pkg.BlockId, block []pkg2.Word36, encrypted []pkg2.Word36, entry []pkg2.Word36) error {
+	entryBytes := make([]byte, encryptedEntryWords*4)
+	_, err := rand.Read(entryBytes[:encryptedNonceSize])
+	if err != nil {
+		return err
+	}
+
+	plain := packBlockWords(block)
+	sealed := bd.aead.Seal(plain[:0], entryBytes[:encryptedNonceSize], plain, encryptedBlockAAD(blockId, true))
+	copy(entryBytes[encryptedNonceSize:], sealed[len(plain):])
+
+	unpackBlockWords(sealed[:len(plain)], encrypted)
+	bytesToWords(entryBytes, entry)
+	return nil
+}
+
+func (bd *EncryptedBlockDevice) newTable() *encryptedTable {
+	return &encryptedTable{
+		device: bd,
+		buffer: make([]pkg2.Word36, bd.geometry.wordsPerBlock),
+	}
+}
+
+// sealFreeEntry produces the table entry for a block which has never been written, or has been released
+func sealFreeEntry(aead cipher.AEAD, blockId pkg.BlockId, entry []pkg2.Word36) error {
+	entryBytes := make([]byte, encryptedEntryWords*4)
+	_, err := rand.Read(entryBytes[:encryptedNonceSize])
+	if err != nil {
+		return err
+	}
+
+	tag := aead.Seal(nil, entryBytes[:encryptedNonceSize], nil, encryptedBlockAAD(blockId, false))
+	copy(entryBytes[encryptedNonceSize:], tag)
+	bytesToWords(entryBytes, entry)
+	return nil
+}
+
+// encryptedBlockAAD produces the additional authenticated data for a block - its id, and whether it is written
+func encryptedBlockAAD(blockId pkg.BlockId, isWritten bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, uint64(blockId))
+	if isWritten {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// packBlockWords packs the words of a block two to nine bytes
+func packBlockWords(block []pkg2.Word36) []byte {
+	words := make([]uint64, len(block))
+	for wx, word := range block {
+		words[wx] = uint64(word)
+	}
+
+	packed := make([]byte, len(block)*9/2)
+	_ = common.PackWord36Strict(words, packed)
+	return packed
+}
+
+// unpackBlockWords unpacks bytes packed by packBlockWords
+func unpackBlockWords(packed []byte, block []pkg2.Word36) {
+	words := make([]uint64, len(block))
+	_ = common.UnpackWord36Strict(packed, words)
+	for wx, word := range words {
+		block[wx] = pkg2.Word36(word)
+	}
+}
+
+// openEncryptedBase reads the header of an open base device, and prepares the cipher with the key from keySource
+func openEncryptedBase(base BlockDevice, keySource EncryptionKeySource) (cipher.AEAD, BlockGeometry, DeviceResult) {
+	geometry, res := base.GetGeometry()
+	if res.status != DeviceStatusSuccessful {
+		return nil, BlockGeometry{}, res
+	}
+
+	header := make([]pkg2.Word36, geometry.wordsPerBlock)
+	res = base.ReadBlocks(pkg.BlockId(geometry.blockCount-1), 1, header)
+	if res.status != DeviceStatusSuccessful {
+		return nil, BlockGeometry{}, res
+	}
+
+	headerBytes := make([]byte, 48)
+	wordsToBytes(header, headerBytes)
+	if string(headerBytes[:8]) != encryptedIdentifier {
+		return nil, BlockGeometry{}, DeviceResult{DeviceStatusInvalidIdentifierConstant, nil}
+	}
+
+	dataBlocks, _ := encryptedLayout(geometry)
+	if binary.BigEndian.Uint64(headerBytes[40:]) != uint64(dataBlocks) {
+		return nil, BlockGeometry{}, DeviceResult{DeviceStatusInvalidBlockSize, nil}
+	}
+
+	salt := headerBytes[8 : 8+encryptedSaltSize]
+	keyCheck := headerBytes[8+encryptedSaltSize : 8+encryptedSaltSize+encryptedKeyCheckSize]
+	aead, key, err := newEncryptionCipher(keySource, salt)
+	if err != nil {
+		return nil, BlockGeometry{}, DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if !bytes.Equal(encryptedKeyCheck(key), keyCheck) {
+		return nil, BlockGeometry{}, DeviceResult{DeviceStatusAuthenticationFailed, fmt.Errorf("incorrect encryption key")}
+	}
+
+	geometry.blockCount = dataBlocks
+	return aead, geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func newEncryptionCipher(keySource EncryptionKeySource, salt []byte) (cipher.AEAD, []byte, error) {
+	key, err := keySource(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	return aead, key, err
+}
+
+// InitializeEncryptedBlockDevice prepares a base device to hold an encrypted pack, with a key from keySource.
+// Anything previously stored on the base device is lost.
+// If the base device is not already open, it is opened for the initialization and closed afterward.
+func InitializeEncryptedBlockDevice(base *BlockDevice, keySource EncryptionKeySource) DeviceResult {
+	if !(*base).IsOpen() {
+		res := (*base).Open(false, false)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+		defer (*base).Close()
+	}
+
+	geometry, res := (*base).GetGeometry()
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	dataBlocks, _ := encryptedLayout(geometry)
+	if dataBlocks == 0 {
+		return DeviceResult{DeviceStatusMaxBlocksExceeded, nil}
+	}
+
+	headerBytes := make([]byte, 48)
+	copy(headerBytes, encryptedIdentifier)
+	salt := headerBytes[8 : 8+encryptedSaltSize]
+	_, err := rand.Read(salt)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	aead, key, err := newEncryptionCipher(keySource, salt)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	copy(headerBytes[8+encryptedSaltSize:], encryptedKeyCheck(key))
+	binary.BigEndian.PutUint64(headerBytes[40:], uint64(dataBlocks))
+
+	//	Fill the table with free entries, so that every block reads as zeroes, then write the header
+	_, entriesPerBlock := encryptedLayout(geometry)
+	buffer := make([]pkg2.Word36, geometry.wordsPerBlock)
+	for bid := pkg.BlockId(dataBlocks); bid < pkg.BlockId(geometry.blockCount-1); bid++ {
+		for ex := 0; ex < entriesPerBlock; ex++ {
+			entry := buffer[ex*encryptedEntryWords : (ex+1)*encryptedEntryWords]
+			dataBlockId := (bid-pkg.BlockId(dataBlocks))*pkg.BlockId(entriesPerBlock) + pkg.BlockId(ex)
+			if dataBlockId >= pkg.BlockId(dataBlocks) {
+				for wx := range entry {
+					entry[wx] = 0
+				}
+			} else if err := sealFreeEntry(aead, dataBlockId, entry); err != nil {
+				return DeviceResult{DeviceStatusSystemError, err}
+			}
+		}
+
+		res = (*base).WriteBlocks(bid, 1, buffer)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	bytesToWords(headerBytes, buffer)
+	return (*base).WriteBlocks(pkg.BlockId(geometry.blockCount-1), 1, buffer)
+}
+
+// InitializeEncryptedPack prepares the pack in packFileName (see NewBlockDeviceForPack) to hold an encrypted pack
+func InitializeEncryptedPack(packFileName string, keySource EncryptionKeySource) error {
+	base, err := NewBlockDeviceForPack(packFileName)
+	if err != nil {
+		return err
+	}
+
+	res := InitializeEncryptedBlockDevice(&base, keySource)
+	if res.status != DeviceStatusSuccessful {
+		return deviceResultError(res)
+	}
+	return nil
+}
+
+// NewEncryptedBlockDevice creates an encrypted device over the given base device, with keys from keySource
+func NewEncryptedBlockDevice(base *BlockDevice, keySource EncryptionKeySource) *EncryptedBlockDevice {
+	return &EncryptedBlockDevice{
+		base:      base,
+		keySource: keySource,
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func newEncryptedTestDevice(t *testing.T, keySource EncryptionKeySource) (BlockDevice, *EncryptedBlockDevice) {
+	var base BlockDevice
+	base, _ = NewTemporaryBlockDevice("BASE", 100)
+	base.Open(false, false)
+	if res := InitializeEncryptedBlockDevice(&base, keySource); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error initializing: %v", res)
+	}
+
+	bd := NewEncryptedBlockDevice(&base, keySource)
+	if res := bd.Open(false, false); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error opening encrypted device: %v", res)
+	}
+	return base, bd
+}
+
+func Test_EncryptedBlockDevice_ReadWrite(t *testing.T) {
+	base, bd := newEncryptedTestDevice(t, EncryptionKeyFromPassphrase("correct horse"))
+	defer bd.Close()
+
+	//	one block of the base holds the header, and one holds the table for the remaining 98
+	geo, _ := bd.GetGeometry()
+	if geo.blockCount != 98 || geo.wordsPerBlock != 1792 {
+		t.Errorf("Error unexpected geometry %+v", geo)
+	}
+
+	buffer := make([]pkg2.Word36, 3*1792)
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(wx) | 0400000000000
+	}
+	if res := bd.WriteBlocks(96, 2, buffer[:2*1792]); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error writing: %v", res)
+	}
+	bd.WriteBlocks(10, 1, buffer[2*1792:])
+
+	raw := make([]pkg2.Word36, 1792)
+	base.ReadBlocks(10, 1, raw)
+	for wx := range raw {
+		if raw[wx] == buffer[2*1792+wx] {
+			t.Fatalf("Error word %d was stored in the clear", wx)
+		}
+		if raw[wx] > 0777777777777 {
+			t.Fatalf("Error word %d is wider than 36 bits", wx)
+		}
+	}
+
+	result := make([]pkg2.Word36, 3*1792)
+	result[0] = 0777
+	if res := bd.ReadBlocks(95, 3, result); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error reading: %v", res)
+	}
+	for wx := range result {
+		expected := pkg2.Word36(0)
+		if wx >= 1792 {
+			expected = buffer[wx-1792]
+		}
+		if result[wx] != expected {
+			t.Fatalf("Error word %d expected %012o, got %012o", wx, expected, result[wx])
+		}
+	}
+
+	bd.ReleaseBlocks(96, 1)
+	bd.ReadBlocks(96, 1, raw)
+	if !isZeroBlock(raw) {
+		t.Errorf("Error released block was not zeroed")
+	}
+	if res := bd.ReadBlocks(98, 1, raw); res.status != DeviceStatusInvalidBlockId {
+		t.Errorf("Error expected invalid block id, got %v", res)
+	}
+}
+
+func Test_EncryptedBlockDevice_Tampering(t *testing.T) {
+	base, bd := newEncryptedTestDevice(t, EncryptionKeyFromPassphrase("correct horse"))
+	defer bd.Close()
+
+	buffer := make([]pkg2.Word36, 2*1792)
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(wx)
+	}
+	bd.WriteBlocks(20, 2, buffer)
+
+	//	a changed word is detected
+	raw := make([]pkg2.Word36, 1792)
+	base.ReadBlocks(20, 1, raw)
+	raw[100] ^= 1
+	base.WriteBlocks(20, 1, raw)
+
+	result := make([]pkg2.Word36, 1792)
+	res := bd.ReadBlocks(20, 1, result)
+	if res.status != DeviceStatusAuthenticationFailed || res.systemError == nil {
+		t.Errorf("Error expected authentication failure, got %v", res)
+	}
+	if !isZeroBlock(result) {
+		t.Errorf("Error buffer holds data from a block which failed authentication")
+	}
+
+	//	so is a block copied into another block id, even with its own table entry
+	base.ReadBlocks(21, 1, raw)
+	base.WriteBlocks(22, 1, raw)
+	table := make([]pkg2.Word36, 1792)
+	base.ReadBlocks(98, 1, table)
+	copy(table[22*encryptedEntryWords:23*encryptedEntryWords], table[21*encryptedEntryWords:])
+	base.WriteBlocks(98, 1, table)
+	if res := bd.ReadBlocks(22, 1, result); res.status != DeviceStatusAuthenticationFailed {
+		t.Errorf("Error expected authentication failure for moved block, got %v", res)
+	}
+	if res := bd.ReadBlocks(21, 1, result); res.status != DeviceStatusSuccessful || result[0] != 1792 {
+		t.Errorf("Error reading untouched block: %v", res)
+	}
+}
+
+func Test_EncryptedBlockDevice_ZeroedEntry(t *testing.T) {
+	base, bd := newEncryptedTestDevice(t, EncryptionKeyFromPassphrase("correct horse"))
+	defer bd.Close()
+
+	buffer := make([]pkg2.Word36, 1792)
+	buffer[0] = 0777
+	bd.WriteBlocks(20, 1, buffer)
+
+	//	no table entry of a freshly initialized device is all zeroes, and free blocks read as zeroes
+	table := make([]pkg2.Word36, 1792)
+	base.ReadBlocks(98, 1, table)
+	if isZeroBlock(table[30*encryptedEntryWords : 31*encryptedEntryWords]) {
+		t.Fatalf("Error free block has an all-zero table entry")
+	}
+	result := make([]pkg2.Word36, 1792)
+	if res := bd.ReadBlocks(30, 1, result); res.status != DeviceStatusSuccessful || !isZeroBlock(result) {
+		t.Fatalf("Error reading free block: %v", res)
+	}
+
+	//	zeroing the entry of a written block does not make it read as zeroes, nor does zeroing that of a free block
+	for _, bid := range []int{20, 30} {
+		for wx := bid * encryptedEntryWords; wx < (bid+1)*encryptedEntryWords; wx++ {
+			table[wx] = 0
+		}
+	}
+	base.WriteBlocks(98, 1, table)
+	for _, bid := range []pkg.BlockId{20, 30} {
+		if res := bd.ReadBlocks(bid, 1, result); res.status != DeviceStatusAuthenticationFailed {
+			t.Errorf("Error expected authentication failure for zeroed entry of block %d, got %v", bid, res)
+		}
+	}
+
+	//	nor can the free entry of one block be used for another
+	base.ReadBlocks(98, 1, table)
+	copy(table[20*encryptedEntryWords:21*encryptedEntryWords], table[40*encryptedEntryWords:])
+	base.WriteBlocks(98, 1, table)
+	if res := bd.ReadBlocks(20, 1, result); res.status != DeviceStatusAuthenticationFailed {
+		t.Errorf("Error expected authentication failure for moved free entry, got %v", res)
+	}
+	if res := bd.ReadBlocks(40, 1, result); res.status != DeviceStatusSuccessful || !isZeroBlock(result) {
+		t.Errorf("Error reading untouched free block: %v", res)
+	}
+}
+
+func Test_EncryptedBlockDevice_Keys(t *testing.T) {
+	keyFileName := filepath.Join(t.TempDir(), "pack.key")
+	if err := CreateEncryptionKeyFile(keyFileName); err != nil {
+		t.Fatalf("Error creating key file: %v", err)
+	}
+	if err := CreateEncryptionKeyFile(keyFileName); err == nil {
+		t.Errorf("Error expected an existing key file not to be overwritten")
+	}
+	fi, _ := os.Stat(keyFileName)
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("Error key file has permissions %v", fi.Mode().Perm())
+	}
+
+	base, bd := newEncryptedTestDevice(t, EncryptionKeyFromFile(keyFileName))
+	buffer := make([]pkg2.Word36, 1792)
+	buffer[0] = 0777
+	bd.WriteBlocks(5, 1, buffer)
+	bd.Close()
+
+	//	the base remains open, so it can be reopened with the same key, but not with any other
+	other := NewEncryptedBlockDevice(&base, EncryptionKeyFromPassphrase("correct horse"))
+	if res := other.Open(false, false); res.status != DeviceStatusAuthenticationFailed {
+		t.Errorf("Error expected authentication failure for wrong key, got %v", res)
+	}
+
+	bd.Open(true, false)
+	defer bd.Close()
+	bd.ReadBlocks(5, 1, buffer)
+	if buffer[0] != 0777 {
+		t.Errorf("Error expected 0777, got %o", buffer[0])
+	}
+	if res := bd.WriteBlocks(5, 1, buffer); res.status != DeviceStatusWriteProtected {
+		t.Errorf("Error expected write protected, got %v", res)
+	}
+
+	badKeyFileName := filepath.Join(t.TempDir(), "bad.key")
+	_ = os.WriteFile(badKeyFileName, []byte("not a key"), 0600)
+	if _, err := EncryptionKeyFromFile(badKeyFileName)(make([]byte, encryptedSaltSize)); err == nil {
+		t.Errorf("Error expected invalid key file to be rejected")
+	}
+}
+
+func Test_EncryptedBlockDevice_Uninitialized(t *testing.T) {
+	var base BlockDevice
+	base, _ = NewTemporaryBlockDevice("BASE", 100)
+	bd := NewEncryptedBlockDevice(&base, EncryptionKeyFromPassphrase("x"))
+	if res := bd.Open(false, false); res.status != DeviceStatusInvalidIdentifierConstant {
+		t.Errorf("Error expected invalid identifier, got %v", res)
+	}
+	if base.IsOpen() {
+		t.Errorf("Error base was left open")
+	}
+	if bd.GetDeviceType() != DeviceTypeEncryptedBlock || bd.IsOpen() {
+		t.Errorf("Error unexpected device state")
+	}
+}
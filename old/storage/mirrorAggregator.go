@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+type MirrorMemberStatus int
+
+const (
+	MirrorMemberHealthy MirrorMemberStatus = iota
+	MirrorMemberFailed
+	MirrorMemberResynchronizing
+)
+
+// blocks copied per step when resynchronizing a member - the set is locked for the duration of each step
+const mirrorResyncBlocks = 64
+
+var errNoHealthyMember = errors.New("no healthy mirror member")
+
+type mirrorMember struct {
+	device *BlockDevice
+	status MirrorMemberStatus
+}
+
+// mirrorSet presents a set of devices holding identical content as a single block device.
+// Writes go to every member which has not failed, reads come from any healthy member.
+// A member which reports anything other than success for a valid request is marked as failed,
+// and is not used again until it is replaced.
+type mirrorSet struct {
+	members  []*mirrorMember
+	geometry BlockGeometry
+	isOpen   bool
+	nextRead int        // member from which the next read is attempted, so that reads are spread across members
+	mutex    sync.Mutex // protects everything above, and serializes I/O against the set
+}
+
+func (ms *mirrorSet) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	return ms.forEachMember(blockId, blockCount, -1, func(device BlockDevice) DeviceResult {
+		return device.AllocateBlocks(blockId, blockCount)
+	})
+}
+
+func (ms *mirrorSet) Close() DeviceResult {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if !ms.isOpen {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	for _, member := range ms.members {
+		_ = (*member.device).Close()
+	}
+
+	ms.isOpen = false
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (ms *mirrorSet) GetDeviceType() pkg.DeviceType {
+	return DeviceTypeMirroredBlock
+}
+
+func (ms *mirrorSet) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !ms.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return ms.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (ms *mirrorSet) IsOpen() bool {
+	return ms.isOpen
+}
+
+func (ms *mirrorSet) IsWriteProtected() bool {
+	return false
+}
+
+// Open opens all the members of the set. Members which cannot be opened, or whose geometry does not agree
+// with the first member which could be opened, are marked as failed. At least one member must be usable.
+// The set is only as large as its smallest member.
+func (ms *mirrorSet) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if ms.isOpen {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	if writeProtected {
+		return DeviceResult{DeviceStatusCannotSetWriteProtect, nil}
+	}
+
+	failure := DeviceResult{DeviceStatusSystemError, errNoHealthyMember}
+	healthy := 0
+	for _, member := range ms.members {
+		member.status = MirrorMemberFailed
+		res := (*member.device).Open(false, writeThrough)
+		if res.status != DeviceStatusSuccessful {
+			failure = res
+			continue
+		}
+
+		geo, res := (*member.device).GetGeometry()
+		if res.status == DeviceStatusSuccessful && healthy > 0 && geo.wordsPerBlock != ms.geometry.wordsPerBlock {
+			res = DeviceResult{DeviceStatusInvalidBlockSize, nil}
+		}
+		if res.status != DeviceStatusSuccessful {
+			_ = (*member.device).Close()
+			failure = res
+			continue
+		}
+
+		if healthy == 0 {
+			ms.geometry = geo
+		} else if geo.blockCount < ms.geometry.blockCount {
+			ms.geometry.blockCount = geo.blockCount
+		}
+		member.status = MirrorMemberHealthy
+		healthy++
+	}
+
+	if healthy == 0 {
+		return failure
+	}
+
+	ms.nextRead = 0
+	ms.isOpen = true
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (ms *mirrorSet) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if !ms.isOpen {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	res := checkBlockRange(blockId, blockCount, len(buffer), int(ms.geometry.wordsPerBlock), ms.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	return ms.read(blockId, blockCount, buffer)
+}
+
+func (ms *mirrorSet) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	return ms.forEachMember(blockId, blockCount, -1, func(device BlockDevice) DeviceResult {
+		return device.ReleaseBlocks(blockId, blockCount)
+	})
+}
+
+func (ms *mirrorSet) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	return ms.forEachMember(blockId, blockCount, len(buffer), func(device BlockDevice) DeviceResult {
+		return device.WriteBlocks(blockId, blockCount, buffer)
+	})
+}
+
+// forEachMember applies an update to every member which has not failed.
+// The update succeeds if it succeeds on at least one healthy member.
+// bufferLength is the length of the buffer for writes, or -1 for updates which have no buffer.
+func (ms *mirrorSet) forEachMember(
+	blockId pkg.BlockId,
+	blockCount pkg.BlockCount,
+	bufferLength int,
+	update func(device BlockDevice) DeviceResult,
+) DeviceResult {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if !ms.isOpen {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	wordsPerBlock := int(ms.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, bufferLength, wordsPerBlock, ms.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	updated := false
+	failure := DeviceResult{DeviceStatusSystemError, errNoHealthyMember}
+	for _, member := range ms.members {
+		if member.status == MirrorMemberFailed {
+			continue
+		}
+
+		res := update(*member.device)
+		if res.status != DeviceStatusSuccessful {
+			member.status = MirrorMemberFailed
+			failure = res
+		} else if member.status == MirrorMemberHealthy {
+			updated = true
+		}
+	}
+
+	if !updated {
+		return failure
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// read attempts the read against each healthy member in turn, until one succeeds. The mutex must be held.
+func (ms *mirrorSet) read(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	failure := DeviceResult{DeviceStatusSystemError, errNoHealthyMember}
+	for attempt := 0; attempt < len(ms.members); attempt++ {
+		mx := (ms.nextRead + attempt) % len(ms.members)
+		member := ms.members[mx]
+		if member.status != MirrorMemberHealthy {
+			continue
+		}
+
+		res := (*member.device).ReadBlocks(blockId, blockCount, buffer)
+		if res.status == DeviceStatusSuccessful {
+			ms.nextRead = (mx + 1) % len(ms.members)
+			return res
+		}
+
+		member.status = MirrorMemberFailed
+		failure = res
+	}
+
+	return failure
+}
+
+// resynchronize copies the content of the healthy members to a member which has been replaced.
+// The member receives writes while it is being resynchronized, but is not read until it is complete.
+// stopping is polled between steps, so that the set can be closed.
+func (ms *mirrorSet) resynchronize(member *mirrorMember, stopping func() bool) {
+	wordsPerBlock := int(ms.geometry.wordsPerBlock)
+	buffer := make([]pkg2.Word36, mirrorResyncBlocks*wordsPerBlock)
+	for blockId := pkg.BlockId(0); int(blockId) < int(ms.geometry.blockCount); blockId += mirrorResyncBlocks {
+		if stopping() {
+			return
+		}
+
+		ms.mutex.Lock()
+		if member.status != MirrorMemberResynchronizing {
+			ms.mutex.Unlock()
+			return
+		}
+
+		blockCount := pkg.BlockCount(mirrorResyncBlocks)
+		if int(blockId)+int(blockCount) > int(ms.geometry.blockCount) {
+			blockCount = ms.geometry.blockCount - pkg.BlockCount(blockId)
+		}
+
+		sub := buffer[:int(blockCount)*wordsPerBlock]
+		res := ms.read(blockId, blockCount, sub)
+		if res.status == DeviceStatusSuccessful {
+			res = (*member.device).WriteBlocks(blockId, blockCount, sub)
+		}
+		if res.status != DeviceStatusSuccessful {
+			member.status = MirrorMemberFailed
+			ms.mutex.Unlock()
+			return
+		}
+		ms.mutex.Unlock()
+	}
+
+	ms.mutex.Lock()
+	member.status = MirrorMemberHealthy
+	ms.mutex.Unlock()
+}
+
+// MirrorAggregator presents each of its device indices as a mirrored set of devices (RAID-1).
+// RegisterDevice adds a member to the set for the given device index.
+// Failed members may be replaced with ReplaceMember, after which they are resynchronized in the background.
+type MirrorAggregator struct {
+	sets     map[pkg.DeviceIndex]*mirrorSet
+	devices  map[pkg.DeviceIndex]*BlockDevice // each set, as a BlockDevice
+	isOpen   bool
+	stopping atomic.Bool
+	pending  sync.WaitGroup
+}
+
+func (agg *MirrorAggregator) Close() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.stopping.Store(true)
+	agg.pending.Wait()
+	for _, ms := range agg.sets {
+		_ = ms.Close()
+	}
+
+	agg.isOpen = false
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *MirrorAggregator) GetDevice(deviceIndex pkg.DeviceIndex) (*BlockDevice, AggregatorResult) {
+	dev, ok := agg.devices[deviceIndex]
+	if ok {
+		return dev, AggregatorResult{AggregatorStatusSuccessful, nil}
+	} else {
+		return nil, AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+}
+
+// GetMemberStatus retrieves the status of each member of the set for the given device index,
+// in the order in which the members were registered.
+func (agg *MirrorAggregator) GetMemberStatus(deviceIndex pkg.DeviceIndex) ([]MirrorMemberStatus, AggregatorResult) {
+	ms, ok := agg.sets[deviceIndex]
+	if !ok {
+		return nil, AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	result := make([]MirrorMemberStatus, len(ms.members))
+	for mx, member := range ms.members {
+		result[mx] = member.status
+	}
+	return result, AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *MirrorAggregator) IsOpen() bool {
+	return agg.isOpen
+}
+
+func (agg *MirrorAggregator) Open() AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	for _, ms := range agg.sets {
+		res := ms.Open(false, true)
+		if res.status != DeviceStatusSuccessful {
+			for _, ms2 := range agg.sets {
+				_ = ms2.Close()
+			}
+			return AggregatorResult{AggregatorStatusDeviceError, &res}
+		}
+	}
+
+	agg.stopping.Store(false)
+	agg.isOpen = true
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// RegisterDevice adds a member to the mirrored set for the given device index.
+// Members cannot be registered while the aggregator is open - use ReplaceMember instead.
+func (agg *MirrorAggregator) RegisterDevice(deviceIndex pkg.DeviceIndex, device *BlockDevice) AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	ms, ok := agg.sets[deviceIndex]
+	if !ok {
+		ms = &mirrorSet{members: make([]*mirrorMember, 0)}
+		var dev BlockDevice = ms
+		agg.sets[deviceIndex] = ms
+		agg.devices[deviceIndex] = &dev
+	}
+
+	ms.members = append(ms.members, &mirrorMember{device: device, status: MirrorMemberFailed})
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// ReplaceMember replaces a failed member of the set for the given device index with a new device,
+// which is opened and then resynchronized from the healthy members in the background.
+// memberIndex is the position of the member in the order of registration.
+func (agg *MirrorAggregator) ReplaceMember(deviceIndex pkg.DeviceIndex, memberIndex int, device *BlockDevice) AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	ms, ok := agg.sets[deviceIndex]
+	if !ok || memberIndex < 0 || memberIndex >= len(ms.members) {
+		return AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	member := ms.members[memberIndex]
+	if member.status != MirrorMemberFailed {
+		return AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+
+	res := (*device).Open(false, true)
+	if res.status != DeviceStatusSuccessful {
+		return AggregatorResult{AggregatorStatusDeviceError, &res}
+	}
+
+	geo, res := (*device).GetGeometry()
+	if res.status == DeviceStatusSuccessful {
+		if geo.wordsPerBlock != ms.geometry.wordsPerBlock {
+			res = DeviceResult{DeviceStatusInvalidBlockSize, nil}
+		} else if geo.blockCount < ms.geometry.blockCount {
+			res = DeviceResult{DeviceStatusMaxBlocksExceeded, nil}
+		}
+	}
+	if res.status != DeviceStatusSuccessful {
+		_ = (*device).Close()
+		return AggregatorResult{AggregatorStatusDeviceError, &res}
+	}
+
+	_ = (*member.device).Close()
+	member.device = device
+	member.status = MirrorMemberResynchronizing
+	agg.pending.Add(1)
+	go func() {
+		defer agg.pending.Done()
+		ms.resynchronize(member, agg.stopping.Load)
+	}()
+
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *MirrorAggregator) StartIO(request *BlockIORequest) {
+	if !agg.IsOpen() {
+		request.complete(AggregatorStatusNotOpen, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	ms, ok := agg.sets[request.deviceIndex]
+	if !ok {
+		request.complete(AggregatorStatusInvalidDeviceIndex, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	request.aggregatorStatus = AggregatorStatusInProgress
+	agg.pending.Add(1)
+	go func() {
+		defer agg.pending.Done()
+		serviceBlockDeviceRequest(ms, request)
+	}()
+}
+
+func NewMirrorAggregator() *MirrorAggregator {
+	return &MirrorAggregator{
+		sets:    make(map[pkg.DeviceIndex]*mirrorSet),
+		devices: make(map[pkg.DeviceIndex]*BlockDevice),
+	}
+}
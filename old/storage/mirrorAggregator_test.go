@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// failingBlockDevice wraps a block device, and fails all reads and writes once it has been told to
+type failingBlockDevice struct {
+	BlockDevice
+	failing bool
+}
+
+func (bd *failingBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	if bd.failing {
+		return DeviceResult{DeviceStatusSystemError, errors.New("injected failure")}
+	}
+	return bd.BlockDevice.ReadBlocks(blockId, blockCount, buffer)
+}
+
+func (bd *failingBlockDevice) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	if bd.failing {
+		return DeviceResult{DeviceStatusSystemError, errors.New("injected failure")}
+	}
+	return bd.BlockDevice.WriteBlocks(blockId, blockCount, buffer)
+}
+
+func newFailingTestDevice(blockCount pkg.BlockCount) (*failingBlockDevice, *BlockDevice) {
+	tbd, _ := NewTemporaryBlockDevice("MIRROR", blockCount)
+	fbd := &failingBlockDevice{BlockDevice: tbd}
+	var bd BlockDevice = fbd
+	return fbd, &bd
+}
+
+func aggregatorTestIO(agg Aggregator, function AggregatorFunction, blockId pkg.BlockId, buffer []pkg2.Word36) *BlockIORequest {
+	req := NewBlockIORequest(function, 1, blockId, pkg.BlockCount(len(buffer)/1792), buffer)
+	agg.StartIO(req)
+	req.WaitForCompletion()
+	return req
+}
+
+func Test_MirrorAggregator_FailAndResynchronize(t *testing.T) {
+	agg := NewMirrorAggregator()
+	members := make([]*failingBlockDevice, 3)
+	for mx := range members {
+		var dev *BlockDevice
+		members[mx], dev = newFailingTestDevice(200)
+		agg.RegisterDevice(1, dev)
+	}
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+	defer agg.Close()
+
+	buffer := make([]pkg2.Word36, 150*1792)
+	fillCacheTestBlock(buffer, 0123)
+	if req := aggregatorTestIO(agg, AggregatorFunctionWrite, 10, buffer); req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Fatalf("Error writing: %d", req.GetAggregatorStatus())
+	}
+
+	//	a member which fails a read is marked failed, and the read is satisfied from another member
+	members[0].failing = true
+	members[1].failing = true
+	check := make([]pkg2.Word36, 1792)
+	for bid := pkg.BlockId(10); bid < 13; bid++ {
+		req := aggregatorTestIO(agg, AggregatorFunctionRead, bid, check)
+		if req.GetAggregatorStatus() != AggregatorStatusSuccessful || check[0] != buffer[int(bid-10)*1792] {
+			t.Errorf("Error reading block %d from surviving member", bid)
+		}
+	}
+
+	status, _ := agg.GetMemberStatus(1)
+	if status[0] != MirrorMemberFailed || status[1] != MirrorMemberFailed || status[2] != MirrorMemberHealthy {
+		t.Fatalf("Error unexpected member status %v", status)
+	}
+
+	//	replace member 1, and wait for it to be resynchronized
+	replacement, dev := newFailingTestDevice(200)
+	if ar := agg.ReplaceMember(1, 1, dev); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error replacing member: %v", ar)
+	}
+	for wait := 0; status[1] != MirrorMemberHealthy && wait < 500; wait++ {
+		time.Sleep(10 * time.Millisecond)
+		status, _ = agg.GetMemberStatus(1)
+	}
+	if status[1] != MirrorMemberHealthy {
+		t.Fatalf("Error member was not resynchronized: %v", status)
+	}
+
+	//	now lose the original survivor - the replacement must have everything
+	members[2].failing = true
+	replacement.BlockDevice.ReadBlocks(159, 1, check)
+	if check[5] != buffer[149*1792+5] {
+		t.Errorf("Error replacement was not resynchronized")
+	}
+	req := aggregatorTestIO(agg, AggregatorFunctionRead, 10, buffer)
+	if req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Errorf("Error reading from replacement: %d", req.GetAggregatorStatus())
+	}
+
+	replacement.failing = true
+	req = aggregatorTestIO(agg, AggregatorFunctionWrite, 10, check)
+	if req.GetAggregatorStatus() != AggregatorStatusDeviceError || req.GetDeviceStatus() != DeviceStatusSystemError {
+		t.Errorf("Error expected device error with no healthy members, got %d %d",
+			req.GetAggregatorStatus(), req.GetDeviceStatus())
+	}
+}
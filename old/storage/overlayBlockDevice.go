@@ -0,0 +1,478 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// Delta file layout:
+//
+//	offset 0:   header - identifier, words per block, and block count, as 8-byte big-endian values
+//	offset 64:  bitmap - one bit per block (MSB first), set if the block is held in the delta
+//	dataOffset: block data - each word as an 8-byte big-endian value, block n at dataOffset + n * bytes per block
+//
+// Blocks which have never been written are never touched, so the host file system keeps them as holes.
+const overlayDeltaIdentifier = "KHOVLY01"
+const overlayDeltaHeaderSize = 64
+const overlayDeltaAlignment = 4096
+
+type overlayDelta struct {
+	file          *os.File
+	wordsPerBlock int
+	blockCount    pkg.BlockCount
+	present       []byte
+	dataOffset    int64
+}
+
+func newOverlayDelta(file *os.File, wordsPerBlock int, blockCount pkg.BlockCount) *overlayDelta {
+	bitmapSize := (int64(blockCount) + 7) / 8
+	dataOffset := overlayDeltaHeaderSize + bitmapSize
+	dataOffset = (dataOffset + overlayDeltaAlignment - 1) / overlayDeltaAlignment * overlayDeltaAlignment
+	return &overlayDelta{
+		file:          file,
+		wordsPerBlock: wordsPerBlock,
+		blockCount:    blockCount,
+		present:       make([]byte, bitmapSize),
+		dataOffset:    dataOffset,
+	}
+}
+
+// createOverlayDelta creates an empty delta file for a base with the given geometry
+func createOverlayDelta(fileName string, wordsPerBlock int, blockCount pkg.BlockCount, writeThrough bool) (*overlayDelta, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
+	if writeThrough {
+		flags |= os.O_SYNC
+	}
+
+	file, err := os.OpenFile(fileName, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := newOverlayDelta(file, wordsPerBlock, blockCount)
+	header := make([]byte, overlayDeltaHeaderSize)
+	copy(header, overlayDeltaIdentifier)
+	binary.BigEndian.PutUint64(header[8:], uint64(wordsPerBlock))
+	binary.BigEndian.PutUint64(header[16:], uint64(blockCount))
+	_, err = file.WriteAt(header, 0)
+	if err == nil {
+		_, err = file.WriteAt(delta.present, overlayDeltaHeaderSize)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(fileName)
+		return nil, err
+	}
+
+	return delta, nil
+}
+
+// openOverlayDelta opens an existing delta file
+func openOverlayDelta(fileName string, readOnly bool, writeThrough bool) (*overlayDelta, error) {
+	flags := os.O_RDWR
+	if readOnly {
+		flags = os.O_RDONLY
+	} else if writeThrough {
+		flags |= os.O_SYNC
+	}
+
+	file, err := os.OpenFile(fileName, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, overlayDeltaHeaderSize)
+	_, err = file.ReadAt(header, 0)
+	if err == nil && string(header[:8]) != overlayDeltaIdentifier {
+		err = fmt.Errorf("%v is not an overlay delta file", fileName)
+	}
+
+	var delta *overlayDelta
+	if err == nil {
+		wordsPerBlock := int(binary.BigEndian.Uint64(header[8:]))
+		blockCount := pkg.BlockCount(binary.BigEndian.Uint64(header[16:]))
+		delta = newOverlayDelta(file, wordsPerBlock, blockCount)
+		_, err = file.ReadAt(delta.present, overlayDeltaHeaderSize)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return delta, nil
+}
+
+func (d *overlayDelta) close() error {
+	return d.file.Close()
+}
+
+func (d *overlayDelta) isPresent(blockId pkg.BlockId) bool {
+	return d.present[blockId/8]&(0x80>>(blockId%8)) != 0
+}
+
+func (d *overlayDelta) blockOffset(blockId pkg.BlockId) int64 {
+	return d.dataOffset + int64(blockId)*int64(d.wordsPerBlock)*8
+}
+
+// readBlocks reads consecutive blocks, all of which must be present in the delta
+func (d *overlayDelta) readBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) error {
+	bytes := make([]byte, len(buffer)*8)
+	_, err := d.file.ReadAt(bytes, d.blockOffset(blockId))
+	if err != nil {
+		return err
+	}
+
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(binary.BigEndian.Uint64(bytes[wx*8:]))
+	}
+	return nil
+}
+
+// writeBlocks writes consecutive blocks to the delta, then marks them present.
+// The data is written before the bitmap, so that a failure never leaves a block marked present with bad content.
+func (d *overlayDelta) writeBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) error {
+	bytes := make([]byte, len(buffer)*8)
+	for wx, word := range buffer {
+		binary.BigEndian.PutUint64(bytes[wx*8:], uint64(word))
+	}
+
+	_, err := d.file.WriteAt(bytes, d.blockOffset(blockId))
+	if err != nil {
+		return err
+	}
+
+	limitId := blockId + pkg.BlockId(blockCount)
+	for bid := blockId; bid < limitId; bid++ {
+		d.present[bid/8] |= 0x80 >> (bid % 8)
+	}
+
+	first := int64(blockId / 8)
+	limit := int64((limitId + 7) / 8)
+	_, err = d.file.WriteAt(d.present[first:limit], overlayDeltaHeaderSize+first)
+	return err
+}
+
+// OverlayBlockDevice presents a base block device which is never written, along with a delta file which holds
+// every block written through the overlay. Reads are satisfied from the delta where it holds the block,
+// and from the base otherwise. Released blocks are written to the delta as zeroes.
+// The delta file is created when the overlay is first opened. It may be committed into the base,
+// saved as a snapshot, or discarded, with CommitOverlay, SnapshotOverlay, and DiscardOverlay.
+//
+// If the base is already open when the overlay is opened, it is used as it is, and is left open
+// when the overlay is closed. Otherwise, the overlay opens it write-protected, and closes it again.
+type OverlayBlockDevice struct {
+	base           *BlockDevice
+	deltaFileName  string
+	delta          *overlayDelta
+	geometry       BlockGeometry
+	ownsBase       bool
+	writeProtected bool
+	mutex          sync.Mutex
+}
+
+func (bd *OverlayBlockDevice) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	//	Every block is readable (from the base) - there is nothing to allocate
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) Close() DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	err := bd.delta.close()
+	bd.delta = nil
+	if bd.ownsBase {
+		_ = (*bd.base).Close()
+	}
+
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) GetDeviceType() pkg.DeviceType {
+	return DeviceTypeOverlayBlock
+}
+
+func (bd *OverlayBlockDevice) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !bd.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return bd.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) IsOpen() bool {
+	return bd.delta != nil
+}
+
+func (bd *OverlayBlockDevice) IsWriteProtected() bool {
+	return bd.writeProtected
+}
+
+func (bd *OverlayBlockDevice) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if bd.IsOpen() {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	bd.ownsBase = !(*bd.base).IsOpen()
+	if bd.ownsBase {
+		res := (*bd.base).Open(true, false)
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+	}
+
+	geo, res := (*bd.base).GetGeometry()
+	if res.status != DeviceStatusSuccessful {
+		bd.closeBase()
+		return res
+	}
+
+	delta, err := openOverlayDelta(bd.deltaFileName, writeProtected, writeThrough)
+	if errors.Is(err, os.ErrNotExist) && !writeProtected {
+		delta, err = createOverlayDelta(bd.deltaFileName, int(geo.wordsPerBlock), geo.blockCount, writeThrough)
+	}
+	if err != nil {
+		bd.closeBase()
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if delta.wordsPerBlock != int(geo.wordsPerBlock) || delta.blockCount != geo.blockCount {
+		_ = delta.close()
+		bd.closeBase()
+		return DeviceResult{DeviceStatusInvalidBlockSize, nil}
+	}
+
+	bd.geometry = geo
+	bd.delta = delta
+	bd.writeProtected = writeProtected
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	wordsPerBlock := int(bd.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, len(buffer), wordsPerBlock, bd.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	//	Read runs of consecutive blocks which come from the same place
+	limitId := blockId + pkg.BlockId(blockCount)
+	for bid := blockId; bid < limitId; {
+		inDelta := bd.delta.isPresent(bid)
+		runLimit := bid + 1
+		for runLimit < limitId && bd.delta.isPresent(runLimit) == inDelta {
+			runLimit++
+		}
+
+		runCount := pkg.BlockCount(runLimit - bid)
+		sub := buffer[int(bid-blockId)*wordsPerBlock : int(runLimit-blockId)*wordsPerBlock]
+		if inDelta {
+			err := bd.delta.readBlocks(bid, runCount, sub)
+			if err != nil {
+				return DeviceResult{DeviceStatusSystemError, err}
+			}
+		} else {
+			res := (*bd.base).ReadBlocks(bid, runCount, sub)
+			if res.status != DeviceStatusSuccessful {
+				return res
+			}
+		}
+
+		bid = runLimit
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	buffer := make([]pkg2.Word36, int(blockCount)*int(bd.geometry.wordsPerBlock))
+	err := bd.delta.writeBlocks(blockId, blockCount, buffer)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *OverlayBlockDevice) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	if len(buffer) != int(blockCount)*int(bd.geometry.wordsPerBlock) {
+		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
+	}
+
+	err := bd.delta.writeBlocks(blockId, blockCount, buffer)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// checkUpdate verifies that an allocate, release, or write request may proceed. The mutex must be held.
+func (bd *OverlayBlockDevice) checkUpdate(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	if bd.IsWriteProtected() {
+		return DeviceResult{DeviceStatusWriteProtected, nil}
+	}
+
+	return checkBlockRange(blockId, blockCount, -1, 0, bd.geometry.blockCount)
+}
+
+func (bd *OverlayBlockDevice) closeBase() {
+	if bd.ownsBase {
+		_ = (*bd.base).Close()
+	}
+}
+
+// NewOverlayBlockDevice creates an overlay of the given base device, keeping changes in the named delta file
+func NewOverlayBlockDevice(base *BlockDevice, deltaFileName string) *OverlayBlockDevice {
+	return &OverlayBlockDevice{
+		base:          base,
+		deltaFileName: deltaFileName,
+	}
+}
+
+// CommitOverlay writes every block held in a delta file into its base device, then removes the delta file.
+// If the base device is not already open, it is opened for the commit and closed afterward.
+func CommitOverlay(base *BlockDevice, deltaFileName string) error {
+	delta, err := openOverlayDelta(deltaFileName, true, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if delta != nil {
+			_ = delta.close()
+		}
+	}()
+
+	if !(*base).IsOpen() {
+		res := (*base).Open(false, true)
+		if res.status != DeviceStatusSuccessful {
+			return deviceResultError(res)
+		}
+		defer (*base).Close()
+	}
+
+	geo, res := (*base).GetGeometry()
+	if res.status != DeviceStatusSuccessful {
+		return deviceResultError(res)
+	} else if int(geo.wordsPerBlock) != delta.wordsPerBlock || geo.blockCount != delta.blockCount {
+		return fmt.Errorf("delta file %v does not match the geometry of its base", deltaFileName)
+	}
+
+	buffer := make([]pkg2.Word36, delta.wordsPerBlock)
+	for bid := pkg.BlockId(0); int(bid) < int(delta.blockCount); bid++ {
+		if delta.isPresent(bid) {
+			err = delta.readBlocks(bid, 1, buffer)
+			if err != nil {
+				return err
+			}
+
+			res = (*base).WriteBlocks(bid, 1, buffer)
+			if res.status != DeviceStatusSuccessful {
+				return deviceResultError(res)
+			}
+		}
+	}
+
+	_ = delta.close()
+	delta = nil
+	return os.Remove(deltaFileName)
+}
+
+// DiscardOverlay throws away the changes held in a delta file.
+// The next time an overlay is opened with the file, it starts out empty.
+func DiscardOverlay(deltaFileName string) error {
+	return os.Remove(deltaFileName)
+}
+
+// SnapshotOverlay copies a delta file to a new file, preserving the holes for blocks which are not present.
+// A snapshot is itself a delta file - it can be put back in place of the original delta,
+// or used directly as the delta of another overlay on the same base.
+func SnapshotOverlay(deltaFileName string, snapshotFileName string) error {
+	delta, err := openOverlayDelta(deltaFileName, true, false)
+	if err != nil {
+		return err
+	}
+	defer delta.close()
+
+	snapshot, err := createOverlayDelta(snapshotFileName, delta.wordsPerBlock, delta.blockCount, false)
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]pkg2.Word36, delta.wordsPerBlock)
+	for bid := pkg.BlockId(0); err == nil && int(bid) < int(delta.blockCount); bid++ {
+		if delta.isPresent(bid) {
+			err = delta.readBlocks(bid, 1, buffer)
+			if err == nil {
+				err = snapshot.writeBlocks(bid, 1, buffer)
+			}
+		}
+	}
+
+	closeErr := snapshot.close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(snapshotFileName)
+	}
+	return err
+}
+
+func deviceResultError(res DeviceResult) error {
+	if res.systemError != nil {
+		return res.systemError
+	}
+	return fmt.Errorf("device status %v", res.status)
+}
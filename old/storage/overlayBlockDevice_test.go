@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func newOverlayTestBase(t *testing.T) BlockDevice {
+	tbd, _ := NewTemporaryBlockDevice("BASE", 100)
+	tbd.Open(false, false)
+	buffer := make([]pkg2.Word36, 100*1792)
+	for bx := 0; bx < 100; bx++ {
+		buffer[bx*1792] = pkg2.Word36(bx)
+	}
+	if res := tbd.WriteBlocks(0, 100, buffer); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error writing base: %v", res)
+	}
+	return tbd
+}
+
+func checkOverlayTestBlocks(t *testing.T, device BlockDevice, expected map[pkg.BlockId]pkg2.Word36) {
+	buffer := make([]pkg2.Word36, 1792)
+	for bid, value := range expected {
+		res := device.ReadBlocks(bid, 1, buffer)
+		if res.status != DeviceStatusSuccessful {
+			t.Errorf("Error reading block %d: %v", bid, res)
+		} else if buffer[0] != value {
+			t.Errorf("Error block %d expected %d, got %d", bid, value, buffer[0])
+		}
+	}
+}
+
+func Test_OverlayBlockDevice_CopyOnWrite(t *testing.T) {
+	base := newOverlayTestBase(t)
+	deltaName := filepath.Join(t.TempDir(), "test.delta")
+	ov := NewOverlayBlockDevice(&base, deltaName)
+	if res := ov.Open(false, false); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error opening overlay: %v", res)
+	}
+
+	buffer := make([]pkg2.Word36, 3*1792)
+	buffer[0], buffer[1792], buffer[2*1792] = 0777, 0776, 0775
+	ov.WriteBlocks(10, 3, buffer)
+	ov.ReleaseBlocks(50, 1)
+
+	//	a read spanning base and delta blocks
+	span := make([]pkg2.Word36, 5*1792)
+	ov.ReadBlocks(9, 5, span)
+	for bx, value := range []pkg2.Word36{9, 0777, 0776, 0775, 13} {
+		if span[bx*1792] != value {
+			t.Errorf("Error spanning read block %d expected %d, got %d", bx+9, value, span[bx*1792])
+		}
+	}
+	checkOverlayTestBlocks(t, ov, map[pkg.BlockId]pkg2.Word36{50: 0, 51: 51})
+	checkOverlayTestBlocks(t, base, map[pkg.BlockId]pkg2.Word36{10: 10, 11: 11, 50: 50})
+
+	//	the delta survives closing and reopening the overlay
+	ov.Close()
+	if !base.IsOpen() {
+		t.Errorf("Error overlay closed a base which it did not open")
+	}
+	ov.Open(false, false)
+	checkOverlayTestBlocks(t, ov, map[pkg.BlockId]pkg2.Word36{11: 0776, 12: 0775, 50: 0})
+	ov.Close()
+
+	//	a snapshot is a delta in its own right
+	snapName := filepath.Join(t.TempDir(), "test.snap")
+	if err := SnapshotOverlay(deltaName, snapName); err != nil {
+		t.Fatalf("Error taking snapshot: %v", err)
+	}
+	snap := NewOverlayBlockDevice(&base, snapName)
+	snap.Open(true, false)
+	checkOverlayTestBlocks(t, snap, map[pkg.BlockId]pkg2.Word36{10: 0777, 50: 0, 99: 99})
+	if res := snap.WriteBlocks(1, 1, buffer[:1792]); res.status != DeviceStatusWriteProtected {
+		t.Errorf("Error expected write protected, got %v", res)
+	}
+	snap.Close()
+
+	//	discarding the delta leaves the base as it was
+	if err := DiscardOverlay(deltaName); err != nil {
+		t.Fatalf("Error discarding: %v", err)
+	}
+	ov.Open(false, false)
+	checkOverlayTestBlocks(t, ov, map[pkg.BlockId]pkg2.Word36{10: 10, 50: 50})
+	ov.Close()
+
+	//	committing the snapshot updates the base and removes the delta
+	if err := CommitOverlay(&base, snapName); err != nil {
+		t.Fatalf("Error committing: %v", err)
+	}
+	checkOverlayTestBlocks(t, base, map[pkg.BlockId]pkg2.Word36{10: 0777, 11: 0776, 12: 0775, 13: 13, 50: 0})
+	if _, err := os.Stat(snapName); !os.IsNotExist(err) {
+		t.Errorf("Error delta file remains after commit")
+	}
+}
+
+func Test_OverlayBlockDevice_GeometryMismatch(t *testing.T) {
+	base := newOverlayTestBase(t)
+	deltaName := filepath.Join(t.TempDir(), "test.delta")
+	delta, err := createOverlayDelta(deltaName, 1792, 50, false)
+	if err != nil {
+		t.Fatalf("Error creating delta: %v", err)
+	}
+	delta.close()
+
+	ov := NewOverlayBlockDevice(&base, deltaName)
+	if res := ov.Open(false, false); res.status != DeviceStatusInvalidBlockSize {
+		t.Errorf("Error expected invalid block size, got %v", res)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// PackFormatTable maps the name of a pack format to the device type which implements it
+var PackFormatTable = map[string]pkg.DeviceType{
+	"FILE":   DeviceTypeFileBlock,
+	"PACKED": DeviceTypePackedBlock,
+	"SPARSE": DeviceTypeSparseBlock,
+}
+
+// ConvertPack copies the pack in sourceFileName (of any format recognized by NewBlockDeviceForPack)
+// to a new pack of the given format in destFileName, with the same label, block size, and block count.
+// Blocks which contain only zeroes are not written, so that they remain unallocated on the new pack.
+// The new pack is removed if the conversion fails.
+func ConvertPack(sourceFileName string, destFileName string, destType pkg.DeviceType) error {
+	if strings.Contains(sourceFileName, "+") {
+		return fmt.Errorf("cannot convert an overlay - commit or snapshot it first")
+	}
+
+	source, err := NewBlockDeviceForPack(sourceFileName)
+	if err != nil {
+		return err
+	}
+
+	res := source.Open(true, false)
+	if res.status != DeviceStatusSuccessful {
+		return deviceResultError(res)
+	}
+	defer source.Close()
+
+	geometry, _ := source.GetGeometry()
+	switch destType {
+	case DeviceTypeFileBlock:
+		res = CreateFileBlockDevice(destFileName, geometry.label, geometry.wordsPerBlock, geometry.blockCount, false)
+	case DeviceTypePackedBlock:
+		res = CreatePackedBlockDevice(destFileName, geometry.label, geometry.wordsPerBlock, geometry.blockCount, false)
+	case DeviceTypeSparseBlock:
+		res = CreateSparseBlockDevice(destFileName, geometry.label, geometry.wordsPerBlock, geometry.blockCount)
+	default:
+		return fmt.Errorf("cannot convert to device type %03o", destType)
+	}
+	if res.status != DeviceStatusSuccessful {
+		return deviceResultError(res)
+	}
+
+	dest, err := NewBlockDeviceForPack(destFileName)
+	if err == nil {
+		res = dest.Open(false, false)
+		if res.status != DeviceStatusSuccessful {
+			err = deviceResultError(res)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(destFileName)
+		return err
+	}
+
+	buffer := make([]pkg2.Word36, geometry.wordsPerBlock)
+	for bid := pkg.BlockId(0); err == nil && int(bid) < int(geometry.blockCount); bid++ {
+		res = source.ReadBlocks(bid, 1, buffer)
+		if res.status == DeviceStatusSuccessful && !isZeroBlock(buffer) {
+			res = dest.WriteBlocks(bid, 1, buffer)
+		}
+		if res.status != DeviceStatusSuccessful {
+			err = deviceResultError(res)
+		}
+	}
+
+	res = dest.Close()
+	if err == nil && res.status != DeviceStatusSuccessful {
+		err = deviceResultError(res)
+	}
+	if err != nil {
+		_ = os.Remove(destFileName)
+	}
+	return err
+}
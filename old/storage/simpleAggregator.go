@@ -2,24 +2,35 @@ package storage
 
 import "khalehla/pkg"
 
+// simpleQueueDepth and simpleQueueWorkers size the queue which a SimpleAggregator keeps for each device
+const simpleQueueDepth = 64
+const simpleQueueWorkers = 8
+
 // SimpleAggregator is a simple coordinator for a set of block devices.
 // It manages async IO across the multiple devices in a quasi-efficient manner.
+// Each device has its own queue, with several requests in progress at once.
 type SimpleAggregator struct {
-	deviceQueues map[pkg.DeviceIndex]blockDeviceQueue
+	deviceQueues map[pkg.DeviceIndex]*blockDeviceQueue
 	isOpen       bool
 }
 
+// Close waits for all requests in progress to complete, and closes the devices.
+// StartIO must not be called while Close is in progress.
 func (agg *SimpleAggregator) Close() AggregatorResult {
 	if !agg.IsOpen() {
 		return AggregatorResult{AggregatorStatusNotOpen, nil}
 	}
 
+	result := AggregatorResult{AggregatorStatusSuccessful, nil}
 	for _, dq := range agg.deviceQueues {
-		dq.Close()
+		res := dq.Close()
+		if res.aggregatorStatus != AggregatorStatusSuccessful {
+			result = res
+		}
 	}
 	agg.isOpen = false
 
-	return AggregatorResult{AggregatorStatusSuccessful, nil}
+	return result
 }
 
 func (agg *SimpleAggregator) Open() AggregatorResult {
@@ -27,16 +38,19 @@ func (agg *SimpleAggregator) Open() AggregatorResult {
 		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
 	}
 
+	opened := make([]*blockDeviceQueue, 0)
 	for _, dq := range agg.deviceQueues {
 		res := dq.Open(false, true)
 		if res.aggregatorStatus != AggregatorStatusSuccessful {
-			for _, dq2 := range agg.deviceQueues {
+			for _, dq2 := range opened {
 				_ = dq2.Close()
 			}
 			return res
 		}
+		opened = append(opened, dq)
 	}
 
+	agg.isOpen = true
 	return AggregatorResult{AggregatorStatusSuccessful, nil}
 }
 
@@ -54,30 +68,35 @@ func (agg *SimpleAggregator) IsOpen() bool {
 }
 
 func (agg *SimpleAggregator) RegisterDevice(deviceIndex pkg.DeviceIndex, device *BlockDevice) AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
 	_, ok := agg.deviceQueues[deviceIndex]
 	if ok {
 		return AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
 	}
 
-	dq := NewBlockDeviceQueue(device)
-	agg.deviceQueues[deviceIndex] = dq
-	go dq.routine()
-
+	agg.deviceQueues[deviceIndex] = NewBlockDeviceQueue(device, simpleQueueDepth, simpleQueueWorkers)
 	return AggregatorResult{AggregatorStatusSuccessful, nil}
 }
 
 func (agg *SimpleAggregator) StartIO(request *BlockIORequest) {
+	if !agg.IsOpen() {
+		request.complete(AggregatorStatusNotOpen, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
 	dq, ok := agg.deviceQueues[request.deviceIndex]
 	if ok {
-		request.aggregatorStatus = AggregatorStatusInProgress
-		dq.channel <- request
+		dq.enqueue(request)
 	} else {
-		request.aggregatorStatus = AggregatorStatusInvalidDeviceIndex
+		request.complete(AggregatorStatusInvalidDeviceIndex, DeviceResult{DeviceStatusSuccessful, nil})
 	}
 }
 
 func NewSimpleAggregator() *SimpleAggregator {
 	return &SimpleAggregator{
-		deviceQueues: make(map[pkg.DeviceIndex]blockDeviceQueue),
+		deviceQueues: make(map[pkg.DeviceIndex]*blockDeviceQueue),
 	}
 }
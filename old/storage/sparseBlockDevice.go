@@ -0,0 +1,492 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+// Sparse file layout:
+//
+//	offset 0:           header - identifier, label (8 ASCII characters), words per block, block count,
+//	                    and blocks per track, as 8-byte big-endian values
+//	offset 64:          block index - one 16-byte entry per block
+//	sparseDataOffset(): compressed block data, in no particular order
+//
+// Each index entry is the offset of the block's data (8 bytes), the length of the compressed data (4 bytes,
+// with the top bit set if the block is allocated), and the space reserved for the data (4 bytes).
+// An all-zero entry describes a block which is not allocated, so the index of a mostly-empty pack is itself
+// mostly holes in the host file. An allocated block which holds only zeroes has no data.
+// Block data is the block's words as 8-byte big-endian values, compressed with DEFLATE.
+const sparseIdentifier = "KHSPRS01"
+const sparseHeaderSize = 64
+const sparseIndexEntrySize = 16
+const sparseAllocatedFlag = 0x80000000
+const sparseSpaceGranule = 64 // space for block data is reserved in multiples of this many bytes
+
+type sparseIndexEntry struct {
+	offset    int64
+	length    uint32
+	capacity  uint32
+	allocated bool
+}
+
+type sparseExtent struct {
+	offset int64
+	length uint32
+}
+
+// SparseBlockDevice persists data to an underlying system file, storing only the blocks which are allocated
+// and contain something other than zeroes, each one individually compressed.
+// A block index at the front of the file provides random access to the blocks.
+// Space freed by released blocks (or by blocks which no longer compress as well as they did)
+// is reused for later writes; the file itself never shrinks.
+type SparseBlockDevice struct {
+	fileName       string
+	geometry       BlockGeometry
+	file           *os.File
+	index          []sparseIndexEntry
+	freeExtents    []sparseExtent // sorted by offset
+	fileLimit      int64          // offset of the end of the block data
+	writeProtected bool
+	mutex          sync.Mutex
+}
+
+func (bd *SparseBlockDevice) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	for bx := pkg.BlockCount(0); bx < blockCount; bx++ {
+		bid := blockId + pkg.BlockId(bx)
+		if !bd.index[bid].allocated {
+			bd.index[bid].allocated = true
+			err := bd.writeIndexEntry(bid)
+			if err != nil {
+				return DeviceResult{DeviceStatusSystemError, err}
+			}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *SparseBlockDevice) Close() DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	err := bd.file.Close()
+	bd.file = nil
+	bd.index = nil
+	bd.freeExtents = nil
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// GetAllocatedBlockCount retrieves the number of blocks which are currently allocated
+func (bd *SparseBlockDevice) GetAllocatedBlockCount() pkg.BlockCount {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	count := pkg.BlockCount(0)
+	for _, entry := range bd.index {
+		if entry.allocated {
+			count++
+		}
+	}
+	return count
+}
+
+func (bd *SparseBlockDevice) GetDeviceType() pkg.DeviceType {
+	return DeviceTypeSparseBlock
+}
+
+func (bd *SparseBlockDevice) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !bd.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return bd.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *SparseBlockDevice) IsOpen() bool {
+	return bd.file != nil
+}
+
+func (bd *SparseBlockDevice) IsWriteProtected() bool {
+	return bd.writeProtected
+}
+
+func (bd *SparseBlockDevice) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if bd.IsOpen() {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	flags := os.O_RDWR
+	if writeProtected {
+		flags = os.O_RDONLY
+	} else if writeThrough {
+		flags |= os.O_SYNC
+	}
+
+	file, err := os.OpenFile(bd.fileName, flags, 0644)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	header := make([]byte, sparseHeaderSize)
+	_, err = file.ReadAt(header, 0)
+	if err != nil {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	if string(header[:8]) != sparseIdentifier {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusInvalidIdentifierConstant, nil}
+	}
+
+	bd.geometry = BlockGeometry{
+		label:          strings.TrimRight(string(header[8:16]), "\x00"),
+		wordsPerBlock:  pkg.BlockSize(binary.BigEndian.Uint64(header[16:])),
+		blockCount:     pkg.BlockCount(binary.BigEndian.Uint64(header[24:])),
+		blocksPerTrack: pkg.BlockCount(binary.BigEndian.Uint64(header[32:])),
+	}
+	bd.geometry.bytesPerBlock = bd.geometry.wordsPerBlock * 8
+
+	err = bd.readIndex(file)
+	if err != nil {
+		_ = file.Close()
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	bd.file = file
+	bd.writeProtected = writeProtected
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (bd *SparseBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	wordsPerBlock := int(bd.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, len(buffer), wordsPerBlock, bd.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	for bx := 0; bx < int(blockCount); bx++ {
+		err := bd.readBlock(blockId+pkg.BlockId(bx), buffer[bx*wordsPerBlock:(bx+1)*wordsPerBlock])
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// ReleaseBlocks frees the space held by the indicated blocks, which subsequently read as zeroes
+func (bd *SparseBlockDevice) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	for bx := pkg.BlockCount(0); bx < blockCount; bx++ {
+		bid := blockId + pkg.BlockId(bx)
+		if bd.index[bid].allocated || bd.index[bid].offset != 0 {
+			bd.freeSpace(bid)
+			bd.index[bid] = sparseIndexEntry{}
+			err := bd.writeIndexEntry(bid)
+			if err != nil {
+				return DeviceResult{DeviceStatusSystemError, err}
+			}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// WriteBlocks writes the indicated blocks, which thereby become allocated if they were not already
+func (bd *SparseBlockDevice) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
+	res := bd.checkUpdate(blockId, blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	wordsPerBlock := int(bd.geometry.wordsPerBlock)
+	if len(buffer) != int(blockCount)*wordsPerBlock {
+		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
+	}
+
+	for bx := 0; bx < int(blockCount); bx++ {
+		err := bd.writeBlock(blockId+pkg.BlockId(bx), buffer[bx*wordsPerBlock:(bx+1)*wordsPerBlock])
+		if err != nil {
+			return DeviceResult{DeviceStatusSystemError, err}
+		}
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// checkUpdate verifies that an allocate, release, or write request may proceed. The mutex must be held.
+func (bd *SparseBlockDevice) checkUpdate(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	if !bd.IsOpen() {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	if bd.IsWriteProtected() {
+		return DeviceResult{DeviceStatusWriteProtected, nil}
+	}
+
+	return checkBlockRange(blockId, blockCount, -1, 0, bd.geometry.blockCount)
+}
+
+// claimSpace finds room for the given number of bytes of block data, reusing freed space where possible
+func (bd *SparseBlockDevice) claimSpace(length uint32) (int64, uint32) {
+	capacity := (length + sparseSpaceGranule - 1) / sparseSpaceGranule * sparseSpaceGranule
+	for fx, extent := range bd.freeExtents {
+		if extent.length >= capacity {
+			offset := extent.offset
+			if extent.length == capacity {
+				bd.freeExtents = append(bd.freeExtents[:fx], bd.freeExtents[fx+1:]...)
+			} else {
+				bd.freeExtents[fx] = sparseExtent{extent.offset + int64(capacity), extent.length - capacity}
+			}
+			return offset, capacity
+		}
+	}
+
+	offset := bd.fileLimit
+	bd.fileLimit += int64(capacity)
+	return offset, capacity
+}
+
+// freeSpace returns the space held by a block's data to the free list, merging it with any adjacent free space
+func (bd *SparseBlockDevice) freeSpace(blockId pkg.BlockId) {
+	entry := bd.index[blockId]
+	if entry.offset == 0 {
+		return
+	}
+
+	fx := sort.Search(len(bd.freeExtents), func(i int) bool {
+		return bd.freeExtents[i].offset > entry.offset
+	})
+	extent := sparseExtent{entry.offset, entry.capacity}
+	if fx < len(bd.freeExtents) && extent.offset+int64(extent.length) == bd.freeExtents[fx].offset {
+		extent.length += bd.freeExtents[fx].length
+		bd.freeExtents = append(bd.freeExtents[:fx], bd.freeExtents[fx+1:]...)
+	}
+	if fx > 0 && bd.freeExtents[fx-1].offset+int64(bd.freeExtents[fx-1].length) == extent.offset {
+		bd.freeExtents[fx-1].length += extent.length
+		return
+	}
+	bd.freeExtents = append(bd.freeExtents, sparseExtent{})
+	copy(bd.freeExtents[fx+1:], bd.freeExtents[fx:])
+	bd.freeExtents[fx] = extent
+}
+
+func (bd *SparseBlockDevice) readBlock(blockId pkg.BlockId, buffer []pkg2.Word36) error {
+	entry := bd.index[blockId]
+	if entry.offset == 0 {
+		for wx := range buffer {
+			buffer[wx] = 0
+		}
+		return nil
+	}
+
+	compressed := make([]byte, entry.length)
+	_, err := bd.file.ReadAt(compressed, entry.offset)
+	if err != nil {
+		return err
+	}
+
+	raw := make([]byte, len(buffer)*8)
+	_, err = io.ReadFull(flate.NewReader(bytes.NewReader(compressed)), raw)
+	if err != nil {
+		return fmt.Errorf("block %v is corrupt: %v", blockId, err)
+	}
+
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(binary.BigEndian.Uint64(raw[wx*8:]))
+	}
+	return nil
+}
+
+// readIndex loads the block index, and derives the free space from the gaps between the blocks' data
+func (bd *SparseBlockDevice) readIndex(file *os.File) error {
+	raw := make([]byte, int(bd.geometry.blockCount)*sparseIndexEntrySize)
+	_, err := file.ReadAt(raw, sparseHeaderSize)
+	if err != nil {
+		return err
+	}
+
+	bd.index = make([]sparseIndexEntry, bd.geometry.blockCount)
+	used := make([]sparseExtent, 0)
+	for bx := range bd.index {
+		entryBytes := raw[bx*sparseIndexEntrySize:]
+		length := binary.BigEndian.Uint32(entryBytes[8:])
+		entry := sparseIndexEntry{
+			offset:    int64(binary.BigEndian.Uint64(entryBytes)),
+			length:    length &^ sparseAllocatedFlag,
+			capacity:  binary.BigEndian.Uint32(entryBytes[12:]),
+			allocated: length&sparseAllocatedFlag != 0,
+		}
+		bd.index[bx] = entry
+		if entry.offset != 0 {
+			used = append(used, sparseExtent{entry.offset, entry.capacity})
+		}
+	}
+
+	sort.Slice(used, func(i, j int) bool {
+		return used[i].offset < used[j].offset
+	})
+
+	bd.freeExtents = make([]sparseExtent, 0)
+	bd.fileLimit = bd.dataOffset()
+	for _, extent := range used {
+		if extent.offset > bd.fileLimit {
+			bd.freeExtents = append(bd.freeExtents, sparseExtent{bd.fileLimit, uint32(extent.offset - bd.fileLimit)})
+		}
+		bd.fileLimit = extent.offset + int64(extent.length)
+	}
+
+	return nil
+}
+
+func (bd *SparseBlockDevice) dataOffset() int64 {
+	return sparseDataOffset(bd.geometry.blockCount)
+}
+
+func (bd *SparseBlockDevice) writeBlock(blockId pkg.BlockId, buffer []pkg2.Word36) error {
+	entry := &bd.index[blockId]
+	entry.allocated = true
+
+	if isZeroBlock(buffer) {
+		bd.freeSpace(blockId)
+		entry.offset = 0
+		entry.length = 0
+		entry.capacity = 0
+		return bd.writeIndexEntry(blockId)
+	}
+
+	raw := make([]byte, len(buffer)*8)
+	for wx, word := range buffer {
+		binary.BigEndian.PutUint64(raw[wx*8:], uint64(word))
+	}
+
+	compressed := bytes.Buffer{}
+	writer, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	_, _ = writer.Write(raw)
+	_ = writer.Close()
+
+	length := uint32(compressed.Len())
+	if entry.offset == 0 || length > entry.capacity {
+		bd.freeSpace(blockId)
+		entry.offset, entry.capacity = bd.claimSpace(length)
+	}
+	entry.length = length
+
+	//	The data is written before the index entry which refers to it
+	_, err := bd.file.WriteAt(compressed.Bytes(), entry.offset)
+	if err != nil {
+		return err
+	}
+	return bd.writeIndexEntry(blockId)
+}
+
+func (bd *SparseBlockDevice) writeIndexEntry(blockId pkg.BlockId) error {
+	entry := bd.index[blockId]
+	raw := make([]byte, sparseIndexEntrySize)
+	length := entry.length
+	if entry.allocated {
+		length |= sparseAllocatedFlag
+	}
+
+	binary.BigEndian.PutUint64(raw, uint64(entry.offset))
+	binary.BigEndian.PutUint32(raw[8:], length)
+	binary.BigEndian.PutUint32(raw[12:], entry.capacity)
+	_, err := bd.file.WriteAt(raw, sparseHeaderSize+int64(blockId)*sparseIndexEntrySize)
+	return err
+}
+
+func sparseDataOffset(blockCount pkg.BlockCount) int64 {
+	limit := sparseHeaderSize + int64(blockCount)*sparseIndexEntrySize
+	return (limit + sparseSpaceGranule - 1) / sparseSpaceGranule * sparseSpaceGranule
+}
+
+// CreateSparseBlockDevice creates the file for an empty sparse block device.
+// blocksPerTrack is derived from wordsPerBlock, as for the other devices.
+func CreateSparseBlockDevice(fileName string, label string, wordsPerBlock pkg.BlockSize, blockCount pkg.BlockCount) DeviceResult {
+	if !IsLabelValid(label) || len(label) > 8 {
+		return DeviceResult{DeviceStatusInvalidLabel, nil}
+	}
+
+	if !IsWordsPerBlockValid(wordsPerBlock) {
+		return DeviceResult{DeviceStatusInvalidBlockSize, nil}
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	header := make([]byte, sparseHeaderSize)
+	copy(header, sparseIdentifier)
+	copy(header[8:16], label)
+	binary.BigEndian.PutUint64(header[16:], uint64(wordsPerBlock))
+	binary.BigEndian.PutUint64(header[24:], uint64(blockCount))
+	binary.BigEndian.PutUint64(header[32:], uint64(1792/wordsPerBlock))
+	_, err = file.WriteAt(header, 0)
+	if err == nil {
+		//	The index is all zeroes, so we need only establish the size of the file
+		err = file.Truncate(sparseDataOffset(blockCount))
+	}
+
+	if err != nil {
+		return DeviceResult{DeviceStatusSystemError, err}
+	}
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func NewSparseBlockDevice(fileName string) *SparseBlockDevice {
+	return &SparseBlockDevice{
+		fileName: fileName,
+	}
+}
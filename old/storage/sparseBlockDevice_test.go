@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func newSparseTestDevice(t *testing.T, blockCount pkg.BlockCount) (*SparseBlockDevice, string) {
+	fileName := filepath.Join(t.TempDir(), "test.sparse")
+	if res := CreateSparseBlockDevice(fileName, "SPARSE", 1792, blockCount); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error creating sparse device: %v", res)
+	}
+
+	bd := NewSparseBlockDevice(fileName)
+	if res := bd.Open(false, false); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error opening sparse device: %v", res)
+	}
+	return bd, fileName
+}
+
+func Test_SparseBlockDevice_Geometry(t *testing.T) {
+	bd, _ := newSparseTestDevice(t, 1000)
+	defer bd.Close()
+
+	geo, _ := bd.GetGeometry()
+	if geo.label != "SPARSE" || geo.wordsPerBlock != 1792 || geo.blockCount != 1000 || geo.blocksPerTrack != 1 {
+		t.Errorf("Error unexpected geometry %+v", geo)
+	}
+	if bd.GetDeviceType() != DeviceTypeSparseBlock {
+		t.Errorf("Error unexpected device type %03o", bd.GetDeviceType())
+	}
+}
+
+func Test_SparseBlockDevice_ReadWrite(t *testing.T) {
+	bd, fileName := newSparseTestDevice(t, 1000)
+
+	buffer := make([]pkg2.Word36, 3*1792)
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(wx % 7)
+	}
+	if res := bd.WriteBlocks(500, 3, buffer); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error writing: %v", res)
+	}
+
+	//	unwritten blocks read as zeroes, and the written blocks survive a reopen
+	bd.Close()
+	bd.Open(true, false)
+	result := make([]pkg2.Word36, 5*1792)
+	result[0] = 0777
+	if res := bd.ReadBlocks(499, 5, result); res.status != DeviceStatusSuccessful {
+		t.Fatalf("Error reading: %v", res)
+	}
+	for wx := range result {
+		expected := pkg2.Word36(0)
+		if wx >= 1792 && wx < 4*1792 {
+			expected = buffer[wx-1792]
+		}
+		if result[wx] != expected {
+			t.Fatalf("Error word %d expected %d, got %d", wx, expected, result[wx])
+		}
+	}
+
+	if res := bd.WriteBlocks(0, 1, buffer[:1792]); res.status != DeviceStatusWriteProtected {
+		t.Errorf("Error expected write protected, got %v", res)
+	}
+	if res := bd.ReadBlocks(999, 2, make([]pkg2.Word36, 2*1792)); res.status != DeviceStatusMaxBlocksExceeded {
+		t.Errorf("Error expected max blocks exceeded, got %v", res)
+	}
+	bd.Close()
+
+	//	three compressible blocks take far less space than the blocks themselves
+	fi, _ := os.Stat(fileName)
+	if fi.Size() >= sparseDataOffset(1000)+3*1792*8 {
+		t.Errorf("Error file is unexpectedly large: %d", fi.Size())
+	}
+}
+
+func Test_SparseBlockDevice_AllocateRelease(t *testing.T) {
+	bd, _ := newSparseTestDevice(t, 100)
+	defer bd.Close()
+
+	bd.AllocateBlocks(10, 5)
+	buffer := make([]pkg2.Word36, 1792)
+	buffer[0] = 0777
+	bd.WriteBlocks(50, 1, buffer)
+	if count := bd.GetAllocatedBlockCount(); count != 6 {
+		t.Errorf("Error expected 6 allocated blocks, got %d", count)
+	}
+
+	bd.ReleaseBlocks(12, 40)
+	if count := bd.GetAllocatedBlockCount(); count != 2 {
+		t.Errorf("Error expected 2 allocated blocks, got %d", count)
+	}
+
+	bd.ReadBlocks(50, 1, buffer)
+	if buffer[0] != 0 {
+		t.Errorf("Error released block was not zeroed")
+	}
+}
+
+func Test_SparseBlockDevice_SpaceReuse(t *testing.T) {
+	bd, _ := newSparseTestDevice(t, 100)
+
+	buffer := make([]pkg2.Word36, 1792)
+	for wx := range buffer {
+		buffer[wx] = pkg2.Word36(wx * 0101010101)
+	}
+	for bid := pkg.BlockId(0); bid < 10; bid++ {
+		buffer[0] = pkg2.Word36(bid)
+		bd.WriteBlocks(bid, 1, buffer)
+	}
+	limit := bd.fileLimit
+
+	//	rewriting a block with data of the same size, or writing new blocks after a release, does not extend the file
+	bd.ReleaseBlocks(2, 3)
+	for bid := pkg.BlockId(4); bid < 7; bid++ {
+		buffer[0] = pkg2.Word36(bid)
+		bd.WriteBlocks(bid+6, 1, buffer)
+	}
+	buffer[0] = 5
+	bd.WriteBlocks(5, 1, buffer)
+	if bd.fileLimit != limit || len(bd.freeExtents) != 0 {
+		t.Errorf("Error unexpected space use: limit %d (expected %d), free %v", bd.fileLimit, limit, bd.freeExtents)
+	}
+
+	//	released space is merged with its neighbors, and recovered when the device is reopened
+	bd.ReleaseBlocks(5, 1)
+	bd.ReleaseBlocks(1, 1)
+	bd.ReleaseBlocks(7, 1)
+	bd.ReleaseBlocks(6, 1)
+	free := append([]sparseExtent{}, bd.freeExtents...)
+	bd.Close()
+	bd.Open(false, false)
+	defer bd.Close()
+	if bd.fileLimit != limit || len(bd.freeExtents) != 2 || bd.freeExtents[0] != free[0] || bd.freeExtents[1] != free[1] {
+		t.Errorf("Error unexpected free space after reopen: %v, expected %v", bd.freeExtents, free)
+	}
+	for bid, expected := range map[pkg.BlockId]pkg2.Word36{1: 0, 3: 0, 6: 0, 8: 8, 9: 9, 10: 4, 12: 6} {
+		bd.ReadBlocks(bid, 1, buffer)
+		if buffer[0] != expected {
+			t.Errorf("Error block %d expected %d, got %d", bid, expected, buffer[0])
+		}
+	}
+}
+
+func Test_ConvertPack_Sparse(t *testing.T) {
+	bd, fileName := newSparseTestDevice(t, 100)
+	buffer := make([]pkg2.Word36, 1792)
+	for _, bid := range []pkg.BlockId{1, 40, 99} {
+		buffer[1] = pkg2.Word36(bid)
+		bd.WriteBlocks(bid, 1, buffer)
+	}
+	bd.Close()
+
+	destName := filepath.Join(t.TempDir(), "copy.sparse")
+	if err := ConvertPack(fileName, destName, DeviceTypeSparseBlock); err != nil {
+		t.Fatalf("Error converting: %v", err)
+	}
+
+	dest := NewSparseBlockDevice(destName)
+	dest.Open(true, false)
+	defer dest.Close()
+	geo, _ := dest.GetGeometry()
+	if geo.label != "SPARSE" || geo.blockCount != 100 || geo.wordsPerBlock != 1792 {
+		t.Errorf("Error geometry not preserved: %+v", geo)
+	}
+	if count := dest.GetAllocatedBlockCount(); count != 3 {
+		t.Errorf("Error expected 3 allocated blocks, got %d", count)
+	}
+	for _, bid := range []pkg.BlockId{1, 40, 99} {
+		dest.ReadBlocks(bid, 1, buffer)
+		if buffer[1] != pkg2.Word36(bid) {
+			t.Errorf("Error block %d not copied", bid)
+		}
+	}
+
+	if err := ConvertPack(fileName, destName, DeviceTypeTemporaryBlock); err == nil {
+		t.Errorf("Error expected conversion to an unsupported type to fail")
+	}
+}
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"sync"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+type stripeMember struct {
+	device *BlockDevice
+	mutex  sync.Mutex // serializes I/O against the member
+}
+
+// stripeSet presents a set of devices as a single block device, spreading the blocks across the members
+// in stripe units of a fixed number of consecutive blocks. Unit 0 is on member 0, unit 1 on member 1,
+// and so on, wrapping around to member 0 after the last member.
+// Requests which touch more than one unit are broken up, and each member is locked only while it is
+// being accessed, so that requests against different members proceed concurrently.
+// Every member must be usable - the set provides no redundancy.
+type stripeSet struct {
+	members   []*stripeMember
+	unitCount pkg.BlockCount // blocks per stripe unit
+	geometry  BlockGeometry
+	isOpen    bool
+}
+
+func (ss *stripeSet) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	return ss.forEachUnit(blockId, blockCount, nil,
+		func(device BlockDevice, memberBlockId pkg.BlockId, memberBlockCount pkg.BlockCount, _ []pkg2.Word36) DeviceResult {
+			return device.AllocateBlocks(memberBlockId, memberBlockCount)
+		})
+}
+
+func (ss *stripeSet) Close() DeviceResult {
+	if !ss.isOpen {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	result := DeviceResult{DeviceStatusSuccessful, nil}
+	for _, member := range ss.members {
+		res := (*member.device).Close()
+		if res.status != DeviceStatusSuccessful {
+			result = res
+		}
+	}
+
+	ss.isOpen = false
+	return result
+}
+
+func (ss *stripeSet) GetDeviceType() pkg.DeviceType {
+	return DeviceTypeStripedBlock
+}
+
+func (ss *stripeSet) GetGeometry() (BlockGeometry, DeviceResult) {
+	if !ss.IsOpen() {
+		return BlockGeometry{}, DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	return ss.geometry, DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (ss *stripeSet) IsOpen() bool {
+	return ss.isOpen
+}
+
+func (ss *stripeSet) IsWriteProtected() bool {
+	return false
+}
+
+// Open opens all the members of the set, which must agree on block size.
+// Each member contributes as many whole stripe units as will fit on the smallest member.
+// The label and track geometry are taken from the first member.
+func (ss *stripeSet) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	if ss.isOpen {
+		return DeviceResult{DeviceStatusAlreadyOpen, nil}
+	}
+
+	if writeProtected {
+		return DeviceResult{DeviceStatusCannotSetWriteProtect, nil}
+	}
+
+	var geometry BlockGeometry
+	for mx, member := range ss.members {
+		res := (*member.device).Open(false, writeThrough)
+		var geo BlockGeometry
+		if res.status == DeviceStatusSuccessful {
+			geo, res = (*member.device).GetGeometry()
+		}
+		if res.status == DeviceStatusSuccessful && mx > 0 && geo.wordsPerBlock != geometry.wordsPerBlock {
+			res = DeviceResult{DeviceStatusInvalidBlockSize, nil}
+		}
+
+		if res.status != DeviceStatusSuccessful {
+			for _, member2 := range ss.members[:mx+1] {
+				_ = (*member2.device).Close()
+			}
+			return res
+		}
+
+		if mx == 0 {
+			geometry = geo
+		} else if geo.blockCount < geometry.blockCount {
+			geometry.blockCount = geo.blockCount
+		}
+	}
+
+	unitsPerMember := geometry.blockCount / ss.unitCount
+	geometry.blockCount = unitsPerMember * ss.unitCount * pkg.BlockCount(len(ss.members))
+	ss.geometry = geometry
+	ss.isOpen = true
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+func (ss *stripeSet) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	return ss.forEachUnit(blockId, blockCount, buffer,
+		func(device BlockDevice, memberBlockId pkg.BlockId, memberBlockCount pkg.BlockCount, sub []pkg2.Word36) DeviceResult {
+			return device.ReadBlocks(memberBlockId, memberBlockCount, sub)
+		})
+}
+
+func (ss *stripeSet) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	return ss.forEachUnit(blockId, blockCount, nil,
+		func(device BlockDevice, memberBlockId pkg.BlockId, memberBlockCount pkg.BlockCount, _ []pkg2.Word36) DeviceResult {
+			return device.ReleaseBlocks(memberBlockId, memberBlockCount)
+		})
+}
+
+func (ss *stripeSet) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	return ss.forEachUnit(blockId, blockCount, buffer,
+		func(device BlockDevice, memberBlockId pkg.BlockId, memberBlockCount pkg.BlockCount, sub []pkg2.Word36) DeviceResult {
+			return device.WriteBlocks(memberBlockId, memberBlockCount, sub)
+		})
+}
+
+// forEachUnit breaks a request up into pieces which each lie within a single stripe unit,
+// and applies the operation to the corresponding blocks of the member holding each unit.
+// buffer is nil for operations which do not transfer data.
+func (ss *stripeSet) forEachUnit(
+	blockId pkg.BlockId,
+	blockCount pkg.BlockCount,
+	buffer []pkg2.Word36,
+	operation func(device BlockDevice, memberBlockId pkg.BlockId, memberBlockCount pkg.BlockCount, sub []pkg2.Word36) DeviceResult,
+) DeviceResult {
+	if !ss.isOpen {
+		return DeviceResult{DeviceStatusNotOpen, nil}
+	}
+
+	bufferLength := -1
+	if buffer != nil {
+		bufferLength = len(buffer)
+	}
+	wordsPerBlock := int(ss.geometry.wordsPerBlock)
+	res := checkBlockRange(blockId, blockCount, bufferLength, wordsPerBlock, ss.geometry.blockCount)
+	if res.status != DeviceStatusSuccessful {
+		return res
+	}
+
+	memberCount := pkg.BlockId(len(ss.members))
+	unitCount := pkg.BlockId(ss.unitCount)
+	limitId := blockId + pkg.BlockId(blockCount)
+	for bid := blockId; bid < limitId; {
+		unit := bid / unitCount
+		pieceLimit := (unit + 1) * unitCount
+		if pieceLimit > limitId {
+			pieceLimit = limitId
+		}
+
+		var sub []pkg2.Word36
+		if buffer != nil {
+			sub = buffer[int(bid-blockId)*wordsPerBlock : int(pieceLimit-blockId)*wordsPerBlock]
+		}
+
+		member := ss.members[unit%memberCount]
+		memberBlockId := (unit/memberCount)*unitCount + bid%unitCount
+		member.mutex.Lock()
+		res := operation(*member.device, memberBlockId, pkg.BlockCount(pieceLimit-bid), sub)
+		member.mutex.Unlock()
+		if res.status != DeviceStatusSuccessful {
+			return res
+		}
+
+		bid = pieceLimit
+	}
+
+	return DeviceResult{DeviceStatusSuccessful, nil}
+}
+
+// StripeAggregator presents each of its device indices as a striped set of devices (RAID-0).
+// RegisterDevice adds a member to the set for the given device index.
+type StripeAggregator struct {
+	sets      map[pkg.DeviceIndex]*stripeSet
+	devices   map[pkg.DeviceIndex]*BlockDevice // each set, as a BlockDevice
+	unitCount pkg.BlockCount
+	isOpen    bool
+	pending   sync.WaitGroup
+}
+
+func (agg *StripeAggregator) Close() AggregatorResult {
+	if !agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusNotOpen, nil}
+	}
+
+	agg.pending.Wait()
+	result := AggregatorResult{AggregatorStatusSuccessful, nil}
+	for _, ss := range agg.sets {
+		res := ss.Close()
+		if res.status != DeviceStatusSuccessful {
+			result = AggregatorResult{AggregatorStatusDeviceError, &res}
+		}
+	}
+
+	agg.isOpen = false
+	return result
+}
+
+func (agg *StripeAggregator) GetDevice(deviceIndex pkg.DeviceIndex) (*BlockDevice, AggregatorResult) {
+	dev, ok := agg.devices[deviceIndex]
+	if ok {
+		return dev, AggregatorResult{AggregatorStatusSuccessful, nil}
+	} else {
+		return nil, AggregatorResult{AggregatorStatusInvalidDeviceIndex, nil}
+	}
+}
+
+func (agg *StripeAggregator) IsOpen() bool {
+	return agg.isOpen
+}
+
+func (agg *StripeAggregator) Open() AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	for _, ss := range agg.sets {
+		res := ss.Open(false, true)
+		if res.status != DeviceStatusSuccessful {
+			for _, ss2 := range agg.sets {
+				_ = ss2.Close()
+			}
+			return AggregatorResult{AggregatorStatusDeviceError, &res}
+		}
+	}
+
+	agg.isOpen = true
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+// RegisterDevice adds a member to the striped set for the given device index.
+// Members are striped in the order in which they are registered, so the order must not change
+// from one use of the set to the next.
+func (agg *StripeAggregator) RegisterDevice(deviceIndex pkg.DeviceIndex, device *BlockDevice) AggregatorResult {
+	if agg.IsOpen() {
+		return AggregatorResult{AggregatorStatusAlreadyOpen, nil}
+	}
+
+	ss, ok := agg.sets[deviceIndex]
+	if !ok {
+		ss = &stripeSet{
+			members:   make([]*stripeMember, 0),
+			unitCount: agg.unitCount,
+		}
+		var dev BlockDevice = ss
+		agg.sets[deviceIndex] = ss
+		agg.devices[deviceIndex] = &dev
+	}
+
+	ss.members = append(ss.members, &stripeMember{device: device})
+	return AggregatorResult{AggregatorStatusSuccessful, nil}
+}
+
+func (agg *StripeAggregator) StartIO(request *BlockIORequest) {
+	if !agg.IsOpen() {
+		request.complete(AggregatorStatusNotOpen, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	ss, ok := agg.sets[request.deviceIndex]
+	if !ok {
+		request.complete(AggregatorStatusInvalidDeviceIndex, DeviceResult{DeviceStatusSuccessful, nil})
+		return
+	}
+
+	request.aggregatorStatus = AggregatorStatusInProgress
+	agg.pending.Add(1)
+	go func() {
+		defer agg.pending.Done()
+		serviceBlockDeviceRequest(ss, request)
+	}()
+}
+
+// NewStripeAggregator creates a stripe aggregator.
+// unitCount is the number of consecutive blocks which are placed on one member before moving to the next.
+func NewStripeAggregator(unitCount pkg.BlockCount) *StripeAggregator {
+	if unitCount < 1 {
+		unitCount = 1
+	}
+
+	return &StripeAggregator{
+		sets:      make(map[pkg.DeviceIndex]*stripeSet),
+		devices:   make(map[pkg.DeviceIndex]*BlockDevice),
+		unitCount: unitCount,
+	}
+}
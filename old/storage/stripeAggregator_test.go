@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	pkg2 "khalehla/old/pkg"
+	"khalehla/pkg"
+)
+
+func Test_StripeAggregator_Layout(t *testing.T) {
+	agg := NewStripeAggregator(4)
+	members := make([]BlockDevice, 3)
+	for mx := range members {
+		//	the smallest member limits each member to 6 units of 4 blocks
+		tbd, _ := NewTemporaryBlockDevice("STRIPE", pkg.BlockCount(25+mx))
+		members[mx] = tbd
+		agg.RegisterDevice(1, &members[mx])
+	}
+	if ar := agg.Open(); ar.aggregatorStatus != AggregatorStatusSuccessful {
+		t.Fatalf("Error opening aggregator: %v", ar)
+	}
+	defer agg.Close()
+
+	geometry, _ := GetBlockGeometry(agg, 1)
+	if geometry.blockCount != 72 {
+		t.Fatalf("Error expected 72 blocks, got %d", geometry.blockCount)
+	}
+
+	//	blocks 2 through 13 are written - units 0 (member 0), 1 (member 1), 2 (member 2), and 3 (member 0 again)
+	buffer := make([]pkg2.Word36, 12*1792)
+	for bx := 0; bx < 12; bx++ {
+		buffer[bx*1792] = pkg2.Word36(bx + 2)
+	}
+	if req := aggregatorTestIO(agg, AggregatorFunctionWrite, 2, buffer); req.GetAggregatorStatus() != AggregatorStatusSuccessful {
+		t.Fatalf("Error writing: %d", req.GetAggregatorStatus())
+	}
+
+	expected := map[int]map[pkg.BlockId]pkg2.Word36{
+		0: {2: 2, 3: 3, 4: 12, 5: 13},
+		1: {0: 4, 3: 7},
+		2: {0: 8, 3: 11},
+	}
+	check := make([]pkg2.Word36, 1792)
+	for mx, blocks := range expected {
+		for bid, value := range blocks {
+			members[mx].ReadBlocks(bid, 1, check)
+			if check[0] != value {
+				t.Errorf("Error member %d block %d expected %d, got %d", mx, bid, value, check[0])
+			}
+		}
+	}
+
+	readBack := make([]pkg2.Word36, 12*1792)
+	aggregatorTestIO(agg, AggregatorFunctionRead, 2, readBack)
+	for bx := 0; bx < 12; bx++ {
+		if readBack[bx*1792] != pkg2.Word36(bx+2) {
+			t.Errorf("Error block %d read back incorrectly", bx+2)
+		}
+	}
+
+	req := aggregatorTestIO(agg, AggregatorFunctionRead, 70, readBack[:3*1792])
+	if req.GetDeviceStatus() != DeviceStatusMaxBlocksExceeded {
+		t.Errorf("Error expected max blocks exceeded, got %d", req.GetDeviceStatus())
+	}
+}
+
+func Test_StripeAggregator_Concurrent(t *testing.T) {
+	agg := NewStripeAggregator(2)
+	for mx := 0; mx < 4; mx++ {
+		tbd, _ := NewTemporaryBlockDevice("STRIPE", 64)
+		var bd BlockDevice = tbd
+		agg.RegisterDevice(1, &bd)
+	}
+	agg.Open()
+	defer agg.Close()
+
+	wg := sync.WaitGroup{}
+	for gx := 0; gx < 8; gx++ {
+		wg.Add(1)
+		go func(gx int) {
+			defer wg.Done()
+			buffer := make([]pkg2.Word36, 5*1792)
+			fillCacheTestBlock(buffer, uint64(gx+1))
+			bid := pkg.BlockId(gx * 30)
+			aggregatorTestIO(agg, AggregatorFunctionWrite, bid, buffer)
+			check := make([]pkg2.Word36, 5*1792)
+			aggregatorTestIO(agg, AggregatorFunctionRead, bid, check)
+			for wx := range check {
+				if check[wx] != buffer[wx] {
+					t.Errorf("Error goroutine %d read back incorrectly at word %d", gx, wx)
+					return
+				}
+			}
+		}(gx)
+	}
+	wg.Wait()
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"sync"
+
 	pkg2 "khalehla/old/pkg"
 	"khalehla/pkg"
 )
@@ -11,21 +13,29 @@ type TemporaryBlockDevice struct {
 	geometry BlockGeometry
 	storage  map[pkg.BlockId][]pkg2.Word36 // index is logical block id, value is the actual block of data
 	isOpen   bool
+	mutex    sync.RWMutex // protects storage - reads hold it shared
 }
 
 func (bd *TemporaryBlockDevice) AllocateBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
 	bid := blockId
 	for bx := pkg.BlockCount(0); bx < blockCount; bx++ {
 		_, ok := bd.storage[bid]
 		if !ok {
 			bd.storage[bid] = make([]pkg2.Word36, bd.geometry.wordsPerBlock)
 		}
+		bid++
 	}
 
 	return DeviceResult{DeviceStatusSuccessful, nil}
 }
 
 func (bd *TemporaryBlockDevice) Close() DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
 	if !bd.IsOpen() {
 		return DeviceResult{DeviceStatusNotOpen, nil}
 	}
@@ -51,6 +61,9 @@ func (bd *TemporaryBlockDevice) IsWriteProtected() bool {
 }
 
 func (bd *TemporaryBlockDevice) Open(writeProtected bool, writeThrough bool) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
 	// writeThrough is ignored - we are effectively always and never write-through.
 	if bd.IsOpen() {
 		return DeviceResult{DeviceStatusAlreadyOpen, nil}
@@ -61,6 +74,7 @@ func (bd *TemporaryBlockDevice) Open(writeProtected bool, writeThrough bool) Dev
 	}
 
 	bd.storage = make(map[pkg.BlockId][]pkg2.Word36)
+	bd.isOpen = true
 	return DeviceResult{DeviceStatusSuccessful, nil}
 }
 
@@ -76,6 +90,9 @@ func (bd *TemporaryBlockDevice) readBlock(blockId pkg.BlockId, buffer []pkg2.Wor
 }
 
 func (bd *TemporaryBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.RLock()
+	defer bd.mutex.RUnlock()
+
 	if len(buffer) != int(blockCount)*int(bd.geometry.wordsPerBlock) {
 		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
 	}
@@ -92,6 +109,9 @@ func (bd *TemporaryBlockDevice) ReadBlocks(blockId pkg.BlockId, blockCount pkg.B
 }
 
 func (bd *TemporaryBlockDevice) ReleaseBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
 	bid := blockId
 	for bx := 0; bx < int(blockCount); bx++ {
 		delete(bd.storage, bid)
@@ -112,6 +132,9 @@ func (bd *TemporaryBlockDevice) writeBlock(blockId pkg.BlockId, buffer []pkg2.Wo
 }
 
 func (bd *TemporaryBlockDevice) WriteBlocks(blockId pkg.BlockId, blockCount pkg.BlockCount, buffer []pkg2.Word36) DeviceResult {
+	bd.mutex.Lock()
+	defer bd.mutex.Unlock()
+
 	if len(buffer) != int(blockCount)*int(bd.geometry.wordsPerBlock) {
 		return DeviceResult{DeviceStatusInvalidBufferSize, nil}
 	}
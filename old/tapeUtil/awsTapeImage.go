@@ -0,0 +1,126 @@
+// khalehla Project
+// Copyright © 2023-2024 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tapeUtil
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	awsHeaderSize = 6
+	awsMaxChunk   = 0xFFFF
+
+	awsFlagNewRecord = 0x80
+	awsFlagTapeMark  = 0x40
+	awsFlagEndRecord = 0x20
+)
+
+// AwsTapeImage handles AWSTAPE tape image files.
+//
+// The image is a sequence of chunks, each of which begins with a 6-byte header:
+//
+//	+0 16-bit little-endian length of this chunk's data
+//	+2 16-bit little-endian length of the previous chunk's data (zero for the first chunk)
+//	+4 flags: 0x80 first chunk of a record, 0x20 last chunk of a record, 0x40 tape mark
+//	+5 zero
+//
+// A data record is one or more chunks, so that records longer than 65535 bytes may be stored.
+// A tape mark is a chunk with no data.
+//
+// There is no means of recording bad data, erase gaps, or end of medium. Bad data is written as good data,
+// while erase gaps and end of medium are dropped (the end of the file is the end of the medium).
+type AwsTapeImage struct {
+	tapeImageFile
+	previousLength uint16
+}
+
+func NewAwsTapeImage() *AwsTapeImage {
+	return &AwsTapeImage{}
+}
+
+func (img *AwsTapeImage) ReadRecord() (record *TapeRecord, err error) {
+	var data []byte
+	for {
+		var header []byte
+		if data == nil {
+			header, err = img.readBytes(awsHeaderSize)
+		} else {
+			header, err = img.readRemainder(awsHeaderSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		length := int(binary.LittleEndian.Uint16(header))
+		flags := header[4]
+		if flags&awsFlagTapeMark != 0 {
+			if data != nil {
+				return nil, fmt.Errorf("tape mark found within a data record")
+			}
+			return NewTapeRecord(TapeRecordTapeMark, nil), nil
+		}
+
+		if flags&awsFlagNewRecord != 0 {
+			if data != nil {
+				return nil, fmt.Errorf("new record found within a data record")
+			}
+			data = make([]byte, 0, length)
+		} else if data == nil {
+			return nil, fmt.Errorf("data record continuation found outside of a data record")
+		}
+
+		chunk, err := img.readRemainder(length)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, chunk...)
+		if flags&awsFlagEndRecord != 0 {
+			return NewTapeRecord(TapeRecordData, data), nil
+		}
+	}
+}
+
+func (img *AwsTapeImage) WriteRecord(record *TapeRecord) error {
+	switch record.recordType {
+	case TapeRecordData, TapeRecordBadData:
+		remaining := record.data
+		flags := byte(awsFlagNewRecord)
+		for {
+			length := len(remaining)
+			last := length <= awsMaxChunk
+			if last {
+				flags |= awsFlagEndRecord
+			} else {
+				length = awsMaxChunk
+			}
+
+			err := img.writeChunk(remaining[:length], flags)
+			if err != nil || last {
+				return err
+			}
+
+			remaining = remaining[length:]
+			flags = 0
+		}
+
+	case TapeRecordTapeMark:
+		return img.writeChunk(nil, awsFlagTapeMark)
+	}
+
+	return nil
+}
+
+func (img *AwsTapeImage) writeChunk(data []byte, flags byte) error {
+	bytes := make([]byte, awsHeaderSize+len(data))
+	binary.LittleEndian.PutUint16(bytes, uint16(len(data)))
+	binary.LittleEndian.PutUint16(bytes[2:], img.previousLength)
+	bytes[4] = flags
+	copy(bytes[awsHeaderSize:], data)
+
+	img.previousLength = uint16(len(data))
+	return img.writeBytes(bytes)
+}
@@ -0,0 +1,77 @@
+// khalehla Project
+// Copyright © 2023-2024 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tapeUtil
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const nativeTapeMark = 0xFFFFFFFF
+
+// NativeTapeImage handles the tape volume files used by the file-system tape device.
+//
+// A data record is formatted as
+//   - 32-bit big-endian length of the payload (0 to 0xFFFFFFFE bytes)
+//   - the payload
+//   - 32-bit big-endian length of the payload again
+//
+// A tape mark is a single 32-bit 0xFFFFFFFF.
+//
+// There is no means of recording bad data, erase gaps, or end of medium. Bad data is written as good data,
+// while erase gaps and end of medium are dropped (the end of the file is the end of the medium).
+type NativeTapeImage struct {
+	tapeImageFile
+}
+
+func NewNativeTapeImage() *NativeTapeImage {
+	return &NativeTapeImage{}
+}
+
+func (img *NativeTapeImage) ReadRecord() (record *TapeRecord, err error) {
+	header, err := img.readBytes(4)
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length == nativeTapeMark {
+		return NewTapeRecord(TapeRecordTapeMark, nil), nil
+	}
+
+	data, err := img.readRemainder(int(length) + 4)
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := binary.BigEndian.Uint32(data[length:])
+	if trailer != length {
+		return nil, fmt.Errorf("record length %v does not match trailing length %v", length, trailer)
+	}
+
+	return NewTapeRecord(TapeRecordData, data[:length]), nil
+}
+
+func (img *NativeTapeImage) WriteRecord(record *TapeRecord) error {
+	switch record.recordType {
+	case TapeRecordData, TapeRecordBadData:
+		if uint64(len(record.data)) >= nativeTapeMark {
+			return fmt.Errorf("record of %v bytes is too long", len(record.data))
+		}
+
+		bytes := make([]byte, len(record.data)+8)
+		binary.BigEndian.PutUint32(bytes, uint32(len(record.data)))
+		copy(bytes[4:], record.data)
+		binary.BigEndian.PutUint32(bytes[4+len(record.data):], uint32(len(record.data)))
+		return img.writeBytes(bytes)
+
+	case TapeRecordTapeMark:
+		bytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(bytes, nativeTapeMark)
+		return img.writeBytes(bytes)
+	}
+
+	return nil
+}
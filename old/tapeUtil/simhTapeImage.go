@@ -0,0 +1,121 @@
+// khalehla Project
+// Copyright © 2023-2024 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tapeUtil
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	simhTapeMark    = 0x00000000
+	simhEraseGap    = 0xFFFFFFFE
+	simhHalfGap     = 0xFFFEFFFF
+	simhEndOfMedium = 0xFFFFFFFF
+
+	simhClassMask   = 0xF0000000
+	simhLengthMask  = 0x0FFFFFFF
+	simhClassGood   = 0x00000000
+	simhClassBad    = 0x80000000
+	simhClassMarker = 0xF0000000
+)
+
+// SimhTapeImage handles SIMH .tap tape image files.
+//
+// Every item begins with a 32-bit little-endian metadata word, whose top four bits give its class:
+//   - class 0 is a good data record, and class 8 a bad data record. The rest of the word is the length
+//     of the payload, which follows, padded with a zero byte to an even length, and then the metadata word again.
+//     A bad data record holds whatever data was recovered, which might be none.
+//   - 0x00000000 is a tape mark (so a good data record cannot be empty)
+//   - 0xFFFFFFFE is an erase gap. 0xFFFEFFFF (a half gap, left where a gap was partially overwritten)
+//     is read as an erase gap, and never written.
+//   - 0xFFFFFFFF is end of medium
+//
+// The private and reserved classes are rejected.
+type SimhTapeImage struct {
+	tapeImageFile
+}
+
+func NewSimhTapeImage() *SimhTapeImage {
+	return &SimhTapeImage{}
+}
+
+func (img *SimhTapeImage) ReadRecord() (record *TapeRecord, err error) {
+	header, err := img.readBytes(4)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := binary.LittleEndian.Uint32(header)
+	switch {
+	case metadata == simhTapeMark:
+		return NewTapeRecord(TapeRecordTapeMark, nil), nil
+	case metadata == simhEraseGap || metadata == simhHalfGap:
+		return NewTapeRecord(TapeRecordEraseGap, nil), nil
+	case metadata == simhEndOfMedium:
+		return NewTapeRecord(TapeRecordEndOfMedium, nil), nil
+	}
+
+	var recordType TapeRecordType
+	switch metadata & simhClassMask {
+	case simhClassGood:
+		recordType = TapeRecordData
+	case simhClassBad:
+		recordType = TapeRecordBadData
+	default:
+		return nil, fmt.Errorf("unsupported SIMH metadata %08X", metadata)
+	}
+
+	length := int(metadata & simhLengthMask)
+	padded := length + length%2
+	data, err := img.readRemainder(padded + 4)
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := binary.LittleEndian.Uint32(data[padded:])
+	if trailer != metadata {
+		return nil, fmt.Errorf("record metadata %08X does not match trailing metadata %08X", metadata, trailer)
+	}
+
+	return NewTapeRecord(recordType, data[:length]), nil
+}
+
+func (img *SimhTapeImage) WriteRecord(record *TapeRecord) error {
+	var metadata uint32
+	switch record.recordType {
+	case TapeRecordData, TapeRecordBadData:
+		if len(record.data) > simhLengthMask {
+			return fmt.Errorf("record of %v bytes is too long", len(record.data))
+		}
+
+		metadata = uint32(len(record.data))
+		if record.recordType == TapeRecordBadData {
+			metadata |= simhClassBad
+		} else if metadata == 0 {
+			return fmt.Errorf("SIMH images cannot contain an empty data record")
+		}
+
+		padded := len(record.data) + len(record.data)%2
+		bytes := make([]byte, padded+8)
+		binary.LittleEndian.PutUint32(bytes, metadata)
+		copy(bytes[4:], record.data)
+		binary.LittleEndian.PutUint32(bytes[4+padded:], metadata)
+		return img.writeBytes(bytes)
+
+	case TapeRecordTapeMark:
+		metadata = simhTapeMark
+	case TapeRecordEraseGap:
+		metadata = simhEraseGap
+	case TapeRecordEndOfMedium:
+		metadata = simhEndOfMedium
+	default:
+		return fmt.Errorf("unknown record type %v", record.recordType)
+	}
+
+	bytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bytes, metadata)
+	return img.writeBytes(bytes)
+}
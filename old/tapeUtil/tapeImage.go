@@ -0,0 +1,251 @@
+// khalehla Project
+// Copyright © 2023-2024 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tapeUtil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Tape images are sequences of records, as they were found on (or are to be written to) a physical tape.
+// Unlike TapeReader and TapeWriter, which deal in blocks of words, tape images deal in bytes, so that a record
+// of any length (including an odd number of bytes) survives conversion from one image format to another.
+
+type TapeRecordType int
+
+const (
+	// TapeRecordData is a data record
+	TapeRecordData TapeRecordType = iota
+	// TapeRecordBadData is a data record which the drive could not read (or write) cleanly - the data is whatever
+	// was recovered, and might be empty
+	TapeRecordBadData
+	// TapeRecordTapeMark is a tape mark
+	TapeRecordTapeMark
+	// TapeRecordEraseGap is a stretch of erased tape
+	TapeRecordEraseGap
+	// TapeRecordEndOfMedium indicates that nothing further is recorded on the tape
+	TapeRecordEndOfMedium
+)
+
+var TapeRecordTypeTable = map[TapeRecordType]string{
+	TapeRecordData:        "Data",
+	TapeRecordBadData:     "BadData",
+	TapeRecordTapeMark:    "TapeMark",
+	TapeRecordEraseGap:    "EraseGap",
+	TapeRecordEndOfMedium: "EndOfMedium",
+}
+
+type TapeRecord struct {
+	recordType TapeRecordType
+	data       []byte
+}
+
+func NewTapeRecord(recordType TapeRecordType, data []byte) *TapeRecord {
+	return &TapeRecord{
+		recordType: recordType,
+		data:       data,
+	}
+}
+
+func (rec *TapeRecord) GetData() []byte {
+	return rec.data
+}
+
+func (rec *TapeRecord) GetRecordType() TapeRecordType {
+	return rec.recordType
+}
+
+// TapeImageReader reads the records of a tape image in order.
+// ReadRecord returns io.EOF when the end of the image file is reached.
+type TapeImageReader interface {
+	Close() error
+	OpenInputFile(fileName string) error
+	ReadRecord() (record *TapeRecord, err error)
+}
+
+// TapeImageWriter writes records to a tape image.
+// Writers which cannot represent a particular record type drop it (erase gaps, end of medium)
+// or write the closest thing they can (bad data is written as good data).
+type TapeImageWriter interface {
+	Close() error
+	OpenOutputFile(fileName string) error
+	WriteRecord(record *TapeRecord) error
+}
+
+// tapeImageFile implements the file handling which the tape image formats have in common.
+// Images are read and written strictly sequentially.
+type tapeImageFile struct {
+	file   *os.File
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func (tif *tapeImageFile) Close() error {
+	if tif.file == nil {
+		return fmt.Errorf("file is not open")
+	}
+
+	var err error
+	if tif.writer != nil {
+		err = tif.writer.Flush()
+	}
+
+	closeErr := tif.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	tif.file = nil
+	tif.reader = nil
+	tif.writer = nil
+	return err
+}
+
+func (tif *tapeImageFile) OpenInputFile(fileName string) error {
+	if tif.file != nil {
+		return fmt.Errorf("file is already open")
+	}
+
+	file, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	tif.file = file
+	tif.reader = bufio.NewReader(file)
+	return nil
+}
+
+func (tif *tapeImageFile) OpenOutputFile(fileName string) error {
+	if tif.file != nil {
+		return fmt.Errorf("file is already open")
+	}
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	tif.file = file
+	tif.writer = bufio.NewWriter(file)
+	return nil
+}
+
+// readBytes reads exactly count bytes. It returns io.EOF only if the image ends before the first of them,
+// so that callers reading a record header can tell a clean end of image from a truncated record.
+func (tif *tapeImageFile) readBytes(count int) ([]byte, error) {
+	if tif.reader == nil {
+		return nil, fmt.Errorf("file is not open for input")
+	}
+
+	bytes := make([]byte, count)
+	_, err := io.ReadFull(tif.reader, bytes)
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// readRemainder reads exactly count bytes which must be present, as they are part of a record already begun
+func (tif *tapeImageFile) readRemainder(count int) ([]byte, error) {
+	bytes, err := tif.readBytes(count)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return bytes, err
+}
+
+func (tif *tapeImageFile) writeBytes(bytes []byte) error {
+	if tif.writer == nil {
+		return fmt.Errorf("file is not open for output")
+	}
+
+	_, err := tif.writer.Write(bytes)
+	return err
+}
+
+// TapeImageStatistics counts the records which were copied by CopyTapeImage
+type TapeImageStatistics struct {
+	dataRecords    uint64
+	badDataRecords uint64
+	tapeMarks      uint64
+	eraseGaps      uint64
+	dataBytes      uint64
+}
+
+func (stats *TapeImageStatistics) String() string {
+	return fmt.Sprintf("%v data records (%v in error) %v bytes, %v tape marks, %v erase gaps",
+		stats.dataRecords+stats.badDataRecords,
+		stats.badDataRecords,
+		stats.dataBytes,
+		stats.tapeMarks,
+		stats.eraseGaps)
+}
+
+// CopyTapeImage copies every record from the reader to the writer, in order,
+// up to the end of the input image or to an end-of-medium record (which is itself copied).
+func CopyTapeImage(reader TapeImageReader, writer TapeImageWriter) (stats *TapeImageStatistics, err error) {
+	stats = &TapeImageStatistics{}
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			return stats, err
+		}
+
+		switch record.recordType {
+		case TapeRecordData:
+			stats.dataRecords++
+			stats.dataBytes += uint64(len(record.data))
+		case TapeRecordBadData:
+			stats.badDataRecords++
+			stats.dataBytes += uint64(len(record.data))
+		case TapeRecordTapeMark:
+			stats.tapeMarks++
+		case TapeRecordEraseGap:
+			stats.eraseGaps++
+		case TapeRecordEndOfMedium:
+			return stats, nil
+		}
+	}
+}
+
+// ConvertTapeImage copies the tape image in inputFileName to a new image in outputFileName.
+// The new image is removed if the conversion fails.
+func ConvertTapeImage(
+	reader TapeImageReader,
+	inputFileName string,
+	writer TapeImageWriter,
+	outputFileName string,
+) (stats *TapeImageStatistics, err error) {
+	err = reader.OpenInputFile(inputFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	err = writer.OpenOutputFile(outputFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err = CopyTapeImage(reader, writer)
+	closeErr := writer.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(outputFileName)
+	}
+	return stats, err
+}
@@ -0,0 +1,197 @@
+// khalehla Project
+// Copyright © 2023-2024 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tapeUtil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTestRecords() []*TapeRecord {
+	long := make([]byte, 150000)
+	for bx := range long {
+		long[bx] = byte(bx * 7)
+	}
+
+	return []*TapeRecord{
+		NewTapeRecord(TapeRecordData, []byte("VOL1 HDR")),
+		NewTapeRecord(TapeRecordData, []byte("odd")),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+		NewTapeRecord(TapeRecordData, long),
+		NewTapeRecord(TapeRecordData, make([]byte, awsMaxChunk)),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+	}
+}
+
+func writeTestImage(t *testing.T, writer TapeImageWriter, fileName string, records []*TapeRecord) {
+	err := writer.OpenOutputFile(fileName)
+	if err != nil {
+		t.Fatalf("OpenOutputFile: %v", err)
+	}
+
+	for _, record := range records {
+		err = writer.WriteRecord(record)
+		if err != nil {
+			t.Fatalf("WriteRecord: %v", err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func readTestImage(t *testing.T, reader TapeImageReader, fileName string) []*TapeRecord {
+	err := reader.OpenInputFile(fileName)
+	if err != nil {
+		t.Fatalf("OpenInputFile: %v", err)
+	}
+	defer reader.Close()
+
+	records := make([]*TapeRecord, 0)
+	for {
+		record, err := reader.ReadRecord()
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func compareTestRecords(t *testing.T, expected []*TapeRecord, actual []*TapeRecord) {
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %v records, got %v", len(expected), len(actual))
+	}
+
+	for rx := range expected {
+		if actual[rx].recordType != expected[rx].recordType {
+			t.Fatalf("Record %v: expected type %v, got %v",
+				rx, TapeRecordTypeTable[expected[rx].recordType], TapeRecordTypeTable[actual[rx].recordType])
+		}
+		if !bytes.Equal(actual[rx].data, expected[rx].data) {
+			t.Fatalf("Record %v: data does not match", rx)
+		}
+	}
+}
+
+func Test_TapeImage_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	records := makeTestRecords()
+
+	images := map[string]func() (TapeImageReader, TapeImageWriter){
+		"native": func() (TapeImageReader, TapeImageWriter) { return NewNativeTapeImage(), NewNativeTapeImage() },
+		"simh":   func() (TapeImageReader, TapeImageWriter) { return NewSimhTapeImage(), NewSimhTapeImage() },
+		"aws":    func() (TapeImageReader, TapeImageWriter) { return NewAwsTapeImage(), NewAwsTapeImage() },
+	}
+
+	for name, newImage := range images {
+		fileName := filepath.Join(dir, name)
+		reader, writer := newImage()
+		writeTestImage(t, writer, fileName, records)
+		compareTestRecords(t, records, readTestImage(t, reader, fileName))
+	}
+}
+
+func Test_TapeImage_SimhMarkers(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "simh")
+	records := []*TapeRecord{
+		NewTapeRecord(TapeRecordData, []byte("abc")),
+		NewTapeRecord(TapeRecordEraseGap, nil),
+		NewTapeRecord(TapeRecordBadData, []byte("xy")),
+		NewTapeRecord(TapeRecordBadData, []byte{}),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+		NewTapeRecord(TapeRecordEndOfMedium, nil),
+	}
+
+	writeTestImage(t, NewSimhTapeImage(), fileName, records)
+
+	expected := []byte{
+		0x03, 0x00, 0x00, 0x00, 'a', 'b', 'c', 0x00, 0x03, 0x00, 0x00, 0x00,
+		0xFE, 0xFF, 0xFF, 0xFF,
+		0x02, 0x00, 0x00, 0x80, 'x', 'y', 0x02, 0x00, 0x00, 0x80,
+		0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x80,
+		0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	actual, _ := os.ReadFile(fileName)
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("Expected\n%v\ngot\n%v", expected, actual)
+	}
+
+	compareTestRecords(t, records, readTestImage(t, NewSimhTapeImage(), fileName))
+}
+
+func Test_TapeImage_SimhRejectsEmptyRecord(t *testing.T) {
+	img := NewSimhTapeImage()
+	err := img.OpenOutputFile(filepath.Join(t.TempDir(), "simh"))
+	if err != nil {
+		t.Fatalf("OpenOutputFile: %v", err)
+	}
+	defer img.Close()
+
+	err = img.WriteRecord(NewTapeRecord(TapeRecordData, []byte{}))
+	if err == nil {
+		t.Fatalf("Expected an error writing an empty good data record")
+	}
+}
+
+func Test_TapeImage_ImportExport(t *testing.T) {
+	dir := t.TempDir()
+	simhName := filepath.Join(dir, "in.tap")
+	nativeName := filepath.Join(dir, "volume")
+	awsName := filepath.Join(dir, "out.aws")
+
+	writeTestImage(t, NewSimhTapeImage(), simhName, []*TapeRecord{
+		NewTapeRecord(TapeRecordData, []byte("HDR1")),
+		NewTapeRecord(TapeRecordEraseGap, nil),
+		NewTapeRecord(TapeRecordBadData, []byte("damaged")),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+		NewTapeRecord(TapeRecordEndOfMedium, nil),
+		NewTapeRecord(TapeRecordData, []byte("beyond the end")),
+	})
+
+	err := DoImportSimh([]string{simhName, nativeName})
+	if err != nil {
+		t.Fatalf("DoImportSimh: %v", err)
+	}
+
+	err = DoExportAws([]string{nativeName, awsName})
+	if err != nil {
+		t.Fatalf("DoExportAws: %v", err)
+	}
+
+	expected := []*TapeRecord{
+		NewTapeRecord(TapeRecordData, []byte("HDR1")),
+		NewTapeRecord(TapeRecordData, []byte("damaged")),
+		NewTapeRecord(TapeRecordTapeMark, nil),
+	}
+	compareTestRecords(t, expected, readTestImage(t, NewNativeTapeImage(), nativeName))
+	compareTestRecords(t, expected, readTestImage(t, NewAwsTapeImage(), awsName))
+}
+
+func Test_TapeImage_TruncatedImage(t *testing.T) {
+	dir := t.TempDir()
+	inName := filepath.Join(dir, "in.tap")
+	outName := filepath.Join(dir, "volume")
+	err := os.WriteFile(inName, []byte{0x08, 0x00, 0x00, 0x00, 'a', 'b'}, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err = DoImportSimh([]string{inName, outName})
+	if err == nil {
+		t.Fatalf("Expected an error importing a truncated image")
+	}
+
+	_, err = os.Stat(outName)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output image to be removed")
+	}
+}
@@ -191,8 +191,48 @@ func DoArguments() error {
 	return nil
 }
 
+// doConvertImage copies the image named by args[0] to a new image named by args[1], reporting what was copied
+func doConvertImage(command string, args []string, reader TapeImageReader, writer TapeImageWriter) error {
+	if len(args) != 2 {
+		return fmt.Errorf("incorrect number of arguments for %v command", command)
+	}
+
+	stats, err := ConvertTapeImage(reader, args[0], writer, args[1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Converted %v\n", stats)
+	return nil
+}
+
+// DoExportAws converts a native tape volume to an AWSTAPE image
+func DoExportAws(args []string) error {
+	return doConvertImage("export-aws", args, NewNativeTapeImage(), NewAwsTapeImage())
+}
+
+// DoExportSimh converts a native tape volume to a SIMH .tap image
+func DoExportSimh(args []string) error {
+	return doConvertImage("export-simh", args, NewNativeTapeImage(), NewSimhTapeImage())
+}
+
+// DoImportAws converts an AWSTAPE image to a native tape volume
+func DoImportAws(args []string) error {
+	return doConvertImage("import-aws", args, NewAwsTapeImage(), NewNativeTapeImage())
+}
+
+// DoImportSimh converts a SIMH .tap image to a native tape volume.
+// Bad data records are imported as good data, and erase gaps are dropped.
+func DoImportSimh(args []string) error {
+	return doConvertImage("import-simh", args, NewSimhTapeImage(), NewNativeTapeImage())
+}
+
 func DoUsage() {
 	fmt.Println("Usage: tapeUtil {switches} {command} {file-name-1} [ {file-name-2} ]")
+	fmt.Println("  import-simh {simh_file} {tape_file}")
+	fmt.Println("  export-simh {tape_file} {simh_file}")
+	fmt.Println("  import-aws {aws_file} {tape_file}")
+	fmt.Println("  export-aws {tape_file} {aws_file}")
 	fmt.Println("  tapeConvert {input_file} {output_file} [ -if {format} ] [ -of {format} ]")
 	fmt.Println("-if format - defines the format of the input file")
 	fmt.Println("  format: BIN | KEXEC | KFAST ")
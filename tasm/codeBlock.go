@@ -5,7 +5,11 @@
 
 package tasm
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strings"
+)
 
 type CodeBlock struct {
 	sourceSet     *SourceSet
@@ -14,15 +18,22 @@ type CodeBlock struct {
 	segmentNumber uint64
 	segmentOffset uint64
 	code          []uint64
+	forms         [][]uint64 // form for each generated word, nil (or missing) if generated as a whole word
 	references    []*Reference
 	diagnostics   *DiagnosticSet
 }
 
-func NewCodeBlock(sourceSet *SourceSet, lineNumber uint64, segmentNumber uint64, segmentOffset uint64) *CodeBlock {
+func NewCodeBlock(
+	sourceSet *SourceSet,
+	sourceItem *SourceItem,
+	lineNumber uint64,
+	segmentNumber uint64,
+	segmentOffset uint64,
+) *CodeBlock {
 	return &CodeBlock{
 		sourceSet:     sourceSet,
 		lineNumber:    lineNumber,
-		sourceItem:    sourceSet.sourceItems[lineNumber-1],
+		sourceItem:    sourceItem,
 		segmentNumber: segmentNumber,
 		segmentOffset: segmentOffset,
 		code:          make([]uint64, 0),
@@ -31,21 +42,55 @@ func NewCodeBlock(sourceSet *SourceSet, lineNumber uint64, segmentNumber uint64,
 	}
 }
 
-func (cb *CodeBlock) Emit() {
+// AppendWord appends a generated word to the code block, along with the references (if any) which apply to it.
+// The offset of each reference is expected to be the location of the word within the segment.
+func (cb *CodeBlock) AppendWord(word uint64, references ...*Reference) *CodeBlock {
+	cb.code = append(cb.code, word)
+	cb.references = append(cb.references, references...)
+	return cb
+}
+
+// getForm returns the form with which the indicated word was generated, or nil if it was generated as a whole word
+func (cb *CodeBlock) getForm(wordIndex int) []uint64 {
+	if wordIndex < len(cb.forms) {
+		return cb.forms[wordIndex]
+	}
+	return nil
+}
+
+// Emit writes the listing lines for this code block - the source line along with the segment, offset,
+// and value of the first generated word, then a line for each subsequent word, then any diagnostics.
+// Words are displayed with a space between the fields of the form which generated them.
+func (cb *CodeBlock) Emit(writer io.Writer) {
 	genStr := ""
 	if len(cb.code) > 0 {
-		genStr = fmt.Sprintf("%03o:%06o  %012o", cb.segmentNumber, cb.segmentOffset, cb.code[0])
+		genStr = fmt.Sprintf("%03o:%06o  %s", cb.segmentNumber, cb.segmentOffset, formatWord(cb.code[0], cb.getForm(0)))
 	}
 
-	fmt.Printf("  %24s  %-20s:%6d  %s\n", genStr, cb.sourceSet.name, cb.lineNumber, cb.sourceSet.sourceItems[cb.lineNumber-1].GetString())
+	_, _ = fmt.Fprintf(writer, "%-36s %6d  %s\n", genStr, cb.lineNumber, cb.sourceItem.GetString())
 	for cx := 1; cx < len(cb.code); cx++ {
-		genStr = fmt.Sprintf("%03o:%06o  %012o", cb.segmentNumber, cb.segmentOffset, cb.code[cx])
-		fmt.Printf("  %s\n" + genStr)
+		genStr = fmt.Sprintf("%03o:%06o  %s", cb.segmentNumber, cb.segmentOffset+uint64(cx), formatWord(cb.code[cx], cb.getForm(cx)))
+		_, _ = fmt.Fprintf(writer, "%s\n", genStr)
+	}
+
+	for _, diag := range cb.diagnostics.GetDiagnostics() {
+		_, _ = fmt.Fprintf(writer, "  %s\n", diag.GetString())
+	}
+}
+
+// formatWord produces the octal representation of a word, with the fields of the given form separated by spaces.
+// Each field is displayed with as many octal digits as are needed for its width.
+func formatWord(word uint64, form []uint64) string {
+	if len(form) <= 1 {
+		return fmt.Sprintf("%012o", word)
 	}
 
-	for _, dArray := range cb.diagnostics.diagnostics {
-		for _, diag := range dArray {
-			fmt.Printf("  %s\n", diag.GetString())
-		}
+	fields := make([]string, len(form))
+	bit := uint64(0)
+	for fx, bitCount := range form {
+		value := (word >> (36 - bit - bitCount)) & ((1 << bitCount) - 1)
+		fields[fx] = fmt.Sprintf("%0*o", (bitCount+2)/3, value)
+		bit += bitCount
 	}
+	return strings.Join(fields, " ")
 }
@@ -5,7 +5,10 @@
 
 package tasm
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Diagnostic interface {
 	GetLineNumber() uint64
@@ -97,6 +100,45 @@ func (ds *DiagnosticSet) NewInfo(source *SourceSet, lineNumber uint64, message s
 	ds.infoCount++
 }
 
+// Append adds all the diagnostics from the given set to this set
+func (ds *DiagnosticSet) Append(other *DiagnosticSet) {
+	for _, diags := range other.diagnostics {
+		for _, diag := range diags {
+			ds.putDiag(diag)
+		}
+	}
+	ds.infoCount += other.infoCount
+	ds.warningCount += other.warningCount
+	ds.errorCount += other.errorCount
+}
+
+func (ds *DiagnosticSet) GetErrorCount() uint64 {
+	return ds.errorCount
+}
+
+func (ds *DiagnosticSet) GetInfoCount() uint64 {
+	return ds.infoCount
+}
+
+func (ds *DiagnosticSet) GetWarningCount() uint64 {
+	return ds.warningCount
+}
+
+// GetDiagnostics returns all the diagnostics in the set, ordered by line number
+func (ds *DiagnosticSet) GetDiagnostics() []Diagnostic {
+	lineNumbers := make([]uint64, 0)
+	for lineNumber := range ds.diagnostics {
+		lineNumbers = append(lineNumbers, lineNumber)
+	}
+	sort.Slice(lineNumbers, func(i, j int) bool { return lineNumbers[i] < lineNumbers[j] })
+
+	result := make([]Diagnostic, 0)
+	for _, lineNumber := range lineNumbers {
+		result = append(result, ds.diagnostics[lineNumber]...)
+	}
+	return result
+}
+
 func (ds *DiagnosticSet) NewWarning(source *SourceSet, lineNumber uint64, message string) {
 	d := &WarningDiagnostic{
 		sourceSet:  source,
@@ -105,5 +147,5 @@ func (ds *DiagnosticSet) NewWarning(source *SourceSet, lineNumber uint64, messag
 	}
 
 	ds.putDiag(d)
-	ds.infoCount++
+	ds.warningCount++
 }
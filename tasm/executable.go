@@ -30,6 +30,13 @@ type Executable struct {
 	processorPrivilege        uint64
 	quarterWordMode           bool
 	startingAddress           uint64
+
+	//	for the map and symbol files
+	placements []*placedSegment
+	symbols    map[string]*LinkedSymbol
+
+	//	problems found while linking
+	diagnostics *DiagnosticSet
 }
 
 func (e *Executable) GetBanks() map[uint64]*Bank {
@@ -40,6 +47,14 @@ func (e *Executable) GetBaseRegisterSelection() bool {
 	return e.baseRegisterSelection
 }
 
+// GetDiagnostics returns the problems found while linking the executable
+func (e *Executable) GetDiagnostics() *DiagnosticSet {
+	if e.diagnostics == nil {
+		e.diagnostics = NewDiagnosticSet()
+	}
+	return e.diagnostics
+}
+
 func (e *Executable) GetInitiallyBasedBanks() map[uint64]uint64 {
 	return e.initiallyBasedBanks
 }
@@ -79,11 +94,12 @@ func (e *Executable) IsQuarterWordMode() bool {
 // LinkSimple links the given segments into a single bank, all accessLock allowed, ring/domain == 0.
 // the BDI for the bank will be 0_600004 (level 6, BDI 00004)
 func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool) {
-	fmt.Printf("\nLink Simple...\n")
-
 	bdi := uint64(0_600004)
 	e.banks = make(map[uint64]*Bank)
 	e.initiallyBasedBanks = make(map[uint64]uint64)
+	e.placements = make([]*placedSegment, 0)
+	e.symbols = make(map[string]*LinkedSymbol)
+	e.diagnostics = NewDiagnosticSet()
 	orderedSegmentNumbers := getOrderedSegmentNumbers(segments)
 
 	//	Find the offsets of all the segments relative to the start of the bank
@@ -101,11 +117,6 @@ func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool)
 		}
 	}
 
-	fmt.Printf("  Segment Table:\n")
-	for segmentNumber, offset := range offsets {
-		fmt.Printf("    Seg %03o is in bank %06o at offset %08o\n", segmentNumber, bdi, offset)
-	}
-
 	bankCode := make([]uint64, bankLength)
 	lowerLimit := uint64(01000)
 
@@ -120,11 +131,6 @@ func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool)
 		}
 	}
 
-	fmt.Printf("  Label Values:\n")
-	for symbol, value := range resolved {
-		fmt.Printf("    %-12s: %012o\n", symbol, value)
-	}
-
 	//	Load code one segment at a time (unresolved)
 	for segmentNumber, segment := range segments {
 		cx := offsets[segmentNumber]
@@ -137,16 +143,24 @@ func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool)
 	}
 
 	//	Now resolve references
-	for segNumber, segment := range segments {
+	for _, segNumber := range orderedSegmentNumbers {
 		segOffset := offsets[segNumber]
-		for _, ref := range segment.references {
-			newValue := resolved[strings.ToUpper(ref.symbol)]
-			targetIndex := segOffset + ref.offset
-			baseValue := bankCode[targetIndex]
-			var err error
-			bankCode[targetIndex], err = addFractional(baseValue, newValue, ref.startingBit, ref.bitCount)
-			if err != nil {
-				fmt.Printf("E: BDI:%06o Offset:%012o: %s\n", bdi, targetIndex, err.Error())
+		for _, cb := range segments[segNumber].generatedCode {
+			for _, ref := range cb.references {
+				targetIndex := segOffset + ref.offset
+				newValue, ok := resolved[strings.ToUpper(ref.symbol)]
+				if !ok {
+					e.diagnostics.NewError(cb.sourceSet, cb.lineNumber, fmt.Sprintf("undefined symbol %s", ref.symbol))
+					continue
+				}
+
+				baseValue := bankCode[targetIndex]
+				var err error
+				bankCode[targetIndex], err = addFractional(baseValue, newValue, ref.startingBit, ref.bitCount, ref.subtract)
+				if err != nil {
+					e.diagnostics.NewError(cb.sourceSet, cb.lineNumber,
+						fmt.Sprintf("bank %06o offset %06o: %s", bdi, targetIndex, err.Error()))
+				}
 			}
 		}
 	}
@@ -166,6 +180,9 @@ func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool)
 		bankDescriptorIndex: bdi,
 		code:                bankCode,
 	}
+	for _, segmentNumber := range orderedSegmentNumbers {
+		e.recordSegment(segmentNumber, segments[segmentNumber], e.banks[bdi], offsets[segmentNumber])
+	}
 
 	if extendedMode {
 		e.initiallyBasedBanks[0] = bdi // the bank should be based on B0
@@ -190,10 +207,11 @@ func (e *Executable) LinkSimple(segments map[uint64]*Segment, extendedMode bool)
 // Thus, we expect the initial code address to be in segment 12, at 01000.
 // The lower/upper limits for non-initially-based banks will all be set to 01000.
 func (e *Executable) LinkBankPerSegment(segments map[uint64]*Segment, extendedMode bool) {
-	fmt.Printf("\nLink Bank-Per-Segment...\n")
-
 	e.banks = make(map[uint64]*Bank)
 	e.initiallyBasedBanks = make(map[uint64]uint64) // key is segment number, value is BDI
+	e.placements = make([]*placedSegment, 0)
+	e.symbols = make(map[string]*LinkedSymbol)
+	e.diagnostics = NewDiagnosticSet()
 	e.basicMode = !extendedMode
 	orderedSegmentNumbers := getOrderedSegmentNumbers(segments)
 
@@ -249,20 +267,10 @@ func (e *Executable) LinkBankPerSegment(segments map[uint64]*Segment, extendedMo
 		}
 	}
 
-	fmt.Printf("  Label Values:\n")
-	for symbol, value := range resolved {
-		fmt.Printf("    %-12s: %012o\n", symbol, value)
-	}
-
-	fmt.Printf("  Bank Table:\n")
-	fmt.Printf("    L,BDI  Lower  Upper        Seg\n")
-	fmt.Printf("    ------ ------ ------------ ---\n")
-	for lbdi, bank := range e.banks {
-		fmt.Printf("    %06o %06o %012o %03o\n",
-			lbdi,
-			bank.bankDescriptor.GetLowerLimitNormalized(),
-			bank.bankDescriptor.GetUpperLimitNormalized(),
-			lbdi&0777)
+	for _, segmentNumber := range orderedSegmentNumbers {
+		if bank, ok := e.banks[0601000+segmentNumber]; ok {
+			e.recordSegment(segmentNumber, segments[segmentNumber], bank, 0)
+		}
 	}
 
 	//	Load code
@@ -279,18 +287,26 @@ func (e *Executable) LinkBankPerSegment(segments map[uint64]*Segment, extendedMo
 	}
 
 	//	Now resolve references
-	for segmentNumber, segment := range segments {
-		for _, ref := range segment.references {
-			//	L,BDI and bank descriptor for the bank in which the reference exists
-			lbdi := 0601000 + segmentNumber
-			bank := e.banks[lbdi]
-
-			newValue := resolved[strings.ToUpper(ref.symbol)]
-			baseValue := bank.code[ref.offset]
-			var err error
-			bank.code[ref.offset], err = addFractional(baseValue, newValue, ref.startingBit, ref.bitCount)
-			if err != nil {
-				fmt.Printf("E: BDI:%06o Offset:%012o: %s\n", lbdi, ref.offset, err.Error())
+	for _, segmentNumber := range orderedSegmentNumbers {
+		for _, cb := range segments[segmentNumber].generatedCode {
+			for _, ref := range cb.references {
+				//	L,BDI and bank descriptor for the bank in which the reference exists
+				lbdi := 0601000 + segmentNumber
+				bank := e.banks[lbdi]
+
+				newValue, ok := resolved[strings.ToUpper(ref.symbol)]
+				if !ok {
+					e.diagnostics.NewError(cb.sourceSet, cb.lineNumber, fmt.Sprintf("undefined symbol %s", ref.symbol))
+					continue
+				}
+
+				baseValue := bank.code[ref.offset]
+				var err error
+				bank.code[ref.offset], err = addFractional(baseValue, newValue, ref.startingBit, ref.bitCount, ref.subtract)
+				if err != nil {
+					e.diagnostics.NewError(cb.sourceSet, cb.lineNumber,
+						fmt.Sprintf("bank %06o offset %06o: %s", lbdi, ref.offset, err.Error()))
+				}
 			}
 		}
 	}
@@ -318,16 +334,35 @@ func (e *Executable) Dump() {
 	}
 }
 
-func addFractional(baseValue uint64, addend2 uint64, startingBit uint64, bitCount uint64) (uint64, error) {
+// addFractional adds addend2 to (or subtracts it from) the field of baseValue described by startingBit and bitCount.
+// A field which holds a negative (ones-complement) value, or a subtraction, is handled with ones-complement
+// arithmetic within the field (with a zero result always being positive zero);
+// otherwise a sum which does not fit in the field is an error.
+func addFractional(baseValue uint64, addend2 uint64, startingBit uint64, bitCount uint64, subtract bool) (uint64, error) {
 	mask := uint64(1<<bitCount) - 1
+	signBit := uint64(1) << (bitCount - 1)
 	shift := 36 - startingBit - bitCount
 	shiftedMask := mask << shift
 	shiftedNotMask := (^shiftedMask) & common.NegativeZero
 
 	addend1 := (baseValue & shiftedMask) >> shift
+	if subtract {
+		if addend2&mask != addend2 {
+			return 0, fmt.Errorf("value %012o truncated startingBit:%v length:%v", addend2, startingBit, bitCount)
+		}
+		addend2 ^= mask
+	}
+
+	onesComplement := subtract || addend1&signBit != 0
 	sum := addend1 + addend2
 	if (sum & mask) != sum {
-		return 0, fmt.Errorf("value %012o truncated startingBit:%v length:%v", sum, startingBit, bitCount)
+		if !onesComplement {
+			return 0, fmt.Errorf("value %012o truncated startingBit:%v length:%v", sum, startingBit, bitCount)
+		}
+		sum = (sum & mask) + 1 // end-around carry
+	}
+	if onesComplement && sum == mask {
+		sum = 0 // prefer positive zero
 	}
 
 	shiftedSum := sum << shift
@@ -342,7 +377,8 @@ func getOrderedSegmentNumbers(segments map[uint64]*Segment) []uint64 {
 		done := false
 		for ox < len(orderedSegmentNumbers) && !done {
 			if segNum < orderedSegmentNumbers[ox] {
-				orderedSegmentNumbers = append([]uint64{segNum}, orderedSegmentNumbers...)
+				orderedSegmentNumbers = append(orderedSegmentNumbers[:ox+1], orderedSegmentNumbers[ox:]...)
+				orderedSegmentNumbers[ox] = segNum
 				done = true
 			} else {
 				ox++
@@ -0,0 +1,240 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"khalehla/common"
+)
+
+// An absolute executable file holds a linked Executable as a sequence of 36-bit words, packed two words
+// to every nine bytes. The words are laid out as follows:
+//
+//	header:
+//		+0      'TASM' in ASCII
+//		+1      format version
+//		+2      designator settings, in the bit positions of the designator register
+//		+3      starting address
+//		+4      number of initially based banks
+//		+5      number of banks
+//	for each initially based bank:
+//		+0      base register index in H1, L,BDI in H2
+//	for each bank:
+//		+0      L,BDI
+//		+1      length of the bank, in words
+//		+2..+9  bank descriptor, with a zero base address
+//		+10..   content of the bank
+//
+// If the total number of words is odd, a zero word is appended to complete the final nine-byte group.
+
+const executableFileIdentifier = uint64(0_124_101_123_115) // 'TASM'
+const executableFileVersion = uint64(1)
+
+// Designator register bit positions used in the header
+const (
+	executableFlagExec24BitIndexing   = uint64(1) << 11
+	executableFlagBasicMode           = uint64(1) << 16
+	executableFlagExecRegisterSet     = uint64(1) << 17
+	executableFlagOperationTrap       = uint64(1) << 27
+	executableFlagArithmeticException = uint64(1) << 29
+	executableFlagBaseRegisterSelect  = uint64(1) << 31
+	executableFlagQuarterWordMode     = uint64(1) << 32
+)
+
+var executableFlags = []struct {
+	flag  uint64
+	value func(e *Executable) *bool
+}{
+	{executableFlagExec24BitIndexing, func(e *Executable) *bool { return &e.exec24BitIndexing }},
+	{executableFlagBasicMode, func(e *Executable) *bool { return &e.basicMode }},
+	{executableFlagExecRegisterSet, func(e *Executable) *bool { return &e.execRegisterSet }},
+	{executableFlagOperationTrap, func(e *Executable) *bool { return &e.operationTrapEnable }},
+	{executableFlagArithmeticException, func(e *Executable) *bool { return &e.arithmeticExceptionEnable }},
+	{executableFlagBaseRegisterSelect, func(e *Executable) *bool { return &e.baseRegisterSelection }},
+	{executableFlagQuarterWordMode, func(e *Executable) *bool { return &e.quarterWordMode }},
+}
+
+// Write writes the executable to the given writer in absolute executable format
+func (e *Executable) Write(writer io.Writer) error {
+	designators := (e.processorPrivilege & 03) << 14
+	for _, ef := range executableFlags {
+		if *ef.value(e) {
+			designators |= ef.flag
+		}
+	}
+
+	baseRegisters := make([]uint64, 0)
+	for brx := uint64(0); brx < 32; brx++ {
+		if _, ok := e.initiallyBasedBanks[brx]; ok {
+			baseRegisters = append(baseRegisters, brx)
+		}
+	}
+
+	bankIndices := make([]uint64, 0, len(e.banks))
+	for lbdi := range e.banks {
+		bankIndices = append(bankIndices, lbdi)
+	}
+	sort.Slice(bankIndices, func(i, j int) bool { return bankIndices[i] < bankIndices[j] })
+
+	words := []uint64{
+		executableFileIdentifier,
+		executableFileVersion,
+		designators,
+		e.startingAddress,
+		uint64(len(baseRegisters)),
+		uint64(len(bankIndices)),
+	}
+
+	for _, brx := range baseRegisters {
+		words = append(words, (brx<<18)|(e.initiallyBasedBanks[brx]&0_777777))
+	}
+
+	for _, lbdi := range bankIndices {
+		bank := e.banks[lbdi]
+		words = append(words, lbdi, bank.GetCodeLength())
+
+		//	The base address is not known until load time
+		bd := bank.GetBankDescriptor()
+		baseAddress := bd.GetBaseAddress()
+		bd.SetBaseAddress(common.NewAbsoluteAddress(0, 0))
+		bdWords := make([]common.Word36, 8)
+		bd.Serialize(bdWords)
+		bd.SetBaseAddress(baseAddress)
+
+		for _, w := range bdWords {
+			words = append(words, w.GetW())
+		}
+		words = append(words, bank.code...)
+	}
+
+	if len(words)%2 != 0 {
+		words = append(words, 0)
+	}
+
+	buffer := make([]byte, len(words)*9/2)
+	err := common.PackWord36Strict(words, buffer)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(buffer)
+	return err
+}
+
+// Save writes the executable to the named file in absolute executable format
+func (e *Executable) Save(fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	err = e.Write(file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadExecutable reads an executable in absolute executable format from the given reader
+func ReadExecutable(reader io.Reader) (*Executable, error) {
+	buffer, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer)%9 != 0 {
+		return nil, fmt.Errorf("executable is not a whole number of word pairs")
+	}
+
+	words := make([]uint64, len(buffer)*2/9)
+	err = common.UnpackWord36Strict(buffer, words)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(words) < 6 || words[0] != executableFileIdentifier {
+		return nil, fmt.Errorf("not an absolute executable")
+	} else if words[1] != executableFileVersion {
+		return nil, fmt.Errorf("unsupported executable version %d", words[1])
+	}
+
+	designators := words[2]
+	e := &Executable{
+		banks:               make(map[uint64]*Bank),
+		initiallyBasedBanks: make(map[uint64]uint64),
+		processorPrivilege:  (designators >> 14) & 03,
+		startingAddress:     words[3],
+	}
+	for _, ef := range executableFlags {
+		*ef.value(e) = designators&ef.flag != 0
+	}
+
+	baseRegisterCount := words[4]
+	bankCount := words[5]
+	wx := uint64(6)
+	if wx+baseRegisterCount > uint64(len(words)) {
+		return nil, fmt.Errorf("executable is truncated")
+	}
+	for bx := uint64(0); bx < baseRegisterCount; bx++ {
+		e.initiallyBasedBanks[words[wx]>>18] = words[wx] & 0_777777
+		wx++
+	}
+
+	for bx := uint64(0); bx < bankCount; bx++ {
+		if wx+10 > uint64(len(words)) {
+			return nil, fmt.Errorf("executable is truncated")
+		}
+
+		lbdi := words[wx]
+		length := words[wx+1]
+		bdWords := make([]common.Word36, 8)
+		for dx := range bdWords {
+			bdWords[dx] = common.Word36(words[wx+2+uint64(dx)])
+		}
+		wx += 10
+
+		if wx+length > uint64(len(words)) {
+			return nil, fmt.Errorf("executable is truncated")
+		} else if _, ok := e.banks[lbdi]; ok {
+			return nil, fmt.Errorf("bank %06o appears more than once", lbdi)
+		}
+
+		code := make([]uint64, length)
+		copy(code, words[wx:wx+length])
+		wx += length
+
+		bd := common.NewBankDescriptorFromStorage(bdWords)
+		bd.SetBaseAddress(nil)
+		e.banks[lbdi] = NewBank(bd, lbdi, code)
+	}
+
+	for brx, lbdi := range e.initiallyBasedBanks {
+		if _, ok := e.banks[lbdi]; !ok {
+			return nil, fmt.Errorf("bank %06o for B%d is not in the executable", lbdi, brx)
+		}
+	}
+
+	return e, nil
+}
+
+// LoadExecutable reads an executable in absolute executable format from the named file
+func LoadExecutable(fileName string) (*Executable, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	e, err := ReadExecutable(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err.Error())
+	}
+	return e, nil
+}
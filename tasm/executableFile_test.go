@@ -0,0 +1,80 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_ExecutableFile_RoundTrip(t *testing.T) {
+	a := assembleSource(linkerTestSource)
+	spec, err := LoadLinkSpec("testdata/link.json")
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	spec.SetQuarterWordMode(true).SetArithmeticExceptionEnabled(true).SetProcessorPrivilege(3)
+
+	original, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+
+	buffer := &bytes.Buffer{}
+	err = original.Write(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	if buffer.Len()%9 != 0 {
+		t.Errorf("Error expected a multiple of 9 bytes, got %d", buffer.Len())
+	}
+
+	e, err := ReadExecutable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	if e.GetStartingAddress() != original.GetStartingAddress() ||
+		e.GetProcessorPrivilege() != 3 ||
+		!e.IsQuarterWordMode() ||
+		!e.IsArithmeticExceptionEnabled() ||
+		e.IsBasicMode() ||
+		e.IsOperationTrapEnabled() {
+		t.Errorf("Error designator settings or starting address not preserved")
+	}
+
+	if len(e.GetInitiallyBasedBanks()) != 3 || e.GetInitiallyBasedBanks()[5] != 0200020 {
+		t.Errorf("Error unexpected initial basing %v", e.GetInitiallyBasedBanks())
+	}
+
+	for lbdi, originalBank := range original.GetBanks() {
+		bank, ok := e.GetBanks()[lbdi]
+		if !ok {
+			t.Fatalf("Error bank %06o missing", lbdi)
+		}
+		checkCode(t, bank.GetCode(), originalBank.GetCode())
+
+		bd := bank.GetBankDescriptor()
+		originalBD := originalBank.GetBankDescriptor()
+		if bd.GetLowerLimitNormalized() != originalBD.GetLowerLimitNormalized() ||
+			bd.GetUpperLimitNormalized() != originalBD.GetUpperLimitNormalized() ||
+			bd.GetAccessLock().GetComposite() != originalBD.GetAccessLock().GetComposite() ||
+			bd.GetGeneralAccessPermissions().GetComposite() != originalBD.GetGeneralAccessPermissions().GetComposite() ||
+			bd.GetSpecialAccessPermissions().GetComposite() != originalBD.GetSpecialAccessPermissions().GetComposite() {
+			t.Errorf("Error bank descriptor for %06o not preserved", lbdi)
+		}
+	}
+}
+
+func Test_ExecutableFile_Errors(t *testing.T) {
+	_, err := ReadExecutable(bytes.NewReader(make([]byte, 8)))
+	if err == nil {
+		t.Errorf("Error expected failure for partial word pair")
+	}
+
+	_, err = ReadExecutable(bytes.NewReader(make([]byte, 27)))
+	if err == nil {
+		t.Errorf("Error expected failure for missing identifier")
+	}
+}
@@ -0,0 +1,29 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"testing"
+)
+
+func Test_GetOrderedSegmentNumbers(t *testing.T) {
+	// Enough segments that map iteration order is all but certain to insert some of them mid-list
+	segments := make(map[uint64]*Segment)
+	for segNum := uint64(0); segNum < 32; segNum++ {
+		segments[segNum*3] = nil
+	}
+
+	ordered := getOrderedSegmentNumbers(segments)
+	if len(ordered) != len(segments) {
+		t.Fatalf("expected %v segment numbers, got %v", len(segments), len(ordered))
+	}
+
+	for sx, segNum := range ordered {
+		if segNum != uint64(sx*3) {
+			t.Fatalf("expected segment %v at position %v, got %v: %v", sx*3, sx, segNum, ordered)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Expressions are made up of integer literals (octal if they begin with a leading zero, otherwise decimal,
+// with optional underscore separators), symbols, and the location counter '$', combined with these operators,
+// listed from lowest to highest precedence:
+//
+//	|          inclusive or
+//	^          exclusive or
+//	&          and
+//	<< >>      logical shift left, right
+//	+ -        add, subtract
+//	* /        multiply, divide
+//	- + ~      unary negate, plus, ones-complement
+//
+// Parentheses may be used for grouping. Values are 36-bit ones-complement integers.
+//
+// Symbols and the location counter are relocatable - their values are not known until link time.
+// A relocatable value may be added to or subtracted from an absolute value or another relocatable value,
+// but it may not participate in any other operation.
+
+const word36Mask = uint64(0_777777_777777)
+
+// expressionValue is the result of evaluating an expression.
+// The value is absolute if there are no references, otherwise it is relocatable and the final value
+// is the absolute part plus the sum of the referenced symbols, each multiplied by its coefficient.
+type expressionValue struct {
+	value      int64
+	references map[string]int
+}
+
+func newAbsoluteValue(value int64) *expressionValue {
+	return &expressionValue{
+		value:      value,
+		references: make(map[string]int),
+	}
+}
+
+func newRelocatableValue(symbol string) *expressionValue {
+	ev := newAbsoluteValue(0)
+	ev.references[symbol] = 1
+	return ev
+}
+
+func (ev *expressionValue) isRelocatable() bool {
+	return len(ev.references) > 0
+}
+
+// getSymbols returns the referenced symbols in a consistent order
+func (ev *expressionValue) getSymbols() []string {
+	symbols := make([]string, 0, len(ev.references))
+	for symbol := range ev.references {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+func (ev *expressionValue) add(operand *expressionValue, sign int) {
+	ev.value += int64(sign) * operand.value
+	for symbol, coefficient := range operand.references {
+		ev.references[symbol] += sign * coefficient
+		if ev.references[symbol] == 0 {
+			delete(ev.references, symbol)
+		}
+	}
+}
+
+// toWord36 converts a signed value to its 36-bit ones-complement representation
+func toWord36(value int64) uint64 {
+	if value < 0 {
+		return (^uint64(-value)) & word36Mask
+	}
+	return uint64(value) & word36Mask
+}
+
+// fromWord36 converts a 36-bit ones-complement value to a signed value
+func fromWord36(value uint64) int64 {
+	value &= word36Mask
+	if value&0_400000_000000 != 0 {
+		return -int64((^value) & word36Mask)
+	}
+	return int64(value)
+}
+
+// expressionParser evaluates a single expression.
+// locationSymbol and location describe the location counter - the symbol for the origin of the
+// current segment, and the offset from that origin.
+type expressionParser struct {
+	text           string
+	index          int
+	locationSymbol string
+	location       uint64
+	locationUsed   bool
+}
+
+// evaluate evaluates the given expression, returning its value and whether the location counter was referenced.
+func evaluate(expression string, locationSymbol string, location uint64) (*expressionValue, bool, error) {
+	p := &expressionParser{
+		text:           expression,
+		locationSymbol: locationSymbol,
+		location:       location,
+	}
+
+	p.skipWhiteSpace()
+	if p.atEnd() {
+		return nil, false, fmt.Errorf("incomplete expression")
+	}
+
+	value, err := p.parseOr()
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.skipWhiteSpace()
+	if !p.atEnd() {
+		return nil, false, fmt.Errorf("syntax error in expression")
+	}
+
+	return value, p.locationUsed, nil
+}
+
+func (p *expressionParser) atEnd() bool {
+	return p.index >= len(p.text)
+}
+
+func (p *expressionParser) skipWhiteSpace() {
+	for !p.atEnd() && (p.text[p.index] == ' ' || p.text[p.index] == '\t') {
+		p.index++
+	}
+}
+
+// parseOperator consumes the first of the given operators which appears next in the text
+func (p *expressionParser) parseOperator(operators ...string) (string, bool) {
+	p.skipWhiteSpace()
+	for _, operator := range operators {
+		if strings.HasPrefix(p.text[p.index:], operator) {
+			p.index += len(operator)
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+// parseBinary parses a sequence of operands at one level of precedence, separated by the given operators
+func (p *expressionParser) parseBinary(
+	next func() (*expressionValue, error),
+	operators []string,
+) (*expressionValue, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator, ok := p.parseOperator(operators...)
+		if !ok {
+			return left, nil
+		}
+
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		left, err = applyOperator(operator, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *expressionParser) parseOr() (*expressionValue, error) {
+	return p.parseBinary(p.parseXor, []string{"|"})
+}
+
+func (p *expressionParser) parseXor() (*expressionValue, error) {
+	return p.parseBinary(p.parseAnd, []string{"^"})
+}
+
+func (p *expressionParser) parseAnd() (*expressionValue, error) {
+	return p.parseBinary(p.parseShift, []string{"&"})
+}
+
+func (p *expressionParser) parseShift() (*expressionValue, error) {
+	return p.parseBinary(p.parseAdditive, []string{"<<", ">>"})
+}
+
+func (p *expressionParser) parseAdditive() (*expressionValue, error) {
+	return p.parseBinary(p.parseMultiplicative, []string{"+", "-"})
+}
+
+func (p *expressionParser) parseMultiplicative() (*expressionValue, error) {
+	return p.parseBinary(p.parseUnary, []string{"*", "/"})
+}
+
+func (p *expressionParser) parseUnary() (*expressionValue, error) {
+	operator, ok := p.parseOperator("-", "+", "~")
+	if !ok {
+		return p.parseTerm()
+	}
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator {
+	case "-":
+		result := newAbsoluteValue(0)
+		result.add(operand, -1)
+		return result, nil
+	case "~":
+		if operand.isRelocatable() {
+			return nil, fmt.Errorf("relocatable value not allowed with operator '~'")
+		}
+		return newAbsoluteValue(fromWord36(^toWord36(operand.value))), nil
+	}
+
+	return operand, nil
+}
+
+func (p *expressionParser) parseTerm() (*expressionValue, error) {
+	p.skipWhiteSpace()
+	if p.atEnd() {
+		return nil, fmt.Errorf("incomplete expression")
+	}
+
+	ch := p.text[p.index]
+	if ch == '(' {
+		p.index++
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.parseOperator(")"); !ok {
+			return nil, fmt.Errorf("missing right parenthesis")
+		}
+		return value, nil
+	}
+
+	if isDigit(ch) {
+		return p.parseInteger()
+	}
+
+	if isSymbolStart(ch) {
+		start := p.index
+		for !p.atEnd() && isSymbolCharacter(p.text[p.index]) {
+			p.index++
+		}
+
+		symbol := strings.ToUpper(p.text[start:p.index])
+		if symbol == "$" {
+			p.locationUsed = true
+			value := newRelocatableValue(p.locationSymbol)
+			value.value = int64(p.location)
+			return value, nil
+		}
+
+		if len(symbol) > 12 {
+			return nil, fmt.Errorf("symbol is too long")
+		}
+		return newRelocatableValue(symbol), nil
+	}
+
+	return nil, fmt.Errorf("syntax error in expression")
+}
+
+func (p *expressionParser) parseInteger() (*expressionValue, error) {
+	radix := uint64(10)
+	if p.text[p.index] == '0' {
+		radix = 8
+	}
+
+	var value uint64
+	for !p.atEnd() {
+		ch := p.text[p.index]
+		if isDigit(ch) {
+			digit := uint64(ch - '0')
+			if digit >= radix {
+				return nil, fmt.Errorf("invalid digit in octal literal")
+			}
+			value = value*radix + digit
+			if value > word36Mask {
+				return nil, fmt.Errorf("integer literal too large")
+			}
+		} else if ch != '_' {
+			break
+		}
+		p.index++
+	}
+
+	return newAbsoluteValue(int64(value)), nil
+}
+
+func applyOperator(operator string, left *expressionValue, right *expressionValue) (*expressionValue, error) {
+	switch operator {
+	case "+":
+		left.add(right, 1)
+		return left, nil
+	case "-":
+		left.add(right, -1)
+		return left, nil
+	}
+
+	if left.isRelocatable() || right.isRelocatable() {
+		return nil, fmt.Errorf("relocatable value not allowed with operator '%s'", operator)
+	}
+
+	lValue := left.value
+	rValue := right.value
+	switch operator {
+	case "*":
+		return newAbsoluteValue(lValue * rValue), nil
+	case "/":
+		if rValue == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return newAbsoluteValue(lValue / rValue), nil
+	case "<<", ">>":
+		if rValue < 0 {
+			return nil, fmt.Errorf("negative shift count")
+		}
+		if rValue >= 36 {
+			return newAbsoluteValue(0), nil
+		}
+		if operator == "<<" {
+			return newAbsoluteValue(fromWord36(toWord36(lValue) << rValue)), nil
+		}
+		return newAbsoluteValue(fromWord36(toWord36(lValue) >> rValue)), nil
+	case "&":
+		return newAbsoluteValue(fromWord36(toWord36(lValue) & toWord36(rValue))), nil
+	case "^":
+		return newAbsoluteValue(fromWord36(toWord36(lValue) ^ toWord36(rValue))), nil
+	case "|":
+		return newAbsoluteValue(fromWord36(toWord36(lValue) | toWord36(rValue))), nil
+	}
+
+	return nil, fmt.Errorf("operator '%s' not recognized", operator)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isSymbolStart(ch byte) bool {
+	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || ch == '$'
+}
+
+func isSymbolCharacter(ch byte) bool {
+	return isSymbolStart(ch) || isDigit(ch) || ch == '_'
+}
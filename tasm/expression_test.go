@@ -0,0 +1,89 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import "testing"
+
+func checkAbsoluteExpression(t *testing.T, expression string, expected int64) {
+	value, _, err := evaluate(expression, "$SEG000", 0)
+	if err != nil {
+		t.Errorf("Error evaluating '%s': %s", expression, err.Error())
+	} else if value.isRelocatable() {
+		t.Errorf("Error expected '%s' to be absolute", expression)
+	} else if value.value != expected {
+		t.Errorf("Error expected '%s' to be %d, got %d", expression, expected, value.value)
+	}
+}
+
+func Test_Expression_Arithmetic(t *testing.T) {
+	checkAbsoluteExpression(t, "1+2*3", 7)
+	checkAbsoluteExpression(t, "(1+2)*3", 9)
+	checkAbsoluteExpression(t, "010-1", 7)
+	checkAbsoluteExpression(t, "17/5", 3)
+	checkAbsoluteExpression(t, "-5+2", -3)
+	checkAbsoluteExpression(t, "- (2 * 3)", -6)
+	checkAbsoluteExpression(t, "0777_777", 0777777)
+}
+
+func Test_Expression_Logical(t *testing.T) {
+	checkAbsoluteExpression(t, "1<<6", 0100)
+	checkAbsoluteExpression(t, "0770>>3", 077)
+	checkAbsoluteExpression(t, "0770&0077", 070)
+	checkAbsoluteExpression(t, "0700|07", 0707)
+	checkAbsoluteExpression(t, "0707^0777", 070)
+	checkAbsoluteExpression(t, "1+1<<3", 020)
+	checkAbsoluteExpression(t, "~0", 0)
+	checkAbsoluteExpression(t, "~1", -1)
+	checkAbsoluteExpression(t, "-1&0777", 0776)
+	checkAbsoluteExpression(t, "0_400000_000000>>35", 1)
+}
+
+func Test_Expression_Relocatable(t *testing.T) {
+	value, _, err := evaluate("start+5-end", "$SEG000", 0)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	if value.value != 5 || value.references["START"] != 1 || value.references["END"] != -1 {
+		t.Errorf("Error unexpected value %v", value)
+	}
+
+	value, _, err = evaluate("start-start+2", "$SEG000", 0)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	if value.isRelocatable() || value.value != 2 {
+		t.Errorf("Error expected absolute 2, got %v", value)
+	}
+
+	value, used, err := evaluate("$+2", "$SEG003", 010)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	if !used || value.value != 012 || value.references["$SEG003"] != 1 {
+		t.Errorf("Error unexpected location counter value %v", value)
+	}
+}
+
+func Test_Expression_Errors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"1+",
+		"(1+2",
+		"1 2",
+		"08",
+		"1/0",
+		"start*2",
+		"start<<1",
+		"~start",
+		"avery_long_symbol_name",
+		"1 # 2",
+	} {
+		_, _, err := evaluate(expression, "$SEG000", 0)
+		if err == nil {
+			t.Errorf("Error expected '%s' to fail", expression)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"khalehla/common"
+)
+
+// Instructions are written in the conventional form:
+//
+//	mnemonic[,j]   [register,][*]address[,[*]Xn][,Bn]
+//
+// The j designator (W, H1, XU, Q2, etc.) may be given only for instructions which take a partial-word designator.
+// The register operand is required for instructions which use the a-field to specify a register.
+// The address may be an expression or a GRS register name. In basic mode a leading '*' sets the i-bit,
+// and in extended mode a base register may be specified for instructions which use an address operand.
+// A '*' before the index register sets the h-bit (index register incrementation).
+// Encodings are taken from the instruction tables in common, which are shared with the disassembler.
+
+const (
+	formFJAXHIU  = "FJAXHIU"
+	formFJAXHIBD = "FJAXHIBD"
+	formFJAXU    = "FJAXU"
+)
+
+// parseRegister interprets text as a register name with the given prefix, such as "A5" or "X12".
+// Returns false if the text is not such a register name.
+func parseRegister(text string, prefix string, limit uint64) (uint64, bool) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	if !strings.HasPrefix(text, prefix) || len(text) == len(prefix) {
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(text[len(prefix):], 10, 64)
+	if err != nil || value >= limit {
+		return 0, false
+	}
+
+	return value, true
+}
+
+// parseGRSAddress interprets text as the name of an X, A, or R register, returning the register's GRS address
+func parseGRSAddress(text string) (uint64, bool) {
+	if value, ok := parseRegister(text, "X", 16); ok {
+		return common.X0 + value, true
+	} else if value, ok := parseRegister(text, "A", 16); ok {
+		return common.A0 + value, true
+	} else if value, ok := parseRegister(text, "R", 16); ok {
+		return common.R0 + value, true
+	}
+
+	return 0, false
+}
+
+// parsePartialWordDesignator interprets the j designator of an operation field
+func parsePartialWordDesignator(text string) (uint64, bool) {
+	for jx, name := range common.JFieldThirdWordNames {
+		if name == text {
+			return uint64(jx), true
+		}
+	}
+
+	for jx, name := range common.JFieldQuarterWordNames {
+		if name == text {
+			return uint64(jx), true
+		}
+	}
+
+	return 0, false
+}
+
+// lookupInstruction finds the encoding for the mnemonic in the given operation field (e.g., "LA,U"),
+// returning nil if the operation field does not name an instruction in the current mode.
+func (a *TinyAssembler) lookupInstruction(command string) *common.InstructionEncoding {
+	mnemonic, _, _ := strings.Cut(command, ",")
+	return common.LookupMnemonic(mnemonic, a.basicMode)
+}
+
+// processInstruction generates an instruction word for the given mnemonic instruction
+func (a *TinyAssembler) processInstruction(cb *CodeBlock, encoding *common.InstructionEncoding) {
+	definition := encoding.GetDefinition()
+	_, designator, hasDesignator := strings.Cut(*cb.sourceItem.command, ",")
+	operands := cb.sourceItem.operands
+
+	var f, j, aField, x, h, i, b uint64
+	f = encoding.GetF()
+	j = encoding.GetJ()
+	aField = encoding.GetA()
+
+	if definition.GetJFieldUsage() == common.JPartialWordDesignator {
+		if hasDesignator {
+			var ok bool
+			j, ok = parsePartialWordDesignator(designator)
+			if !ok {
+				cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "invalid partial-word designator")
+			}
+		} else {
+			j = common.JFieldW
+		}
+	} else if hasDesignator {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "partial-word designator not allowed for this instruction")
+	}
+
+	ox := 0
+	switch definition.GetAFieldUsage() {
+	case common.ARegister, common.BRegister, common.RRegister, common.XRegister:
+		prefix := map[common.AFieldUsage]string{
+			common.ARegister: "A",
+			common.BRegister: "B",
+			common.RRegister: "R",
+			common.XRegister: "X",
+		}[definition.GetAFieldUsage()]
+		if len(operands) == 0 {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, fmt.Sprintf("%s register operand required", prefix))
+			break
+		}
+
+		var ok bool
+		aField, ok = parseRegister(operands[0], prefix, 16)
+		if !ok {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, fmt.Sprintf("%s register operand required", prefix))
+		}
+		ox++
+
+	case common.AGRSComponent:
+		if len(operands) == 0 {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "register operand required")
+			break
+		}
+
+		//	GRS locations which have no register name may be given as absolute addresses
+		grsAddress, ok := parseGRSAddress(operands[0])
+		if !ok {
+			value, err := a.evaluateAbsolute(cb, operands[0])
+			if err != nil || value < 0 || value > 0177 {
+				cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "register operand required")
+			} else {
+				grsAddress = uint64(value)
+			}
+		}
+		j = grsAddress >> 4
+		aField = grsAddress & 017
+		ox++
+	}
+
+	// address operand
+	address := newAbsoluteValue(0)
+	if ox < len(operands) {
+		text := strings.TrimSpace(operands[ox])
+		if strings.HasPrefix(text, "*") {
+			if a.basicMode {
+				i = 1
+			} else {
+				cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "indirect addressing not allowed in extended mode")
+			}
+			text = text[1:]
+		}
+
+		if grsAddress, ok := parseGRSAddress(text); ok {
+			address.value = int64(grsAddress)
+		} else if len(text) > 0 {
+			value, err := a.evaluate(cb, text)
+			if err != nil {
+				cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, err.Error())
+			} else {
+				address = value
+			}
+		}
+		ox++
+	}
+
+	// index register operand
+	if ox < len(operands) {
+		text := strings.TrimSpace(operands[ox])
+		if strings.HasPrefix(text, "*") {
+			h = 1
+			text = text[1:]
+		}
+
+		if len(text) > 0 {
+			var ok bool
+			x, ok = parseRegister(text, "X", 16)
+			if !ok {
+				cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "index register operand expected")
+			}
+		}
+		ox++
+	}
+
+	// base register operand - extended mode only, for instructions which develop an operand address
+	uOperand := definition.GetJFieldUsage() == common.JPartialWordDesignator &&
+		(j == common.JFieldU || j == common.JFieldXU)
+	useBase := !a.basicMode && !definition.IsUField18Bits() && !uOperand
+	if useBase && ox < len(operands) {
+		var ok bool
+		b, ok = parseRegister(operands[ox], "B", 16)
+		if !ok {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "base register operand expected")
+		}
+		ox++
+	}
+
+	if ox < len(operands) {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "too many operands")
+	}
+
+	fixed := func(value uint64) *expressionValue {
+		return newAbsoluteValue(int64(value))
+	}
+
+	if uOperand && x == 0 {
+		a.generateWord(cb, a.forms[formFJAXU],
+			[]*expressionValue{fixed(f), fixed(j), fixed(aField), fixed(x), address})
+	} else if useBase {
+		a.generateWord(cb, a.forms[formFJAXHIBD],
+			[]*expressionValue{fixed(f), fixed(j), fixed(aField), fixed(x), fixed(h), fixed(i), fixed(b), address})
+	} else {
+		a.generateWord(cb, a.forms[formFJAXHIU],
+			[]*expressionValue{fixed(f), fixed(j), fixed(aField), fixed(x), fixed(h), fixed(i), address})
+	}
+}
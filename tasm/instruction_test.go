@@ -0,0 +1,122 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"strings"
+	"testing"
+)
+
+// assembleInstructions assembles the given source into segment 0 and returns the generated words
+func assembleInstructions(t *testing.T, basicMode bool, source string) ([]uint64, *Segment) {
+	sourceSet, diagnostics, err := ParseSource("test", strings.NewReader(source))
+	if err != nil || diagnostics.GetErrorCount() > 0 {
+		t.Fatalf("Error parsing source: %v %v", err, diagnostics.GetDiagnostics())
+	}
+
+	a := NewTinyAssembler().SetBasicMode(basicMode)
+	a.Assemble(sourceSet)
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error unexpected diagnostics %s", a.GetDiagnostics().GetDiagnostics()[0].GetString())
+	}
+
+	segment := a.GetSegments()[0]
+	code := make([]uint64, 0)
+	for _, cb := range segment.generatedCode {
+		code = append(code, cb.code...)
+	}
+	return code, segment
+}
+
+func checkCode(t *testing.T, code []uint64, expected []uint64) {
+	if len(code) != len(expected) {
+		t.Fatalf("Error expected %d words, got %d", len(expected), len(code))
+	}
+	for cx := range code {
+		if code[cx] != expected[cx] {
+			t.Errorf("Error word %d expected %012o, got %012o", cx, expected[cx], code[cx])
+		}
+	}
+}
+
+func Test_Instruction_Extended(t *testing.T) {
+	source := "         LA,U     A0,5\n" +
+		"         LA       A1,0100,*X2,B3\n" +
+		"         SA,H1    A2,A5\n" +
+		"         LXSI,XU  X3,0777777\n" +
+		"         LR       R1,0200\n" +
+		"loop     JNZ      A1,loop\n" +
+		"         LD       0\n" +
+		"         JGD      X10,loop,X1\n" +
+		"         IAR      0\n"
+	code, segment := assembleInstructions(t, false, source)
+	checkCode(t, code, []uint64{
+		0_107000_000005,
+		0_100022_430100,
+		0_011040_000021,
+		0_517460_777777,
+		0_230020_000200,
+		0_740420_000000,
+		0_736700_000000,
+		0_700241_000000,
+		0_737540_000000,
+	})
+
+	if len(segment.references) != 2 {
+		t.Fatalf("Error expected 2 references, got %d", len(segment.references))
+	}
+	ref := segment.references[0]
+	if ref.symbol != "LOOP" || ref.offset != 5 || ref.startingBit != 20 || ref.bitCount != 16 {
+		t.Errorf("Error unexpected reference %v", ref)
+	}
+}
+
+func Test_Instruction_Basic(t *testing.T) {
+	source := "         .BASIC\n" +
+		"         LA,U     A0,5\n" +
+		"         LA       A1,*0100,X2\n" +
+		"         SLJ      0300\n" +
+		"         LD       0\n" +
+		"         JC       01000\n"
+	code, _ := assembleInstructions(t, false, source)
+	checkCode(t, code, []uint64{
+		0_107000_000005,
+		0_100022_200100,
+		0_720400_000300,
+		0_736700_000000,
+		0_747000_001000,
+	})
+}
+
+func Test_Instruction_ModeSpecific(t *testing.T) {
+	sourceSet, _, _ := ParseSource("test", strings.NewReader(" LXSI X1,0\n"))
+	a := NewTinyAssembler().SetBasicMode(true)
+	a.Assemble(sourceSet)
+	if a.GetDiagnostics().GetErrorCount() != 1 {
+		t.Errorf("Error expected LXSI to be rejected in basic mode")
+	}
+}
+
+func Test_Instruction_Errors(t *testing.T) {
+	source := " LA A0\n" +
+		" LA,Z A0,0\n" +
+		" LA X0,0\n" +
+		" J,U 0\n" +
+		" LA A0,0,X1,B2,5\n" +
+		" LA A0,0,B1\n"
+	sourceSet, _, _ := ParseSource("test", strings.NewReader(source))
+	a := NewTinyAssembler()
+	a.Assemble(sourceSet)
+	diags := a.GetDiagnostics().GetDiagnostics()
+	if len(diags) != 5 {
+		t.Fatalf("Error expected 5 diagnostics, got %v", diags)
+	}
+	for dx, lineNumber := range []uint64{2, 3, 4, 5, 6} {
+		if diags[dx].GetLineNumber() != lineNumber {
+			t.Errorf("Error expected diagnostic %d on line %d, got line %d", dx, lineNumber, diags[dx].GetLineNumber())
+		}
+	}
+}
@@ -0,0 +1,410 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"khalehla/common"
+)
+
+// The linkers record where each segment was placed and the final value of each label, so that a map
+// (for humans) and a symbol file (for debuggers and the disassembler) can be written for the executable.
+
+// placedSegment records the bank into which a segment was placed, and where
+type placedSegment struct {
+	segmentNumber uint64
+	levelBDI      uint64
+	offset        uint64 // offset of the segment from the start of the bank
+	length        uint64
+}
+
+// LinkedSymbol describes a label after linking - the bank and segment which contain it,
+// its offset from the start of the segment, and its relative address.
+type LinkedSymbol struct {
+	name     string
+	levelBDI uint64
+	segment  uint64
+	offset   uint64
+	address  uint64
+}
+
+func NewLinkedSymbol(name string, levelBDI uint64, segment uint64, offset uint64, address uint64) *LinkedSymbol {
+	return &LinkedSymbol{
+		name:     name,
+		levelBDI: levelBDI,
+		segment:  segment,
+		offset:   offset,
+		address:  address,
+	}
+}
+
+func (ls *LinkedSymbol) GetAddress() uint64 {
+	return ls.address
+}
+
+func (ls *LinkedSymbol) GetLevelBDI() uint64 {
+	return ls.levelBDI
+}
+
+func (ls *LinkedSymbol) GetName() string {
+	return ls.name
+}
+
+func (ls *LinkedSymbol) GetOffset() uint64 {
+	return ls.offset
+}
+
+func (ls *LinkedSymbol) GetSegment() uint64 {
+	return ls.segment
+}
+
+// recordSegment notes the placement of a segment, and the final values of the (exported) labels it defines
+func (e *Executable) recordSegment(segmentNumber uint64, segment *Segment, bank *Bank, offset uint64) {
+	lbdi := bank.bankDescriptorIndex
+	e.placements = append(e.placements, &placedSegment{
+		segmentNumber: segmentNumber,
+		levelBDI:      lbdi,
+		offset:        offset,
+		length:        segment.currentLength,
+	})
+
+	if e.symbols == nil {
+		e.symbols = make(map[string]*LinkedSymbol)
+	}
+
+	lowerLimit := bank.bankDescriptor.GetLowerLimitNormalized()
+	for label, labelOffset := range segment.labels {
+		if !isLocalSymbol(label) {
+			e.symbols[label] = NewLinkedSymbol(label, lbdi, segmentNumber, labelOffset, lowerLimit+offset+labelOffset)
+		}
+	}
+}
+
+// GetSymbols returns the linked symbols, ordered by L,BDI then address then name
+func (e *Executable) GetSymbols() []*LinkedSymbol {
+	return sortLinkedSymbols(e.symbols)
+}
+
+func sortLinkedSymbols(symbols map[string]*LinkedSymbol) []*LinkedSymbol {
+	result := make([]*LinkedSymbol, 0, len(symbols))
+	for _, symbol := range symbols {
+		result = append(result, symbol)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].levelBDI != result[j].levelBDI {
+			return result[i].levelBDI < result[j].levelBDI
+		} else if result[i].address != result[j].address {
+			return result[i].address < result[j].address
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// getOrderedBankIndices returns the L,BDIs of the banks in ascending order
+func (e *Executable) getOrderedBankIndices() []uint64 {
+	result := make([]uint64, 0, len(e.banks))
+	for lbdi := range e.banks {
+		result = append(result, lbdi)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// formatPermissions returns the given permissions in the form "ERW", with '-' for each permission not granted
+func formatPermissions(perms *common.AccessPermissions) string {
+	return strings.TrimPrefix(perms.GetString(), "Permissions:")
+}
+
+// WriteMap writes the link map - the banks with their attributes and initial basing, the segments
+// in each bank, and the values of all the symbols, first in address order, then in name order.
+func (e *Executable) WriteMap(writer io.Writer) {
+	basedOn := make(map[uint64]uint64)
+	for brx, lbdi := range e.initiallyBasedBanks {
+		basedOn[lbdi] = brx
+	}
+
+	_, _ = fmt.Fprintf(writer, "\nBanks\n\n")
+	_, _ = fmt.Fprintf(writer, "L,BDI   Lower         Upper         Length    Mode      Lock         GAP  SAP  Base\n")
+	for _, lbdi := range e.getOrderedBankIndices() {
+		bank := e.banks[lbdi]
+		bd := bank.bankDescriptor
+		mode := "extended"
+		if bd.GetBankType() == common.BasicModeBankDescriptor {
+			mode = "basic"
+		}
+		base := ""
+		if brx, ok := basedOn[lbdi]; ok {
+			base = fmt.Sprintf("B%d", brx)
+		}
+		_, _ = fmt.Fprintf(writer, "%06o  %012o  %012o  %08o  %-8s  %o:%06o     %-3s  %-3s  %s\n",
+			lbdi,
+			bd.GetLowerLimitNormalized(),
+			bd.GetUpperLimitNormalized(),
+			len(bank.code),
+			mode,
+			bd.GetAccessLock().GetRing(),
+			bd.GetAccessLock().GetDomain(),
+			formatPermissions(bd.GetGeneralAccessPermissions()),
+			formatPermissions(bd.GetSpecialAccessPermissions()),
+			base)
+	}
+
+	placements := make([]*placedSegment, len(e.placements))
+	copy(placements, e.placements)
+	sort.Slice(placements, func(i, j int) bool {
+		if placements[i].levelBDI != placements[j].levelBDI {
+			return placements[i].levelBDI < placements[j].levelBDI
+		}
+		return placements[i].offset < placements[j].offset
+	})
+
+	_, _ = fmt.Fprintf(writer, "\nSegments\n\n")
+	_, _ = fmt.Fprintf(writer, "Seg  L,BDI   Offset    Address       Length\n")
+	for _, ps := range placements {
+		lowerLimit := e.banks[ps.levelBDI].bankDescriptor.GetLowerLimitNormalized()
+		_, _ = fmt.Fprintf(writer, "%03o  %06o  %08o  %012o  %08o\n",
+			ps.segmentNumber, ps.levelBDI, ps.offset, lowerLimit+ps.offset, ps.length)
+	}
+
+	symbols := e.GetSymbols()
+	_, _ = fmt.Fprintf(writer, "\nSymbols by Address\n\n")
+	for _, symbol := range symbols {
+		_, _ = fmt.Fprintf(writer, "%06o:%012o  %-12s  %03o:%06o\n",
+			symbol.levelBDI, symbol.address, symbol.name, symbol.segment, symbol.offset)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].name < symbols[j].name })
+	_, _ = fmt.Fprintf(writer, "\nSymbols by Name\n\n")
+	for _, symbol := range symbols {
+		_, _ = fmt.Fprintf(writer, "%-12s  %06o:%012o  %03o:%06o\n",
+			symbol.name, symbol.levelBDI, symbol.address, symbol.segment, symbol.offset)
+	}
+
+	_, _ = fmt.Fprintf(writer, "\nStarting address %012o\n", e.startingAddress)
+}
+
+//	Symbol file ---------------------------------------------------------------------------------------------------------
+
+// SymbolTable is the content of a symbol file - the banks of an executable, and the symbols within those banks.
+type SymbolTable struct {
+	banks           []*SymbolTableBank
+	symbols         []*LinkedSymbol
+	startingAddress uint64
+}
+
+// SymbolTableBank describes one bank of an executable, for the purposes of a symbol file
+type SymbolTableBank struct {
+	levelBDI     uint64
+	basicMode    bool
+	lowerLimit   uint64
+	upperLimit   uint64
+	baseRegister int // -1 if the bank is not initially based
+}
+
+type symbolFile struct {
+	StartingAddress uint64            `json:"startingAddress"`
+	Banks           []symbolFileBank  `json:"banks"`
+	Symbols         []symbolFileEntry `json:"symbols"`
+}
+
+type symbolFileBank struct {
+	LevelBDI     uint64 `json:"levelBDI"`
+	BasicMode    bool   `json:"basicMode"`
+	LowerLimit   uint64 `json:"lowerLimit"`
+	UpperLimit   uint64 `json:"upperLimit"`
+	BaseRegister *int   `json:"baseRegister,omitempty"`
+}
+
+type symbolFileEntry struct {
+	Name     string `json:"name"`
+	LevelBDI uint64 `json:"levelBDI"`
+	Segment  uint64 `json:"segment"`
+	Offset   uint64 `json:"offset"`
+	Address  uint64 `json:"address"`
+}
+
+// GetSymbolTable produces the symbol table for the executable
+func (e *Executable) GetSymbolTable() *SymbolTable {
+	st := &SymbolTable{
+		banks:           make([]*SymbolTableBank, 0),
+		symbols:         e.GetSymbols(),
+		startingAddress: e.startingAddress,
+	}
+
+	basedOn := make(map[uint64]int)
+	for brx, lbdi := range e.initiallyBasedBanks {
+		basedOn[lbdi] = int(brx)
+	}
+
+	for _, lbdi := range e.getOrderedBankIndices() {
+		bd := e.banks[lbdi].bankDescriptor
+		stb := &SymbolTableBank{
+			levelBDI:     lbdi,
+			basicMode:    bd.GetBankType() == common.BasicModeBankDescriptor,
+			lowerLimit:   bd.GetLowerLimitNormalized(),
+			upperLimit:   bd.GetUpperLimitNormalized(),
+			baseRegister: -1,
+		}
+		if brx, ok := basedOn[lbdi]; ok {
+			stb.baseRegister = brx
+		}
+		st.banks = append(st.banks, stb)
+	}
+
+	return st
+}
+
+// WriteSymbols writes the symbol file (JSON) for the executable
+func (e *Executable) WriteSymbols(writer io.Writer) error {
+	return e.GetSymbolTable().Write(writer)
+}
+
+func (st *SymbolTable) GetBanks() []*SymbolTableBank {
+	return st.banks
+}
+
+func (st *SymbolTable) GetStartingAddress() uint64 {
+	return st.startingAddress
+}
+
+// GetSymbols returns the symbols, ordered by L,BDI then address then name
+func (st *SymbolTable) GetSymbols() []*LinkedSymbol {
+	return st.symbols
+}
+
+// GetSymbolsForBank returns the symbols in the given bank, keyed by relative address.
+// Where more than one symbol has the same address, the first in name order is chosen.
+func (st *SymbolTable) GetSymbolsForBank(levelBDI uint64) map[uint64]string {
+	result := make(map[uint64]string)
+	for _, symbol := range st.symbols {
+		if symbol.levelBDI == levelBDI {
+			if _, ok := result[symbol.address]; !ok {
+				result[symbol.address] = symbol.name
+			}
+		}
+	}
+	return result
+}
+
+func (stb *SymbolTableBank) GetBaseRegister() (uint64, bool) {
+	return uint64(stb.baseRegister), stb.baseRegister >= 0
+}
+
+func (stb *SymbolTableBank) GetLevelBDI() uint64 {
+	return stb.levelBDI
+}
+
+func (stb *SymbolTableBank) GetLowerLimit() uint64 {
+	return stb.lowerLimit
+}
+
+func (stb *SymbolTableBank) GetUpperLimit() uint64 {
+	return stb.upperLimit
+}
+
+func (stb *SymbolTableBank) IsBasicMode() bool {
+	return stb.basicMode
+}
+
+// Write writes the symbol table as a symbol file (JSON)
+func (st *SymbolTable) Write(writer io.Writer) error {
+	sf := symbolFile{
+		StartingAddress: st.startingAddress,
+		Banks:           make([]symbolFileBank, 0),
+		Symbols:         make([]symbolFileEntry, 0),
+	}
+
+	for _, stb := range st.banks {
+		sfb := symbolFileBank{
+			LevelBDI:   stb.levelBDI,
+			BasicMode:  stb.basicMode,
+			LowerLimit: stb.lowerLimit,
+			UpperLimit: stb.upperLimit,
+		}
+		if stb.baseRegister >= 0 {
+			brx := stb.baseRegister
+			sfb.BaseRegister = &brx
+		}
+		sf.Banks = append(sf.Banks, sfb)
+	}
+
+	for _, symbol := range st.symbols {
+		sf.Symbols = append(sf.Symbols, symbolFileEntry{
+			Name:     symbol.name,
+			LevelBDI: symbol.levelBDI,
+			Segment:  symbol.segment,
+			Offset:   symbol.offset,
+			Address:  symbol.address,
+		})
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&sf)
+}
+
+// ReadSymbolTable reads a symbol file (JSON) from the given reader
+func ReadSymbolTable(reader io.Reader) (*SymbolTable, error) {
+	var sf symbolFile
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&sf)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &SymbolTable{
+		banks:           make([]*SymbolTableBank, 0),
+		startingAddress: sf.StartingAddress,
+	}
+
+	for _, sfb := range sf.Banks {
+		stb := &SymbolTableBank{
+			levelBDI:     sfb.LevelBDI,
+			basicMode:    sfb.BasicMode,
+			lowerLimit:   sfb.LowerLimit,
+			upperLimit:   sfb.UpperLimit,
+			baseRegister: -1,
+		}
+		if sfb.BaseRegister != nil {
+			stb.baseRegister = *sfb.BaseRegister
+		}
+		st.banks = append(st.banks, stb)
+	}
+
+	symbols := make(map[string]*LinkedSymbol)
+	for _, entry := range sf.Symbols {
+		if _, ok := symbols[entry.Name]; ok {
+			return nil, fmt.Errorf("symbol %s appears more than once", entry.Name)
+		}
+		symbols[entry.Name] = NewLinkedSymbol(entry.Name, entry.LevelBDI, entry.Segment, entry.Offset, entry.Address)
+	}
+	st.symbols = sortLinkedSymbols(symbols)
+
+	return st, nil
+}
+
+// LoadSymbolTable reads a symbol file (JSON) from the named file
+func LoadSymbolTable(fileName string) (*SymbolTable, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	st, err := ReadSymbolTable(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err.Error())
+	}
+	return st, nil
+}
@@ -0,0 +1,86 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func linkTestExecutable(t *testing.T) *Executable {
+	a := assembleSource(linkerTestSource)
+	spec, err := LoadLinkSpec("testdata/link.json")
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	e, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+	return e
+}
+
+func Test_LinkMap_WriteMap(t *testing.T) {
+	e := linkTestExecutable(t)
+
+	buffer := &bytes.Buffer{}
+	e.WriteMap(buffer)
+	linkMap := buffer.String()
+
+	expected := []string{
+		"400010  000000002000  000000002002  00000003",
+		"600004  000000001000  000000001002  00000003",
+		"ER-  ER-  B0",
+		"003  400010  00000002  000000002002",
+		"400010:000000002002  MORE          003:000000",
+		"START         600004:000000001001  000:000001",
+		"TABLE         400010:000000002000  002:000000",
+	}
+	for _, str := range expected {
+		if !strings.Contains(linkMap, str) {
+			t.Errorf("Error expected map to contain '%s'", str)
+		}
+	}
+	if t.Failed() {
+		t.Logf("%s", linkMap)
+	}
+}
+
+func Test_SymbolTable_RoundTrip(t *testing.T) {
+	e := linkTestExecutable(t)
+
+	buffer := &bytes.Buffer{}
+	err := e.WriteSymbols(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	st, err := ReadSymbolTable(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	if st.GetStartingAddress() != e.GetStartingAddress() {
+		t.Errorf("Error expected starting address %06o, got %06o", e.GetStartingAddress(), st.GetStartingAddress())
+	}
+	if len(st.GetBanks()) != 3 {
+		t.Fatalf("Error expected 3 banks, got %d", len(st.GetBanks()))
+	}
+	brx, ok := st.GetBanks()[2].GetBaseRegister()
+	if st.GetBanks()[2].GetLevelBDI() != 0600004 || !ok || brx != 0 {
+		t.Errorf("Error expected bank 600004 based on B0")
+	}
+
+	symbols := st.GetSymbolsForBank(0400010)
+	if len(symbols) != 2 || symbols[02000] != "TABLE" || symbols[02002] != "MORE" {
+		t.Errorf("Error unexpected symbols for bank 400010:%v", symbols)
+	}
+
+	_, err = ReadSymbolTable(strings.NewReader("{\"banks\":[]"))
+	if err == nil {
+		t.Errorf("Error expected failure reading a malformed symbol file")
+	}
+}
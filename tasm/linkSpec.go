@@ -0,0 +1,347 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"khalehla/common"
+)
+
+// LinkSpec describes how assembled segments are to be combined into banks, and how the resulting
+// program is to be initially established - which banks are based on which base registers,
+// where execution begins, and the initial state of the designator register.
+type LinkSpec struct {
+	banks                     []*BankSpec
+	initialBasing             map[uint64]uint64 // key is base register index, value is L,BDI
+	startingSymbol            string
+	startingAddress           uint64
+	hasStartingAddress        bool
+	arithmeticExceptionEnable bool
+	baseRegisterSelection     bool
+	basicMode                 bool
+	execRegisterSet           bool
+	exec24BitIndexing         bool
+	operationTrapEnable       bool
+	processorPrivilege        uint64
+	quarterWordMode           bool
+}
+
+// BankSpec describes one bank - the segments it contains (in order), and its bank descriptor attributes.
+type BankSpec struct {
+	levelBDI           uint64
+	segments           []uint64
+	basicMode          bool
+	lowerLimit         uint64
+	size               uint64
+	ring               uint64
+	domain             uint64
+	generalPermissions *common.AccessPermissions
+	specialPermissions *common.AccessPermissions
+}
+
+func NewLinkSpec() *LinkSpec {
+	return &LinkSpec{
+		banks:         make([]*BankSpec, 0),
+		initialBasing: make(map[uint64]uint64),
+	}
+}
+
+// NewBankSpec creates a bank specification for the given L,BDI (level in the top 3 bits, BDI in the lower 15)
+// containing the given segments. By default the bank is an extended mode bank with a lower limit of 01000,
+// a ring/domain of zero, and all access permitted.
+func NewBankSpec(levelBDI uint64, segments ...uint64) *BankSpec {
+	return &BankSpec{
+		levelBDI:           levelBDI,
+		segments:           segments,
+		lowerLimit:         01000,
+		generalPermissions: common.NewAccessPermissions(true, true, true),
+		specialPermissions: common.NewAccessPermissions(true, true, true),
+	}
+}
+
+func (ls *LinkSpec) AddBank(bank *BankSpec) *LinkSpec {
+	ls.banks = append(ls.banks, bank)
+	return ls
+}
+
+// BaseOn requests that the bank with the given L,BDI be initially based on the given base register
+func (ls *LinkSpec) BaseOn(baseRegisterIndex uint64, levelBDI uint64) *LinkSpec {
+	ls.initialBasing[baseRegisterIndex] = levelBDI
+	return ls
+}
+
+func (ls *LinkSpec) GetBanks() []*BankSpec {
+	return ls.banks
+}
+
+func (ls *LinkSpec) GetInitialBasing() map[uint64]uint64 {
+	return ls.initialBasing
+}
+
+func (ls *LinkSpec) SetArithmeticExceptionEnabled(value bool) *LinkSpec {
+	ls.arithmeticExceptionEnable = value
+	return ls
+}
+
+func (ls *LinkSpec) SetBaseRegisterSelection(value bool) *LinkSpec {
+	ls.baseRegisterSelection = value
+	return ls
+}
+
+func (ls *LinkSpec) SetBasicMode(value bool) *LinkSpec {
+	ls.basicMode = value
+	return ls
+}
+
+func (ls *LinkSpec) SetExecRegisterSetEnabled(value bool) *LinkSpec {
+	ls.execRegisterSet = value
+	return ls
+}
+
+func (ls *LinkSpec) SetExec24BitIndexingEnabled(value bool) *LinkSpec {
+	ls.exec24BitIndexing = value
+	return ls
+}
+
+func (ls *LinkSpec) SetOperationTrapEnabled(value bool) *LinkSpec {
+	ls.operationTrapEnable = value
+	return ls
+}
+
+func (ls *LinkSpec) SetProcessorPrivilege(value uint64) *LinkSpec {
+	ls.processorPrivilege = value
+	return ls
+}
+
+func (ls *LinkSpec) SetQuarterWordMode(value bool) *LinkSpec {
+	ls.quarterWordMode = value
+	return ls
+}
+
+// SetStartingAddress specifies an absolute starting address, overriding any starting symbol
+func (ls *LinkSpec) SetStartingAddress(address uint64) *LinkSpec {
+	ls.startingAddress = address
+	ls.hasStartingAddress = true
+	return ls
+}
+
+// SetStartingSymbol specifies the label at which execution is to begin.
+// If neither a starting symbol nor a starting address is specified, execution begins at the lower limit
+// of the bank based on B0 (extended mode) or B12 (basic mode).
+func (ls *LinkSpec) SetStartingSymbol(symbol string) *LinkSpec {
+	ls.startingSymbol = symbol
+	return ls
+}
+
+func (bs *BankSpec) GetLevelBDI() uint64 {
+	return bs.levelBDI
+}
+
+func (bs *BankSpec) GetSegments() []uint64 {
+	return bs.segments
+}
+
+func (bs *BankSpec) SetAccessLock(ring uint64, domain uint64) *BankSpec {
+	bs.ring = ring
+	bs.domain = domain
+	return bs
+}
+
+func (bs *BankSpec) SetBasicMode(value bool) *BankSpec {
+	bs.basicMode = value
+	return bs
+}
+
+func (bs *BankSpec) SetGeneralPermissions(canEnter bool, canRead bool, canWrite bool) *BankSpec {
+	bs.generalPermissions = common.NewAccessPermissions(canEnter, canRead, canWrite)
+	return bs
+}
+
+// SetLowerLimit sets the lower limit of the bank, which must be a multiple of 01000
+func (bs *BankSpec) SetLowerLimit(value uint64) *BankSpec {
+	bs.lowerLimit = value
+	return bs
+}
+
+// SetSize establishes a minimum size for the bank. If the segments in the bank require more space,
+// the bank is larger; otherwise the bank is zero-filled to this size (useful for stacks and work areas).
+func (bs *BankSpec) SetSize(value uint64) *BankSpec {
+	bs.size = value
+	return bs
+}
+
+func (bs *BankSpec) SetSpecialPermissions(canEnter bool, canRead bool, canWrite bool) *BankSpec {
+	bs.specialPermissions = common.NewAccessPermissions(canEnter, canRead, canWrite)
+	return bs
+}
+
+//	JSON representation ------------------------------------------------------------------------------------------------
+
+// Numeric values in link spec files are strings, so that they may be written in octal - a leading zero
+// indicates octal, as in source code. Permissions are written as some combination of E, R, and W.
+
+type linkSpecFile struct {
+	Banks                      []bankSpecFile    `json:"banks"`
+	InitialBasing              map[string]string `json:"initialBasing"`
+	StartingSymbol             string            `json:"startingSymbol"`
+	StartingAddress            string            `json:"startingAddress"`
+	BasicMode                  bool              `json:"basicMode"`
+	QuarterWordMode            bool              `json:"quarterWordMode"`
+	ProcessorPrivilege         string            `json:"processorPrivilege"`
+	ArithmeticExceptionEnabled bool              `json:"arithmeticExceptionEnabled"`
+	OperationTrapEnabled       bool              `json:"operationTrapEnabled"`
+}
+
+type bankSpecFile struct {
+	LevelBDI           string   `json:"levelBDI"`
+	Segments           []string `json:"segments"`
+	BasicMode          bool     `json:"basicMode"`
+	LowerLimit         string   `json:"lowerLimit"`
+	Size               string   `json:"size"`
+	Ring               string   `json:"ring"`
+	Domain             string   `json:"domain"`
+	GeneralPermissions *string  `json:"generalPermissions"`
+	SpecialPermissions *string  `json:"specialPermissions"`
+}
+
+// parseLinkSpecNumber interprets a numeric string from a link spec file. An empty string yields the default.
+func parseLinkSpecNumber(text string, defaultValue uint64) (uint64, error) {
+	if len(text) == 0 {
+		return defaultValue, nil
+	}
+
+	radix := 10
+	if len(text) > 1 && text[0] == '0' {
+		radix = 8
+	}
+	return strconv.ParseUint(text, radix, 64)
+}
+
+// parseLinkSpecPermissions interprets a permissions string such as "ER" or "RW"
+func parseLinkSpecPermissions(text string) (*common.AccessPermissions, error) {
+	var canEnter, canRead, canWrite bool
+	for _, ch := range text {
+		switch ch {
+		case 'E', 'e':
+			canEnter = true
+		case 'R', 'r':
+			canRead = true
+		case 'W', 'w':
+			canWrite = true
+		default:
+			return nil, fmt.Errorf("invalid permissions '%s'", text)
+		}
+	}
+	return common.NewAccessPermissions(canEnter, canRead, canWrite), nil
+}
+
+// LoadLinkSpec reads a link specification from a JSON file
+func LoadLinkSpec(fileName string) (*LinkSpec, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lsf linkSpecFile
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&lsf)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err.Error())
+	}
+
+	ls := NewLinkSpec()
+	ls.SetBasicMode(lsf.BasicMode)
+	ls.SetQuarterWordMode(lsf.QuarterWordMode)
+	ls.SetArithmeticExceptionEnabled(lsf.ArithmeticExceptionEnabled)
+	ls.SetOperationTrapEnabled(lsf.OperationTrapEnabled)
+	ls.SetStartingSymbol(lsf.StartingSymbol)
+
+	var value uint64
+	if value, err = parseLinkSpecNumber(lsf.ProcessorPrivilege, 0); err != nil {
+		return nil, fmt.Errorf("%s:processorPrivilege:%s", fileName, err.Error())
+	}
+	ls.SetProcessorPrivilege(value)
+
+	if len(lsf.StartingAddress) > 0 {
+		if value, err = parseLinkSpecNumber(lsf.StartingAddress, 0); err != nil {
+			return nil, fmt.Errorf("%s:startingAddress:%s", fileName, err.Error())
+		}
+		ls.SetStartingAddress(value)
+	}
+
+	for brText, lbdiText := range lsf.InitialBasing {
+		brx, err := parseLinkSpecNumber(brText, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s:initialBasing:%s", fileName, err.Error())
+		}
+		lbdi, err := parseLinkSpecNumber(lbdiText, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s:initialBasing:%s", fileName, err.Error())
+		}
+		ls.BaseOn(brx, lbdi)
+	}
+
+	for _, bsf := range lsf.Banks {
+		bs, err := bsf.toBankSpec()
+		if err != nil {
+			return nil, fmt.Errorf("%s:bank %s:%s", fileName, bsf.LevelBDI, err.Error())
+		}
+		ls.AddBank(bs)
+	}
+
+	return ls, nil
+}
+
+func (bsf *bankSpecFile) toBankSpec() (*BankSpec, error) {
+	lbdi, err := parseLinkSpecNumber(bsf.LevelBDI, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]uint64, len(bsf.Segments))
+	for sx, segText := range bsf.Segments {
+		if segments[sx], err = parseLinkSpecNumber(segText, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	bs := NewBankSpec(lbdi, segments...)
+	bs.SetBasicMode(bsf.BasicMode)
+	if bs.lowerLimit, err = parseLinkSpecNumber(bsf.LowerLimit, bs.lowerLimit); err != nil {
+		return nil, err
+	}
+	if bs.size, err = parseLinkSpecNumber(bsf.Size, 0); err != nil {
+		return nil, err
+	}
+
+	var ring, domain uint64
+	if ring, err = parseLinkSpecNumber(bsf.Ring, 0); err != nil {
+		return nil, err
+	}
+	if domain, err = parseLinkSpecNumber(bsf.Domain, 0); err != nil {
+		return nil, err
+	}
+	bs.SetAccessLock(ring, domain)
+
+	if bsf.GeneralPermissions != nil {
+		if bs.generalPermissions, err = parseLinkSpecPermissions(*bsf.GeneralPermissions); err != nil {
+			return nil, err
+		}
+	}
+	if bsf.SpecialPermissions != nil {
+		if bs.specialPermissions, err = parseLinkSpecPermissions(*bsf.SpecialPermissions); err != nil {
+			return nil, err
+		}
+	}
+
+	return bs, nil
+}
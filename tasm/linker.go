@@ -0,0 +1,239 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"khalehla/common"
+)
+
+// linkSourceSet is the nominal source for link diagnostics which are not attributable to a line of source
+var linkSourceSet = NewSourceSet("link", nil)
+
+// segmentPlacement records where a segment ends up
+type segmentPlacement struct {
+	bank   *Bank
+	offset uint64 // offset of the segment from the start of the bank
+}
+
+// Link builds an Executable from the given segments, according to the given link specification.
+// Problems with the specification itself are reported against the nominal source set "link";
+// problems with references (undefined symbols, truncated values) are reported against the referencing source line.
+// The executable is returned even if errors are reported, but it should not be loaded in that case.
+func Link(segments map[uint64]*Segment, spec *LinkSpec) (*Executable, *DiagnosticSet) {
+	diagnostics := NewDiagnosticSet()
+	e := &Executable{
+		banks:                     make(map[uint64]*Bank),
+		initiallyBasedBanks:       make(map[uint64]uint64),
+		arithmeticExceptionEnable: spec.arithmeticExceptionEnable,
+		baseRegisterSelection:     spec.baseRegisterSelection,
+		basicMode:                 spec.basicMode,
+		execRegisterSet:           spec.execRegisterSet,
+		exec24BitIndexing:         spec.exec24BitIndexing,
+		operationTrapEnable:       spec.operationTrapEnable,
+		processorPrivilege:        spec.processorPrivilege,
+		quarterWordMode:           spec.quarterWordMode,
+		placements:                make([]*placedSegment, 0),
+		symbols:                   make(map[string]*LinkedSymbol),
+		diagnostics:               diagnostics,
+	}
+
+	if spec.processorPrivilege > 3 {
+		diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("invalid processor privilege %d", spec.processorPrivilege))
+	}
+
+	//	Create the banks and place the segments
+	placements := make(map[uint64]*segmentPlacement)
+	for _, bs := range spec.banks {
+		lbdi := bs.levelBDI
+		if lbdi > 0_777777 || (lbdi>>15 == 0 && lbdi&077777 < 32) {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("invalid L,BDI %06o", lbdi))
+			continue
+		} else if _, ok := e.banks[lbdi]; ok {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("bank %06o is specified more than once", lbdi))
+			continue
+		}
+
+		if bs.ring > 3 || bs.domain > 0177777 {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("invalid access lock for bank %06o", lbdi))
+		}
+		if bs.lowerLimit&0777 != 0 || bs.lowerLimit > 0_777777_777 {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("invalid lower limit for bank %06o", lbdi))
+		}
+
+		bank := &Bank{bankDescriptorIndex: lbdi}
+		var length uint64
+		for _, segmentNumber := range bs.segments {
+			segment, ok := segments[segmentNumber]
+			if !ok {
+				diagnostics.NewError(linkSourceSet, 0,
+					fmt.Sprintf("segment %03o in bank %06o does not exist", segmentNumber, lbdi))
+				continue
+			} else if prior, ok := placements[segmentNumber]; ok {
+				diagnostics.NewError(linkSourceSet, 0,
+					fmt.Sprintf("segment %03o is in bank %06o and bank %06o",
+						segmentNumber, prior.bank.bankDescriptorIndex, lbdi))
+				continue
+			}
+
+			placements[segmentNumber] = &segmentPlacement{bank: bank, offset: length}
+			length += segment.currentLength
+		}
+
+		if bs.size > length {
+			length = bs.size
+		}
+		if length == 0 {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("bank %06o is empty", lbdi))
+			continue
+		}
+
+		bank.code = make([]uint64, length)
+		bank.bankDescriptor = common.NewBankDescriptor(
+			bs.basicMode,
+			common.NewAccessLock(bs.ring, bs.domain),
+			bs.generalPermissions,
+			bs.specialPermissions,
+			nil, // this has to be filled in when the bank is loaded
+			false,
+			bs.lowerLimit,
+			bs.lowerLimit+length-1,
+			0)
+		e.banks[lbdi] = bank
+	}
+
+	for _, segmentNumber := range getOrderedSegmentNumbers(segments) {
+		if _, ok := placements[segmentNumber]; !ok && segments[segmentNumber].currentLength > 0 {
+			diagnostics.NewWarning(linkSourceSet, 0, fmt.Sprintf("segment %03o is not in any bank", segmentNumber))
+		}
+	}
+
+	//	Resolve label values, and load the code
+	resolved := make(map[string]uint64)
+	for _, segmentNumber := range getOrderedSegmentNumbers(segments) {
+		placement, ok := placements[segmentNumber]
+		if !ok || placement.bank.bankDescriptor == nil {
+			continue
+		}
+
+		segment := segments[segmentNumber]
+		e.recordSegment(segmentNumber, segment, placement.bank, placement.offset)
+		lowerLimit := placement.bank.bankDescriptor.GetLowerLimitNormalized()
+		for symbol, offset := range segment.labels {
+			resolved[symbol] = lowerLimit + placement.offset + offset
+		}
+
+		cx := placement.offset
+		for _, codeBlock := range segment.generatedCode {
+			cx += uint64(copy(placement.bank.code[cx:], codeBlock.code))
+		}
+	}
+
+	//	Resolve references
+	for _, segmentNumber := range getOrderedSegmentNumbers(segments) {
+		placement, ok := placements[segmentNumber]
+		if !ok {
+			continue
+		}
+
+		for _, cb := range segments[segmentNumber].generatedCode {
+			for _, ref := range cb.references {
+				value, ok := resolved[strings.ToUpper(ref.symbol)]
+				if !ok {
+					diagnostics.NewError(cb.sourceSet, cb.lineNumber, fmt.Sprintf("undefined symbol %s", ref.symbol))
+					continue
+				}
+
+				cx := placement.offset + ref.offset
+				var err error
+				placement.bank.code[cx], err =
+					addFractional(placement.bank.code[cx], value, ref.startingBit, ref.bitCount, ref.subtract)
+				if err != nil {
+					diagnostics.NewError(cb.sourceSet, cb.lineNumber,
+						fmt.Sprintf("bank %06o offset %06o: %s", placement.bank.bankDescriptorIndex, cx, err.Error()))
+				}
+			}
+		}
+	}
+
+	//	Establish initial basing
+	baseRegisters := make([]uint64, 0, len(spec.initialBasing))
+	for brx := range spec.initialBasing {
+		baseRegisters = append(baseRegisters, brx)
+	}
+	sort.Slice(baseRegisters, func(i, j int) bool { return baseRegisters[i] < baseRegisters[j] })
+
+	for _, brx := range baseRegisters {
+		lbdi := spec.initialBasing[brx]
+		if brx > 15 || (spec.basicMode && brx < 12) {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("bank %06o cannot be initially based on B%d", lbdi, brx))
+		} else if _, ok := e.banks[lbdi]; !ok {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("bank %06o for B%d is not defined", lbdi, brx))
+		} else {
+			e.initiallyBasedBanks[brx] = lbdi
+		}
+	}
+
+	checkBasicModeOverlap(e, diagnostics)
+
+	//	Determine starting address
+	codeRegister := uint64(0)
+	if spec.basicMode {
+		codeRegister = 12
+	}
+
+	if spec.hasStartingAddress {
+		e.startingAddress = spec.startingAddress
+	} else if len(spec.startingSymbol) > 0 {
+		value, ok := resolved[strings.ToUpper(spec.startingSymbol)]
+		if ok {
+			e.startingAddress = value
+		} else {
+			diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("starting symbol %s is not defined", spec.startingSymbol))
+		}
+	} else if lbdi, ok := e.initiallyBasedBanks[codeRegister]; ok {
+		e.startingAddress = e.banks[lbdi].bankDescriptor.GetLowerLimitNormalized()
+	}
+
+	if _, ok := e.initiallyBasedBanks[codeRegister]; !ok {
+		diagnostics.NewError(linkSourceSet, 0, fmt.Sprintf("no bank is initially based on B%d", codeRegister))
+	}
+
+	return e, diagnostics
+}
+
+// checkBasicModeOverlap verifies that the address ranges of banks initially based on B12 through B15 do not overlap,
+// since basic mode selects a base register by comparing the relative address against the bank limits.
+func checkBasicModeOverlap(e *Executable, diagnostics *DiagnosticSet) {
+	if !e.basicMode {
+		return
+	}
+
+	for brx1 := uint64(12); brx1 < 16; brx1++ {
+		lbdi1, ok := e.initiallyBasedBanks[brx1]
+		if !ok {
+			continue
+		}
+
+		bd1 := e.banks[lbdi1].bankDescriptor
+		for brx2 := brx1 + 1; brx2 < 16; brx2++ {
+			lbdi2, ok := e.initiallyBasedBanks[brx2]
+			if !ok {
+				continue
+			}
+
+			bd2 := e.banks[lbdi2].bankDescriptor
+			if bd1.GetLowerLimitNormalized() <= bd2.GetUpperLimitNormalized() &&
+				bd2.GetLowerLimitNormalized() <= bd1.GetUpperLimitNormalized() {
+				diagnostics.NewError(linkSourceSet, 0,
+					fmt.Sprintf("banks %06o on B%d and %06o on B%d overlap", lbdi1, brx1, lbdi2, brx2))
+			}
+		}
+	}
+}
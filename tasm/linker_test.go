@@ -0,0 +1,166 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"strings"
+	"testing"
+)
+
+const linkerTestSource = "         .SEG     2\n" +
+	"table    W        1\n" +
+	"         W        2\n" +
+	"         .SEG     3\n" +
+	"more     W        table\n" +
+	"         .SEG     0\n" +
+	"         W        0\n" +
+	"start    LA       A0,more,,B2\n" +
+	"         IAR      0\n"
+
+func checkLinkDiagnostics(t *testing.T, diagnostics *DiagnosticSet, expected []string) {
+	diags := diagnostics.GetDiagnostics()
+	if len(diags) != len(expected) {
+		for _, diag := range diags {
+			t.Logf("%s", diag.GetString())
+		}
+		t.Fatalf("Error expected %d diagnostics, got %d", len(expected), len(diags))
+	}
+	for dx, diag := range diags {
+		if !strings.Contains(diag.GetString(), expected[dx]) {
+			t.Errorf("Error expected diagnostic containing '%s', got '%s'", expected[dx], diag.GetString())
+		}
+	}
+}
+
+func Test_Linker_LinkSpecFile(t *testing.T) {
+	a := assembleSource(linkerTestSource)
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error unexpected diagnostics %v", a.GetDiagnostics().GetDiagnostics())
+	}
+
+	spec, err := LoadLinkSpec("testdata/link.json")
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	e, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+
+	if len(e.GetBanks()) != 3 {
+		t.Fatalf("Error expected 3 banks, got %d", len(e.GetBanks()))
+	}
+
+	code := e.GetBanks()[0600004]
+	bd := code.GetBankDescriptor()
+	if bd.GetAccessLock().GetRing() != 1 || bd.GetAccessLock().GetDomain() != 5 {
+		t.Errorf("Error wrong access lock %s", bd.GetAccessLock().GetString())
+	}
+	if bd.GetGeneralAccessPermissions().GetString() != "Permissions:ER-" {
+		t.Errorf("Error wrong GAP %s", bd.GetGeneralAccessPermissions().GetString())
+	}
+
+	// segment 2 is two words at 02000, so segment 3 (more) is at 02002 and contains the address of table
+	data := e.GetBanks()[0400010]
+	if data.GetCodeLength() != 3 || data.GetCode()[2] != 02000 {
+		t.Errorf("Error unexpected data bank content %v", data.GetCode())
+	}
+	if code.GetCode()[1] != 0_100000_022002 {
+		t.Errorf("Error unexpected code %012o", code.GetCode()[1])
+	}
+
+	if e.GetBanks()[0200020].GetCodeLength() != 0100 {
+		t.Errorf("Error expected the work bank to be 0100 words")
+	}
+
+	// upper limits are inclusive
+	for lbdi, upper := range map[uint64]uint64{0600004: 01002, 0400010: 02002, 0200020: 01077} {
+		bd := e.GetBanks()[lbdi].GetBankDescriptor()
+		if bd.GetUpperLimitNormalized() != upper {
+			t.Errorf("Error bank %06o expected upper limit %06o, got %06o", lbdi, upper, bd.GetUpperLimitNormalized())
+		}
+	}
+
+	if e.GetStartingAddress() != 01001 || e.GetProcessorPrivilege() != 2 || e.IsBasicMode() {
+		t.Errorf("Error unexpected starting state %o %d", e.GetStartingAddress(), e.GetProcessorPrivilege())
+	}
+	basing := e.GetInitiallyBasedBanks()
+	if basing[0] != 0600004 || basing[2] != 0400010 || basing[5] != 0200020 {
+		t.Errorf("Error unexpected initial basing %v", basing)
+	}
+}
+
+func Test_Linker_SpecDiagnostics(t *testing.T) {
+	a := assembleSource(linkerTestSource)
+	spec := NewLinkSpec().
+		AddBank(NewBankSpec(0600004, 0, 2)).
+		AddBank(NewBankSpec(0600004, 3)).
+		AddBank(NewBankSpec(0000010, 3)).
+		AddBank(NewBankSpec(0600005, 2, 077).SetAccessLock(4, 0).SetLowerLimit(01234)).
+		BaseOn(2, 0600007).
+		BaseOn(16, 0600004).
+		SetStartingSymbol("nowhere")
+
+	_, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{
+		"bank 600004 is specified more than once",
+		"invalid L,BDI 000010",
+		"invalid access lock for bank 600005",
+		"invalid lower limit for bank 600005",
+		"segment 002 is in bank 600004 and bank 600005",
+		"segment 077 in bank 600005 does not exist",
+		"bank 600005 is empty",
+		"segment 003 is not in any bank",
+		"bank 600007 for B2 is not defined",
+		"bank 600004 cannot be initially based on B16",
+		"starting symbol nowhere is not defined",
+		"no bank is initially based on B0",
+		"E:test:8:undefined symbol MORE",
+	})
+}
+
+func Test_Linker_BasicModeOverlap(t *testing.T) {
+	a := assembleSource(linkerTestSource)
+	spec := NewLinkSpec().
+		SetBasicMode(true).
+		AddBank(NewBankSpec(0600004, 0).SetBasicMode(true)).
+		AddBank(NewBankSpec(0600005, 2, 3).SetBasicMode(true)).
+		BaseOn(12, 0600004).
+		BaseOn(13, 0600005).
+		BaseOn(2, 0600005)
+
+	_, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{
+		"bank 600005 cannot be initially based on B2",
+		"banks 600004 on B12 and 600005 on B13 overlap",
+	})
+}
+
+func Test_Linker_BasicModeAdjacent(t *testing.T) {
+	// a bank of 01000 words at 01000 ends at 01777, so it abuts (but does not overlap) a bank at 02000
+	a := assembleSource(linkerTestSource)
+	spec := NewLinkSpec().
+		SetBasicMode(true).
+		AddBank(NewBankSpec(0600004, 0).SetBasicMode(true).SetSize(01000)).
+		AddBank(NewBankSpec(0600005, 2, 3).SetBasicMode(true).SetLowerLimit(02000)).
+		BaseOn(12, 0600004).
+		BaseOn(13, 0600005)
+
+	_, diagnostics := Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+
+	// one more word, and the last word of the first bank is the first word of the second
+	spec = NewLinkSpec().
+		SetBasicMode(true).
+		AddBank(NewBankSpec(0600004, 0).SetBasicMode(true).SetSize(01001)).
+		AddBank(NewBankSpec(0600005, 2, 3).SetBasicMode(true).SetLowerLimit(02000)).
+		BaseOn(12, 0600004).
+		BaseOn(13, 0600005)
+
+	_, diagnostics = Link(a.GetSegments(), spec)
+	checkLinkDiagnostics(t, diagnostics, []string{
+		"banks 600004 on B12 and 600005 on B13 overlap",
+	})
+}
@@ -0,0 +1,294 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// An object module is the relocatable result of assembling one or more source sets.
+// It holds the segments with their generated code, the labels defined in those segments (all of which are
+// exported, except for the hidden location counter origins), the unresolved references along with the bit
+// positions they modify, and the source line from which each block of code was generated.
+// Object modules are written as JSON, so that they remain readable (and diffable) by humans.
+//
+// Object modules are combined with MergeSegments, which appends same-numbered segments from each module
+// in turn. The result may then be linked in the usual way - thus a library may be assembled once,
+// and linked into many programs.
+
+const objectModuleFormat = "tasm-object"
+const objectModuleVersion = 1
+
+type ObjectModule struct {
+	name     string
+	segments map[uint64]*Segment
+}
+
+type objectModuleFile struct {
+	Format   string              `json:"format"`
+	Version  int                 `json:"version"`
+	Name     string              `json:"name"`
+	Segments []objectSegmentFile `json:"segments"`
+}
+
+type objectSegmentFile struct {
+	Number uint64            `json:"number"`
+	Length uint64            `json:"length"`
+	Labels map[string]uint64 `json:"labels"`
+	Blocks []objectBlockFile `json:"blocks"`
+}
+
+type objectBlockFile struct {
+	Source     string                `json:"source"`
+	Line       uint64                `json:"line"`
+	Offset     uint64                `json:"offset"`
+	Label      string                `json:"label,omitempty"`
+	Command    string                `json:"command,omitempty"`
+	Operands   []string              `json:"operands,omitempty"`
+	Code       []uint64              `json:"code,omitempty"`
+	References []objectReferenceFile `json:"references,omitempty"`
+}
+
+type objectReferenceFile struct {
+	Symbol      string `json:"symbol"`
+	Offset      uint64 `json:"offset"`
+	StartingBit uint64 `json:"startingBit"`
+	BitCount    uint64 `json:"bitCount"`
+	Subtract    bool   `json:"subtract,omitempty"`
+}
+
+func NewObjectModule(name string, segments map[uint64]*Segment) *ObjectModule {
+	return &ObjectModule{
+		name:     name,
+		segments: segments,
+	}
+}
+
+// GetObjectModule packages the segments assembled so far as an object module with the given name
+func (a *TinyAssembler) GetObjectModule(name string) *ObjectModule {
+	return NewObjectModule(name, a.segments)
+}
+
+func (om *ObjectModule) GetName() string {
+	return om.name
+}
+
+func (om *ObjectModule) GetSegments() map[uint64]*Segment {
+	return om.segments
+}
+
+// Write writes the object module to the given writer
+func (om *ObjectModule) Write(writer io.Writer) error {
+	omf := objectModuleFile{
+		Format:   objectModuleFormat,
+		Version:  objectModuleVersion,
+		Name:     om.name,
+		Segments: make([]objectSegmentFile, 0),
+	}
+
+	for _, segmentNumber := range getOrderedSegmentNumbers(om.segments) {
+		segment := om.segments[segmentNumber]
+		osf := objectSegmentFile{
+			Number: segmentNumber,
+			Length: segment.currentLength,
+			Labels: segment.labels,
+			Blocks: make([]objectBlockFile, 0),
+		}
+
+		for _, cb := range segment.generatedCode {
+			obf := objectBlockFile{
+				Source: cb.sourceSet.name,
+				Line:   cb.lineNumber,
+				Offset: cb.segmentOffset,
+				Code:   cb.code,
+			}
+			if cb.sourceItem.label != nil {
+				obf.Label = *cb.sourceItem.label
+			}
+			if cb.sourceItem.command != nil {
+				obf.Command = *cb.sourceItem.command
+			}
+			obf.Operands = cb.sourceItem.operands
+
+			for _, ref := range cb.references {
+				obf.References = append(obf.References, objectReferenceFile{
+					Symbol:      ref.symbol,
+					Offset:      ref.offset,
+					StartingBit: ref.startingBit,
+					BitCount:    ref.bitCount,
+					Subtract:    ref.subtract,
+				})
+			}
+			osf.Blocks = append(osf.Blocks, obf)
+		}
+
+		omf.Segments = append(omf.Segments, osf)
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&omf)
+}
+
+// Save writes the object module to the named file
+func (om *ObjectModule) Save(fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	err = om.Write(file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadObjectModule reads an object module from the given reader
+func ReadObjectModule(reader io.Reader) (*ObjectModule, error) {
+	var omf objectModuleFile
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&omf)
+	if err != nil {
+		return nil, err
+	}
+
+	if omf.Format != objectModuleFormat {
+		return nil, fmt.Errorf("not an object module")
+	} else if omf.Version != objectModuleVersion {
+		return nil, fmt.Errorf("unsupported object module version %d", omf.Version)
+	}
+
+	sourceSets := make(map[string]*SourceSet)
+	segments := make(map[uint64]*Segment)
+	for _, osf := range omf.Segments {
+		if osf.Number > 077 {
+			return nil, fmt.Errorf("invalid segment number %o", osf.Number)
+		} else if _, ok := segments[osf.Number]; ok {
+			return nil, fmt.Errorf("segment %03o appears more than once", osf.Number)
+		}
+
+		segment := NewSegment()
+		for label, offset := range osf.Labels {
+			segment.labels[label] = offset
+		}
+
+		for _, obf := range osf.Blocks {
+			sourceSet, ok := sourceSets[obf.Source]
+			if !ok {
+				sourceSet = NewSourceSet(obf.Source, nil)
+				sourceSets[obf.Source] = sourceSet
+			}
+
+			if obf.Offset != segment.currentLength {
+				return nil, fmt.Errorf("segment %03o block at line %d is out of sequence", osf.Number, obf.Line)
+			}
+
+			item := NewSourceItem(obf.Label, obf.Command, obf.Operands)
+			item.lineNumber = obf.Line
+			cb := NewCodeBlock(sourceSet, item, obf.Line, osf.Number, obf.Offset)
+			cb.code = append(cb.code, obf.Code...)
+			for _, orf := range obf.References {
+				if orf.Offset < obf.Offset || orf.Offset >= obf.Offset+uint64(len(obf.Code)) ||
+					orf.StartingBit+orf.BitCount > 36 || orf.BitCount == 0 {
+					return nil, fmt.Errorf("segment %03o block at line %d has an invalid reference", osf.Number, obf.Line)
+				}
+				ref := NewReference(orf.Symbol, orf.StartingBit, orf.BitCount, orf.Offset)
+				ref.subtract = orf.Subtract
+				cb.references = append(cb.references, ref)
+			}
+
+			segment.AppendCodeBlock(cb)
+		}
+
+		if segment.currentLength != osf.Length {
+			return nil, fmt.Errorf("segment %03o length does not match its content", osf.Number)
+		}
+		segments[osf.Number] = segment
+	}
+
+	return NewObjectModule(omf.Name, segments), nil
+}
+
+// LoadObjectModule reads an object module from the named file
+func LoadObjectModule(fileName string) (*ObjectModule, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	om, err := ReadObjectModule(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", fileName, err.Error())
+	}
+	return om, nil
+}
+
+// isLocalSymbol indicates whether the symbol is private to its object module (i.e., a location counter origin)
+func isLocalSymbol(symbol string) bool {
+	return strings.HasPrefix(symbol, "$SEG")
+}
+
+// MergeSegments combines the segments of the given object modules. Segments with the same number are
+// concatenated in the order in which the modules are given, with labels and references adjusted accordingly.
+// A label which is defined in more than one module is reported as an error.
+func MergeSegments(modules ...*ObjectModule) (map[uint64]*Segment, *DiagnosticSet) {
+	diagnostics := NewDiagnosticSet()
+	result := make(map[uint64]*Segment)
+	definedBy := make(map[string]string)
+
+	for mx, om := range modules {
+		localName := func(symbol string) string {
+			if isLocalSymbol(symbol) {
+				return fmt.Sprintf("%s.%d", symbol, mx)
+			}
+			return symbol
+		}
+
+		for _, segmentNumber := range getOrderedSegmentNumbers(om.segments) {
+			segment := om.segments[segmentNumber]
+			target, ok := result[segmentNumber]
+			if !ok {
+				target = NewSegment()
+				result[segmentNumber] = target
+			}
+			base := target.currentLength
+
+			for label, offset := range segment.labels {
+				if !isLocalSymbol(label) {
+					if prior, ok := definedBy[label]; ok {
+						diagnostics.NewError(linkSourceSet, 0,
+							fmt.Sprintf("label %s is defined in module %s and module %s", label, prior, om.name))
+						continue
+					}
+					definedBy[label] = om.name
+				}
+				target.labels[localName(label)] = base + offset
+			}
+
+			for _, cb := range segment.generatedCode {
+				newCB := NewCodeBlock(cb.sourceSet, cb.sourceItem, cb.lineNumber, segmentNumber, base+cb.segmentOffset)
+				newCB.code = cb.code
+				for _, ref := range cb.references {
+					newRef := NewReference(localName(ref.symbol), ref.startingBit, ref.bitCount, base+ref.offset)
+					newRef.subtract = ref.subtract
+					newCB.references = append(newCB.references, newRef)
+				}
+
+				target.AppendCodeBlock(newCB)
+			}
+		}
+	}
+
+	return result, diagnostics
+}
@@ -0,0 +1,107 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const objectModuleLibrarySource = "         .SEG     0\n" +
+	"square   W        $\n" +
+	"         W        value\n" +
+	"         .SEG     2\n" +
+	"value    W        5\n"
+
+const objectModuleMainSource = "         .SEG     0\n" +
+	"start    W        square\n" +
+	"         W        0\n" +
+	"         .SEG     2\n" +
+	"mine     W        -mine\n"
+
+// assembleObjectModule assembles the given source, then writes and reads back the resulting object module
+func assembleObjectModule(t *testing.T, name string, source string) *ObjectModule {
+	sourceSet, _, _ := ParseSource(name, strings.NewReader(source))
+	a := NewTinyAssembler()
+	a.Assemble(sourceSet)
+	if a.GetDiagnostics().GetErrorCount() > 0 {
+		t.Fatalf("Error unexpected diagnostics %v", a.GetDiagnostics().GetDiagnostics())
+	}
+
+	buffer := &bytes.Buffer{}
+	err := a.GetObjectModule(name).Write(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	om, err := ReadObjectModule(buffer)
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	return om
+}
+
+func Test_ObjectModule_RoundTrip(t *testing.T) {
+	om := assembleObjectModule(t, "lib", objectModuleLibrarySource)
+	if om.GetName() != "lib" || len(om.GetSegments()) != 2 {
+		t.Fatalf("Error unexpected module %s with %d segments", om.GetName(), len(om.GetSegments()))
+	}
+
+	segment := om.GetSegments()[0]
+	if segment.currentLength != 2 || segment.labels["SQUARE"] != 0 {
+		t.Errorf("Error unexpected segment length %d labels %v", segment.currentLength, segment.labels)
+	}
+	if len(segment.references) != 2 || segment.references[1].symbol != "VALUE" || segment.references[1].offset != 1 {
+		t.Errorf("Error unexpected references")
+	}
+
+	cb := segment.generatedCode[2]
+	if cb.sourceSet.GetName() != "lib" || cb.lineNumber != 3 || *cb.sourceItem.command != "W" {
+		t.Errorf("Error unexpected line info %s:%d %s", cb.sourceSet.GetName(), cb.lineNumber, cb.sourceItem.GetString())
+	}
+}
+
+func Test_ObjectModule_MergeAndLink(t *testing.T) {
+	main := assembleObjectModule(t, "main", objectModuleMainSource)
+	lib := assembleObjectModule(t, "lib", objectModuleLibrarySource)
+
+	segments, diagnostics := MergeSegments(main, lib)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+
+	spec := NewLinkSpec().
+		AddBank(NewBankSpec(0600004, 0, 2)).
+		BaseOn(0, 0600004).
+		SetStartingSymbol("start")
+	e, diagnostics := Link(segments, spec)
+	checkLinkDiagnostics(t, diagnostics, []string{})
+
+	expected := []uint64{01002, 0, 01002, 01005, 0_777777_776773, 5}
+	code := e.GetBanks()[0600004].code
+	checkCode(t, code, expected)
+}
+
+func Test_ObjectModule_Errors(t *testing.T) {
+	lib := assembleObjectModule(t, "lib", objectModuleLibrarySource)
+	again := assembleObjectModule(t, "again", objectModuleLibrarySource)
+	_, diagnostics := MergeSegments(lib, again)
+	checkLinkDiagnostics(t, diagnostics, []string{
+		"label SQUARE is defined in module lib and module again",
+		"label VALUE is defined in module lib and module again",
+	})
+
+	_, err := ReadObjectModule(strings.NewReader(`{"format":"something-else","version":1}`))
+	if err == nil {
+		t.Errorf("Error expected failure for wrong format")
+	}
+
+	_, err = ReadObjectModule(strings.NewReader(`{"format":"tasm-object","version":1,"segments":[` +
+		`{"number":0,"length":1,"blocks":[{"source":"x","line":1,"offset":0,"code":[0],` +
+		`"references":[{"symbol":"A","offset":0,"startingBit":30,"bitCount":18}]}]}]}`))
+	if err == nil {
+		t.Errorf("Error expected failure for invalid reference")
+	}
+}
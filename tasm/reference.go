@@ -10,6 +10,7 @@ type Reference struct {
 	startingBit uint64
 	bitCount    uint64
 	offset      uint64
+	subtract    bool // the value of the symbol is to be subtracted from, rather than added to, the field
 }
 
 func NewReference(symbol string, startingBit uint64, bitCount uint64, offset uint64) *Reference {
@@ -20,3 +21,9 @@ func NewReference(symbol string, startingBit uint64, bitCount uint64, offset uin
 		offset:      offset,
 	}
 }
+
+// SetSubtract indicates whether the value of the symbol is to be subtracted from, rather than added to, the field
+func (r *Reference) SetSubtract(value bool) *Reference {
+	r.subtract = value
+	return r
+}
@@ -21,7 +21,30 @@ func NewSegment() *Segment {
 	}
 }
 
+// AppendCodeBlock appends a code block (which should begin at the current length of the segment)
+// along with its references, to the segment
 func (s *Segment) AppendCodeBlock(cb *CodeBlock) {
 	s.generatedCode = append(s.generatedCode, cb)
 	s.currentLength += uint64(len(cb.code))
+	s.references = append(s.references, cb.references...)
+}
+
+// GetCode returns the words generated for the segment, in order
+func (s *Segment) GetCode() []uint64 {
+	code := make([]uint64, 0, s.currentLength)
+	for _, cb := range s.generatedCode {
+		code = append(code, cb.code...)
+	}
+	return code
+}
+
+// GetLength returns the number of words generated for the segment
+func (s *Segment) GetLength() uint64 {
+	return s.currentLength
+}
+
+// SetLabel defines a label at the given offset from the start of the segment
+func (s *Segment) SetLabel(label string, offset uint64) *Segment {
+	s.labels[label] = offset
+	return s
 }
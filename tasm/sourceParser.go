@@ -0,0 +1,196 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Source text is line-oriented, in the traditional columnar layout:
+//
+//	label   operation   operand,operand,...   . comment
+//
+// A label must begin in column 1 - a line which begins with a blank has no label.
+// The operation field follows the label field (or the leading blanks), and the operand field follows the
+// operation field. Operands are separated by commas; commas within quoted strings or parentheses do not
+// separate operands. Quoted strings are delimited by either single or double quotes.
+// A period which is preceded by a blank (or begins the line) and is followed by a blank (or ends the line)
+// begins a comment, which extends to the end of the line.
+// A semicolon as the last non-blank character of a line (ignoring any comment) continues the statement
+// on the next line. The line number of a statement is the line number of its first line.
+
+// ParseSourceFile reads the assembler source in the given file.
+// The name of the resulting source set is the base name of the file.
+// An error is returned only if the file cannot be read - syntax errors are reported in the diagnostic set.
+func ParseSourceFile(fileName string) (*SourceSet, *DiagnosticSet, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return ParseSource(filepath.Base(fileName), file)
+}
+
+// ParseSource reads assembler source text from the given reader, producing a source set with the given name.
+// An error is returned only if the reader fails - syntax errors are reported in the diagnostic set.
+func ParseSource(name string, reader io.Reader) (*SourceSet, *DiagnosticSet, error) {
+	sourceSet := NewSourceSet(name, make([]*SourceItem, 0))
+	diagnostics := NewDiagnosticSet()
+
+	scanner := bufio.NewScanner(reader)
+	var lineNumber uint64
+	var statement string
+	var statementLine uint64
+	continuing := false
+	for scanner.Scan() {
+		lineNumber++
+		text, ok := stripComment(scanner.Text())
+		if !ok {
+			diagnostics.NewError(sourceSet, lineNumber, "unterminated string")
+		}
+
+		text = strings.TrimRight(text, " \t")
+		if continuing {
+			statement += strings.TrimLeft(text, " \t")
+		} else {
+			statement = text
+			statementLine = lineNumber
+		}
+
+		continuing = strings.HasSuffix(statement, ";")
+		if continuing {
+			statement = statement[:len(statement)-1]
+			continue
+		}
+
+		item := parseStatement(sourceSet, diagnostics, statementLine, statement)
+		if item != nil {
+			sourceSet.sourceItems = append(sourceSet.sourceItems, item)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if continuing {
+		diagnostics.NewWarning(sourceSet, statementLine, "continuation at end of source")
+		item := parseStatement(sourceSet, diagnostics, statementLine, statement)
+		if item != nil {
+			sourceSet.sourceItems = append(sourceSet.sourceItems, item)
+		}
+	}
+
+	return sourceSet, diagnostics, nil
+}
+
+// parseStatement splits a complete statement (comments removed, continuations joined) into its fields.
+// Returns nil if the statement is empty.
+func parseStatement(sourceSet *SourceSet, diagnostics *DiagnosticSet, lineNumber uint64, text string) *SourceItem {
+	if len(strings.TrimSpace(text)) == 0 {
+		return nil
+	}
+
+	label := ""
+	if text[0] != ' ' && text[0] != '\t' {
+		label, text = splitField(text)
+	}
+
+	operation, text := splitField(strings.TrimLeft(text, " \t"))
+	operandField := strings.TrimSpace(text)
+
+	operands := make([]string, 0)
+	if len(operandField) > 0 {
+		var ok bool
+		operands, ok = splitOperands(operandField)
+		if !ok {
+			diagnostics.NewError(sourceSet, lineNumber, "unbalanced parentheses in operand field")
+		}
+	}
+
+	if len(operation) == 0 && len(operands) > 0 {
+		diagnostics.NewWarning(sourceSet, lineNumber, "operands ignored - no operator specified")
+	}
+
+	item := NewSourceItem(label, operation, operands)
+	item.lineNumber = lineNumber
+	return item
+}
+
+// splitField returns the text up to the first blank, and the remainder of the text
+func splitField(text string) (field string, remainder string) {
+	ix := strings.IndexAny(text, " \t")
+	if ix < 0 {
+		return text, ""
+	}
+	return text[:ix], text[ix:]
+}
+
+// splitOperands separates the operand field at commas which are not within quotes or parentheses.
+// Returns false if parentheses are unbalanced.
+func splitOperands(text string) ([]string, bool) {
+	operands := make([]string, 0)
+	depth := 0
+	var quote rune
+	start := 0
+	for ix, ch := range text {
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch ch {
+		case '\'', '"':
+			quote = ch
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				operands = append(operands, strings.TrimSpace(text[start:ix]))
+				start = ix + 1
+			}
+		}
+	}
+
+	operands = append(operands, strings.TrimSpace(text[start:]))
+	return operands, depth == 0
+}
+
+// stripComment removes the comment (if any) from a line of source.
+// Returns false if the line contains an unterminated string.
+func stripComment(text string) (string, bool) {
+	var quote byte
+	for ix := 0; ix < len(text); ix++ {
+		ch := text[ix]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if ch == '\'' || ch == '"' {
+			quote = ch
+		} else if ch == '.' {
+			blankBefore := ix == 0 || text[ix-1] == ' ' || text[ix-1] == '\t'
+			blankAfter := ix+1 == len(text) || text[ix+1] == ' ' || text[ix+1] == '\t'
+			if blankBefore && blankAfter {
+				return text[:ix], true
+			}
+		}
+	}
+
+	return text, quote == 0
+}
@@ -0,0 +1,97 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"strings"
+	"testing"
+)
+
+func checkSourceItem(t *testing.T, item *SourceItem, lineNumber uint64, label string, command string, operands []string) {
+	if item.GetLineNumber() != lineNumber {
+		t.Errorf("Error expected line number %d, got %d", lineNumber, item.GetLineNumber())
+	}
+	if *item.label != label {
+		t.Errorf("Error line %d expected label '%s', got '%s'", lineNumber, label, *item.label)
+	}
+	if *item.command != command {
+		t.Errorf("Error line %d expected command '%s', got '%s'", lineNumber, command, *item.command)
+	}
+	if strings.Join(item.operands, "|") != strings.Join(operands, "|") {
+		t.Errorf("Error line %d expected operands %v, got %v", lineNumber, operands, item.operands)
+	}
+}
+
+func Test_SourceParser_File(t *testing.T) {
+	sourceSet, diagnostics, err := ParseSourceFile("testdata/sample.asm")
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+	if diagnostics.GetErrorCount() != 0 || diagnostics.GetWarningCount() != 0 {
+		t.Fatalf("Error unexpected diagnostics %v", diagnostics.GetDiagnostics())
+	}
+	if sourceSet.GetName() != "sample.asm" {
+		t.Errorf("Error unexpected source set name '%s'", sourceSet.GetName())
+	}
+
+	items := sourceSet.GetSourceItems()
+	if len(items) != 7 {
+		t.Fatalf("Error expected 7 source items, got %d", len(items))
+	}
+
+	checkSourceItem(t, items[0], 3, "", ".SEG", []string{"077"})
+	checkSourceItem(t, items[1], 4, "VALUE", "W", []string{"0123"})
+	checkSourceItem(t, items[2], 5, "PAIR", "HW", []string{"01", "02"})
+	checkSourceItem(t, items[3], 7, "MESSAGE", ".ASC", []string{"'a,b'"})
+	checkSourceItem(t, items[4], 9, "", ".SEG", []string{"0"})
+	checkSourceItem(t, items[5], 10, "START", "FJAXHIU", []string{"010", "0", "0", "0", "0", "0", "value"})
+	checkSourceItem(t, items[6], 12, "", "FJAXU", []string{"073", "017", "006", "0", "0"})
+}
+
+func Test_SourceParser_Fields(t *testing.T) {
+	source := "label\n" +
+		"  op\n" +
+		"lab2 op2 a , (b,c) , d . comment\n" +
+		"lab3 op3 x.y\n" +
+		"     op4 'unterminated\n"
+	sourceSet, diagnostics, err := ParseSource("test", strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Error:%s", err.Error())
+	}
+
+	items := sourceSet.GetSourceItems()
+	if len(items) != 5 {
+		t.Fatalf("Error expected 5 source items, got %d", len(items))
+	}
+
+	checkSourceItem(t, items[0], 1, "LABEL", "", []string{})
+	checkSourceItem(t, items[1], 2, "", "OP", []string{})
+	checkSourceItem(t, items[2], 3, "LAB2", "OP2", []string{"a", "(b,c)", "d"})
+	checkSourceItem(t, items[3], 4, "LAB3", "OP3", []string{"x.y"})
+
+	diags := diagnostics.GetDiagnostics()
+	if diagnostics.GetErrorCount() != 1 || len(diags) != 1 || diags[0].GetLineNumber() != 5 {
+		t.Errorf("Error expected one error diagnostic on line 5, got %v", diags)
+	}
+}
+
+func Test_SourceParser_AssemblerLineNumbers(t *testing.T) {
+	source := ". leading comment\n" +
+		"\n" +
+		"         W      01\n" +
+		"         BOGUS  02\n"
+	sourceSet, _, _ := ParseSource("test", strings.NewReader(source))
+
+	a := NewTinyAssembler()
+	a.Assemble(sourceSet)
+	diags := a.GetDiagnostics().GetDiagnostics()
+	if a.GetDiagnostics().GetErrorCount() != 1 || len(diags) != 1 {
+		t.Fatalf("Error expected one diagnostic, got %v", diags)
+	}
+	if diags[0].GetLineNumber() != 4 {
+		t.Errorf("Error expected the diagnostic on line 4, got line %d", diags[0].GetLineNumber())
+	}
+}
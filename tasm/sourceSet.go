@@ -16,9 +16,10 @@ type SourceSet struct {
 }
 
 type SourceItem struct {
-	label    *string
-	command  *string
-	operands []string
+	lineNumber uint64 // zero if the item was not read from source text
+	label      *string
+	command    *string
+	operands   []string
 }
 
 func NewSourceItem(label string, command string, operands []string) *SourceItem {
@@ -32,6 +33,12 @@ func NewSourceItem(label string, command string, operands []string) *SourceItem
 	}
 }
 
+// GetLineNumber returns the line number in the source text at which this item begins,
+// or zero if the item was constructed directly.
+func (si *SourceItem) GetLineNumber() uint64 {
+	return si.lineNumber
+}
+
 func (si *SourceItem) GetString() string {
 	lab := ""
 	if si.label != nil {
@@ -57,3 +64,11 @@ func NewSourceSet(name string, sourceItems []*SourceItem) *SourceSet {
 		sourceItems: sourceItems,
 	}
 }
+
+func (ss *SourceSet) GetName() string {
+	return ss.name
+}
+
+func (ss *SourceSet) GetSourceItems() []*SourceItem {
+	return ss.sourceItems
+}
@@ -7,14 +7,20 @@ package tasm
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
+	"strings"
 
-	"khalehla/old/parser"
+	"khalehla/common"
 )
 
 // TinyAssembler is a very tiny assembler which assists in unit tests
 type TinyAssembler struct {
+	basicMode            bool
+	codeBlocks           []*CodeBlock // every code block, in the order assembled, for the listing
 	currentSegmentNumber uint64
+	diagnostics          *DiagnosticSet
 	forms                map[string][]uint64
 	segments             map[uint64]*Segment
 }
@@ -22,6 +28,7 @@ type TinyAssembler struct {
 func NewTinyAssembler() *TinyAssembler {
 	ta := &TinyAssembler{}
 	ta.currentSegmentNumber = 0
+	ta.diagnostics = NewDiagnosticSet()
 	ta.forms = map[string][]uint64{
 		"W":        {36},
 		"HW":       {18, 18},
@@ -37,6 +44,13 @@ func NewTinyAssembler() *TinyAssembler {
 	return ta
 }
 
+// SetBasicMode selects basic mode or extended mode instruction encodings for subsequent source.
+// The assembler starts out in extended mode. Source may also change modes via .BASIC and .EXTEND.
+func (a *TinyAssembler) SetBasicMode(value bool) *TinyAssembler {
+	a.basicMode = value
+	return a
+}
+
 func (a *TinyAssembler) establishSegment(segmentNumber uint64) {
 	_, ok := a.segments[segmentNumber]
 	if !ok {
@@ -44,53 +58,32 @@ func (a *TinyAssembler) establishSegment(segmentNumber uint64) {
 	}
 }
 
-func evaluate(expression string) (uint64, []string, error) {
-	p := parser.NewParser(expression)
-	var value uint64
-	var references []string
-	wantOperator := false
-	wantTerm := true
-	for !p.AtEnd() {
-		if wantOperator {
-			p.SkipWhiteSpace()
-			if p.ParseCharacter('+') {
-				wantTerm = true
-				wantOperator = false
-				continue
-			}
-
-			return 0, nil, fmt.Errorf("expected an operator")
-		}
-
-		if wantTerm {
-			p.SkipWhiteSpace()
-			iVal, ok := p.ParseInteger(true, true)
-			if ok {
-				value += iVal
-				wantTerm = false
-				wantOperator = true
-				continue
-			}
-
-			sVal, err := p.ParseSymbol() // TODO we need to parse our own symbol
-			if err != nil {
-				return 0, nil, err
-			} else if sVal != nil {
-				references = append(references, *sVal)
-				wantTerm = false
-				wantOperator = true
-				continue
-			}
-		}
+// GetLocationSymbol returns the (hidden) label which marks the origin of the given segment.
+// References to the location counter are relocated relative to this label.
+func GetLocationSymbol(segmentNumber uint64) string {
+	return fmt.Sprintf("$SEG%03o", segmentNumber)
+}
 
-		return 0, nil, fmt.Errorf("syntax error in expression")
+// evaluate evaluates an expression in the context of the given code block.
+// The location counter is the location of the next word to be generated by the code block.
+func (a *TinyAssembler) evaluate(cb *CodeBlock, expression string) (*expressionValue, error) {
+	locationSymbol := GetLocationSymbol(cb.segmentNumber)
+	value, locationUsed, err := evaluate(expression, locationSymbol, cb.segmentOffset+uint64(len(cb.code)))
+	if err == nil && locationUsed {
+		a.segments[cb.segmentNumber].labels[locationSymbol] = 0
 	}
+	return value, err
+}
 
-	if wantTerm {
-		return 0, nil, fmt.Errorf("incomplete expression")
+// evaluateAbsolute evaluates an expression which must produce an absolute value
+func (a *TinyAssembler) evaluateAbsolute(cb *CodeBlock, expression string) (int64, error) {
+	value, err := a.evaluate(cb, expression)
+	if err != nil {
+		return 0, err
+	} else if value.isRelocatable() {
+		return 0, fmt.Errorf("relocatable value not allowed here")
 	}
-
-	return value, references, nil
+	return value.value, nil
 }
 
 func (a *TinyAssembler) processCommand(cb *CodeBlock) {
@@ -113,23 +106,38 @@ func (a *TinyAssembler) processCommand(cb *CodeBlock) {
 	switch *command {
 	case ".ASC":
 		a.processDataGenerationAscii(cb)
-		break
+		return
 
 	case ".FD":
 		a.processDataGenerationFieldata(cb)
-		break
+		return
 
 	case ".FORM":
 		a.processForm(cb)
-		break
+		return
 
 	case ".RES":
-		//	TODO reserve space
-		break
+		a.processReserve(cb)
+		return
+
+	case ".BASIC":
+		a.processMode(cb, true)
+		return
+
+	case ".EXTEND":
+		a.processMode(cb, false)
+		return
 
 	case ".SEG":
 		a.processSegment(cb)
 		return
+
+	default:
+		encoding := a.lookupInstruction(*command)
+		if encoding != nil {
+			a.processInstruction(cb, encoding)
+			return
+		}
 	}
 
 	cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "operator not recognized")
@@ -141,57 +149,200 @@ func (a *TinyAssembler) processDataGeneration(cb *CodeBlock, form []uint64) {
 		return
 	}
 
-	var bit uint64
-	var compositeValue uint64
-
+	values := make([]*expressionValue, len(form))
 	for fx := 0; fx < len(form); fx++ {
-		bitCount := form[fx]
-		iVal, symbols, err := evaluate(cb.sourceItem.operands[fx])
+		value, err := a.evaluate(cb, cb.sourceItem.operands[fx])
 		if err != nil {
 			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, err.Error())
-			continue
+			value = newAbsoluteValue(0)
 		}
+		values[fx] = value
+	}
+
+	a.generateWord(cb, form, values)
+}
+
+// generateWord composes a word from the given field values according to the form,
+// and appends it (along with references for any symbols in the field values) to the code block.
+// Negative values are stored in ones-complement form, within the width of the field.
+func (a *TinyAssembler) generateWord(cb *CodeBlock, form []uint64, values []*expressionValue) {
+	var bit uint64
+	var compositeValue uint64
 
+	offset := cb.segmentOffset + uint64(len(cb.code))
+	for fx := 0; fx < len(form); fx++ {
+		bitCount := form[fx]
 		mask := uint64((1 << bitCount) - 1)
+
+		iVal := uint64(values[fx].value)
+		if values[fx].value < 0 {
+			iVal = uint64(-values[fx].value)
+		}
 		if iVal&mask != iVal {
 			cb.diagnostics.NewWarning(cb.sourceSet, cb.lineNumber, fmt.Sprintf("truncated value at bit %v", bit))
 			iVal &= mask
 		}
+		if values[fx].value < 0 {
+			iVal ^= mask
+		}
 
 		compositeValue <<= bitCount
 		compositeValue |= iVal
 
-		offset := a.segments[a.currentSegmentNumber].currentLength
-		for _, sym := range symbols {
-			cb.references = append(cb.references, NewReference(sym, bit, bitCount, offset))
+		for _, sym := range values[fx].getSymbols() {
+			coefficient := values[fx].references[sym]
+			for count := coefficient; count != 0; {
+				ref := NewReference(sym, bit, bitCount, offset)
+				if count < 0 {
+					ref.subtract = true
+					count++
+				} else {
+					count--
+				}
+				cb.references = append(cb.references, ref)
+			}
 		}
 
 		bit += bitCount
 	}
 
+	for len(cb.forms) < len(cb.code) {
+		cb.forms = append(cb.forms, nil)
+	}
+	cb.forms = append(cb.forms, form)
 	cb.code = append(cb.code, compositeValue)
 }
 
+// parseString extracts the text of a quoted string operand. Either single or double quotes may be used,
+// and the delimiting quote may be included in the text by doubling it.
+func parseString(operand string) (string, bool) {
+	operand = strings.TrimSpace(operand)
+	if len(operand) < 2 || (operand[0] != '\'' && operand[0] != '"') || operand[len(operand)-1] != operand[0] {
+		return "", false
+	}
+
+	quote := operand[0:1]
+	text := operand[1 : len(operand)-1]
+	if strings.Contains(strings.ReplaceAll(text, quote+quote, ""), quote) {
+		return "", false
+	}
+	return strings.ReplaceAll(text, quote+quote, quote), true
+}
+
+// processDataGenerationString generates the words produced by packing the string operands with the given converter
+func (a *TinyAssembler) processDataGenerationString(cb *CodeBlock, convert func(string) []uint64) {
+	if len(cb.sourceItem.operands) == 0 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "string operand required")
+		return
+	}
+
+	text := ""
+	for _, operand := range cb.sourceItem.operands {
+		str, ok := parseString(operand)
+		if !ok {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "invalid string operand")
+			return
+		}
+		text += str
+	}
+
+	cb.code = append(cb.code, convert(text)...)
+}
+
+// processDataGenerationAscii generates ASCII text, packed four characters per word and space-filled
 func (a *TinyAssembler) processDataGenerationAscii(cb *CodeBlock) {
-	//	TODO
+	a.processDataGenerationString(cb, common.StringToAscii)
 }
 
+// processDataGenerationFieldata generates Fieldata text, packed six characters per word and space-filled
 func (a *TinyAssembler) processDataGenerationFieldata(cb *CodeBlock) {
-	//	TODO
+	a.processDataGenerationString(cb, common.StringToFieldata)
 }
 
+// processForm defines a new form, named by the label, with field widths given by the operands.
+// The field widths must add up to 36 bits.
 func (a *TinyAssembler) processForm(cb *CodeBlock) {
-	//	TODO
+	if cb.sourceItem.label == nil || len(*cb.sourceItem.label) == 0 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "label required for .FORM")
+		return
+	}
+	if len(cb.sourceItem.operands) == 0 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "field widths required for .FORM")
+		return
+	}
+
+	form := make([]uint64, len(cb.sourceItem.operands))
+	var total uint64
+	for fx, operand := range cb.sourceItem.operands {
+		width, err := a.evaluateAbsolute(cb, operand)
+		if err != nil {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, err.Error())
+			return
+		} else if width <= 0 || width > 36 {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "invalid field width")
+			return
+		}
+		form[fx] = uint64(width)
+		total += uint64(width)
+	}
+
+	if total != 36 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "field widths must total 36 bits")
+		return
+	}
+
+	if _, ok := a.forms[*cb.sourceItem.label]; ok {
+		cb.diagnostics.NewWarning(cb.sourceSet, cb.lineNumber, "form redefined")
+	}
+	a.forms[*cb.sourceItem.label] = form
 }
 
 func (a *TinyAssembler) processLabel(cb *CodeBlock) {
-	if cb.sourceItem.label != nil && len(*cb.sourceItem.label) > 0 {
-		_, ok := a.segments[a.currentSegmentNumber].labels[*cb.sourceItem.label]
-		if ok {
-			cb.diagnostics.NewWarning(cb.sourceSet, cb.lineNumber, "label overridden")
+	if cb.sourceItem.label == nil || len(*cb.sourceItem.label) == 0 {
+		return
+	}
+
+	// a .FORM label names the form, not a location
+	if cb.sourceItem.command != nil && *cb.sourceItem.command == ".FORM" {
+		return
+	}
+
+	label := *cb.sourceItem.label
+	for segmentNumber, segment := range a.segments {
+		if _, ok := segment.labels[label]; ok {
+			cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber,
+				fmt.Sprintf("label %s is already defined in segment %03o", label, segmentNumber))
+			return
 		}
-		a.segments[a.currentSegmentNumber].labels[*cb.sourceItem.label] = a.segments[a.currentSegmentNumber].currentLength
 	}
+
+	a.segments[a.currentSegmentNumber].labels[label] = a.segments[a.currentSegmentNumber].currentLength
+}
+
+// processReserve reserves (and zero-fills) the number of words given by the operand
+func (a *TinyAssembler) processReserve(cb *CodeBlock) {
+	if len(cb.sourceItem.operands) != 1 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "one operand required for .RES")
+		return
+	}
+
+	count, err := a.evaluateAbsolute(cb, cb.sourceItem.operands[0])
+	if err != nil {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, err.Error())
+		return
+	} else if count < 0 || count > 0_777777 {
+		cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, "invalid reservation size")
+		return
+	}
+
+	cb.code = append(cb.code, make([]uint64, count)...)
+}
+
+func (a *TinyAssembler) processMode(cb *CodeBlock, basicMode bool) {
+	if len(cb.sourceItem.operands) > 0 {
+		cb.diagnostics.NewWarning(cb.sourceSet, cb.lineNumber, "operands ignored")
+	}
+	a.basicMode = basicMode
 }
 
 func (a *TinyAssembler) processSegment(cb *CodeBlock) {
@@ -221,14 +372,16 @@ func (a *TinyAssembler) processSegment(cb *CodeBlock) {
 }
 
 func (a *TinyAssembler) Assemble(source *SourceSet) {
-	fmt.Printf("\nAssembling %s...\n", source.name)
 	codeBlocks := make([]*CodeBlock, len(source.sourceItems))
 	for sx, item := range source.sourceItems {
-		lineNumber := uint64(sx + 1)
+		lineNumber := item.lineNumber
+		if lineNumber == 0 {
+			lineNumber = uint64(sx + 1)
+		}
 
 		seg := a.segments[a.currentSegmentNumber]
 		offset := seg.currentLength
-		codeBlocks[sx] = NewCodeBlock(source, lineNumber, a.currentSegmentNumber, offset)
+		codeBlocks[sx] = NewCodeBlock(source, item, lineNumber, a.currentSegmentNumber, offset)
 		a.processLabel(codeBlocks[sx])
 
 		if item.command != nil {
@@ -236,19 +389,76 @@ func (a *TinyAssembler) Assemble(source *SourceSet) {
 		}
 
 		seg.AppendCodeBlock(codeBlocks[sx])
-		seg.references = append(seg.references, codeBlocks[sx].references...)
 	}
 
 	for _, cb := range codeBlocks {
-		cb.Emit()
+		a.diagnostics.Append(cb.diagnostics)
 	}
+	a.codeBlocks = append(a.codeBlocks, codeBlocks...)
+}
 
-	fmt.Printf("  Labels:\n")
-	for segNumber, segment := range a.segments {
-		for symbol, value := range segment.labels {
-			fmt.Printf("    %-12s = %03o:%08o\n", symbol, segNumber, value)
+// WriteListing writes a listing of everything assembled so far - each source line with the words generated for it
+// and any diagnostics it produced, followed by the labels defined in each segment.
+func (a *TinyAssembler) WriteListing(writer io.Writer) {
+	var sourceSet *SourceSet
+	for _, cb := range a.codeBlocks {
+		if cb.sourceSet != sourceSet {
+			sourceSet = cb.sourceSet
+			_, _ = fmt.Fprintf(writer, "\nSource %s\n\n", sourceSet.name)
 		}
+		cb.Emit(writer)
 	}
+
+	_, _ = fmt.Fprintf(writer, "\nLabels\n\n")
+	for _, segmentNumber := range getOrderedSegmentNumbers(a.segments) {
+		labels := a.segments[segmentNumber].labels
+		symbols := make([]string, 0, len(labels))
+		for symbol := range labels {
+			if !isLocalSymbol(symbol) {
+				symbols = append(symbols, symbol)
+			}
+		}
+		sort.Slice(symbols, func(i, j int) bool {
+			return labels[symbols[i]] < labels[symbols[j]] ||
+				(labels[symbols[i]] == labels[symbols[j]] && symbols[i] < symbols[j])
+		})
+
+		for _, symbol := range symbols {
+			_, _ = fmt.Fprintf(writer, "%-12s  %03o:%06o\n", symbol, segmentNumber, labels[symbol])
+		}
+	}
+
+	_, _ = fmt.Fprintf(writer, "\n%d error(s), %d warning(s)\n", a.diagnostics.GetErrorCount(), a.diagnostics.GetWarningCount())
+}
+
+// CheckReferences verifies that every symbol referenced by the source assembled so far is defined as a label
+// in some segment, posting an error against the referencing line for each symbol which is not.
+// It should be invoked after all the source sets have been assembled, since a symbol may be referenced
+// in one source set and defined in another.
+func (a *TinyAssembler) CheckReferences() {
+	defined := make(map[string]bool)
+	for _, segment := range a.segments {
+		for label := range segment.labels {
+			defined[label] = true
+		}
+	}
+
+	for _, segmentNumber := range getOrderedSegmentNumbers(a.segments) {
+		for _, cb := range a.segments[segmentNumber].generatedCode {
+			for _, ref := range cb.references {
+				if !defined[strings.ToUpper(ref.symbol)] {
+					message := fmt.Sprintf("undefined symbol %s referenced at %03o:%06o", ref.symbol, segmentNumber, ref.offset)
+					cb.diagnostics.NewError(cb.sourceSet, cb.lineNumber, message)
+					a.diagnostics.NewError(cb.sourceSet, cb.lineNumber, message)
+				}
+			}
+		}
+	}
+}
+
+// GetDiagnostics returns the diagnostics produced by all the source sets assembled so far
+func (a *TinyAssembler) GetDiagnostics() *DiagnosticSet {
+	return a.diagnostics
 }
 
 func (a *TinyAssembler) GetSegments() map[uint64]*Segment {
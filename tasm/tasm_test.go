@@ -0,0 +1,139 @@
+// khalehla Project
+// tiny assembler
+// Copyright © 2023-2025 by Kurt Duncan, BearSnake LLC
+// All Rights Reserved
+
+package tasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func assembleSource(source string) *TinyAssembler {
+	sourceSet, _, _ := ParseSource("test", strings.NewReader(source))
+	a := NewTinyAssembler()
+	a.Assemble(sourceSet)
+	a.CheckReferences()
+	return a
+}
+
+func checkDiagnosticLines(t *testing.T, a *TinyAssembler, lineNumbers []uint64) {
+	diags := a.GetDiagnostics().GetDiagnostics()
+	if len(diags) != len(lineNumbers) {
+		t.Fatalf("Error expected %d diagnostics, got %v", len(lineNumbers), diags)
+	}
+	for dx, lineNumber := range lineNumbers {
+		if diags[dx].GetLineNumber() != lineNumber {
+			t.Errorf("Error expected diagnostic %d on line %d, got %s", dx, lineNumber, diags[dx].GetString())
+		}
+	}
+}
+
+func Test_TinyAssembler_Strings(t *testing.T) {
+	source := "         .ASC     'ABCDE'\n" +
+		"         .FD      'ABC','DEF','G'\n" +
+		"         .ASC     \"it's\"\n" +
+		"         .ASC     'don''t'\n"
+	code, _ := assembleInstructions(t, false, source)
+	checkCode(t, code, []uint64{
+		0_101102_103104, 0_105040_040040,
+		0_060710_111213, 0_140505_050505,
+		0_151164_047163,
+		0_144157_156047, 0_164040_040040,
+	})
+}
+
+func Test_TinyAssembler_FormAndReserve(t *testing.T) {
+	source := "FFF      .FORM    12,6,18\n" +
+		"         FFF      01,02,-1\n" +
+		"buffer   .RES     2*3\n" +
+		"after    W        $-buffer\n" +
+		"         W        after-buffer\n"
+	code, segment := assembleInstructions(t, false, source)
+	checkCode(t, code, []uint64{0_0001_02_777776, 0, 0, 0, 0, 0, 0, 07, 0})
+	if segment.labels["BUFFER"] != 1 || segment.labels["AFTER"] != 7 {
+		t.Errorf("Error unexpected labels %v", segment.labels)
+	}
+
+	e := &Executable{}
+	e.LinkSimple(map[uint64]*Segment{0: segment}, true)
+	bankCode := e.GetBanks()[0_600004].code
+	if bankCode[7] != 6 || bankCode[8] != 6 {
+		t.Errorf("Error expected relocated differences of 6, got %012o %012o", bankCode[7], bankCode[8])
+	}
+}
+
+func Test_TinyAssembler_NegativeRelocation(t *testing.T) {
+	source := "         .SEG     1\n" +
+		"         W        0\n" +
+		"data     W        0\n" +
+		"         .SEG     0\n" +
+		"         LA       A0,data-1\n" +
+		"         LA       A0,data-data\n" +
+		"         HW       -data,$\n"
+	a := assembleSource(source)
+	if a.GetDiagnostics().GetErrorCount() != 0 {
+		t.Fatalf("Error unexpected diagnostics %v", a.GetDiagnostics().GetDiagnostics())
+	}
+
+	e := &Executable{}
+	e.LinkSimple(a.GetSegments(), true)
+	bankCode := e.GetBanks()[0_600004].code
+	// segment 0 is at 01000, segment 1 at 01003; so data is at 01004
+	expected := []uint64{0_100000_001003, 0_100000_000000, 0_776773_001002, 0, 0}
+	for cx, value := range expected {
+		if bankCode[cx] != value {
+			t.Errorf("Error word %d expected %012o, got %012o", cx, value, bankCode[cx])
+		}
+	}
+}
+
+func Test_TinyAssembler_SymbolDiagnostics(t *testing.T) {
+	source := "         .SEG     077\n" +
+		"label    W        1\n" +
+		"         .SEG     0\n" +
+		"label    W        2\n" +
+		"         W        nowhere\n" +
+		"         W        label*2\n" +
+		"         .RES     label\n" +
+		"         .ASC     abc\n" +
+		"BAD      .FORM    6,6\n" +
+		"         .FORM    36\n"
+	a := assembleSource(source)
+	checkDiagnosticLines(t, a, []uint64{4, 5, 6, 7, 8, 9, 10})
+}
+
+func Test_TinyAssembler_Listing(t *testing.T) {
+	source := "         .SEG     0\n" +
+		"start    LA       A0,014,,B2\n" +
+		"FFF      .FORM    12,6,18\n" +
+		"         FFF      01,02,-1\n" +
+		"         J        nowhere\n"
+	a := assembleSource(source)
+
+	buffer := &bytes.Buffer{}
+	a.WriteListing(buffer)
+	listing := buffer.String()
+
+	expected := []string{
+		"000:000000  10 00 00 00 0 0 02 0014",
+		"000:000001  0001 02 777776",
+		"000:000002  74 15 04 00 0 0 000000",
+		"  E:test:5:undefined symbol NOWHERE",
+		"START         000:000000",
+		"1 error(s), 0 warning(s)",
+	}
+	for _, str := range expected {
+		if !strings.Contains(listing, str) {
+			t.Errorf("Error expected listing to contain '%s'", str)
+		}
+	}
+	if strings.Contains(listing, "$SEG") {
+		t.Errorf("Error listing contains local symbols")
+	}
+	if t.Failed() {
+		t.Logf("%s", listing)
+	}
+}
@@ -0,0 +1,12 @@
+. sample.asm - exercises the source text front end
+
+         .SEG    077
+value    W       0123                 . a data word
+pair     HW      01,;
+                 02                   . continued onto a second line
+message  .ASC    'a,b'                . the comma does not split the operand
+
+         .SEG    0
+start    FJAXHIU 010,0,0,0,0,0,value
+. a comment line in the middle
+         FJAXU   073,017,006,0,0